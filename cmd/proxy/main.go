@@ -20,11 +20,18 @@
 //
 //	# Custom ports
 //	PROXY_PORT=3128 MANAGEMENT_PORT=3129 ./proxy
+//
+//	# Check the configured patterns against a corpus of text files
+//	./proxy scan ./corpus
+//
+//	# Print the CA certificate for the client trust store
+//	./proxy --print-ca | sudo tee /usr/local/share/ca-certificates/ai-proxy.crt
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -32,8 +39,10 @@ import (
 	"syscall"
 	"time"
 
+	"ai-anonymizing-proxy/internal/anonymizer"
 	"ai-anonymizing-proxy/internal/config"
 	"ai-anonymizing-proxy/internal/envfile"
+	"ai-anonymizing-proxy/internal/logger"
 	"ai-anonymizing-proxy/internal/management"
 	"ai-anonymizing-proxy/internal/metrics"
 	"ai-anonymizing-proxy/internal/mitm"
@@ -41,11 +50,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		if err := runScan(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("[SCAN] %v", err)
+		}
+		return
+	}
+
 	generateCA := flag.Bool("generate-ca", false, "Generate a self-signed CA cert+key pair and exit.")
 	caCertOut := flag.String("ca-cert", "ca-cert.pem", "Output path for the generated CA certificate (with --generate-ca / --remove-ca-from-store).")
 	caKeyOut := flag.String("ca-key", "ca-key.pem", "Output path for the generated CA private key (with --generate-ca).")
 	envFile := flag.String("env-file", "", "Path to a KEY=VALUE env file applied to the process environment before config load.")
 	removeCA := flag.Bool("remove-ca-from-store", false, "Remove the CA at --ca-cert from the Windows LocalMachine\\Root trust store and exit. Windows-only.")
+	printCA := flag.Bool("print-ca", false, "Print the CA certificate the proxy uses (caCertFile / CA_CERT_FILE) as PEM to stdout and exit, generating the CA first if it does not exist.")
 	flag.Parse()
 
 	if *envFile != "" {
@@ -70,19 +87,43 @@ func main() {
 
 	cfg := config.Load()
 
+	if *printCA {
+		if err := runPrintCA(cfg, os.Stdout); err != nil {
+			log.Fatalf("[CA] %v", err)
+		}
+		return
+	}
+
 	if len(cfg.EnabledPacks) == 0 {
 		log.Fatalf("[PROXY] Fatal: no PII detection packs enabled. Configure enabledPacks in proxy-config.json or set ENABLED_PACKS env var.")
 	}
 
+	if _, err := anonymizer.DecodeEncryptionKey(cfg.SessionEncryptionKey); err != nil {
+		log.Fatalf("[PROXY] Fatal: %v", err)
+	}
+	if _, err := proxy.NewSessionStore(cfg); err != nil {
+		log.Fatalf("[PROXY] Fatal: %v", err)
+	}
+
 	printBanner(cfg)
 
 	registry := management.NewDomainRegistry(cfg, "ai-domains.json")
+	if cfg.DomainsURL != "" && cfg.DomainsRefreshSecs > 0 {
+		stopRefresh := registry.StartRemoteRefresh(cfg.DomainsURL, time.Duration(cfg.DomainsRefreshSecs)*time.Second)
+		defer stopRefresh()
+	}
 	m := metrics.New()
 
-	_ = startManagementAPI(cfg, registry, m)
+	mgmt := startManagementAPI(cfg, registry, m)
 
 	proxyServer := proxy.New(cfg, registry, m)
 	defer closeProxyServer(proxyServer)
+	mgmt.SetCacheStats(proxyServer.CacheStats)
+	mgmt.SetCacheHealth(proxyServer.CacheHealth)
+	mgmt.SetPIITypes(proxyServer.PIITypes)
+	mgmt.SetSessionMappings(proxyServer.SessionMappings)
+	mgmt.SetSessionStats(proxyServer.SessionStats)
+	mgmt.SetConfigReload(proxyServer.ApplyConfig)
 
 	srv := proxyHTTPServer(cfg, proxyServer)
 	log.Printf("[PROXY] Listening on %s", srv.Addr)
@@ -123,6 +164,24 @@ func runGenerateCA(certPath, keyPath string) error {
 	return nil
 }
 
+// runPrintCA writes the PEM certificate of the CA at cfg's caCertFile /
+// caKeyFile to w, so it can be piped into a trust store. The CA is generated
+// if missing, exactly as the proxy would at startup, so the printed cert is
+// the one the proxy signs with.
+func runPrintCA(cfg *config.Config, w io.Writer) error {
+	if cfg.CACertFile == "" || cfg.CAKeyFile == "" {
+		return fmt.Errorf("caCertFile and caKeyFile must be set")
+	}
+	lg := logger.New("MITM", cfg.LogLevel)
+	lg.SetFormat(cfg.LogFormat)
+	ca, err := mitm.LoadOrGenerateCA(cfg.CACertFile, cfg.CAKeyFile, lg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(ca.CertPEM())
+	return err
+}
+
 func printBanner(cfg *config.Config) {
 	upstreamProxy := os.Getenv("HTTPS_PROXY")
 	if upstreamProxy == "" {
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"os"
 	"os/exec"
@@ -174,6 +176,65 @@ func TestRunGenerateCA(t *testing.T) {
 	}
 }
 
+// TestRunPrintCA checks that --print-ca writes the configured CA as a
+// CERTIFICATE PEM block, generating it on first use and printing the same
+// cert afterwards, and that it rejects unset paths.
+func TestRunPrintCA(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		CACertFile: filepath.Join(dir, "ca-cert.pem"),
+		CAKeyFile:  filepath.Join(dir, "ca-key.pem"),
+	}
+
+	var err error
+	out := captureStdout(t, func() { err = runPrintCA(cfg, os.Stdout) })
+	if err != nil {
+		t.Fatalf("runPrintCA: %v", err)
+	}
+	block, _ := pem.Decode([]byte(out))
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("stdout has no CERTIFICATE PEM block:\n%s", out)
+	}
+	onDisk, readErr := os.ReadFile(cfg.CACertFile)
+	if readErr != nil {
+		t.Fatalf("CA not generated: %v", readErr)
+	}
+	if out != string(onDisk) {
+		t.Error("printed cert differs from caCertFile")
+	}
+
+	again := captureStdout(t, func() { err = runPrintCA(cfg, os.Stdout) })
+	if err != nil || again != out {
+		t.Errorf("second run printed a different cert (err=%v)", err)
+	}
+
+	if err := runPrintCA(&config.Config{}, io.Discard); err == nil {
+		t.Error("runPrintCA with empty paths: want error")
+	}
+}
+
+// TestRunPrintCA_LogFormat checks that the CA lines logged by --print-ca
+// follow logFormat like every other module's.
+func TestRunPrintCA_LogFormat(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		CACertFile: filepath.Join(dir, "ca-cert.pem"),
+		CAKeyFile:  filepath.Join(dir, "ca-key.pem"),
+		LogFormat:  "json",
+	}
+	if err := runPrintCA(cfg, io.Discard); err != nil {
+		t.Fatalf("runPrintCA: %v", err)
+	}
+	line, _, _ := strings.Cut(logs.String(), "\n")
+	if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"module":"MITM"`) {
+		t.Errorf("CA log line is not JSON: %q", logs.String())
+	}
+}
+
 // TestMain_HelperProcess_Lifecycle re-execs this test binary as the proxy
 // daemon, waits for it to bind its listener, sends SIGTERM, and verifies a
 // clean exit. Exercises main()'s full startup-and-shutdown lifecycle.
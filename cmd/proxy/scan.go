@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"ai-anonymizing-proxy/internal/anonymizer"
+	"ai-anonymizing-proxy/internal/config"
+	"ai-anonymizing-proxy/internal/proxy"
+)
+
+// runScan implements `proxy scan [--show] [--samples N] <corpus-dir>`: it
+// runs the configured regex patterns over every text file under the corpus
+// and prints how often each PII type matched, with a few redacted sample
+// lines. Nothing is sent to Ollama and no session or cache file is touched.
+// Matched values are printed only with --show.
+func runScan(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("scan", flag.ContinueOnError)
+	show := fset.Bool("show", false, "Print matched original values. Off by default: the output may otherwise be shared.")
+	samples := fset.Int("samples", 5, "Redacted sample lines to print per PII type.")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: proxy scan [--show] [--samples N] <corpus-dir>")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return errors.New("scan: exactly one corpus directory is required")
+	}
+
+	opts := proxy.AnonymizerOptions(config.Load(), nil)
+	opts.UseAI = false
+	opts.CachePath = ""
+	a := anonymizer.NewWithCacheAndCapacity(opts)
+	defer func() { _ = a.Close() }()
+
+	report, err := scanCorpus(a, fset.Arg(0), *samples)
+	if err != nil {
+		return err
+	}
+	report.write(out, *show)
+	return nil
+}
+
+// scanSample is one redacted corpus line.
+type scanSample struct {
+	where    string // path:line
+	redacted string
+	values   []string // originals matched on the line; printed only with --show
+}
+
+// scanTypeStats aggregates the matches of one PII type.
+type scanTypeStats struct {
+	matches int
+	files   map[string]bool
+	samples []scanSample
+}
+
+// scanReport is the result of scanCorpus.
+type scanReport struct {
+	files   int // text files scanned
+	skipped int // files skipped as binary
+	types   map[anonymizer.PIIType]*scanTypeStats
+}
+
+// scanCorpus walks dir and runs a.Detect over each line of every text file.
+// Files containing a NUL byte are treated as binary and skipped. At most
+// samples lines are kept per PII type.
+func scanCorpus(a *anonymizer.Anonymizer, dir string, samples int) (*scanReport, error) {
+	r := &scanReport{types: make(map[anonymizer.PIIType]*scanTypeStats)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path) // #nosec G304 -- operator-supplied corpus
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			r.skipped++
+			return nil
+		}
+		r.files++
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for n := 1; sc.Scan(); n++ {
+			redacted, found := a.Detect(sc.Text())
+			r.add(rel, n, redacted, found, samples)
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", dir, err)
+	}
+	return r, nil
+}
+
+// add records the detections of one line.
+func (r *scanReport) add(file string, line int, redacted string, found []anonymizer.Detection, samples int) {
+	byType := make(map[anonymizer.PIIType][]string)
+	for _, d := range found {
+		byType[d.Type] = append(byType[d.Type], d.Value)
+	}
+	for t, values := range byType {
+		st := r.types[t]
+		if st == nil {
+			st = &scanTypeStats{files: make(map[string]bool)}
+			r.types[t] = st
+		}
+		st.matches += len(values)
+		st.files[file] = true
+		if len(st.samples) < samples {
+			st.samples = append(st.samples, scanSample{fmt.Sprintf("%s:%d", file, line), redacted, values})
+		}
+	}
+}
+
+// write prints the per-type summary, most frequent type first, followed by
+// the sample lines. Original values appear only when show is set.
+func (r *scanReport) write(w io.Writer, show bool) {
+	types := slices.Collect(maps.Keys(r.types))
+	slices.SortFunc(types, func(x, y anonymizer.PIIType) int {
+		return cmp.Or(cmp.Compare(r.types[y].matches, r.types[x].matches), cmp.Compare(x, y))
+	})
+
+	fmt.Fprintf(w, "Scanned %d files (%d binary skipped)\n\n", r.files, r.skipped)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tMATCHES\tFILES")
+	for _, t := range types {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", t, r.types[t].matches, len(r.types[t].files))
+	}
+	_ = tw.Flush()
+
+	for _, t := range types {
+		fmt.Fprintf(w, "\n%s samples:\n", t)
+		for _, s := range r.types[t].samples {
+			fmt.Fprintf(w, "  %s: %s\n", s.where, s.redacted)
+			if show {
+				fmt.Fprintf(w, "    matched: %s\n", strings.Join(s.values, ", "))
+			}
+		}
+	}
+}
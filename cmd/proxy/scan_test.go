@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// writeCorpus creates a small synthetic corpus: two text files and one
+// binary file that must be skipped.
+func writeCorpus(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "Contact alice@example.com for access.\nNothing here.\nCC bob@example.org\n",
+		"sub/b.md":      "Escalate to carol@example.net today.\n",
+		"sub/image.bin": "alice@example.com\x00\x01\x02",
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestRunScan checks the summary counts over a temp corpus and that matched
+// values are printed only with --show.
+func TestRunScan(t *testing.T) {
+	corpus := writeCorpus(t)
+	t.Chdir(t.TempDir()) // no proxy-config.json: built-in defaults
+
+	var out bytes.Buffer
+	if err := runScan([]string{corpus}, &out); err != nil {
+		t.Fatalf("runScan: %v", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "Scanned 2 files (1 binary skipped)") {
+		t.Errorf("file counts missing from output:\n%s", got)
+	}
+	if !regexp.MustCompile(`(?m)^EMAIL\s+3\s+2$`).MatchString(got) {
+		t.Errorf("want EMAIL with 3 matches in 2 files:\n%s", got)
+	}
+	if !strings.Contains(got, "a.txt:1: Contact [PII_EMAIL_") {
+		t.Errorf("redacted sample missing:\n%s", got)
+	}
+	for _, email := range []string{"alice@example.com", "bob@example.org", "carol@example.net"} {
+		if strings.Contains(got, email) {
+			t.Errorf("output without --show contains %q", email)
+		}
+	}
+
+	out.Reset()
+	if err := runScan([]string{"--show", corpus}, &out); err != nil {
+		t.Fatalf("runScan --show: %v", err)
+	}
+	if !strings.Contains(out.String(), "matched: alice@example.com") {
+		t.Errorf("--show output missing original value:\n%s", out.String())
+	}
+}
+
+// TestRunScan_Args rejects a missing corpus directory and surfaces walk errors.
+func TestRunScan_Args(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var out bytes.Buffer
+	if err := runScan(nil, &out); err == nil {
+		t.Error("runScan with no directory: want error")
+	}
+	if err := runScan([]string{filepath.Join(t.TempDir(), "missing")}, &out); err == nil {
+		t.Error("runScan on a missing directory: want error")
+	}
+}
@@ -6,6 +6,5 @@ require (
 	go.etcd.io/bbolt v1.4.3
 	golang.org/x/net v0.54.0
 	golang.org/x/sys v0.44.0
+	golang.org/x/text v0.37.0
 )
-
-require golang.org/x/text v0.37.0 // indirect
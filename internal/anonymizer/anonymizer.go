@@ -11,7 +11,8 @@
 //
 // The cache is keyed by the original PII value, not by a hash of the
 // surrounding text. A recurring value (e.g. an IP address) gets a cache hit
-// regardless of which message body it appears in.
+// regardless of which message body it appears in. With a session encryption
+// key configured the cache key is an HMAC of the value instead (encrypt.go).
 //
 // An in-flight deduplication map prevents multiple concurrent goroutines from
 // querying Ollama for the same value.
@@ -19,19 +20,25 @@ package anonymizer
 
 import (
 	"bytes"
+	"cmp"
 	"context"
-	"crypto/md5" // #nosec G501 -- MD5 used for deterministic PII tokens, not cryptographic security
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
+	"net"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ai-anonymizing-proxy/internal/anonymizer/packs"
+	"ai-anonymizing-proxy/internal/logger"
 	"ai-anonymizing-proxy/internal/metrics"
 )
 
@@ -52,6 +59,8 @@ const (
 	PIISalary     PIIType = "SALARY"
 	PIICompany    PIIType = "COMPANY"
 	PIIJobTitle   PIIType = "JOBTITLE"
+	// GLOBAL pack types.
+	PIIGeoCoordinate PIIType = "GEOCOORD"
 	// New types added by pack system.
 	PIISteuerID PIIType = "STEUERID"
 	PIISVNR     PIIType = "SVNR"
@@ -62,6 +71,7 @@ const (
 	PIIDBConn   PIIType = "DBCONN"
 	PIIAWSKey   PIIType = "AWSKEY"
 	PIIGHToken  PIIType = "GHTOKEN"
+	PIIURLCred  PIIType = "URLCRED"
 	// FR pack types.
 	PIINIR   PIIType = "NIR"
 	PIISIRET PIIType = "SIRET"
@@ -77,6 +87,10 @@ const (
 	PIIMRN         PIIType = "MRN"
 	PIIICD10       PIIType = "ICD10"
 	PIIInsuranceID PIIType = "INSURANCEID"
+	// Country-gated national IDs (see packs.NationalIDs).
+	PIINationalID PIIType = "NATIONALID"
+	// Opt-in, keyword-gated timestamps (see packs.Timestamp).
+	PIITimestamp PIIType = "TIMESTAMP"
 )
 
 // sseDataPrefix is the Server-Sent Events data field prefix ("data: ").
@@ -97,43 +111,212 @@ type pattern struct {
 	confidence float64
 	validate   func(string) bool // optional checksum validator; nil = always accept
 	pack       string            // pack name this pattern belongs to
+	valueGroup int               // index of the (?P<value>...) group; 0 = replace the whole match
 }
 
 // Anonymizer holds compiled patterns and the Ollama client config.
 type Anonymizer struct {
-	patterns    []pattern
-	ollamaURL   string
-	ollamaModel string
-	useAI       bool
-	aiThreshold float64
-	m           *metrics.Metrics // nil = no metrics collection
-	verbose     bool             // enables [DEANON] logging; defaults to true
-
-	cache PersistentCache // cross-session Ollama value cache; keyed by original PII value
-
-	inflightMu sync.Mutex
-	inflight   map[string]bool // prevents duplicate concurrent Ollama queries
-
-	ollamaSem chan struct{} // limits concurrent Ollama queries
-
-	sessionMu sync.RWMutex
-	sessions  map[string]map[string]string // sessionID → token → original
-
-	piiInstructions map[string]string // model family prefix → system instruction
+	patterns     []pattern
+	codePatterns []pattern            // used inside ``` fenced code blocks; nil = patterns everywhere
+	profiles     map[string][]pattern // named alternatives to patterns (see profiles.go)
+	ollamaURL    string
+	ollamaHTTP   *http.Client // http.DefaultClient, or a Unix-socket client for unix:// endpoints
+	ollamaModel  string
+	ollamaHdrs   map[string]string // extra Ollama request headers; values never logged
+	useAI        bool
+	minConf      float64          // patterns below this effective confidence are not loaded
+	m            *metrics.Metrics // nil = no metrics collection
+	verbose      bool             // enables deanonymization debug lines; defaults to true
+
+	log      *logger.Logger  // all anonymizer logging; see Options.Logger
+	missLogs *logger.Sampler // fraction of cache misses written to log
+
+	preserveJSON bool // AnonymizeJSON edits string values in place (see jsonedit.go)
+	indexRepeats bool // suffix repeated tokens within one text with #2, #3, ...
+	separateInst bool // PII instruction is its own system message, not appended
+
+	preserveSuffix map[PIIType]int    // characters of the original kept in tokens (see preserve_suffix.go)
+	policies       map[PIIType]Policy // non-default replacement policies (see policy.go)
+	normalize      bool               // match patterns against the NFKC form (see normalize.go)
+
+	strippedNotice string // prepended to buffered replies that lost all tokens; "" = off
+
+	replaceFn ReplacementFunc // custom token generator (see replacement.go); nil = built-in
+	tokenSalt []byte          // keys the built-in token hash; nil = plain MD5
+	saltTag   string          // prefixes Ollama cache keys while tokenSalt is set
+	retries   *retryCache     // anonymizations reused by exact retries; nil = off
+
+	cache    PersistentCache // cross-session Ollama value cache; keyed by original PII value
+	cacheErr error           // why the configured cache file is not in use; nil = opened
+	enc      *valueEncryptor // nil = originals held in plaintext
+
+	inflightMu    sync.Mutex
+	inflight      map[string]bool // prevents duplicate concurrent Ollama queries
+	dispatchDelay time.Duration   // wait before an async Ollama query (see OllamaDispatchDelay)
+
+	batchWindow time.Duration // collect misses this long into one query; 0 = off (see ollama_batch.go)
+	batchMu     sync.Mutex
+	batch       []string // values waiting for the next batched query
+
+	ollamaSem  chan struct{}    // limits concurrent Ollama queries
+	ollamaDeny map[PIIType]bool // types whose values are never sent to Ollama
+	allowlist  map[string]bool  // values never tokenized, keyed by allowlistKey
+
+	shadowRate float64       // fraction of requests compared in shadow mode (see shadow.go)
+	shadowSem  chan struct{} // one shadow comparison at a time
+
+	sessionMu   sync.RWMutex
+	sessions    map[string]map[string]string // sessionID → token → original (sealed when enc != nil)
+	maxSessions int                          // cap enforced by BeginSession; 0 = unlimited
+	tokenCounts map[string]int               // sessionID → matches seen, for maxTokens
+	maxTokens   int                          // per-session match cap; 0 = unlimited
+	sessionTTL  time.Duration                // how long deleted sessions stay readable; 0 = delete at once
+	ending      map[string]time.Time         // sessionID → removal time, for sessions deleted under sessionTTL
+	stopSweep   func()                       // stops the session sweeper; nil without sessionTTL
+	sessionProf map[string]string            // sessionID → pattern profile, for sessions begun with one
+	started     map[string]time.Time         // sessionID → creation time, for SessionStats
+	store       SessionStore                 // shared copy of the mappings; nil = this instance only
+
+	storePending   map[string]map[string]string // sessionID → mappings not yet written to store; under sessionMu
+	storeDownUntil atomic.Int64                 // UnixNano before which store calls are skipped (see session_store.go)
+
+	settings atomic.Pointer[Settings] // replaced whole, never modified; see ApplySettings
 }
 
 // Options configures the Anonymizer constructor.
 type Options struct {
-	OllamaEndpoint      string           // Ollama API base URL (e.g. "http://localhost:11434")
+	OllamaEndpoint      string           // Ollama API base URL (e.g. "http://localhost:11434" or "unix:///run/ollama.sock")
 	OllamaModel         string           // Ollama model name (e.g. "llama3")
 	UseAI               bool             // enable AI-based PII verification
 	AIThreshold         float64          // confidence threshold for AI verification (0.0-1.0)
+	MinConfidence       float64          // effective confidence below which matches are ignored; 0 = keep all
 	OllamaMaxConcurrent int              // max concurrent Ollama requests (≥1)
 	Metrics             *metrics.Metrics // optional metrics collector; nil disables metrics
 	CachePath           string           // path to bbolt cache file; empty = in-memory only
 	CacheCapacity       int              // S3-FIFO cache capacity; 0 = unbounded (testing only)
+	CacheSRatio         float64          // S3-FIFO S-queue share of capacity; 0 = default (0.1)
 	EnabledPacks        []string         // list of enabled pack names; nil = all registered packs
 	PackDecayRate       float64          // positional confidence decay rate per pack
+	EncryptionKey       []byte           // AES key for originals at rest; nil = plaintext (see DecodeEncryptionKey)
+	MaxSessions         int              // max concurrent sessions admitted by BeginSession; 0 = unlimited
+	MaxTokensPerRequest int              // matches tokenized per session before the rest are left as-is; 0 = unlimited
+	PreserveJSONFormat  bool             // edit JSON string values in place; all other bytes pass through
+	ShadowSampleRate    float64          // fraction of requests also compared regex-only vs regex+Ollama; 0 = off
+	Logger              *logger.Logger   // destination for all anonymizer logging; nil = a new "ANONYMIZER" logger from LogLevel and LogFormat
+	LogLevel            string           // level for the logger built when Logger is nil; "" = info (debug lines off)
+	LogFormat           string           // "json" for one JSON object per line when Logger is nil; "" = columns
+	TokenLogSampleRate  float64          // fraction of per-token debug lines written; 0 = default (1.0, all)
+
+	// IndexRepeatedTokens gives the second and later occurrences of a token
+	// within one text value an index suffix ([PII_EMAIL_<hash>#2]).
+	IndexRepeatedTokens bool
+
+	// PreserveSuffix keeps the last N letters and digits of values of a
+	// type in their tokens ([PII_PHONE_<hash>:5309]), see preserve_suffix.go.
+	PreserveSuffix map[PIIType]int
+
+	// TypePolicies overrides how matches of a type are replaced: redacted
+	// with a marker that is never restored, or passed through. Types not
+	// listed are tokenized. See policy.go.
+	TypePolicies map[PIIType]Policy
+
+	// NormalizeUnicode matches patterns against the NFKC form of the text,
+	// so full-width digits and similar compatibility characters are
+	// detected. The original form is tokenized and restored.
+	NormalizeUnicode bool
+
+	// SeparateInstruction injects the PII instruction as its own system
+	// message or content block instead of appending it to the existing
+	// system prompt (see injectPIIInstruction).
+	SeparateInstruction bool
+
+	// TokenStrippedNotice is prepended to the reply text of a buffered
+	// response that contains none of its request's tokens (see
+	// DeanonymizeResponse). Empty disables the notice.
+	TokenStrippedNotice string
+
+	// CodeBlockPacks, when set, replaces EnabledPacks inside ``` fenced code
+	// blocks, so code and prose can be scanned with different pattern sets
+	// (see code_blocks.go). Same ordering and decay rules as EnabledPacks.
+	CodeBlockPacks []string
+
+	// PatternProfiles defines named pattern sets a session can select with
+	// BeginSessionProfile instead of the EnabledPacks/MinConfidence default
+	// (see profiles.go).
+	PatternProfiles map[string]PatternProfile
+
+	// MRNPrefixes adds site-specific medical record number prefixes to the
+	// HEALTHCARE pack (see packs.CustomMRN). Ignored if HEALTHCARE is off.
+	MRNPrefixes []string
+
+	// SecretTokenPrefixes adds provider token prefixes (e.g. "hf_") to the
+	// SECRETS pack as APIKEY (see packs.PrefixedTokens). Ignored if SECRETS
+	// is off.
+	SecretTokenPrefixes []string
+
+	// APIKeyMinLength is the shortest value the GLOBAL api_key pattern
+	// accepts after its keyword. 0 means packs.DefaultAPIKeyMinLength.
+	APIKeyMinLength int
+
+	// NationalIDCountries enables checksum-validated national ID patterns
+	// for the listed ISO country codes (see packs.NationalIDs). They join
+	// the GLOBAL pack and are ignored if GLOBAL is off.
+	NationalIDCountries []string
+
+	// DetectTimestamps enables the GLOBAL pattern for timestamps that follow
+	// a scheduling or admission keyword (see packs.Timestamp). Ignored if
+	// GLOBAL is off.
+	DetectTimestamps bool
+
+	// CustomPatterns are operator-defined patterns run after all pack
+	// patterns, in order (see custom_patterns.go). Invalid ones are skipped.
+	CustomPatterns []CustomPattern
+
+	// Allowlist lists literal values (e.g. a public support address) that
+	// are never tokenized even when a pattern matches them. Emails compare
+	// case-insensitively, everything else exactly.
+	Allowlist []string
+
+	// OllamaTypeDenylist lists PII types (e.g. "SSN", "CREDITCARD") whose
+	// values are never sent to Ollama; they keep the deterministic token.
+	OllamaTypeDenylist []string
+
+	// OllamaHeaders are set on every Ollama request (e.g. auth for a gateway
+	// in front of Ollama). Values are never logged.
+	OllamaHeaders map[string]string
+
+	// OllamaDispatchDelay holds a cache-miss value this long before it is
+	// sent to Ollama. Misses of the same value during the wait join the
+	// pending query instead of starting another. 0 = query at once.
+	OllamaDispatchDelay time.Duration
+
+	// OllamaBatchWindow collects cache-miss values for this long and sends
+	// them to Ollama as one query instead of one query each. It takes the
+	// place of OllamaDispatchDelay. 0 = no batching.
+	OllamaBatchWindow time.Duration
+
+	// RetryCacheTTL keeps each request's anonymization for this long so an
+	// identical retried body reuses it (see AnonymizeRequest). 0 = off.
+	RetryCacheTTL time.Duration
+
+	// SessionTTL keeps a session's token map readable for this long after
+	// DeleteSession (see session_ttl.go). 0 = delete at once.
+	SessionTTL time.Duration
+
+	// SessionStore, when set, also holds every session's mappings so other
+	// Anonymizers sharing it can restore this one's tokens (see
+	// session_store.go). nil = sessions stay in this instance.
+	SessionStore SessionStore
+
+	// ReplacementFunc replaces the built-in token generator, e.g. to fetch
+	// surrogates from an external vault. It is validated against the loaded
+	// patterns at construction and ignored if its tokens are unsafe.
+	ReplacementFunc ReplacementFunc
+
+	// TokenSalt is mixed into the built-in token hash so the same value
+	// gets different tokens in differently configured deployments (see
+	// replacement.go). "" = unsalted. Ignored with a ReplacementFunc.
+	TokenSalt string
 }
 
 // New creates an Anonymizer with the given options.
@@ -174,15 +357,28 @@ func NewWithCacheAndCapacity(opts Options) *Anonymizer {
 	if opts.OllamaMaxConcurrent < 1 {
 		opts.OllamaMaxConcurrent = 1
 	}
+	if opts.TokenLogSampleRate == 0 {
+		opts.TokenLogSampleRate = 1
+	}
+
+	lg := opts.Logger
+	if lg == nil {
+		lg = logger.New("ANONYMIZER", opts.LogLevel)
+		lg.SetFormat(opts.LogFormat)
+	}
 
-	var c PersistentCache
+	var (
+		c        PersistentCache
+		cacheErr error
+	)
 	if opts.CachePath != "" {
-		bbolt, err := newBboltCache(opts.CachePath)
+		bbolt, err := newBboltCache(opts.CachePath, lg)
 		if err != nil {
-			log.Printf("[ANONYMIZER] failed to open persistent cache at %q, falling back to memory: %v", opts.CachePath, err)
+			lg.Warnf("cache_open", "failed to open persistent cache at %q, falling back to memory: %v", opts.CachePath, err)
 			c = newMemoryCache()
+			cacheErr = err
 		} else if opts.CacheCapacity > 0 {
-			c = newS3FIFOCache(bbolt, opts.CacheCapacity)
+			c = newS3FIFOCache(bbolt, opts.CacheCapacity, opts.CacheSRatio, lg)
 		} else {
 			c = bbolt
 		}
@@ -190,52 +386,239 @@ func NewWithCacheAndCapacity(opts Options) *Anonymizer {
 		c = newMemoryCache()
 	}
 
+	ollamaHTTP, ollamaURL := newOllamaClient(opts.OllamaEndpoint)
 	a := &Anonymizer{
-		ollamaURL:   opts.OllamaEndpoint + "/api/generate",
-		ollamaModel: opts.OllamaModel,
-		useAI:       opts.UseAI,
-		aiThreshold: opts.AIThreshold,
-		m:           opts.Metrics,
-		verbose:     true, // default to verbose for production
-		cache:       c,
-		inflight:    make(map[string]bool),
-		ollamaSem:   make(chan struct{}, opts.OllamaMaxConcurrent),
-		sessions:    make(map[string]map[string]string),
+		ollamaURL:     ollamaURL,
+		ollamaHTTP:    ollamaHTTP,
+		ollamaModel:   opts.OllamaModel,
+		ollamaHdrs:    opts.OllamaHeaders,
+		useAI:         opts.UseAI,
+		minConf:       opts.MinConfidence,
+		m:             opts.Metrics,
+		verbose:       true, // default to verbose for production
+		log:           lg,
+		missLogs:      logger.NewSampler(opts.TokenLogSampleRate),
+		cache:         c,
+		cacheErr:      cacheErr,
+		inflight:      make(map[string]bool),
+		dispatchDelay: max(opts.OllamaDispatchDelay, 0),
+		batchWindow:   max(opts.OllamaBatchWindow, 0),
+		ollamaSem:     make(chan struct{}, opts.OllamaMaxConcurrent),
+		ollamaDeny:    make(map[PIIType]bool, len(opts.OllamaTypeDenylist)),
+		shadowRate:    opts.ShadowSampleRate,
+		shadowSem:     make(chan struct{}, 1),
+		sessions:      make(map[string]map[string]string),
+		maxSessions:   opts.MaxSessions,
+		tokenCounts:   make(map[string]int),
+		maxTokens:     opts.MaxTokensPerRequest,
+		sessionTTL:    max(opts.SessionTTL, 0),
+		ending:        make(map[string]time.Time),
+		sessionProf:   make(map[string]string),
+		started:       make(map[string]time.Time),
+		store:         opts.SessionStore,
+		storePending:  make(map[string]map[string]string),
+
+		preserveJSON: opts.PreserveJSONFormat,
+		indexRepeats: opts.IndexRepeatedTokens,
+		separateInst: opts.SeparateInstruction,
+
+		strippedNotice: opts.TokenStrippedNotice,
+		normalize:      opts.NormalizeUnicode,
+		retries:        newRetryCache(opts.RetryCacheTTL),
+	}
+	a.settings.Store(&Settings{AIThreshold: opts.AIThreshold})
+	a.preserveSuffix = a.preserveSuffixes(opts.PreserveSuffix)
+	a.policies = a.typePolicies(opts.TypePolicies)
+	for _, t := range opts.OllamaTypeDenylist {
+		a.ollamaDeny[PIIType(strings.ToUpper(strings.TrimSpace(t)))] = true
+	}
+	if len(opts.Allowlist) > 0 {
+		a.allowlist = make(map[string]bool, len(opts.Allowlist))
+		for _, v := range opts.Allowlist {
+			if k := allowlistKey(v); k != "" {
+				a.allowlist[k] = true
+			}
+		}
+	}
+	if enc, err := newValueEncryptor(opts.EncryptionKey); err != nil {
+		lg.Warnf("config", "session encryption disabled: %v", err)
+	} else {
+		a.enc = enc
 	}
 	if len(opts.EnabledPacks) == 0 {
 		opts.EnabledPacks = allPackNames()
 	}
-	a.loadPacks(opts.EnabledPacks, opts.PackDecayRate)
+	var extra []packs.Entry
+	if e, ok := packs.CustomMRN(opts.MRNPrefixes); ok {
+		extra = append(extra, e)
+	}
+	if e, ok := packs.PrefixedTokens(a.secretTokenPrefixes(opts.SecretTokenPrefixes)); ok {
+		extra = append(extra, e)
+	}
+	if e, ok := packs.APIKey(opts.APIKeyMinLength); ok {
+		extra = append(extra, e)
+	}
+	ids, unknown := packs.NationalIDs(opts.NationalIDCountries)
+	if len(unknown) > 0 {
+		lg.Warnf("config", "no national ID pattern for %v (supported: %v)", unknown, packs.NationalIDCountries())
+	}
+	extra = append(extra, ids...)
+	if opts.DetectTimestamps {
+		extra = append(extra, packs.Timestamp())
+	}
+	a.patterns = a.loadPacks("enabled packs", opts.EnabledPacks, opts.PackDecayRate, a.minConf, extra...)
+	if len(opts.CodeBlockPacks) > 0 {
+		a.codePatterns = a.loadPacks("code-block packs", opts.CodeBlockPacks, opts.PackDecayRate, a.minConf, extra...)
+	}
+	if custom := a.compileCustomPatterns(opts.CustomPatterns, slices.Concat(a.patterns, a.codePatterns), a.minConf); len(custom) > 0 {
+		a.patterns = append(a.patterns, custom...)
+		if a.codePatterns != nil {
+			a.codePatterns = append(a.codePatterns, custom...)
+		}
+	}
+	a.profiles = a.loadProfiles(opts, extra)
+	a.setTokenSalt(opts.TokenSalt)
+	if a.m != nil {
+		a.m.SetCacheStats(a.cacheLayerStats)
+	}
+	a.setReplacementFunc(opts.ReplacementFunc)
+	if a.sessionTTL > 0 {
+		a.stopSweep = a.startSessionSweeper()
+	}
 	return a
 }
 
-// Close releases resources held by the anonymizer, including the persistent cache.
-// Must be called when the anonymizer is shut down.
+// Close releases resources held by the anonymizer, including the persistent
+// cache, and stops the session sweeper. Must be called when the anonymizer
+// is shut down.
 func (a *Anonymizer) Close() error {
+	if a.stopSweep != nil {
+		a.stopSweep()
+	}
 	return a.cache.Close()
 }
 
-// SetPIIInstructions configures the per-model-family system instructions injected
-// when PII tokens are present. Keys are model family prefixes (e.g. "claude", "gpt");
-// the special key "default" is used when no prefix matches.
+// CacheStats reports the Ollama value cache fill: the number of resident
+// entries and the capacity before eviction (-1 for an unbounded cache).
+func (a *Anonymizer) CacheStats() (entries, capacity int) {
+	return a.cache.Len(), a.cache.Cap()
+}
+
+// cacheLayerStats maps the cache's S3-FIFO layer onto the metrics cache
+// section; ok is false for a cache without one.
+func (a *Anonymizer) cacheLayerStats() (metrics.CacheSnapshot, bool) {
+	st := a.cache.Stats()
+	if st.Capacity == 0 {
+		return metrics.CacheSnapshot{}, false
+	}
+	return metrics.CacheSnapshot{
+		SQueueLen:  st.SQueueLen,
+		MQueueLen:  st.MQueueLen,
+		GhostCount: st.GhostCount,
+		Capacity:   st.Capacity,
+		MemoryHits: st.MemoryHits,
+		ColdHits:   st.ColdHits,
+	}, true
+}
+
+// CacheHealth returns nil if the Ollama value cache is usable. It reports an
+// error when the configured cache file could not be opened (the in-memory
+// fallback is serving instead) or when a write-read-delete probe fails.
+// Either way anonymization continues; only cross-restart reuse is lost.
+func (a *Anonymizer) CacheHealth() error {
+	if a.cacheErr != nil {
+		return a.cacheErr
+	}
+	return a.cache.Probe()
+}
+
+// Settings are the anonymizer settings that can change while it runs. They
+// are published as one value, so a request never sees the threshold of one
+// reload together with the instructions of another. A Settings must not be
+// modified once applied.
+type Settings struct {
+	// AIThreshold is the confidence below which a match is verified with
+	// Ollama rather than tokenized directly.
+	AIThreshold float64
+	// PIIInstructions are the per-model-family system instructions injected
+	// when PII tokens are present. Keys are model family prefixes (e.g.
+	// "claude", "gpt"); the special key "default" is used when no prefix
+	// matches.
+	PIIInstructions map[string]string
+	// LogLevel is the level of the anonymizer's log; "" leaves it unchanged.
+	LogLevel string
+}
+
+// Settings returns the settings in effect.
+func (a *Anonymizer) Settings() Settings {
+	return *a.settings.Load()
+}
+
+// ApplySettings replaces the settings in effect. It is safe to call while
+// requests are being anonymized; a match already in progress may use either
+// set, but never a mix of both.
+func (a *Anonymizer) ApplySettings(s Settings) {
+	if s.LogLevel != "" {
+		a.log.SetLevel(s.LogLevel)
+	}
+	a.settings.Store(&s)
+}
+
+// updateSettings applies a copy of the settings in effect changed by fn.
+func (a *Anonymizer) updateSettings(fn func(*Settings)) {
+	for {
+		cur := a.settings.Load()
+		next := *cur
+		fn(&next)
+		if a.settings.CompareAndSwap(cur, &next) {
+			return
+		}
+	}
+}
+
+// SetPIIInstructions replaces Settings.PIIInstructions, keeping the other
+// settings.
 func (a *Anonymizer) SetPIIInstructions(instructions map[string]string) {
-	a.piiInstructions = instructions
+	a.updateSettings(func(s *Settings) { s.PIIInstructions = instructions })
+}
+
+// SetAIThreshold replaces Settings.AIThreshold, keeping the other settings.
+func (a *Anonymizer) SetAIThreshold(threshold float64) {
+	a.updateSettings(func(s *Settings) { s.AIThreshold = threshold })
 }
 
-// SetVerbose enables or disables [DEANON] logging. The default is true (verbose).
+// threshold returns the current AI verification threshold.
+func (a *Anonymizer) threshold() float64 {
+	return a.settings.Load().AIThreshold
+}
+
+// SetVerbose enables or disables deanonymization debug lines. The default is true (verbose).
 // Set to false during benchmarks to avoid flooding stdout.
 func (a *Anonymizer) SetVerbose(v bool) {
 	a.verbose = v
 }
 
-// loadPacks populates a.patterns from the pack registry, filtered by enabledPacks.
+// loadPacks builds a pattern list from the pack registry, filtered by enabledPacks.
 // Patterns are ordered by pack position in enabledPacks — the first pack listed
 // runs first, so its patterns get priority over later packs. This ordering is
 // critical: specific packs (e.g. SECRETS) should precede broad packs (e.g. GLOBAL)
 // to prevent keyword overlap from stealing matches (see issue #70).
-// Confidence is decayed by packDecayRate based on a pack's position.
-func (a *Anonymizer) loadPacks(enabledPacks []string, packDecayRate float64) {
+// Confidence is decayed by packDecayRate based on a pack's position. Extra
+// entries (built from config) follow the registered entries of their pack,
+// except that one with the name of a registered entry takes its place.
+// Patterns whose effective confidence falls below minConf are left out.
+// label names the list in the startup log.
+func (a *Anonymizer) loadPacks(label string, enabledPacks []string, packDecayRate, minConf float64, extra ...packs.Entry) []pattern {
+	var patterns []pattern
 	allEntries := packs.All()
+	for _, e := range extra {
+		i := slices.IndexFunc(allEntries, func(r packs.Entry) bool { return r.Pack == e.Pack && r.Name == e.Name })
+		if i >= 0 {
+			allEntries[i] = e
+		} else {
+			allEntries = append(allEntries, e)
+		}
+	}
 
 	// Group registered entries by pack name for ordered iteration.
 	byPack := make(map[string][]packs.Entry)
@@ -244,10 +627,11 @@ func (a *Anonymizer) loadPacks(enabledPacks []string, packDecayRate float64) {
 	}
 
 	// Iterate in enabledPacks order so pack position determines pattern priority.
+	dropped := 0
 	for i, packName := range enabledPacks {
 		entries := byPack[packName]
 		if len(entries) == 0 {
-			log.Printf("[ANONYMIZER] warning: enabled pack %q has no registered patterns", packName)
+			a.log.Warnf("config", "enabled pack %q has no registered patterns", packName)
 			continue
 		}
 		for _, entry := range entries {
@@ -256,19 +640,47 @@ func (a *Anonymizer) loadPacks(enabledPacks []string, packDecayRate float64) {
 			if effective < 0 {
 				effective = 0
 			}
+			// Below the floor a match would only ever be noise: drop the
+			// pattern so it neither tokenizes nor reaches the cache/Ollama path.
+			if effective < minConf {
+				dropped++
+				continue
+			}
 
-			a.patterns = append(a.patterns, pattern{
+			patterns = append(patterns, pattern{
 				re:         entry.Re,
 				piiType:    PIIType(entry.PIIType),
 				confidence: effective,
 				validate:   entry.Validate,
 				pack:       entry.Pack,
+				valueGroup: max(entry.Re.SubexpIndex("value"), 0),
 			})
 		}
 	}
 
-	log.Printf("[ANONYMIZER] loaded %d patterns from %d enabled packs: %v",
-		len(a.patterns), len(enabledPacks), enabledPacks)
+	a.log.Infof("config", "loaded %d patterns from %d %s: %v",
+		len(patterns), len(enabledPacks), label, enabledPacks)
+	if dropped > 0 {
+		a.log.Infof("config", "%d patterns below minConfidence %.2f not loaded", dropped, minConf)
+	}
+	return patterns
+}
+
+// secretTokenPrefixes drops, with a log line, prefixes that would match the
+// start of a proxy token ("PII", "PII_EMAIL_"): the proxy must not re-tokenize
+// its own output.
+func (a *Anonymizer) secretTokenPrefixes(prefixes []string) []string {
+	own := tokenPrefix[1:]
+	var out []string
+	for _, p := range prefixes {
+		p = strings.TrimSpace(p)
+		if p != "" && (strings.HasPrefix(own, p) || strings.HasPrefix(p, own)) {
+			a.log.Warnf("config", "skipping secret token prefix %q: it matches proxy tokens", p)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
 }
 
 // allPackNames returns the deduplicated list of pack names from the registry,
@@ -295,44 +707,312 @@ func allPackNames() []string {
 //     cache miss → apply fallback token, log miss, dispatch async Ollama.
 //
 // PII is never left unmasked: every match produces a token regardless of
-// cache state or Ollama availability.
+// cache state or Ollama availability. The one exception is MaxTokensPerRequest:
+// once a session's budget is spent, further matches are left in place and
+// counted (see TokensOverLimit) so the caller can reject the request.
+//
+// Tokens already present in text — a client feeding proxy output back in,
+// as agentic loops do — are counted as pre-tokenized and copied through
+// verbatim: patterns run only on the text between them, so no match can
+// start or end inside a token.
+//
+// With Options.CodeBlockPacks set, fenced code blocks are scanned with their
+// own pattern set (see code_blocks.go). A session begun with a pattern
+// profile has its prose scanned with that profile (see profiles.go).
 func (a *Anonymizer) AnonymizeText(text, sessionID string) string {
+	defer a.flushStore(sessionID)
+	return a.anonymizeText(text, sessionID)
+}
+
+// anonymizeText is AnonymizeText without writing the new mappings to the
+// shared SessionStore, for callers that scan many strings of one request
+// and flush once at the end.
+func (a *Anonymizer) anonymizeText(text, sessionID string) string {
 	if text == "" {
 		return text
 	}
 
+	var repeats map[string]int // token → occurrences in this text; nil = no indexing
+	if a.indexRepeats {
+		repeats = make(map[string]int)
+	}
+	patterns := a.sessionPatterns(sessionID)
+	if a.codePatterns != nil && strings.Contains(text, codeFence) {
+		return a.anonymizeFenced(text, sessionID, patterns, repeats)
+	}
+	return a.anonymizeRegion(text, sessionID, patterns, repeats)
+}
+
+// anonymizeRegion applies patterns to text, copying pre-existing tokens
+// through (see AnonymizeText).
+func (a *Anonymizer) anonymizeRegion(text, sessionID string, patterns []pattern, repeats map[string]int) string {
+	if !strings.Contains(text, "[PII_") {
+		return a.anonymizeSegment(text, sessionID, patterns, repeats)
+	}
+	locs := preTokenRe.FindAllStringIndex(text, -1)
+	if locs == nil {
+		return a.anonymizeSegment(text, sessionID, patterns, repeats)
+	}
+	if a.m != nil {
+		a.m.PreTokenized.Add(int64(len(locs)))
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		b.WriteString(a.anonymizeSegment(text[last:loc[0]], sessionID, patterns, repeats))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(a.anonymizeSegment(text[last:], sessionID, patterns, repeats))
+	return b.String()
+}
+
+// preTokenRe matches a token in the format replacement, withSuffix and
+// indexedToken produce. Type labels from Ollama may contain underscores.
+var preTokenRe = regexp.MustCompile(`\[PII_[A-Z0-9_]+_[0-9a-f]{16}(?::[0-9A-Za-z]{1,8})?(?:#[0-9]+)?\]`)
+
+// anonymizeSegment runs every pattern over text, which contains no tokens.
+func (a *Anonymizer) anonymizeSegment(text, sessionID string, patterns []pattern, repeats map[string]int) string {
+	if text == "" {
+		return text
+	}
 	result := text
-	for _, p := range a.patterns {
-		result = p.re.ReplaceAllStringFunc(result, func(match string) string {
-			// If the pattern has a validator, skip non-matching values.
-			if p.validate != nil && !p.validate(match) {
-				return match
-			}
-			token := a.tokenForMatch(p, match)
-			a.recordMapping(sessionID, token, match)
-			return token
-		})
+	for _, p := range patterns {
+		result = a.replaceMatches(p, result, sessionID, repeats)
 	}
 	return result
 }
 
+// replaceMatches tokenizes each match of p in text: the whole match, or only
+// the named "value" group when the pattern has one, leaving the surrounding
+// context (e.g. the NAME= of an env assignment) in place so the LLM still
+// sees what the masked value was. The matches come filtered from matches;
+// with NormalizeUnicode the original bytes a normalized match maps back to
+// are tokenized and recorded.
+func (a *Anonymizer) replaceMatches(p pattern, text, sessionID string, repeats map[string]int) string {
+	matches := a.matches(p, text)
+	if matches == nil {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		// Policies apply ahead of the token budget: a redaction records
+		// nothing.
+		if a.policy(p.piiType) == PolicyRedact {
+			b.WriteString(text[last:m.start])
+			b.WriteString(redaction(p.piiType))
+			last = m.end
+			continue
+		}
+		if !a.admitToken(sessionID) {
+			continue
+		}
+		token := indexRepeat(a.withSuffix(p.piiType, m.normalized, a.tokenForMatch(p, m.value)), repeats)
+		a.recordMapping(sessionID, token, m.value)
+		b.WriteString(text[last:m.start])
+		b.WriteString(token)
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// patternMatch is one match of a pattern in a text: its span in the
+// original text, the original value, and the normalized form the pattern
+// matched (the same as value unless NormalizeUnicode changed it).
+type patternMatch struct {
+	start, end        int
+	value, normalized string
+}
+
+// matches returns, in order, the matches of p in text that are to be
+// masked. This is the filter chain shared by replaceMatches and detect, so
+// Detect reports what AnonymizeText would mask. With NormalizeUnicode the pattern
+// runs over the NFKC form of text and each match is mapped back to its
+// original span. A match is dropped if it is blank, fails the pattern's
+// validator, widens into the previous match, is a phone number or SSN inside
+// a hex identifier, is allowlisted, or is of a type on PolicyPassthrough.
+func (a *Anonymizer) matches(p pattern, text string) []patternMatch {
+	if a.policy(p.piiType) == PolicyPassthrough {
+		return nil
+	}
+	subject := text
+	var view *normView
+	if a.normalize {
+		if view = newNormView(text); view != nil {
+			subject = view.norm
+		}
+	}
+	var out []patternMatch
+	last := 0
+	for _, loc := range p.re.FindAllStringSubmatchIndex(subject, -1) {
+		start, end := loc[2*p.valueGroup], loc[2*p.valueGroup+1]
+		if start < 0 {
+			continue
+		}
+		normalized := subject[start:end]
+		// A zero-width or whitespace-only match would become a token for
+		// nothing and corrupt the surrounding text.
+		if strings.TrimSpace(normalized) == "" {
+			continue
+		}
+		// If the pattern has a validator, skip non-matching values.
+		if p.validate != nil && !p.validate(normalized) {
+			continue
+		}
+		value := normalized
+		if view != nil {
+			if start, end = view.orig(start, end); start < last {
+				continue // widened into the previous match
+			}
+			value = text[start:end]
+		}
+		if (p.piiType == PIIPhone || p.piiType == PIISSN) && insideHexID(text, start, end) {
+			continue
+		}
+		if a.allowlisted(normalized) {
+			continue
+		}
+		out = append(out, patternMatch{start, end, value, normalized})
+		last = end
+	}
+	return out
+}
+
+// uuidRe matches a canonical 8-4-4-4-12 UUID.
+var uuidRe = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// insideHexID reports whether text[start:end] is part of a longer hex
+// identifier rather than a value on its own: it overlaps a UUID, or is
+// joined by a hyphen to a UUID-like hex group, as in request IDs built from
+// UUID fragments. Digit runs in such IDs can look like phone numbers or SSNs.
+func insideHexID(text string, start, end int) bool {
+	lo, hi := start, end
+	for lo > 0 && isHexOrHyphen(text[lo-1]) {
+		lo--
+	}
+	for hi < len(text) && isHexOrHyphen(text[hi]) {
+		hi++
+	}
+	if lo == start && hi == end {
+		return false
+	}
+	for _, loc := range uuidRe.FindAllStringIndex(text[lo:hi], -1) {
+		if lo+loc[0] < end && lo+loc[1] > start {
+			return true
+		}
+	}
+	return uuidLikeGroup(hexGroup(text[lo:start], false)) || uuidLikeGroup(hexGroup(text[end:hi], true))
+}
+
+// hexGroup returns the hex group joined by a hyphen to a match: the group
+// before the trailing hyphen of s, or after the leading hyphen of s when
+// after is set. It is "" if there is no joining hyphen.
+func hexGroup(s string, after bool) string {
+	if after {
+		g, ok := strings.CutPrefix(s, "-")
+		if !ok {
+			return ""
+		}
+		if i := strings.IndexByte(g, '-'); i >= 0 {
+			g = g[:i]
+		}
+		return g
+	}
+	g, ok := strings.CutSuffix(s, "-")
+	if !ok {
+		return ""
+	}
+	return g[strings.LastIndexByte(g, '-')+1:]
+}
+
+// uuidLikeGroup reports whether g looks like a UUID group rather than, say,
+// a phone extension: at least four characters, with a hex letter or at least
+// eight digits.
+func uuidLikeGroup(g string) bool {
+	return len(g) >= 8 || len(g) >= 4 && strings.ContainsAny(strings.ToLower(g), "abcdef")
+}
+
+func isHexOrHyphen(c byte) bool {
+	return c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// AnonymizePath replaces detected PII in a URL path such as
+// /v1/users/alice@example.com/messages. Each "/"-separated segment is scanned
+// on its own so a match can never span a separator, and the path is rebuilt
+// with the original separators intact. Mappings are recorded under sessionID
+// like any other token, so the response path restores them.
+func (a *Anonymizer) AnonymizePath(urlPath, sessionID string) string {
+	if urlPath == "" {
+		return urlPath
+	}
+	defer a.flushStore(sessionID)
+	segments := strings.Split(urlPath, "/")
+	for i, seg := range segments {
+		if seg != "" {
+			segments[i] = a.anonymizeText(seg, sessionID)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// allowlisted reports whether value is on Options.Allowlist. It is checked
+// in matches rather than in tokenForMatch: matches is the one filter chain
+// every regex match passes, on its way to tokenForMatch and equally to
+// Detect, dry-run counts and shadow mode, which never call tokenForMatch. An
+// allowlisted value thus reaches neither the direct nor the cache path, and
+// is not recorded in the session map or counted as a detection.
+func (a *Anonymizer) allowlisted(value string) bool {
+	return a.allowlist != nil && a.allowlist[allowlistKey(value)]
+}
+
+// allowlistKey normalizes a value for allowlist lookup: surrounding space is
+// trimmed, and emails are lower-cased since their case carries no meaning in
+// practice.
+func allowlistKey(value string) string {
+	v := strings.TrimSpace(value)
+	if strings.Contains(v, "@") {
+		v = strings.ToLower(v)
+	}
+	return v
+}
+
 // tokenForMatch returns the anonymization token for a single regex match.
 // High-confidence patterns are tokenized directly. Low-confidence patterns
 // consult the persistent cache; on miss a fallback token is applied immediately
 // and an async Ollama dispatch warms the cache for future requests.
+// Allowlisted values never get here (see allowlisted).
 func (a *Anonymizer) tokenForMatch(p pattern, match string) string {
-	if !a.useAI || p.confidence >= a.aiThreshold {
+	if !a.useAI || p.confidence >= a.threshold() {
+		a.recordDetection(detectionEvent{p.piiType, metrics.DetectionImmediate, p.confidence})
 		return a.replacement(p.piiType, match)
 	}
 
 	// Low-confidence path: check persistent per-value cache.
-	if cached, hit := a.cache.Get(match); hit {
+	if cached, hit := a.cache.Get(a.valueCacheKey(match)); hit {
+		a.recordDetection(detectionEvent{p.piiType, metrics.DetectionCacheHit, p.confidence})
 		return a.handleCacheHit(p.piiType, cached)
 	}
 
+	a.recordDetection(detectionEvent{p.piiType, metrics.DetectionFallback, p.confidence})
 	return a.handleCacheMiss(p.piiType, match)
 }
 
+// detectionEvent describes how one regex match was tokenized. It deliberately
+// has no field for the matched text.
+type detectionEvent struct {
+	piiType    PIIType
+	path       string // one of the metrics.Detection* constants
+	confidence float64
+}
+
+func (a *Anonymizer) recordDetection(ev detectionEvent) {
+	if a.m != nil {
+		a.m.RecordDetection(string(ev.piiType), ev.path, ev.confidence)
+	}
+}
+
 // handleCacheHit records metrics and returns the cached token.
 func (a *Anonymizer) handleCacheHit(piiType PIIType, cached string) string {
 	if a.m != nil {
@@ -345,19 +1025,27 @@ func (a *Anonymizer) handleCacheHit(piiType PIIType, cached string) string {
 // and dispatches an async Ollama query to warm the cache.
 func (a *Anonymizer) handleCacheMiss(piiType PIIType, match string) string {
 	token := a.replacement(piiType, match)
-	log.Printf("[ANONYMIZER] low-confidence cache miss piiType=%s", piiType)
+	if a.missLogs.Allow() {
+		a.log.Debugf("cache_miss", "low-confidence cache miss piiType=%s", piiType)
+	}
 	if a.m != nil {
 		a.m.RecordCacheMiss(string(piiType))
 		a.m.CacheFallbacks.Add(1)
 	}
-	a.dispatchOllamaAsync(match)
+	a.dispatchOllamaAsync(piiType, match)
 	return token
 }
 
 // dispatchOllamaAsync fires a background goroutine to query Ollama for a
 // single PII value and store the result in the per-value cache.
-// An in-flight map prevents duplicate concurrent queries for the same value.
-func (a *Anonymizer) dispatchOllamaAsync(original string) {
+// An in-flight map prevents duplicate concurrent queries for the same value;
+// a value stays in it through the dispatchDelay wait, so repeat misses in
+// that window coalesce into one query. Values whose regex-detected type is
+// on the Ollama denylist are not sent.
+func (a *Anonymizer) dispatchOllamaAsync(piiType PIIType, original string) {
+	if a.ollamaDeny[piiType] {
+		return
+	}
 	a.inflightMu.Lock()
 	if a.inflight[original] {
 		a.inflightMu.Unlock()
@@ -366,46 +1054,69 @@ func (a *Anonymizer) dispatchOllamaAsync(original string) {
 	a.inflight[original] = true
 	a.inflightMu.Unlock()
 
+	if a.batchWindow > 0 {
+		a.enqueueOllamaBatch(original)
+		return
+	}
+
 	if a.m != nil {
 		a.m.OllamaDispatches.Add(1)
 	}
 
 	go func() {
-		defer func() {
-			a.inflightMu.Lock()
-			delete(a.inflight, original)
-			a.inflightMu.Unlock()
-		}()
-
-		// Acquire semaphore; drop the request if Ollama is already busy.
-		select {
-		case a.ollamaSem <- struct{}{}:
-			defer func() { <-a.ollamaSem }()
-		default:
-			log.Printf("[ANONYMIZER] Ollama busy, skipping background query for value")
-			if a.m != nil {
-				a.m.OllamaErrors.Add(1)
-			}
-			return
+		defer a.releaseInflight(original)
+
+		if a.dispatchDelay > 0 {
+			time.Sleep(a.dispatchDelay)
 		}
+		a.queryAndCache(func() ([]ollamaDetection, error) { return a.queryOllamaHTTP(original) })
+	}()
+}
 
-		detections, err := a.queryOllamaHTTP(original)
-		if err != nil {
-			log.Printf("[ANONYMIZER] async Ollama query failed: %v", err)
-			if a.m != nil {
-				a.m.OllamaErrors.Add(1)
-			}
-			return
+// releaseInflight removes values from the in-flight map once their query
+// has finished or been dropped, so a later miss dispatches again.
+func (a *Anonymizer) releaseInflight(values ...string) {
+	a.inflightMu.Lock()
+	for _, v := range values {
+		delete(a.inflight, v)
+	}
+	a.inflightMu.Unlock()
+}
+
+// queryAndCache runs one Ollama query under the concurrency semaphore and
+// caches the tokens of detections at or above the AI threshold. The query is
+// dropped if Ollama is already busy.
+func (a *Anonymizer) queryAndCache(query func() ([]ollamaDetection, error)) {
+	select {
+	case a.ollamaSem <- struct{}{}:
+		defer func() { <-a.ollamaSem }()
+	default:
+		a.log.Debug("ollama", "Ollama busy, skipping background query for value")
+		if a.m != nil {
+			a.m.OllamaErrors.Add(1)
+		}
+		return
+	}
+
+	detections, err := query()
+	if err != nil {
+		a.log.Errorf("ollama", "async Ollama query failed: %v", err)
+		if a.m != nil {
+			a.m.OllamaErrors.Add(1)
 		}
+		return
+	}
 
-		for _, d := range detections {
-			if d.Original != "" && d.Confidence >= a.aiThreshold {
-				a.cache.Set(d.Original, a.replacement(d.PIIType, d.Original))
-			}
+	// Store the whole response as one batch (one bbolt transaction).
+	pairs := make(map[string]string, len(detections))
+	for _, d := range detections {
+		if d.Original != "" && d.Confidence >= a.threshold() {
+			pairs[a.valueCacheKey(d.Original)] = a.replacement(d.PIIType, d.Original)
 		}
+	}
+	a.cache.SetMany(pairs)
 
-		log.Printf("[ANONYMIZER] async Ollama cache populated for %d value(s)", len(detections))
-	}()
+	a.log.Debugf("ollama", "async Ollama cache populated for %d value(s)", len(detections))
 }
 
 // defaultPIIInstruction is the fallback system instruction used when no
@@ -420,7 +1131,8 @@ const defaultPIIInstruction = "PRIVACY TOKENS: This request contains privacy-pre
 // resolvePIIInstruction returns the configured instruction for the given model
 // string using prefix matching, falling back to defaultPIIInstruction.
 func (a *Anonymizer) resolvePIIInstruction(model string) string {
-	for key, instruction := range a.piiInstructions {
+	instructions := a.settings.Load().PIIInstructions
+	for key, instruction := range instructions {
 		if key == "default" {
 			continue
 		}
@@ -428,7 +1140,7 @@ func (a *Anonymizer) resolvePIIInstruction(model string) string {
 			return instruction
 		}
 	}
-	if fallback, ok := a.piiInstructions["default"]; ok {
+	if fallback, ok := instructions["default"]; ok {
 		return fallback
 	}
 	return defaultPIIInstruction
@@ -438,12 +1150,30 @@ func (a *Anonymizer) resolvePIIInstruction(model string) string {
 // anonymizes them. Non-JSON bodies are treated as plain text.
 // When PII tokens are inserted, a system instruction is injected into the
 // request to prevent the LLM from substituting plausible-looking fake values
-// in place of the tokens.
+// in place of the tokens. With PreserveJSONFormat the body is edited in place
+// instead of being decoded and re-encoded.
 func (a *Anonymizer) AnonymizeJSON(body []byte, requestID string) []byte {
+	out, _ := a.AnonymizeJSONContext(context.Background(), body, requestID)
+	return out
+}
+
+// AnonymizeJSONContext is AnonymizeJSON with cancellation: ctx is checked
+// before each string value is scanned. Once it is done the remaining values
+// are left as they are and ctx.Err() is returned with that partial result,
+// which still contains PII and must not be forwarded.
+func (a *Anonymizer) AnonymizeJSONContext(ctx context.Context, body []byte, requestID string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return body, err
+	}
+	defer a.flushStore(requestID)
+	a.maybeShadow(body)
+	if a.preserveJSON {
+		return a.anonymizeJSONInPlace(ctx, body, requestID)
+	}
 	var doc any
 	if err := json.Unmarshal(body, &doc); err != nil {
 		// Not JSON — treat as plain text
-		return []byte(a.AnonymizeText(string(body), requestID))
+		return []byte(a.anonymizeText(string(body), requestID)), nil
 	}
 	// Extract model name before walking (walkValue may modify the map).
 	model := ""
@@ -453,7 +1183,13 @@ func (a *Anonymizer) AnonymizeJSON(body []byte, requestID string) []byte {
 		}
 	}
 
-	anonymized := a.walkValue(doc, requestID)
+	anonymized := a.walkValue(ctx, doc, requestID)
+	if err := ctx.Err(); err != nil {
+		if out, merr := jsonMarshal(anonymized); merr == nil {
+			return out, err
+		}
+		return body, err
+	}
 
 	// If any tokens were recorded for this request, inject a system instruction
 	// so the LLM knows to reproduce tokens verbatim.
@@ -468,18 +1204,53 @@ func (a *Anonymizer) AnonymizeJSON(body []byte, requestID string) []byte {
 
 	out, err := jsonMarshal(anonymized)
 	if err != nil {
-		return body // fallback: return original
+		return body, nil // fallback: return original
 	}
-	return out
+	return out, nil
+}
+
+// anonymizeJSONInPlace is AnonymizeJSON for PreserveJSONFormat: only string
+// values containing PII are rewritten and every other byte is kept.
+func (a *Anonymizer) anonymizeJSONInPlace(ctx context.Context, body []byte, requestID string) ([]byte, error) {
+	e, ok := scanJSON(body, func(s string) string {
+		if ctx.Err() != nil {
+			return s
+		}
+		return a.anonymizeText(s, requestID)
+	})
+	if !ok {
+		return []byte(a.anonymizeText(string(body), requestID)), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return e.result(), err
+	}
+	if a.SessionTokenCount(requestID) > 0 {
+		e.injectInstruction(a.resolvePIIInstruction(e.model), a.separateInst)
+	}
+	return e.result(), nil
+}
+
+// appendInstruction adds instruction to an existing system prompt.
+func appendInstruction(prompt, instruction string) string {
+	if prompt == "" {
+		return instruction
+	}
+	return prompt + "\n\n" + instruction
 }
 
 // injectPIIInstruction appends the given instruction to the request's system
-// prompt. It handles two API shapes:
+// prompt. It handles three API shapes:
 //
-//   - Anthropic messages API: top-level "system" field (string or content-block array)
+//   - Anthropic messages API: top-level "system" string
+//   - Anthropic messages API: top-level "system" content-block array
 //   - OpenAI-compatible API:  first "messages" entry with role "system"
 //
-// If neither shape is found, the function is a no-op — non-chat endpoints
+// With SeparateInstruction the instruction is never concatenated: a string
+// "system" becomes a two-block array, and an OpenAI system message gets a
+// second system message after it. A content-block array always gets a
+// block of its own.
+//
+// If no shape is found, the function is a no-op — non-chat endpoints
 // (embeddings, completions) don't carry a system prompt to inject into.
 func (a *Anonymizer) injectPIIInstruction(doc map[string]any, instruction string) {
 	if instruction == "" {
@@ -489,11 +1260,14 @@ func (a *Anonymizer) injectPIIInstruction(doc map[string]any, instruction string
 	if sys, ok := doc["system"]; ok {
 		switch s := sys.(type) {
 		case string:
-			if s == "" {
-				doc["system"] = instruction
-			} else {
-				doc["system"] = s + "\n\n" + instruction
+			if a.separateInst && s != "" {
+				doc["system"] = []any{
+					map[string]any{"type": "text", "text": s},
+					map[string]any{"type": "text", "text": instruction},
+				}
+				return
 			}
+			doc["system"] = appendInstruction(s, instruction)
 			return
 		case []any:
 			doc["system"] = append(s, map[string]any{
@@ -506,46 +1280,52 @@ func (a *Anonymizer) injectPIIInstruction(doc map[string]any, instruction string
 
 	// OpenAI-compatible API: look for a system role message
 	if msgs, ok := doc["messages"].([]any); ok {
-		for _, m := range msgs {
+		systemMsg := map[string]any{
+			"role":    "system",
+			"content": instruction,
+		}
+		for i, m := range msgs {
 			if msg, ok := m.(map[string]any); ok && msg["role"] == "system" {
+				if a.separateInst {
+					doc["messages"] = slices.Insert(msgs, i+1, any(systemMsg))
+					return
+				}
 				if content, ok := msg["content"].(string); ok {
-					if content == "" {
-						msg["content"] = instruction
-					} else {
-						msg["content"] = content + "\n\n" + instruction
-					}
+					msg["content"] = appendInstruction(content, instruction)
 				}
 				return
 			}
 		}
 		// No system message — prepend one
-		systemMsg := map[string]any{
-			"role":    "system",
-			"content": instruction,
-		}
 		doc["messages"] = append([]any{systemMsg}, msgs...)
 	}
 }
 
+// structuralFields are request keys whose values are API parameters, not
+// user content, and are never scanned for PII.
+var structuralFields = map[string]bool{
+	"model": true, "temperature": true, "max_tokens": true,
+	"top_p": true, "stream": true, "n": true,
+}
+
 // walkValue recursively anonymizes string leaves in a JSON-decoded value.
-func (a *Anonymizer) walkValue(v any, requestID string) any {
+// Leaves reached after ctx is done are left unchanged.
+func (a *Anonymizer) walkValue(ctx context.Context, v any, requestID string) any {
 	switch val := v.(type) {
 	case string:
-		return a.AnonymizeText(val, requestID)
+		if ctx.Err() != nil {
+			return val
+		}
+		return a.anonymizeText(val, requestID)
 	case []any:
 		for i, item := range val {
-			val[i] = a.walkValue(item, requestID)
+			val[i] = a.walkValue(ctx, item, requestID)
 		}
 		return val
 	case map[string]any:
-		// Skip fields that are structural, not user content
-		skip := map[string]bool{
-			"model": true, "temperature": true, "max_tokens": true,
-			"top_p": true, "stream": true, "n": true,
-		}
 		for k, item := range val {
-			if !skip[k] {
-				val[k] = a.walkValue(item, requestID)
+			if !structuralFields[k] {
+				val[k] = a.walkValue(ctx, item, requestID)
 			}
 		}
 		return val
@@ -567,9 +1347,85 @@ func (a *Anonymizer) walkValue(v any, requestID string) any {
 // TestTokenFormatNonRetriggering enforces this.
 //
 // Token format: [PII_TYPE_XXXXXXXXXXXXXXXX] — 16 hex chars, max 33 bytes.
+// The hex digits come from tokenHash. A validated Options.ReplacementFunc
+// takes over when set.
 func (a *Anonymizer) replacement(piiType PIIType, original string) string {
-	h := fmt.Sprintf("%x", md5.Sum([]byte(original)))[:16] // #nosec G401 -- deterministic token, not crypto
-	return fmt.Sprintf("[PII_%s_%s]", strings.ToUpper(string(piiType)), h)
+	if a.replaceFn != nil {
+		return a.replaceFn(piiType, original)
+	}
+	return fmt.Sprintf("[PII_%s_%s]", strings.ToUpper(string(piiType)), a.tokenHash(original))
+}
+
+// indexRepeat counts token in repeats and returns it unchanged on its first
+// occurrence, or indexed (see indexedToken) on later ones. A nil repeats map
+// disables indexing.
+func indexRepeat(token string, repeats map[string]int) string {
+	if repeats == nil {
+		return token
+	}
+	repeats[token]++
+	if n := repeats[token]; n > 1 {
+		return indexedToken(token, n)
+	}
+	return token
+}
+
+// indexedToken marks the nth occurrence of token inside its brackets:
+// [PII_EMAIL_c160f8cc4b2e1a3d#2]. Each indexed form is mapped to the same
+// original, and since every token ends in ']' no form is a substring of
+// another, so deanonymization can replace them independently.
+func indexedToken(token string, n int) string {
+	return token[:len(token)-1] + "#" + strconv.Itoa(n) + "]"
+}
+
+// ErrTooManySessions is returned by BeginSession when MaxSessions sessions
+// are already open. Callers should shed the request and let the client retry.
+var ErrTooManySessions = errors.New("too many concurrent anonymization sessions")
+
+// BeginSession opens sessionID ahead of anonymization, reserving one of the
+// MaxSessions slots. It returns ErrTooManySessions if the limit is reached;
+// the slot is released by DeleteSession. Sessions created implicitly by
+// AnonymizeText without BeginSession are counted but never refused.
+// Beginning a session that is ending under SessionTTL reopens it.
+func (a *Anonymizer) BeginSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	_, exists := a.sessions[sessionID]
+	_, ending := a.ending[sessionID]
+	if exists && !ending {
+		return nil
+	}
+	if a.maxSessions > 0 && a.activeSessionsLocked() >= a.maxSessions {
+		return ErrTooManySessions
+	}
+	if ending {
+		delete(a.ending, sessionID)
+		return nil
+	}
+	a.newSessionLocked(sessionID)
+	return nil
+}
+
+// newSessionLocked creates an empty token map for sessionID and records its
+// start. a.sessionMu must be held for writing.
+func (a *Anonymizer) newSessionLocked(sessionID string) {
+	a.sessions[sessionID] = make(map[string]string)
+	a.started[sessionID] = time.Now()
+}
+
+// ActiveSessions returns the number of open sessions. Sessions kept for
+// SessionTTL after DeleteSession are not counted.
+func (a *Anonymizer) ActiveSessions() int {
+	a.sessionMu.RLock()
+	defer a.sessionMu.RUnlock()
+	return a.activeSessionsLocked()
+}
+
+func (a *Anonymizer) activeSessionsLocked() int {
+	return len(a.sessions) - len(a.ending)
 }
 
 // SessionTokenCount returns the number of tokens recorded for sessionID.
@@ -584,16 +1440,64 @@ func (a *Anonymizer) SessionTokenCount(sessionID string) int {
 	return n
 }
 
-// recordMapping stores token → original in the session map.
+// tokenTypeRe captures the PII type of a built-in token.
+var tokenTypeRe = regexp.MustCompile(`^\[PII_([A-Z0-9_]+)_[0-9a-f]{16}`)
+
+// SessionTypeCounts returns the number of distinct tokens recorded for
+// sessionID, by PII type. Tokens from a ReplacementFunc that do not follow
+// the built-in format are not counted.
+func (a *Anonymizer) SessionTypeCounts(sessionID string) map[PIIType]int {
+	counts := make(map[PIIType]int)
+	a.sessionMu.RLock()
+	defer a.sessionMu.RUnlock()
+	for token := range a.sessions[sessionID] {
+		if m := tokenTypeRe.FindStringSubmatch(token); m != nil {
+			counts[PIIType(m[1])]++
+		}
+	}
+	return counts
+}
+
+// admitToken counts one match against sessionID's MaxTokensPerRequest budget
+// and reports whether it may still be tokenized.
+func (a *Anonymizer) admitToken(sessionID string) bool {
+	if a.maxTokens <= 0 || sessionID == "" {
+		return true
+	}
+	a.sessionMu.Lock()
+	a.tokenCounts[sessionID]++
+	n := a.tokenCounts[sessionID]
+	a.sessionMu.Unlock()
+	return n <= a.maxTokens
+}
+
+// TokensOverLimit returns how many matches in sessionID were left unmasked
+// because MaxTokensPerRequest was reached. 0 means every match was tokenized.
+func (a *Anonymizer) TokensOverLimit(sessionID string) int {
+	if a.maxTokens <= 0 || sessionID == "" {
+		return 0
+	}
+	a.sessionMu.RLock()
+	n := a.tokenCounts[sessionID]
+	a.sessionMu.RUnlock()
+	return max(n-a.maxTokens, 0)
+}
+
+// recordMapping stores token → original in the session map, sealed if
+// session encryption is enabled.
 func (a *Anonymizer) recordMapping(sessionID, token, original string) {
 	if sessionID == "" {
 		return
 	}
 	a.sessionMu.Lock()
 	if a.sessions[sessionID] == nil {
-		a.sessions[sessionID] = make(map[string]string)
+		a.newSessionLocked(sessionID)
+	}
+	if _, seen := a.sessions[sessionID][token]; !seen {
+		sealed := a.enc.seal(original)
+		a.sessions[sessionID][token] = sealed
+		a.queueStoreLocked(sessionID, token, sealed)
 	}
-	a.sessions[sessionID][token] = original
 	a.sessionMu.Unlock()
 	if a.m != nil {
 		a.m.TokensReplaced.Add(1)
@@ -602,31 +1506,121 @@ func (a *Anonymizer) recordMapping(sessionID, token, original string) {
 
 // DeanonymizeText reverses all token replacements recorded for sessionID.
 func (a *Anonymizer) DeanonymizeText(text, sessionID string) string {
+	result, _, _ := a.deanonymize(text, sessionID)
+	return result
+}
+
+// deanonymize is DeanonymizeText that also returns how many of the
+// session's tokens occurred in text (found) and how many it has (total).
+func (a *Anonymizer) deanonymize(text, sessionID string) (result string, found, total int) {
 	if sessionID == "" || text == "" {
-		return text
+		return text, 0, 0
 	}
-	a.sessionMu.RLock()
-	tokenMap := a.sessions[sessionID]
-	a.sessionMu.RUnlock()
+	tokenMap := a.sessionTokens(sessionID)
+	found = countTokens(text, tokenMap)
 
-	result := text
+	result = text
 	for token, original := range tokenMap {
 		result = strings.ReplaceAll(result, token, original)
 	}
 	if a.m != nil && len(tokenMap) > 0 {
 		a.m.TokensDeanonymized.Add(int64(len(tokenMap)))
 	}
-	return result
+	return result, found, len(tokenMap)
 }
 
-// DeleteSession removes the token map for a completed request.
+// sessionTokens returns a plaintext copy of the token → original map for
+// sessionID, including mappings only the shared SessionStore holds. Entries
+// that fail to decrypt are dropped (and logged), leaving their tokens in
+// place rather than restoring garbage.
+func (a *Anonymizer) sessionTokens(sessionID string) map[string]string {
+	raw := a.storeGet(sessionID)
+	a.sessionMu.RLock()
+	if raw == nil {
+		raw = maps.Clone(a.sessions[sessionID])
+	} else {
+		maps.Copy(raw, a.sessions[sessionID])
+	}
+	a.sessionMu.RUnlock()
+	out := make(map[string]string, len(raw))
+	for token, stored := range raw {
+		original, err := a.enc.open(stored)
+		if err != nil {
+			a.log.Errorf("deanon", "cannot decrypt original for token %s: %v", token, err)
+			continue
+		}
+		out[token] = original
+	}
+	return out
+}
+
+// SessionMappings returns a plaintext copy of the token → original map for
+// an open session, or one kept for SessionTTL, for the management debug
+// endpoint. A session opened by another instance is found through the
+// shared SessionStore. ok is false if the session is unknown or already
+// deleted.
+func (a *Anonymizer) SessionMappings(sessionID string) (mappings map[string]string, ok bool) {
+	a.sessionMu.RLock()
+	_, ok = a.sessions[sessionID]
+	a.sessionMu.RUnlock()
+	mappings = a.sessionTokens(sessionID)
+	if !ok && len(mappings) == 0 {
+		return nil, false
+	}
+	return mappings, true
+}
+
+// SessionStat describes one session for the management API. It carries no
+// tokens or originals.
+type SessionStat struct {
+	SessionID string  `json:"sessionID"`
+	Tokens    int     `json:"tokens"`  // distinct tokens recorded
+	AgeSecs   float64 `json:"ageSecs"` // time since the session was created
+	Ending    bool    `json:"ending"`  // deleted, kept readable for SessionTTL
+}
+
+// SessionStats lists the open sessions, and those kept for SessionTTL,
+// oldest first.
+func (a *Anonymizer) SessionStats() []SessionStat {
+	now := time.Now()
+	a.sessionMu.RLock()
+	stats := make([]SessionStat, 0, len(a.sessions))
+	for id, tokens := range a.sessions {
+		_, ending := a.ending[id]
+		stats = append(stats, SessionStat{
+			SessionID: id,
+			Tokens:    len(tokens),
+			AgeSecs:   now.Sub(a.started[id]).Seconds(),
+			Ending:    ending,
+		})
+	}
+	a.sessionMu.RUnlock()
+	slices.SortFunc(stats, func(x, y SessionStat) int {
+		return cmp.Or(cmp.Compare(y.AgeSecs, x.AgeSecs), strings.Compare(x.SessionID, y.SessionID))
+	})
+	return stats
+}
+
+// DeleteSession removes the token map for a completed request, here and in
+// the shared SessionStore. With SessionTTL set, the map stays readable until
+// the TTL has passed.
 func (a *Anonymizer) DeleteSession(sessionID string) {
 	if sessionID == "" {
 		return
 	}
 	a.sessionMu.Lock()
+	if a.sessionTTL > 0 {
+		a.endSessionLocked(sessionID)
+		a.sessionMu.Unlock()
+		return
+	}
 	delete(a.sessions, sessionID)
+	delete(a.tokenCounts, sessionID)
+	delete(a.sessionProf, sessionID)
+	delete(a.started, sessionID)
+	delete(a.storePending, sessionID)
 	a.sessionMu.Unlock()
+	a.storeDelete(sessionID)
 }
 
 // StreamingDeanonymize wraps src in a reader that replaces PII tokens on-the-fly
@@ -647,16 +1641,10 @@ func (a *Anonymizer) DeleteSession(sessionID string) {
 // A snapshot of the session token map is taken immediately (under the read
 // lock) so the goroutine is unaffected by a later DeleteSession call.
 func (a *Anonymizer) StreamingDeanonymize(src io.ReadCloser, sessionID string, domain string) io.ReadCloser {
-	a.sessionMu.RLock()
-	rawMap := a.sessions[sessionID]
-	tokenMap := make(map[string]string, len(rawMap))
-	for k, v := range rawMap {
-		tokenMap[k] = v
-	}
-	a.sessionMu.RUnlock()
+	tokenMap := a.sessionTokens(sessionID)
 
 	if a.verbose {
-		log.Printf("[DEANON] StreamingDeanonymize sessionID=%s tokens=%d", sessionID, len(tokenMap))
+		a.log.Debugf("deanon_stream", "StreamingDeanonymize sessionID=%s tokens=%d", sessionID, len(tokenMap))
 	}
 	if len(tokenMap) == 0 {
 		return src
@@ -666,11 +1654,7 @@ func (a *Anonymizer) StreamingDeanonymize(src io.ReadCloser, sessionID string, d
 		a.m.TokensDeanonymized.Add(int64(len(tokenMap)))
 	}
 
-	pairs := make([]string, 0, len(tokenMap)*2)
-	for token, original := range tokenMap {
-		pairs = append(pairs, token, original)
-	}
-	replacer := strings.NewReplacer(pairs...)
+	replacer := newTokenReplacer(tokenMap)
 
 	pr, pw := io.Pipe()
 	opts := streamDeanonymizerOpts{
@@ -679,12 +1663,15 @@ func (a *Anonymizer) StreamingDeanonymize(src io.ReadCloser, sessionID string, d
 		sessionID:  sessionID,
 		verbose:    a.verbose,
 		tokenCount: len(tokenMap),
+		log:        a.log,
 	}
 	provider := NewStreamingDeanonymizer(ProviderForDomain(domain), opts)
 	ctx := &streamContext{
 		pw:       pw,
 		replacer: replacer,
 		provider: provider,
+		onEnd:    func() { a.checkFidelity(replacer.found(), len(tokenMap), sessionID) },
+		log:      a.log,
 	}
 	go readLoop(src, ctx)
 	return pr
@@ -692,6 +1679,27 @@ func (a *Anonymizer) StreamingDeanonymize(src io.ReadCloser, sessionID string, d
 
 // --- Ollama integration ---
 
+// ollamaSocketHost is the placeholder URL host for unix:// endpoints; the
+// transport ignores it and dials the socket.
+const ollamaSocketHost = "http://ollama"
+
+// newOllamaClient returns the HTTP client and generate URL for an Ollama
+// endpoint. An http(s) endpoint uses http.DefaultClient. A unix:// endpoint
+// (unix:///run/ollama/ollama.sock) gets a client that dials the socket.
+func newOllamaClient(endpoint string) (*http.Client, string) {
+	socket, ok := strings.CutPrefix(endpoint, "unix://")
+	if !ok {
+		return http.DefaultClient, endpoint + "/api/generate"
+	}
+	var d net.Dialer
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	return client, ollamaSocketHost + "/api/generate"
+}
+
 type ollamaRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
@@ -723,7 +1731,12 @@ Text to analyze:
 
 Return ONLY the JSON array, no explanation. Example: [{"original":"John Smith","type":"name","confidence":0.95}]`,
 		text)
+	return a.queryOllama(prompt)
+}
 
+// queryOllama sends prompt to the Ollama generate API and parses the JSON
+// array of detections out of the model's reply.
+func (a *Anonymizer) queryOllama(prompt string) ([]ollamaDetection, error) {
 	reqBody, _ := json.Marshal(ollamaRequest{
 		Model:  a.ollamaModel,
 		Prompt: prompt,
@@ -737,9 +1750,12 @@ Return ONLY the JSON array, no explanation. Example: [{"original":"John Smith","
 	if err != nil {
 		return nil, fmt.Errorf("create ollama request: %w", err)
 	}
+	for k, v := range a.ollamaHdrs {
+		req.Header.Set(k, v)
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req) // #nosec G704 -- URL from trusted config, not user input
+	resp, err := a.ollamaHTTP.Do(req) // #nosec G704 -- URL from trusted config, not user input
 	if err != nil {
 		return nil, err
 	}
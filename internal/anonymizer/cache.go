@@ -17,9 +17,13 @@
 package anonymizer
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"time"
+
+	"ai-anonymizing-proxy/internal/logger"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -33,14 +37,49 @@ type PersistentCache interface {
 	// Set stores original → token. Overwrites any existing entry silently.
 	Set(original, token string)
 
+	// SetMany stores every original → token pair. Implementations backed by a
+	// transactional store write the whole batch in a single transaction.
+	SetMany(pairs map[string]string)
+
 	// Delete removes the entry for original. A no-op if the key does not exist.
 	Delete(original string)
 
+	// DeleteMany removes all given keys. Implementations backed by a
+	// transactional store apply the whole batch in a single transaction.
+	DeleteMany(originals []string)
+
+	// Len returns the number of entries currently resident in the cache.
+	Len() int
+
+	// Cap returns the maximum number of entries the cache holds before
+	// evicting, or -1 if the cache is unbounded.
+	Cap() int
+
+	// Probe verifies the store is usable by writing, reading back and
+	// deleting a sentinel entry. Returns nil for stores that cannot fail.
+	Probe() error
+
+	// Stats describes the cache's in-memory eviction layer. Caches without
+	// one return the zero value.
+	Stats() CacheLayerStats
+
 	// Close releases any resources held by the cache (e.g. file handles).
 	// Must be called when the anonymizer is shut down.
 	Close() error
 }
 
+// CacheLayerStats describes the S3-FIFO in-memory layer in front of the
+// persistent cache: queue occupancy, and how Get hits split between entries
+// already in memory and entries re-warmed from the backing store.
+type CacheLayerStats struct {
+	SQueueLen  int   // entries on probation
+	MQueueLen  int   // entries promoted after a second access
+	GhostCount int   // keys recently evicted from S, remembered for readmission
+	Capacity   int   // S + M bound; 0 for a cache without the layer
+	MemoryHits int64 // Get hits served from memory
+	ColdHits   int64 // Get hits read from the backing store and re-warmed
+}
+
 // --- memoryCache ---------------------------------------------------------
 
 // memoryCache is a thread-safe in-memory PersistentCache.
@@ -67,12 +106,43 @@ func (c *memoryCache) Set(original, token string) {
 	c.mu.Unlock()
 }
 
+func (c *memoryCache) SetMany(pairs map[string]string) {
+	c.mu.Lock()
+	for k, v := range pairs {
+		c.store[k] = v
+	}
+	c.mu.Unlock()
+}
+
 func (c *memoryCache) Delete(original string) {
 	c.mu.Lock()
 	delete(c.store, original)
 	c.mu.Unlock()
 }
 
+func (c *memoryCache) DeleteMany(originals []string) {
+	c.mu.Lock()
+	for _, k := range originals {
+		delete(c.store, k)
+	}
+	c.mu.Unlock()
+}
+
+func (c *memoryCache) Len() int {
+	c.mu.RLock()
+	n := len(c.store)
+	c.mu.RUnlock()
+	return n
+}
+
+// Cap returns -1: the in-memory cache has no eviction bound.
+func (c *memoryCache) Cap() int { return -1 }
+
+func (c *memoryCache) Probe() error { return nil }
+
+// Stats returns the zero value: there is no eviction layer.
+func (c *memoryCache) Stats() CacheLayerStats { return CacheLayerStats{} }
+
 func (c *memoryCache) Close() error { return nil }
 
 // --- bboltCache ----------------------------------------------------------
@@ -85,12 +155,13 @@ var bboltBucket = "ollama_cache"
 // Entries survive process restarts. The database file is created at the
 // given path if it does not exist.
 type bboltCache struct {
-	db *bolt.DB
+	db  *bolt.DB
+	log *logger.Logger
 }
 
 // newBboltCache opens (or creates) the bbolt database at path and ensures
 // the bucket exists. Returns an error if the file cannot be opened.
-func newBboltCache(path string) (PersistentCache, error) {
+func newBboltCache(path string, lg *logger.Logger) (PersistentCache, error) {
 	db, err := bolt.Open(path, 0600, nil)
 	if err != nil {
 		return nil, fmt.Errorf("open bbolt cache %q: %w", path, err)
@@ -105,8 +176,8 @@ func newBboltCache(path string) (PersistentCache, error) {
 		return nil, fmt.Errorf("create bbolt bucket: %w", err)
 	}
 
-	log.Printf("[ANONYMIZER] persistent cache opened at %s", path)
-	return &bboltCache{db: db}, nil
+	lg.Infof("cache_open", "persistent cache opened at %s", path)
+	return &bboltCache{db: db, log: lg}, nil
 }
 
 func (c *bboltCache) Get(original string) (string, bool) {
@@ -123,7 +194,7 @@ func (c *bboltCache) Get(original string) (string, bool) {
 		return nil
 	})
 	if err != nil {
-		log.Printf("[ANONYMIZER] bbolt Get error: %v", err)
+		c.log.Errorf("cache_get", "bbolt Get error: %v", err)
 		return "", false
 	}
 	return token, token != ""
@@ -137,7 +208,30 @@ func (c *bboltCache) Set(original, token string) {
 		}
 		return b.Put([]byte(original), []byte(token))
 	}); err != nil {
-		log.Printf("[ANONYMIZER] bbolt Set error: %v", err)
+		c.log.Errorf("cache_set", "bbolt Set error: %v", err)
+	}
+}
+
+// SetMany writes all pairs in one bbolt write transaction. An Ollama
+// response typically yields several detections at once; batching them avoids
+// one fsync per value.
+func (c *bboltCache) SetMany(pairs map[string]string) {
+	if len(pairs) == 0 {
+		return
+	}
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bboltBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %q not found", bboltBucket)
+		}
+		for k, v := range pairs {
+			if err := b.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.log.Errorf("cache_set_many", "bbolt SetMany error: %v", err)
 	}
 }
 
@@ -149,8 +243,91 @@ func (c *bboltCache) Delete(original string) {
 		}
 		return b.Delete([]byte(original))
 	}); err != nil {
-		log.Printf("[ANONYMIZER] bbolt Delete error: %v", err)
+		c.log.Errorf("cache_delete", "bbolt Delete error: %v", err)
+	}
+}
+
+// DeleteMany removes all keys in one bbolt write transaction, so a burst of
+// S3-FIFO evictions costs one fsync instead of one per key.
+func (c *bboltCache) DeleteMany(originals []string) {
+	if len(originals) == 0 {
+		return
+	}
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bboltBucket))
+		if b == nil {
+			return nil // bucket gone — nothing to delete
+		}
+		for _, k := range originals {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.log.Errorf("cache_delete_many", "bbolt DeleteMany error: %v", err)
+	}
+}
+
+// Len returns the number of keys in the bucket.
+func (c *bboltCache) Len() int {
+	n := 0
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bboltBucket)); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	}); err != nil {
+		c.log.Errorf("cache_len", "bbolt Len error: %v", err)
+	}
+	return n
+}
+
+// Cap returns -1: bbolt on its own grows without bound. Use s3fifoCache to
+// enforce a capacity.
+func (c *bboltCache) Cap() int { return -1 }
+
+// Stats returns the zero value; the S3-FIFO layer wraps bbolt when one is
+// configured.
+func (c *bboltCache) Stats() CacheLayerStats { return CacheLayerStats{} }
+
+// cacheProbeKey is the sentinel written by Probe. The leading NUL keeps it
+// out of the key space of real values and HMAC cache keys.
+const cacheProbeKey = "\x00cache-probe"
+
+// Probe round-trips a sentinel key through three separate transactions, so
+// a read-only, full or closed database file is reported rather than hidden
+// behind the logged-and-ignored errors of Set.
+func (c *bboltCache) Probe() error {
+	key := []byte(cacheProbeKey)
+	want := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bboltBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %q not found", bboltBucket)
+		}
+		return b.Put(key, want)
+	}); err != nil {
+		return fmt.Errorf("cache probe write: %w", err)
+	}
+	var got []byte
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bboltBucket)); b != nil {
+			got = bytes.Clone(b.Get(key))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cache probe read: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return errors.New("cache probe read back a different value")
+	}
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bboltBucket)).Delete(key)
+	}); err != nil {
+		return fmt.Errorf("cache probe delete: %w", err)
 	}
+	return nil
 }
 
 func (c *bboltCache) Close() error {
@@ -16,7 +16,7 @@ func TestNewBboltCacheBucketError(t *testing.T) {
 	defer func() { bboltBucket = orig }()
 	bboltBucket = ""
 
-	c, err := newBboltCache(filepath.Join(t.TempDir(), "x.db"))
+	c, err := newBboltCache(filepath.Join(t.TempDir(), "x.db"), testLog)
 	if err == nil {
 		t.Fatal("expected error from empty bucket name, got nil")
 	}
@@ -35,7 +35,7 @@ func TestBboltCacheNilBucketPaths(t *testing.T) {
 	if err != nil {
 		t.Fatalf("bolt.Open: %v", err)
 	}
-	c := &bboltCache{db: db}
+	c := &bboltCache{db: db, log: testLog}
 	defer func() { _ = c.Close() }() // test cleanup
 
 	logs := captureLog(t)
@@ -68,7 +68,7 @@ func TestBboltCacheNilBucketPaths(t *testing.T) {
 // TestBboltCacheClosedDBPaths exercises the error branches of Get and Delete
 // when the underlying db has been closed (db.View / db.Update return an error).
 func TestBboltCacheClosedDBPaths(t *testing.T) {
-	c, err := newBboltCache(filepath.Join(t.TempDir(), "closed.db"))
+	c, err := newBboltCache(filepath.Join(t.TempDir(), "closed.db"), testLog)
 	if err != nil {
 		t.Fatalf("newBboltCache: %v", err)
 	}
@@ -1,9 +1,12 @@
 package anonymizer
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 // TestMemoryCacheBasicOperations verifies the in-memory cache satisfies the
@@ -47,7 +50,7 @@ func TestBboltCacheBasicOperations(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test.db")
 
-	c, err := newBboltCache(path)
+	c, err := newBboltCache(path, testLog)
 	if err != nil {
 		t.Fatalf("newBboltCache: %v", err)
 	}
@@ -83,7 +86,7 @@ func TestBboltCacheSurvivesRestart(t *testing.T) {
 	path := filepath.Join(dir, "persist.db")
 
 	// Write entries and close.
-	c1, err := newBboltCache(path)
+	c1, err := newBboltCache(path, testLog)
 	if err != nil {
 		t.Fatalf("open first instance: %v", err)
 	}
@@ -99,7 +102,7 @@ func TestBboltCacheSurvivesRestart(t *testing.T) {
 	}
 
 	// Reopen and verify entries survive.
-	c2, err := newBboltCache(path)
+	c2, err := newBboltCache(path, testLog)
 	if err != nil {
 		t.Fatalf("open second instance: %v", err)
 	}
@@ -131,3 +134,187 @@ func TestNewWithCacheFallback(t *testing.T) {
 		t.Error("anonymization failed with fallback cache")
 	}
 }
+
+// TestCacheLenCap verifies Len tracks resident entries and Cap reports the
+// eviction bound (-1 for unbounded) for every PersistentCache implementation.
+func TestCacheLenCap(t *testing.T) {
+	newBbolt := func(t *testing.T) PersistentCache {
+		c, err := newBboltCache(filepath.Join(t.TempDir(), "lencap.db"), testLog)
+		if err != nil {
+			t.Fatalf("newBboltCache: %v", err)
+		}
+		return c
+	}
+	tests := []struct {
+		name    string
+		cache   func(t *testing.T) PersistentCache
+		wantCap int
+		wantLen int // after 5 Sets
+	}{
+		{"memory", func(*testing.T) PersistentCache { return newMemoryCache() }, -1, 5},
+		{"bbolt", newBbolt, -1, 5},
+		{"s3fifo", func(t *testing.T) PersistentCache { return newS3FIFOCache(newBbolt(t), 3, 0, testLog) }, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cache(t)
+			defer func() { _ = c.Close() }() // test cleanup
+
+			if c.Len() != 0 {
+				t.Errorf("empty cache Len = %d, want 0", c.Len())
+			}
+			for i := range 5 {
+				c.Set(fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("[PII_EMAIL_%016x]", i))
+			}
+			if got := c.Len(); got != tt.wantLen {
+				t.Errorf("Len = %d, want %d", got, tt.wantLen)
+			}
+			if got := c.Cap(); got != tt.wantCap {
+				t.Errorf("Cap = %d, want %d", got, tt.wantCap)
+			}
+		})
+	}
+}
+
+// TestCacheHealth verifies the probe passes for a writable bbolt file and
+// reports degraded for a read-only one and for the in-memory fallback.
+func TestCacheHealth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "health.db")
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434", OllamaModel: "test-model",
+		OllamaMaxConcurrent: 1, CachePath: path, CacheCapacity: 10,
+	})
+	if err := a.CacheHealth(); err != nil {
+		t.Errorf("healthy cache: CacheHealth = %v", err)
+	}
+	if n := a.cache.Len(); n != 0 {
+		t.Errorf("probe left %d entries behind", n)
+	}
+	_ = a.Close() // release the file lock before reopening read-only
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("open read-only: %v", err)
+	}
+	ro := &bboltCache{db: db, log: testLog}
+	defer func() { _ = ro.Close() }() // test cleanup
+	if err := ro.Probe(); err == nil {
+		t.Error("read-only cache: expected probe error")
+	}
+
+	fallback := NewWithCache("http://localhost:11434", "test-model", false, 0.80, 1, nil, "/nonexistent/path/cache.db")
+	defer func() { _ = fallback.Close() }() // test cleanup
+	if err := fallback.CacheHealth(); err == nil {
+		t.Error("memory fallback: expected CacheHealth error")
+	}
+}
+
+func TestAnonymizerCacheStats(t *testing.T) {
+	a := newTestAnonymizer()
+	a.cache.Set("alice@example.com", "[PII_EMAIL_0123456789abcdef]")
+	entries, capacity := a.CacheStats()
+	if entries != 1 || capacity != -1 {
+		t.Errorf("CacheStats = (%d, %d), want (1, -1)", entries, capacity)
+	}
+}
+
+// TestCacheDeleteMany verifies batch deletion for every PersistentCache
+// implementation, including unknown keys and an empty batch.
+func TestCacheDeleteMany(t *testing.T) {
+	bb, err := newBboltCache(t.TempDir()+"/dm.db", testLog)
+	if err != nil {
+		t.Fatalf("newBboltCache: %v", err)
+	}
+	caches := map[string]PersistentCache{
+		"memory": newMemoryCache(),
+		"bbolt":  bb,
+		"s3fifo": newS3FIFOCache(newMemoryCache(), 10, 0, testLog),
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			defer func() { _ = c.Close() }()
+			c.Set("a", "1")
+			c.Set("b", "2")
+			c.Set("c", "3")
+			c.DeleteMany([]string{"a", "c", "missing"})
+			c.DeleteMany(nil)
+			if _, ok := c.Get("a"); ok {
+				t.Error("a should be deleted")
+			}
+			if _, ok := c.Get("b"); !ok {
+				t.Error("b should remain")
+			}
+			if c.Len() != 1 {
+				t.Errorf("Len = %d, want 1", c.Len())
+			}
+		})
+	}
+}
+
+// TestBboltSetManySingleTransaction verifies SetMany commits the whole batch
+// in one write transaction (the bbolt txid advances by exactly one) and that
+// every entry survives a reopen.
+func TestBboltSetManySingleTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setmany.db")
+	pc, err := newBboltCache(path, testLog)
+	if err != nil {
+		t.Fatalf("newBboltCache: %v", err)
+	}
+	c, ok := pc.(*bboltCache)
+	if !ok {
+		t.Fatal("newBboltCache did not return *bboltCache")
+	}
+	txid := func() int {
+		var id int
+		_ = c.db.View(func(tx *bolt.Tx) error { id = tx.ID(); return nil }) // View never fails here
+		return id
+	}
+
+	pairs := map[string]string{
+		"alice@example.com": "[PII_EMAIL_0000000000000001]",
+		"bob@example.com":   "[PII_EMAIL_0000000000000002]",
+		"carol@example.com": "[PII_EMAIL_0000000000000003]",
+	}
+	before := txid()
+	c.SetMany(pairs)
+	if got := txid() - before; got != 1 {
+		t.Errorf("SetMany used %d write transactions, want 1", got)
+	}
+	c.SetMany(nil) // empty batch must not open a transaction
+	if got := txid() - before; got != 1 {
+		t.Errorf("empty SetMany opened a transaction")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := newBboltCache(path, testLog)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = reopened.Close() }() // test cleanup
+	for k, want := range pairs {
+		if got, ok := reopened.Get(k); !ok || got != want {
+			t.Errorf("Get(%q) = %q, %v; want %q", k, got, ok, want)
+		}
+	}
+}
+
+// TestCacheSetMany verifies batch writes for memory and S3-FIFO caches.
+func TestCacheSetMany(t *testing.T) {
+	caches := map[string]PersistentCache{
+		"memory": newMemoryCache(),
+		"s3fifo": newS3FIFOCache(newMemoryCache(), 10, 0, testLog),
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			defer func() { _ = c.Close() }()
+			c.SetMany(map[string]string{"a": "1", "b": "2"})
+			for k, want := range map[string]string{"a": "1", "b": "2"} {
+				if got, ok := c.Get(k); !ok || got != want {
+					t.Errorf("Get(%q) = %q, %v; want %q", k, got, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package anonymizer — code_blocks.go
+//
+// Pasted code and prose carry different PII. A code snippet is where API keys
+// and connection strings turn up, while its digit runs are mostly line
+// numbers and constants that broad patterns such as phone numbers misread.
+// With Options.CodeBlockPacks set, text between ``` fences is scanned with
+// the pattern set loaded from those packs instead of EnabledPacks, so each
+// region can be masked more or less aggressively than the other.
+package anonymizer
+
+import "strings"
+
+// codeFence opens and closes a markdown fenced code block.
+const codeFence = "```"
+
+// anonymizeFenced splits text at code fences and anonymizes the prose
+// regions with prose and the code regions with a.codePatterns. Regions
+// alternate starting with prose; an unclosed fence runs to the end of the text, as markdown renders
+// it. The fences are kept as-is; an info string (```go) is scanned as part
+// of its code region.
+func (a *Anonymizer) anonymizeFenced(text, sessionID string, prose []pattern, repeats map[string]int) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for i, region := range strings.Split(text, codeFence) {
+		patterns := prose
+		if i%2 == 1 {
+			patterns = a.codePatterns
+		}
+		if i > 0 {
+			b.WriteString(codeFence)
+		}
+		b.WriteString(a.anonymizeRegion(region, sessionID, patterns, repeats))
+	}
+	return b.String()
+}
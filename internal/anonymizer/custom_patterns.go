@@ -0,0 +1,136 @@
+// Package anonymizer — custom_patterns.go
+//
+// Operators can detect identifiers no pack covers, such as employee IDs or
+// case numbers, with Options.CustomPatterns. Custom patterns run after every
+// pack pattern, without positional decay, and their matches become tokens in
+// the usual format under their own type name ([PII_EMPLOYEEID_<hash>]).
+//
+// A custom pattern that fails to compile, has an unusable type name, or
+// matches a token the proxy can emit is logged and skipped at construction
+// rather than failing startup. The last check keeps the proxy from
+// re-tokenizing its own output, the property TestTokenFormatNonRetriggering
+// guards for the built-in packs.
+package anonymizer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CustomPattern is one operator-defined detection pattern.
+type CustomPattern struct {
+	Name       string  // identifies the pattern in logs
+	Regex      string  // RE2 syntax; a (?P<value>...) group limits the replaced part
+	PIIType    string  // token type; defaults to Name upper-cased
+	Confidence float64 // 0 means customPatternConfidence
+}
+
+// customPatternConfidence is used when a custom pattern sets none. It is high
+// enough that matches are tokenized directly under the default AI threshold.
+const customPatternConfidence = 0.90
+
+// customPack is the pack name custom patterns report.
+const customPack = "CUSTOM"
+
+// customTypeRe is what preTokenRe accepts as a type label, so tokens of a
+// custom type are still recognised when a client sends them back.
+var customTypeRe = regexp.MustCompile(`^[A-Z0-9_]+$`)
+
+// sampleTokenHashes stand in for the hash part of a token when checking
+// whether a custom pattern matches tokens: digit-only, letter-only and mixed.
+var sampleTokenHashes = []string{"0123456789012345", "abcdefabcdefabcd", "1a2b3c4d5e6f7a8b"}
+
+// compileCustomPatterns turns opts.CustomPatterns into patterns, skipping
+// (with a log line) any that are invalid. existing are the pack patterns
+// already loaded: a custom pattern must not match their tokens either.
+func (a *Anonymizer) compileCustomPatterns(list []CustomPattern, existing []pattern, minConf float64) []pattern {
+	if len(list) == 0 {
+		return nil
+	}
+	compiled := make([]pattern, len(list))
+	errs := make([]error, len(list))
+	types := make(map[PIIType]bool)
+	for _, p := range existing {
+		types[p.piiType] = true
+	}
+	for i, cp := range list {
+		compiled[i], errs[i] = compileCustomPattern(cp)
+		if errs[i] == nil {
+			types[compiled[i].piiType] = true
+		}
+	}
+
+	var out []pattern
+	for i, p := range compiled {
+		err := errs[i]
+		if err == nil && p.confidence < minConf {
+			err = fmt.Errorf("confidence %.2f below minConfidence %.2f", p.confidence, minConf)
+		}
+		if err == nil {
+			if token, ok := matchesSampleToken(p, types); ok {
+				err = fmt.Errorf("matches the token %q and would re-tokenize proxy output", token)
+			}
+		}
+		if err != nil {
+			a.log.Warnf("config", "skipping custom pattern %q: %v", list[i].Name, err)
+			continue
+		}
+		out = append(out, p)
+	}
+	a.log.Infof("config", "loaded %d of %d custom patterns", len(out), len(list))
+	return out
+}
+
+// compileCustomPattern validates and compiles one custom pattern.
+func compileCustomPattern(cp CustomPattern) (pattern, error) {
+	name := strings.TrimSpace(cp.Name)
+	if name == "" {
+		return pattern{}, errors.New("name is required")
+	}
+	piiType := strings.ToUpper(strings.TrimSpace(cp.PIIType))
+	if piiType == "" {
+		piiType = strings.ToUpper(name)
+	}
+	if !customTypeRe.MatchString(piiType) {
+		return pattern{}, fmt.Errorf("type %q must contain only A-Z, 0-9 and _", piiType)
+	}
+	re, err := regexp.Compile(cp.Regex)
+	if err != nil {
+		return pattern{}, fmt.Errorf("invalid regex: %w", err)
+	}
+	if re.MatchString("") {
+		return pattern{}, errors.New("regex matches the empty string")
+	}
+	conf := cp.Confidence
+	if conf == 0 {
+		conf = customPatternConfidence
+	}
+	if conf < 0 || conf > 1 {
+		return pattern{}, fmt.Errorf("confidence %.2f outside [0, 1]", conf)
+	}
+	return pattern{
+		re:         re,
+		piiType:    PIIType(piiType),
+		confidence: conf,
+		pack:       customPack,
+		valueGroup: max(re.SubexpIndex("value"), 0),
+	}, nil
+}
+
+// matchesSampleToken reports whether p matches a built-in format token, plain
+// or indexed, of any of types, and returns the first such token.
+func matchesSampleToken(p pattern, types map[PIIType]bool) (string, bool) {
+	for t := range types {
+		for _, h := range sampleTokenHashes {
+			token := tokenPrefix + string(t) + "_" + h + "]"
+			for _, s := range []string{token, indexedToken(token, 2)} {
+				if p.re.MatchString(s) {
+					return s, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,83 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func newCustomPatternAnonymizer(custom ...CustomPattern) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://localhost:11434",
+		OllamaModel:         "test-model",
+		AIThreshold:         0.8,
+		OllamaMaxConcurrent: 1,
+		CustomPatterns:      custom,
+	})
+}
+
+// TestCustomPatternRoundTrip verifies a custom pattern tokenizes its matches
+// under its own type and that the tokens deanonymize back.
+func TestCustomPatternRoundTrip(t *testing.T) {
+	a := newCustomPatternAnonymizer(CustomPattern{Name: "employee_id", PIIType: "EMPLOYEEID", Regex: `\bEMP-\d{6}\b`})
+	const sessionID = "sess-custom-1"
+	original := "Escalate EMP-123456 and EMP-654321 to payroll"
+
+	anon := a.AnonymizeText(original, sessionID)
+	for _, id := range []string{"EMP-123456", "EMP-654321"} {
+		if strings.Contains(anon, id) {
+			t.Errorf("custom PII %q forwarded: %q", id, anon)
+		}
+	}
+	if want := a.replacement("EMPLOYEEID", "EMP-123456"); !strings.Contains(anon, want) {
+		t.Errorf("expected token %q in %q", want, anon)
+	}
+	if got := a.DeanonymizeText(anon, sessionID); got != original {
+		t.Errorf("round trip: got %q, want %q", got, original)
+	}
+}
+
+// TestCustomPatternValueGroup verifies a (?P<value>...) group limits the
+// replaced part of a custom match.
+func TestCustomPatternValueGroup(t *testing.T) {
+	a := newCustomPatternAnonymizer(CustomPattern{Name: "badge", Regex: `badge (?P<value>B\d{4})`})
+	anon := a.AnonymizeText("Visitor badge B7421 issued", "sess-custom-2")
+	want := "Visitor badge " + a.replacement("BADGE", "B7421") + " issued"
+	if anon != want {
+		t.Errorf("got %q, want %q", anon, want)
+	}
+}
+
+// TestCustomPatternsSkipped verifies that invalid custom patterns are left
+// out without affecting valid ones.
+func TestCustomPatternsSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		cp   CustomPattern
+	}{
+		{"invalid regex", CustomPattern{Name: "bad", Regex: `EMP-(\d{6}`}},
+		{"empty name", CustomPattern{Regex: `EMP-\d{6}`}},
+		{"bad type", CustomPattern{Name: "emp id", Regex: `EMP-\d{6}`}},
+		{"empty match", CustomPattern{Name: "empty", Regex: `\d*`}},
+		{"confidence out of range", CustomPattern{Name: "conf", Regex: `EMP-\d{6}`, Confidence: 1.5}},
+		{"matches tokens", CustomPattern{Name: "greedy", Regex: `PII_[A-Z]+`}},
+		{"matches hash", CustomPattern{Name: "hex", Regex: `[0-9a-f]{16}`}},
+	}
+	valid := CustomPattern{Name: "ticket", Regex: `\bTKT-\d{4}\b`}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newCustomPatternAnonymizer(tt.cp, valid)
+			var custom []pattern
+			for _, p := range a.patterns {
+				if p.pack == customPack {
+					custom = append(custom, p)
+				}
+			}
+			if len(custom) != 1 || custom[0].piiType != "TICKET" {
+				t.Fatalf("loaded custom patterns: got %d, want only TICKET", len(custom))
+			}
+			if anon := a.AnonymizeText("ref TKT-1234", "sess-custom-3"); strings.Contains(anon, "TKT-1234") {
+				t.Errorf("valid custom pattern not applied: %q", anon)
+			}
+		})
+	}
+}
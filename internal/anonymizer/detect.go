@@ -0,0 +1,82 @@
+// Package anonymizer — detect.go
+//
+// Detection without anonymization: the regex patterns run over a text as
+// they would in AnonymizeText, with the same filters, but nothing is recorded in a session, the
+// Ollama cache is not consulted and no metrics are counted. Shadow mode
+// uses it for its regex-only view, the scan command to report what a
+// configuration would mask in a corpus, and the proxy's dry run to count
+// what a request would have had masked.
+package anonymizer
+
+import "strings"
+
+// Detection is one regex match found by Detect.
+type Detection struct {
+	Type       PIIType
+	Value      string // the matched original; never log it
+	Confidence float64
+}
+
+// Detect runs the loaded (default profile) patterns over text and returns
+// the text with each match replaced by its token, along with the matches in
+// the order they were replaced. Matches are filtered as in AnonymizeText
+// (allowlist, type policies, hex identifiers, normalization); low-confidence
+// matches get their deterministic token, so the result is what the regex
+// patterns alone would mask.
+func (a *Anonymizer) Detect(text string) (redacted string, found []Detection) {
+	return a.detect(text, a.patterns)
+}
+
+// CountDetections scans a request body as AnonymizeJSON would, with the
+// named pattern profile, and returns the matches by type. Nothing is kept:
+// no session is opened and nothing reaches the shared SessionStore. Each
+// match is counted in TokensReplaced, standing in for the token it would
+// have been replaced with.
+func (a *Anonymizer) CountDetections(body []byte, profile string) map[PIIType]int {
+	patterns := a.profilePatterns(profile)
+	counts := make(map[PIIType]int)
+	scan := func(s string) string {
+		_, found := a.detect(s, patterns)
+		for _, d := range found {
+			counts[d.Type]++
+		}
+		return s
+	}
+	if _, ok := scanJSON(body, scan); !ok {
+		scan(string(body))
+	}
+	if a.m != nil {
+		for _, n := range counts {
+			a.m.TokensReplaced.Add(int64(n))
+		}
+	}
+	return counts
+}
+
+// detect applies patterns in order like AnonymizeText, replacing each
+// match before the next pattern runs, but records detections instead of
+// sessions.
+func (a *Anonymizer) detect(text string, patterns []pattern) (string, []Detection) {
+	var found []Detection
+	for _, p := range patterns {
+		matches := a.matches(p, text)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			found = append(found, Detection{p.piiType, m.value, p.confidence})
+			b.WriteString(text[last:m.start])
+			if a.policy(p.piiType) == PolicyRedact {
+				b.WriteString(redaction(p.piiType))
+			} else {
+				b.WriteString(a.replacement(p.piiType, m.value))
+			}
+			last = m.end
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+	return text, found
+}
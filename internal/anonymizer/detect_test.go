@@ -0,0 +1,68 @@
+package anonymizer
+
+import (
+	"testing"
+
+	"ai-anonymizing-proxy/internal/metrics"
+)
+
+// TestCountDetections verifies that counting a body's detections for a dry
+// run keeps nothing: no session is opened and no original reaches the
+// shared store.
+func TestCountDetections(t *testing.T) {
+	store := NewMemorySessionStore()
+	m := metrics.New()
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://127.0.0.1:1",
+		EnabledPacks:   []string{"GLOBAL"},
+		Metrics:        m,
+		SessionStore:   store,
+	})
+	defer func() { _ = a.Close() }()
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"Mail alice@example.com and bob@example.org"}]}`)
+	counts := a.CountDetections(body, DefaultProfile)
+	if counts[PIIEmail] != 2 || len(counts) != 1 {
+		t.Errorf("counts = %v, want EMAIL=2", counts)
+	}
+	if got := m.TokensReplaced.Load(); got != 2 {
+		t.Errorf("TokensReplaced = %d, want 2", got)
+	}
+	if n := a.ActiveSessions(); n != 0 {
+		t.Errorf("CountDetections opened %d sessions", n)
+	}
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if len(store.sessions) != 0 {
+		t.Errorf("CountDetections wrote to the session store: %v", store.sessions)
+	}
+
+	if got := a.CountDetections([]byte("not json: carol@example.net"), "no-such-profile"); got[PIIEmail] != 1 {
+		t.Errorf("plain-text body counts = %v, want EMAIL=1", got)
+	}
+}
+
+// TestDetectFilters verifies that Detect drops the matches AnonymizeText
+// would leave alone: digit runs inside a UUID, allowlisted values and types
+// on passthrough. A redacted type is reported with its redaction marker.
+func TestDetectFilters(t *testing.T) {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://127.0.0.1:1",
+		EnabledPacks:   []string{"GLOBAL", "US"},
+		Allowlist:      []string{"support@example.com"},
+		TypePolicies:   map[PIIType]Policy{PIIIPAddress: PolicyPassthrough, PIISSN: PolicyRedact},
+	})
+	defer func() { _ = a.Close() }()
+
+	const input = "trace 7f3a4c1e-555-867-5309 from 10.1.2.3, mail support@example.com, ssn 123-45-6789"
+	redacted, found := a.Detect(input)
+	if len(found) != 1 || found[0].Type != PIISSN {
+		t.Errorf("found = %v, want only the SSN", found)
+	}
+	if want := "trace 7f3a4c1e-555-867-5309 from 10.1.2.3, mail support@example.com, ssn [REDACTED_SSN]"; redacted != want {
+		t.Errorf("redacted = %q, want %q", redacted, want)
+	}
+	if got := a.AnonymizeText(input, "sess-detect-filters"); got != redacted {
+		t.Errorf("AnonymizeText = %q, Detect = %q", got, redacted)
+	}
+}
@@ -0,0 +1,102 @@
+// Package anonymizer — encrypt.go
+//
+// valueEncryptor keeps original PII values out of process memory and the
+// persistent cache in plaintext. When a session encryption key is configured:
+//   - the session map stores AES-GCM ciphertext (random nonce per value) and
+//     deanonymization decrypts on restore;
+//   - the Ollama value cache is keyed by an HMAC-SHA256 of the original, so the
+//     bbolt file never contains a PII value. Cache values are tokens already.
+//
+// Encryption is off by default. A nil *valueEncryptor is valid and passes
+// values through unchanged.
+package anonymizer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// DecodeEncryptionKey parses a base64-encoded AES key (16, 24 or 32 bytes).
+// An empty string returns a nil key, meaning encryption is disabled.
+func DecodeEncryptionKey(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("session encryption key is not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("session encryption key must decode to 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
+
+type valueEncryptor struct {
+	aead   cipher.AEAD
+	macKey []byte // derived from the AES key; used for cache keys only
+}
+
+// newValueEncryptor returns nil for an empty key.
+func newValueEncryptor(key []byte) (*valueEncryptor, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("init AES: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("init GCM: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("ai-anonymizing-proxy cache key"))
+	return &valueEncryptor{aead: aead, macKey: mac.Sum(nil)}, nil
+}
+
+// seal encrypts plaintext as nonce||ciphertext.
+func (e *valueEncryptor) seal(plaintext string) string {
+	if e == nil {
+		return plaintext
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	_, _ = rand.Read(nonce) // crypto/rand.Read never returns an error (Go 1.24+)
+	return string(e.aead.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+// open reverses seal.
+func (e *valueEncryptor) open(sealed string) (string, error) {
+	if e == nil {
+		return sealed, nil
+	}
+	n := e.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := e.aead.Open(nil, []byte(sealed[:n]), []byte(sealed[n:]), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// cacheKey maps an original value to the key used in the Ollama value cache.
+// Deterministic so repeat values still hit; not reversible.
+func (e *valueEncryptor) cacheKey(original string) string {
+	if e == nil {
+		return original
+	}
+	mac := hmac.New(sha256.New, e.macKey)
+	mac.Write([]byte(original))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))
+}
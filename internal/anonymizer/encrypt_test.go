@@ -0,0 +1,122 @@
+package anonymizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, 32)
+
+func newEncryptedTestAnonymizer(useAI bool) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://127.0.0.1:1",
+		OllamaModel:         "test-model",
+		UseAI:               useAI,
+		AIThreshold:         0.8,
+		OllamaMaxConcurrent: 1,
+		EncryptionKey:       testEncryptionKey,
+	})
+}
+
+func TestDecodeEncryptionKey(t *testing.T) {
+	if key, err := DecodeEncryptionKey(""); key != nil || err != nil {
+		t.Errorf("empty key: got %v, %v; want nil, nil", key, err)
+	}
+	for _, n := range []int{16, 24, 32} {
+		s := base64.StdEncoding.EncodeToString(make([]byte, n))
+		if key, err := DecodeEncryptionKey(s); err != nil || len(key) != n {
+			t.Errorf("%d-byte key: got len %d, err %v", n, len(key), err)
+		}
+	}
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString(make([]byte, 20))} {
+		if _, err := DecodeEncryptionKey(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// TestEncryptedSessionRoundTrip verifies that with a key configured the
+// session map never holds an original in plaintext while both buffered and
+// streaming deanonymization still restore it.
+func TestEncryptedSessionRoundTrip(t *testing.T) {
+	a := newEncryptedTestAnonymizer(false)
+	if a.enc == nil {
+		t.Fatal("encryption not enabled")
+	}
+	const sid = "sess-enc"
+	input := "Mail alice@example.com about SSN 123-45-6789"
+	result := a.AnonymizeText(input, sid)
+	if strings.Contains(result, "alice@example.com") {
+		t.Fatalf("email not anonymized: %q", result)
+	}
+
+	a.sessionMu.RLock()
+	stored := a.sessions[sid]
+	if len(stored) == 0 {
+		t.Error("no mappings recorded")
+	}
+	for token, v := range stored {
+		if strings.Contains(v, "alice") || strings.Contains(v, "123-45-6789") {
+			t.Errorf("session map holds plaintext for %s: %q", token, v)
+		}
+	}
+	a.sessionMu.RUnlock()
+
+	if got := a.DeanonymizeText(result, sid); got != input {
+		t.Errorf("DeanonymizeText = %q, want %q", got, input)
+	}
+
+	rc := a.StreamingDeanonymize(io.NopCloser(strings.NewReader(result)), sid, "unknown.example.com")
+	streamed, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if string(streamed) != input {
+		t.Errorf("StreamingDeanonymize = %q, want %q", streamed, input)
+	}
+}
+
+// TestEncryptedSessionTamperedValueNotRestored verifies a corrupted
+// ciphertext leaves the token in place instead of restoring garbage.
+func TestEncryptedSessionTamperedValueNotRestored(t *testing.T) {
+	a := newEncryptedTestAnonymizer(false)
+	const sid = "sess-tamper"
+	result := a.AnonymizeText("alice@example.com", sid)
+
+	a.sessionMu.Lock()
+	for token, v := range a.sessions[sid] {
+		b := []byte(v)
+		b[len(b)-1] ^= 0xff
+		a.sessions[sid][token] = string(b)
+	}
+	a.sessionMu.Unlock()
+
+	if got := a.DeanonymizeText(result, sid); got != result {
+		t.Errorf("tampered mapping restored: %q", got)
+	}
+}
+
+// TestEncryptedCacheKeyedByHMAC verifies the Ollama cache is looked up by a
+// keyed hash rather than the plaintext value.
+func TestEncryptedCacheKeyedByHMAC(t *testing.T) {
+	a := newEncryptedTestAnonymizer(true)
+	const original = "555-867-5309"
+
+	key := a.enc.cacheKey(original)
+	if strings.Contains(key, original) || key != a.enc.cacheKey(original) {
+		t.Fatalf("cache key must be deterministic and opaque, got %q", key)
+	}
+
+	cachedToken := "[PII_PHONE_00000000000000aa]"
+	a.cache.Set(key, cachedToken)
+	p := pattern{piiType: PIIPhone, confidence: 0.1}
+	if got := a.tokenForMatch(p, original); got != cachedToken {
+		t.Errorf("tokenForMatch = %q, want cached %q", got, cachedToken)
+	}
+	if _, hit := a.cache.Get(original); hit {
+		t.Error("cache must not contain the plaintext value as a key")
+	}
+}
@@ -0,0 +1,166 @@
+// Package anonymizer — fidelity.go
+//
+// Token fidelity measures how well upstream models honor the injected token
+// instruction: for each deanonymized response, the fraction of the tokens
+// issued for the request that came back intact. A model that paraphrases,
+// truncates or drops tokens leaves its PII unrestorable, and a falling
+// tokenFidelity metric is the first sign of it.
+//
+// The extreme case is a response with none of its tokens: the model has
+// usually written realistic-looking invented values in their place, and the
+// client would receive fabricated PII with nothing to mark it. Such
+// responses are logged and counted as tokenStripped, and a buffered one can
+// carry a configurable notice at the start of the reply text.
+package anonymizer
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// tokenReplacer restores originals like strings.Replacer and remembers which
+// session tokens passed through it. A stream is deanonymized by a single
+// goroutine, so seen needs no lock.
+type tokenReplacer struct {
+	r      *strings.Replacer
+	tokens []string
+	seen   map[string]bool
+}
+
+func newTokenReplacer(tokenMap map[string]string) *tokenReplacer {
+	pairs := make([]string, 0, len(tokenMap)*2)
+	tokens := make([]string, 0, len(tokenMap))
+	for token, original := range tokenMap {
+		pairs = append(pairs, token, original)
+		tokens = append(tokens, token)
+	}
+	return &tokenReplacer{
+		r:      strings.NewReplacer(pairs...),
+		tokens: tokens,
+		seen:   make(map[string]bool, len(tokens)),
+	}
+}
+
+// Replace implements textReplacer.
+func (t *tokenReplacer) Replace(s string) string {
+	if strings.IndexByte(s, '[') >= 0 {
+		for _, token := range t.tokens {
+			if !t.seen[token] && strings.Contains(s, token) {
+				t.seen[token] = true
+			}
+		}
+	}
+	return t.r.Replace(s)
+}
+
+// found returns how many distinct tokens have been seen so far.
+func (t *tokenReplacer) found() int { return len(t.seen) }
+
+// countTokens returns how many of the tokens in tokenMap occur in text.
+func countTokens(text string, tokenMap map[string]string) int {
+	n := 0
+	for token := range tokenMap {
+		if strings.Contains(text, token) {
+			n++
+		}
+	}
+	return n
+}
+
+// DeanonymizeResponse is DeanonymizeText for a successful buffered upstream
+// response. It also records the response's token fidelity and, when the
+// response contains none of the request's tokens, prepends the configured
+// stripped-token notice to the reply text. Error responses should go through
+// DeanonymizeText: they never echo tokens and would skew the metrics.
+func (a *Anonymizer) DeanonymizeResponse(body, sessionID string) string {
+	result, found, total := a.deanonymize(body, sessionID)
+	if a.checkFidelity(found, total, sessionID) && a.strippedNotice != "" {
+		result = a.prependNotice(result, a.strippedNotice)
+	}
+	return result
+}
+
+// checkFidelity records one response's token fidelity and reports whether it
+// was stripped: its request had tokens and none of them came back.
+func (a *Anonymizer) checkFidelity(found, total int, sessionID string) bool {
+	if a.m != nil {
+		a.m.RecordTokenFidelity(found, total)
+	}
+	if total == 0 || found > 0 {
+		return false
+	}
+	a.log.Warnf("token_fidelity", "response for session %s contains none of its %d tokens; the model may have replaced them with invented values", sessionID, total)
+	if a.m != nil {
+		a.m.TokenStripped.Add(1)
+	}
+	return true
+}
+
+// replyTextPaths lists where known providers put the model's reply text in a
+// buffered JSON response, tried in order. Integers index arrays; the last
+// step is always an object key holding a string.
+var replyTextPaths = [][]any{
+	{"choices", 0, "message", "content"},             // OpenAI chat completions and compatibles
+	{"choices", 0, "text"},                           // OpenAI legacy completions
+	{"candidates", 0, "content", "parts", 0, "text"}, // Gemini
+	{"content", 0, "text"},                           // Anthropic messages
+	{"message", "content", 0, "text"},                // Cohere v2 chat
+	{"text"},                                         // Cohere v1 chat
+}
+
+// prependNotice puts notice and a blank line in front of the reply text of
+// body. A JSON body is edited at the first matching replyTextPaths entry
+// (and returned unchanged if none matches); any other body is treated as
+// plain text.
+func (a *Anonymizer) prependNotice(body, notice string) string {
+	prefix := notice + "\n\n"
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return prefix + body
+	}
+	for _, path := range replyTextPaths {
+		if prependAt(doc, path, prefix) {
+			var b strings.Builder
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(doc); err != nil {
+				return body
+			}
+			return strings.TrimSuffix(b.String(), "\n")
+		}
+	}
+	a.log.Warn("token_fidelity", "stripped-token notice not added: no reply text field in response")
+	return body
+}
+
+// prependAt walks path from v and, if it leads to a string, prefixes it in
+// place. Reports whether it did.
+func prependAt(v any, path []any, prefix string) bool {
+	for i, step := range path {
+		switch k := step.(type) {
+		case int:
+			arr, ok := v.([]any)
+			if !ok || k >= len(arr) {
+				return false
+			}
+			v = arr[k]
+		case string:
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return false
+			}
+			if i == len(path)-1 {
+				s, ok := obj[k].(string)
+				if !ok {
+					return false
+				}
+				obj[k] = prefix + s
+				return true
+			}
+			v = obj[k]
+		}
+	}
+	return false
+}
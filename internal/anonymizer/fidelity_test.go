@@ -0,0 +1,107 @@
+package anonymizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ai-anonymizing-proxy/internal/metrics"
+)
+
+const strippedNotice = "[Notice: personal data in this reply may be invented]"
+
+func newStrippedAnonymizer(m *metrics.Metrics, notice string) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://localhost:11434",
+		AIThreshold:         0.8,
+		EnabledPacks:        []string{"GLOBAL"},
+		Metrics:             m,
+		TokenStrippedNotice: notice,
+	})
+}
+
+// TestDeanonymizeResponseStripped verifies that a response containing none of
+// the request's tokens is counted and, when configured, carries the notice.
+func TestDeanonymizeResponseStripped(t *testing.T) {
+	m := metrics.New()
+	a := newStrippedAnonymizer(m, strippedNotice)
+	const sessionID = "sess-stripped"
+	a.AnonymizeText("Contact alice@example.com", sessionID)
+
+	body := `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Contact jane.doe@example.org."}}]}`
+	out := a.DeanonymizeResponse(body, sessionID)
+
+	if got := m.Snapshot().PIITokens.TokenStripped; got != 1 {
+		t.Errorf("TokenStripped = %d, want 1", got)
+	}
+	var doc struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("response no longer valid JSON: %v\n%s", err, out)
+	}
+	want := strippedNotice + "\n\nContact jane.doe@example.org."
+	if len(doc.Choices) != 1 || doc.Choices[0].Message.Content != want {
+		t.Errorf("content = %q, want %q", doc.Choices[0].Message.Content, want)
+	}
+}
+
+// TestDeanonymizeResponseStrippedNoNotice verifies the metric is recorded and
+// the body left alone when no notice is configured.
+func TestDeanonymizeResponseStrippedNoNotice(t *testing.T) {
+	m := metrics.New()
+	a := newStrippedAnonymizer(m, "")
+	a.AnonymizeText("Contact alice@example.com", "sess-stripped-quiet")
+
+	body := `{"content":[{"type":"text","text":"Contact jane.doe@example.org."}]}`
+	if out := a.DeanonymizeResponse(body, "sess-stripped-quiet"); out != body {
+		t.Errorf("body changed without a notice configured: %s", out)
+	}
+	if got := m.Snapshot().PIITokens.TokenStripped; got != 1 {
+		t.Errorf("TokenStripped = %d, want 1", got)
+	}
+}
+
+// TestDeanonymizeResponseNotStripped verifies that a response reproducing at
+// least one token, or whose request had none, is not flagged.
+func TestDeanonymizeResponseNotStripped(t *testing.T) {
+	m := metrics.New()
+	a := newStrippedAnonymizer(m, strippedNotice)
+	a.AnonymizeText("alice@example.com and bob@example.com", "sess-kept")
+	alice := a.replacement(PIIEmail, "alice@example.com")
+
+	if out := a.DeanonymizeResponse("Reply to "+alice, "sess-kept"); out != "Reply to alice@example.com" {
+		t.Errorf("out = %q", out)
+	}
+	if out := a.DeanonymizeResponse("no tokens were issued", "sess-none"); out != "no tokens were issued" {
+		t.Errorf("out = %q", out)
+	}
+	if got := m.Snapshot().PIITokens.TokenStripped; got != 0 {
+		t.Errorf("TokenStripped = %d, want 0", got)
+	}
+}
+
+func TestPrependNotice(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{"anthropic", `{"content":[{"type":"text","text":"Hi"}],"usage":{"input_tokens":12}}`,
+			`{"content":[{"text":"N\n\nHi","type":"text"}],"usage":{"input_tokens":12}}`},
+		{"gemini", `{"candidates":[{"content":{"parts":[{"text":"Hi"}]}}]}`,
+			`{"candidates":[{"content":{"parts":[{"text":"N\n\nHi"}]}}]}`},
+		{"cohere v2", `{"message":{"content":[{"type":"text","text":"Hi"}]}}`,
+			`{"message":{"content":[{"text":"N\n\nHi","type":"text"}]}}`},
+		{"plain text", "Hi", "N\n\nHi"},
+		{"no reply field", `{"result":"Hi"}`, `{"result":"Hi"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newTestAnonymizer().prependNotice(tc.body, "N"); got != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package anonymizer
 import (
 	"strings"
 	"testing"
+
+	"ai-anonymizing-proxy/internal/metrics"
 )
 
 // TestHEALTHCAREPackPipeline verifies that HEALTHCARE pack patterns detect and
@@ -159,3 +161,33 @@ func TestHEALTHCAREMRNCrossPatternSSN(t *testing.T) {
 	}
 	a.DeleteSession("sess-cross-mrn")
 }
+
+// TestHEALTHCARECustomMRNPrefix verifies that a configured MRN prefix is
+// tokenized as MRN and, being below the AI threshold, takes the
+// Ollama-confirmed path, while the same digits without the prefix and a
+// bare ICD-10-shaped code without context are left alone.
+func TestHEALTHCARECustomMRNPrefix(t *testing.T) {
+	m := metrics.New()
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://127.0.0.1:1",
+		UseAI:          true,
+		AIThreshold:    0.7,
+		Metrics:        m,
+		EnabledPacks:   []string{"HEALTHCARE"},
+		MRNPrefixes:    []string{"CHART"},
+	})
+
+	out := a.AnonymizeText("Patient CHART-7654321, diagnosis E11.9, ref 7654321 room B12", "sess-mrn")
+	if strings.Contains(out, "CHART-7654321") || !strings.Contains(out, "[PII_MRN_") {
+		t.Errorf("custom-prefix MRN not tokenized: %q", out)
+	}
+	if strings.Contains(out, "E11.9") || !strings.Contains(out, "[PII_ICD10_") {
+		t.Errorf("ICD-10 code not tokenized: %q", out)
+	}
+	if !strings.Contains(out, "ref 7654321 room B12") {
+		t.Errorf("control text should be unchanged: %q", out)
+	}
+	if d := m.Snapshot().PIITokens.Detections["MRN"]; d.Fallback != 1 {
+		t.Errorf("custom MRN detection = %+v, want the low-confidence fallback path", d)
+	}
+}
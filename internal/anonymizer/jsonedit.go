@@ -0,0 +1,291 @@
+// Package anonymizer — jsonedit.go
+//
+// jsonEditor rewrites the string values of a JSON document in place. It scans
+// the raw bytes once, hands each string value (never an object key) to the
+// anonymizer, and splices the replacement over the original literal. Every
+// other byte — numbers, whitespace, key order, escapes in untouched strings —
+// is copied through unchanged, so a body without PII leaves byte-for-byte.
+// This is the PreserveJSONFormat path of AnonymizeJSON, for APIs that sign or
+// hash the request body and reject a decode/re-encode round trip.
+//
+// The PII instruction is spliced in the same way, at anchors recorded during
+// the scan: the top-level "system" value, the top-level "messages" array, and
+// each message's "role" and "content".
+package anonymizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type jsonSpan struct{ start, end int } // byte range in src; end == 0 means absent
+
+type jsonEdit struct {
+	start, end int    // range of src replaced; start == end for an insertion
+	text       []byte // replacement bytes
+}
+
+type jsonMessage struct {
+	span    jsonSpan // the whole message object
+	role    string
+	content jsonSpan
+}
+
+type jsonEditor struct {
+	src     []byte
+	pos     int
+	rewrite func(string) string
+	edits   []jsonEdit
+	values  map[int]string // rewritten string values by literal start offset
+
+	// Injection anchors; only recorded when the document is an object.
+	model    string
+	system   jsonSpan
+	messages jsonSpan
+	msgs     []jsonMessage
+}
+
+// scanJSON walks src, passing every string value that is not under a
+// structuralFields key through rewrite. ok is false if src is not valid JSON.
+func scanJSON(src []byte, rewrite func(string) string) (e *jsonEditor, ok bool) {
+	if !json.Valid(src) {
+		return nil, false
+	}
+	e = &jsonEditor{src: src, rewrite: rewrite, values: make(map[int]string)}
+	e.value(0, "", false)
+	return e, true
+}
+
+// The scanner below relies on scanJSON having validated src, so it does not
+// bounds-check or report syntax errors.
+
+func (e *jsonEditor) value(depth int, key string, skip bool) jsonSpan {
+	e.skipSpace()
+	start := e.pos
+	switch e.src[e.pos] {
+	case '{':
+		e.object(depth, skip, nil)
+	case '[':
+		e.array(depth, key, skip)
+	case '"':
+		e.stringLit()
+		if !skip {
+			e.rewriteString(jsonSpan{start, e.pos})
+		}
+	default: // number, true, false, null
+		for e.pos < len(e.src) && strings.IndexByte(",}] \t\r\n", e.src[e.pos]) < 0 {
+			e.pos++
+		}
+	}
+	return jsonSpan{start, e.pos}
+}
+
+// object scans an object. msg is non-nil for elements of the top-level
+// "messages" array so their role and content can be recorded.
+func (e *jsonEditor) object(depth int, skip bool, msg *jsonMessage) {
+	e.pos++ // '{'
+	for {
+		e.skipSpace()
+		switch e.src[e.pos] {
+		case '}':
+			e.pos++
+			return
+		case ',':
+			e.pos++
+			e.skipSpace()
+		}
+		keyStart := e.pos
+		e.stringLit()
+		key := e.decodeString(jsonSpan{keyStart, e.pos})
+		e.skipSpace()
+		e.pos++ // ':'
+		v := e.value(depth+1, key, skip || structuralFields[key])
+
+		isString := e.src[v.start] == '"'
+		switch {
+		case depth == 0 && key == "model" && isString:
+			e.model = e.decodeString(v)
+		case depth == 0 && key == "system":
+			e.system = v
+		case depth == 0 && key == "messages" && e.src[v.start] == '[':
+			e.messages = v
+		case msg != nil && key == "role" && isString:
+			msg.role = e.decodeString(v)
+		case msg != nil && key == "content":
+			msg.content = v
+		}
+	}
+}
+
+func (e *jsonEditor) array(depth int, key string, skip bool) {
+	e.pos++ // '['
+	isMessages := depth == 1 && key == "messages"
+	for {
+		e.skipSpace()
+		switch e.src[e.pos] {
+		case ']':
+			e.pos++
+			return
+		case ',':
+			e.pos++
+			e.skipSpace()
+		}
+		if isMessages && e.src[e.pos] == '{' {
+			m := jsonMessage{span: jsonSpan{start: e.pos}}
+			e.object(depth+1, skip, &m)
+			m.span.end = e.pos
+			e.msgs = append(e.msgs, m)
+			continue
+		}
+		e.value(depth+1, "", skip)
+	}
+}
+
+func (e *jsonEditor) stringLit() {
+	e.pos++ // opening quote
+	for e.src[e.pos] != '"' {
+		if e.src[e.pos] == '\\' {
+			e.pos++
+		}
+		e.pos++
+	}
+	e.pos++
+}
+
+func (e *jsonEditor) skipSpace() {
+	for e.pos < len(e.src) {
+		switch e.src[e.pos] {
+		case ' ', '\t', '\r', '\n':
+			e.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (e *jsonEditor) decodeString(s jsonSpan) string {
+	var out string
+	_ = json.Unmarshal(e.src[s.start:s.end], &out) // validated by scanJSON
+	return out
+}
+
+func (e *jsonEditor) rewriteString(s jsonSpan) {
+	orig := e.decodeString(s)
+	if out := e.rewrite(orig); out != orig {
+		e.setString(s, out)
+	}
+}
+
+// stringValue returns the current (possibly rewritten) value of a string literal.
+func (e *jsonEditor) stringValue(s jsonSpan) string {
+	if v, ok := e.values[s.start]; ok {
+		return v
+	}
+	return e.decodeString(s)
+}
+
+// setString replaces the string literal at s, superseding any earlier edit of it.
+func (e *jsonEditor) setString(s jsonSpan, value string) {
+	e.values[s.start] = value
+	for i := range e.edits {
+		if e.edits[i].start == s.start && e.edits[i].end == s.end {
+			e.edits[i].text = encodeJSONString(value)
+			return
+		}
+	}
+	e.edits = append(e.edits, jsonEdit{s.start, s.end, encodeJSONString(value)})
+}
+
+func (e *jsonEditor) insert(at int, text string) {
+	e.edits = append(e.edits, jsonEdit{at, at, []byte(text)})
+}
+
+// isEmpty reports whether the array or object at s has no elements.
+func (e *jsonEditor) isEmpty(s jsonSpan) bool {
+	return len(bytes.TrimSpace(e.src[s.start+1:s.end-1])) == 0
+}
+
+// injectInstruction is the in-place counterpart of injectPIIInstruction and
+// follows the same precedence: Anthropic "system", then the first OpenAI
+// system message, else a new system message is prepended. separate has the
+// meaning of Options.SeparateInstruction.
+func (e *jsonEditor) injectInstruction(instruction string, separate bool) {
+	if instruction == "" {
+		return
+	}
+	block := `{"type":"text","text":` + string(encodeJSONString(instruction)) + `}`
+	if e.system.end > 0 {
+		switch e.src[e.system.start] {
+		case '"':
+			if separate && e.stringValue(e.system) != "" {
+				// Wrap the (possibly rewritten) literal as the first block.
+				e.insert(e.system.start, `[{"type":"text","text":`)
+				e.insert(e.system.end, `},`+block+`]`)
+				return
+			}
+			e.setString(e.system, appendInstruction(e.stringValue(e.system), instruction))
+			return
+		case '[':
+			if !e.isEmpty(e.system) {
+				block = "," + block
+			}
+			e.insert(e.system.end-1, block)
+			return
+		}
+	}
+	if e.messages.end == 0 {
+		return
+	}
+	msg := `{"role":"system","content":` + string(encodeJSONString(instruction)) + `}`
+	for _, m := range e.msgs {
+		if m.role == "system" {
+			if separate {
+				e.insert(m.span.end, ","+msg)
+				return
+			}
+			if m.content.end > 0 && e.src[m.content.start] == '"' {
+				e.setString(m.content, appendInstruction(e.stringValue(m.content), instruction))
+			}
+			return
+		}
+	}
+	if !e.isEmpty(e.messages) {
+		msg += ","
+	}
+	e.insert(e.messages.start+1, msg)
+}
+
+// result returns src with all edits applied.
+func (e *jsonEditor) result() []byte {
+	if len(e.edits) == 0 {
+		return e.src
+	}
+	// Insertions sort before a replacement starting at the same offset.
+	sort.SliceStable(e.edits, func(i, j int) bool {
+		if e.edits[i].start != e.edits[j].start {
+			return e.edits[i].start < e.edits[j].start
+		}
+		return e.edits[i].end < e.edits[j].end
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, ed := range e.edits {
+		buf.Write(e.src[last:ed.start])
+		buf.Write(ed.text)
+		last = ed.end
+	}
+	buf.Write(e.src[last:])
+	return buf.Bytes()
+}
+
+// encodeJSONString quotes s as a JSON string literal. HTML characters are
+// left unescaped so rewritten values stay as close to the source as possible.
+func encodeJSONString(s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // encoding a string cannot fail
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
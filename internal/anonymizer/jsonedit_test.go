@@ -0,0 +1,147 @@
+package anonymizer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newPreserveJSONTestAnonymizer() *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://127.0.0.1:1",
+		OllamaModel:         "test-model",
+		OllamaMaxConcurrent: 1,
+		PreserveJSONFormat:  true,
+	})
+}
+
+// TestAnonymizeJSONPreserveFormatNoPII verifies numbers keep their literal
+// form and keys their order when nothing is anonymized.
+func TestAnonymizeJSONPreserveFormatNoPII(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	body := `{"model":"gpt-4o","temperature":1.0,"max_tokens":1024,"seed":12345678901234567890,` +
+		`"z":{"b":2.50,"a":1e3},"messages":[{"role":"user","content":"hello"}],"stream":false,"stop":null}`
+	got := string(a.AnonymizeJSON([]byte(body), "sess-nopii"))
+	if got != body {
+		t.Errorf("body changed:\n got %s\nwant %s", got, body)
+	}
+}
+
+// TestAnonymizeJSONPreserveFormatWithPII verifies PII is still replaced and
+// the injected instruction is added without reordering the client's keys.
+func TestAnonymizeJSONPreserveFormatWithPII(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	body := `{"model":"claude-x","messages":[{"role":"user","content":"mail alice@example.com"}],"max_tokens":1.0}`
+	got := string(a.AnonymizeJSON([]byte(body), "sess-pii"))
+	if strings.Contains(got, "alice@example.com") {
+		t.Fatalf("email not anonymized: %s", got)
+	}
+	if !strings.HasPrefix(got, `{"model":"claude-x","messages":[`) ||
+		!strings.Contains(got, `{"role":"user","content":"mail [PII_EMAIL_`) {
+		t.Errorf("key order not preserved: %s", got)
+	}
+	if !strings.HasSuffix(got, `],"max_tokens":1.0}`) {
+		t.Errorf("number literal or trailing key order changed: %s", got)
+	}
+}
+
+// TestAnonymizeJSONPreserveFormatByteIdentical verifies a body with odd
+// whitespace, escapes and number forms survives unchanged when it has no PII.
+func TestAnonymizeJSONPreserveFormatByteIdentical(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	body := "{\n  \"model\" : \"gpt-4o\",\n\t\"temperature\": 0.70,\n  \"messages\": [ {\"role\":\"user\", " +
+		"\"content\": \"caf\\u00e9 \\\"quoted\\\" <b>\"} ],\n  \"n\": -0, \"x\": [1E+2, true, null] }\n"
+	if got := string(a.AnonymizeJSON([]byte(body), "sess-bytes")); got != body {
+		t.Errorf("body changed:\n got %q\nwant %q", got, body)
+	}
+}
+
+// TestAnonymizeJSONPreserveFormatEditsOnlyPIIStrings verifies PII strings are
+// rewritten while every byte outside them, including the instruction
+// anchors' neighbours, is left as sent.
+func TestAnonymizeJSONPreserveFormatEditsOnlyPIIStrings(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	body := "{ \"system\" : \"Be brief.\" ,\n  \"messages\": [\n    {\"role\": \"user\", \"content\": \"mail alice@example.com\"}\n  ],\n  \"max_tokens\": 1.0 }"
+	got := string(a.AnonymizeJSON([]byte(body), "sess-edit"))
+
+	token := a.replacement(PIIEmail, "alice@example.com")
+	want := strings.Replace(body, "alice@example.com", token, 1)
+	want = strings.Replace(want, `"Be brief."`, string(encodeJSONString(appendInstruction("Be brief.", defaultPIIInstruction))), 1)
+	if got != want {
+		t.Errorf("unexpected rewrite:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestAnonymizeJSONPreserveFormatInjection(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{"system blocks", `{"system":[{"type":"text","text":"x"}],"messages":[{"role":"user","content":"alice@example.com"}]}`,
+			`{"system":[{"type":"text","text":"x"},{"type":"text","text":`},
+		{"empty system blocks", `{"system":[],"messages":[{"role":"user","content":"alice@example.com"}]}`,
+			`{"system":[{"type":"text","text":`},
+		{"openai system message", `{"messages":[{"content":"Be helpful.","role":"system"},{"role":"user","content":"alice@example.com"}]}`,
+			`{"messages":[{"content":"Be helpful.\n\nPRIVACY TOKENS`},
+		{"no system message", `{"messages":[{"role":"user","content":"alice@example.com"}]}`,
+			`{"messages":[{"role":"system","content":"PRIVACY TOKENS`},
+		{"pii in system prompt", `{"system":"mail alice@example.com","messages":[]}`,
+			`{"system":"mail [PII_EMAIL_`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newPreserveJSONTestAnonymizer()
+			got := a.AnonymizeJSON([]byte(tc.body), "sess-inject")
+			if !strings.HasPrefix(string(got), tc.want) {
+				t.Errorf("got %s\nwant prefix %s", got, tc.want)
+			}
+			if strings.Contains(string(got), "alice@example.com") {
+				t.Errorf("email not anonymized: %s", got)
+			}
+			if !json.Valid(got) {
+				t.Errorf("output is not valid JSON: %s", got)
+			}
+		})
+	}
+}
+
+func TestAnonymizeJSONPreserveFormatSeparateInstruction(t *testing.T) {
+	block := `{"type":"text","text":` + string(encodeJSONString(defaultPIIInstruction)) + `}`
+	msg := `{"role":"system","content":` + string(encodeJSONString(defaultPIIInstruction)) + `}`
+	cases := []struct {
+		name, body, want string
+	}{
+		{"system string", `{"system": "Be brief.", "messages":[]}`,
+			`{"system": [{"type":"text","text":"Be brief."},` + block + `], "messages":[]}`},
+		{"pii in system string", `{"system":"mail alice@example.com"}`,
+			`{"system":[{"type":"text","text":"mail [PII_EMAIL_`},
+		{"system blocks", `{"system":[{"type":"text","text":"x"}]}`,
+			`{"system":[{"type":"text","text":"x"},` + block + `]}`},
+		{"openai system message", `{"messages":[{"role":"system","content":"Be helpful."}, {"role":"user","content":"hi"}]}`,
+			`{"messages":[{"role":"system","content":"Be helpful."},` + msg + `, {"role":"user","content":"hi"}]}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newPreserveJSONTestAnonymizer()
+			a.separateInst = true
+			// Every body needs a token for the instruction to be injected.
+			a.AnonymizeText("alice@example.com", "sess-separate")
+			got := string(a.AnonymizeJSON([]byte(tc.body), "sess-separate"))
+			if !strings.HasPrefix(got, tc.want) {
+				t.Errorf("got %s\nwant prefix %s", got, tc.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("output is not valid JSON: %s", got)
+			}
+		})
+	}
+}
+
+// TestAnonymizeJSONPreserveFormatInvalidFallsBackToText verifies non-JSON
+// input is still scanned as plain text.
+func TestAnonymizeJSONPreserveFormatInvalidFallsBackToText(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	got := string(a.AnonymizeJSON([]byte(`{"a":1} alice@example.com`), "sess-invalid"))
+	if strings.Contains(got, "alice@example.com") {
+		t.Errorf("email not anonymized in non-JSON body: %q", got)
+	}
+}
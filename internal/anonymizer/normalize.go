@@ -0,0 +1,73 @@
+// Package anonymizer — normalize.go
+//
+// The patterns are written for ASCII digits and punctuation, so a phone
+// number typed in full-width digits (５５５-８６７-５３０９), or a value with
+// ligatures or superscripts, slips past them. With Options.NormalizeUnicode
+// each pattern runs over the NFKC form of the text instead, and every match
+// is mapped back to the byte range of the original text it came from. That
+// range, in its original form, is what gets tokenized and recorded, so the
+// response path restores exactly what the client sent.
+//
+// NFKC folds compatibility characters only. Look-alike letters from other
+// scripts (Cyrillic а for Latin a) are distinct characters and stay as they
+// are.
+package anonymizer
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normView is the NFKC form of a text together with, for each byte of it,
+// the byte range of the original text its normalization segment came from.
+type normView struct {
+	norm     string
+	origFrom []int
+	origTo   []int
+}
+
+// newNormView returns the NFKC view of s, or nil if s is already in NFKC
+// form and can be matched as is.
+func newNormView(s string) *normView {
+	if norm.NFKC.IsNormalString(s) {
+		return nil
+	}
+	v := &normView{origFrom: make([]int, 0, len(s)), origTo: make([]int, 0, len(s))}
+	var b strings.Builder
+	var it norm.Iter
+	it.InitString(norm.NFKC, s)
+	// The iterator hands out a multi-rune expansion (ﬁ → f, i) one rune at
+	// a time, advancing Pos only after the last; the bytes emitted in the
+	// meantime all come from the same original range.
+	from, pending := 0, 0
+	for !it.Done() {
+		seg := it.Next()
+		b.Write(seg)
+		pending += len(seg)
+		pos := it.Pos()
+		if pos == from {
+			continue
+		}
+		v.mapBytes(pending, from, pos)
+		from, pending = pos, 0
+	}
+	v.mapBytes(pending, from, len(s))
+	v.norm = b.String()
+	return v
+}
+
+// mapBytes records n normalized bytes as coming from s[from:to].
+func (v *normView) mapBytes(n, from, to int) {
+	for range n {
+		v.origFrom = append(v.origFrom, from)
+		v.origTo = append(v.origTo, to)
+	}
+}
+
+// orig maps the non-empty range [start, end) of the normalized text to the
+// original text. A range that begins or ends inside the expansion of one
+// original character (a ligature, say) is widened to cover that character.
+func (v *normView) orig(start, end int) (int, int) {
+	return v.origFrom[start], v.origTo[end-1]
+}
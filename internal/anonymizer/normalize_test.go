@@ -0,0 +1,69 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func newNormalizingAnonymizer(normalize bool) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:   "http://localhost:11434",
+		OllamaModel:      "test-model",
+		AIThreshold:      0.8,
+		NormalizeUnicode: normalize,
+	})
+}
+
+// TestNormalizeUnicodeFullWidthPhone detects a phone number written in
+// full-width digits and restores it in its original form.
+func TestNormalizeUnicodeFullWidthPhone(t *testing.T) {
+	a := newNormalizingAnonymizer(true)
+	const sessionID = "sess-nfkc-phone"
+	input := "call ５５５-８６７-５３０９ now, or 555-867-5309"
+
+	anon := a.AnonymizeText(input, sessionID)
+	if strings.Contains(anon, "５５５") || strings.Contains(anon, "555") {
+		t.Fatalf("phone numbers not anonymized: %q", anon)
+	}
+	if !strings.HasPrefix(anon, "call [PII_PHONE_") || !strings.HasSuffix(anon, "] now, or "+a.replacement(PIIPhone, "555-867-5309")) {
+		t.Fatalf("unexpected anonymization: %q", anon)
+	}
+	if got := a.DeanonymizeText(anon, sessionID); got != input {
+		t.Errorf("round trip = %q, want %q", got, input)
+	}
+	mappings, _ := a.SessionMappings(sessionID)
+	if mappings[a.replacement(PIIPhone, "５５５-８６７-５３０９")] != "５５５-８６７-５３０９" {
+		t.Errorf("full-width original not recorded as sent: %v", mappings)
+	}
+}
+
+// TestNormalizeUnicodeOff leaves full-width digits alone by default.
+func TestNormalizeUnicodeOff(t *testing.T) {
+	a := newNormalizingAnonymizer(false)
+	input := "call ５５５-８６７-５３０９ now"
+	if got := a.AnonymizeText(input, "sess-nfkc-off"); got != input {
+		t.Errorf("AnonymizeText = %q, want it unchanged", got)
+	}
+}
+
+// TestNormViewOffsets maps normalized ranges back to the original, widening
+// a range that ends inside the expansion of a ligature.
+func TestNormViewOffsets(t *testing.T) {
+	if newNormView("plain ascii") != nil {
+		t.Error("expected no view for text already in NFKC form")
+	}
+	s := "a１ﬁb" // "a", full-width 1 (3 bytes), "fi" ligature (3 bytes), "b"
+	v := newNormView(s)
+	if v == nil || v.norm != "a1fib" {
+		t.Fatalf("norm = %+v, want a1fib", v)
+	}
+	for _, tc := range []struct{ start, end, wantStart, wantEnd int }{
+		{1, 2, 1, 4}, // "1" → "１"
+		{2, 3, 4, 7}, // "f" → the whole "ﬁ"
+		{1, 5, 1, 8}, // "1fib" → "１ﬁb"
+	} {
+		if gs, ge := v.orig(tc.start, tc.end); gs != tc.wantStart || ge != tc.wantEnd {
+			t.Errorf("orig(%d,%d) = %d,%d; want %d,%d", tc.start, tc.end, gs, ge, tc.wantStart, tc.wantEnd)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package anonymizer — ollama_batch.go
+//
+// A request with many low-confidence candidates (phone-like digit runs, ZIP
+// codes) would otherwise start one Ollama query per value. With
+// Options.OllamaBatchWindow set, cache-miss values are collected for that
+// long and sent together: one prompt asks the model to classify a JSON array
+// of candidates, and the detections come back in the same array format
+// queryOllamaHTTP parses. The window is shared by all requests, so
+// concurrent requests also share queries.
+//
+// Values stay in the in-flight map until their batch's query finishes, so a
+// value is never queued twice, within a batch or across batches.
+package anonymizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ollamaMaxBatch caps the candidates in one query; a full batch is sent
+// without waiting for the window to close.
+const ollamaMaxBatch = 32
+
+// enqueueOllamaBatch adds an in-flight value to the pending batch. The first
+// value of a batch starts the window timer.
+func (a *Anonymizer) enqueueOllamaBatch(original string) {
+	a.batchMu.Lock()
+	a.batch = append(a.batch, original)
+	n := len(a.batch)
+	a.batchMu.Unlock()
+
+	switch {
+	case n >= ollamaMaxBatch:
+		go a.flushOllamaBatch()
+	case n == 1:
+		time.AfterFunc(a.batchWindow, a.flushOllamaBatch)
+	}
+}
+
+// flushOllamaBatch sends the pending values as one query. A timer that fires
+// after its batch was already sent full finds nothing to do.
+func (a *Anonymizer) flushOllamaBatch() {
+	a.batchMu.Lock()
+	values := a.batch
+	a.batch = nil
+	a.batchMu.Unlock()
+	if len(values) == 0 {
+		return
+	}
+	defer a.releaseInflight(values...)
+
+	if a.m != nil {
+		a.m.OllamaDispatches.Add(1)
+	}
+	a.queryAndCache(func() ([]ollamaDetection, error) { return a.queryOllamaBatch(values) })
+}
+
+// queryOllamaBatch asks Ollama to classify each candidate value.
+func (a *Anonymizer) queryOllamaBatch(values []string) ([]ollamaDetection, error) {
+	candidates, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("encode ollama batch: %w", err)
+	}
+	prompt := fmt.Sprintf(`Classify each candidate string below as PII (personally identifiable information) or not.
+Return ONLY a JSON array with one item for each candidate that is PII. Each item must have:
+- "original": the candidate exactly as given
+- "type": one of: email, phone, ssn, creditCard, name, address, medical, salary, company, jobTitle, apiKey
+- "confidence": float 0.0-1.0
+
+Candidates (JSON array):
+%s
+
+Return ONLY the JSON array, no explanation. Example: [{"original":"555-0142","type":"phone","confidence":0.9}]`,
+		candidates)
+	return a.queryOllama(prompt)
+}
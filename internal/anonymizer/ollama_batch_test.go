@@ -0,0 +1,96 @@
+package anonymizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestOllamaBatchWindowOneQuery feeds five distinct low-confidence values
+// within one batch window and checks that a single Ollama query carries all
+// of them and that its detections warm the cache for each.
+func TestOllamaBatchWindowOneQuery(t *testing.T) {
+	values := []string{"ann@example.com", "ben@example.com", "cat@example.com", "dan@example.com", "eve@example.com"}
+
+	var queries atomic.Int64
+	var prompt atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompt.Store(req.Prompt)
+		dets := make([]ollamaDetection, 0, len(values))
+		for _, v := range values {
+			dets = append(dets, ollamaDetection{Original: v, PIIType: PIIEmail, Confidence: 0.999})
+		}
+		reply, _ := json.Marshal(dets)
+		_ = json.NewEncoder(w).Encode(ollamaResponse{Response: string(reply)})
+	}))
+	defer srv.Close()
+
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      srv.URL,
+		UseAI:               true,
+		AIThreshold:         0.99, // every match takes the low-confidence path
+		OllamaMaxConcurrent: 1,
+		OllamaBatchWindow:   50 * time.Millisecond,
+	})
+
+	text := "mail " + strings.Join(values, ", ")
+	a.AnonymizeText(text, "sess-batch")
+	a.AnonymizeText(text, "sess-batch-2") // in flight: must not queue again
+
+	if !waitUntil(func() bool {
+		_, hit := a.cache.Get(a.enc.cacheKey(values[len(values)-1]))
+		return hit
+	}) {
+		t.Fatalf("cache not populated; %d Ollama queries", queries.Load())
+	}
+	time.Sleep(100 * time.Millisecond) // a second query would have been sent by now
+	if n := queries.Load(); n != 1 {
+		t.Fatalf("Ollama queries = %d, want 1", n)
+	}
+	p, _ := prompt.Load().(string)
+	for _, v := range values {
+		if !strings.Contains(p, fmt.Sprintf("%q", v)) {
+			t.Errorf("batch prompt does not list %q", v)
+		}
+		if _, hit := a.cache.Get(a.enc.cacheKey(v)); !hit {
+			t.Errorf("%s not cached", v)
+		}
+	}
+	a.inflightMu.Lock()
+	defer a.inflightMu.Unlock()
+	if len(a.inflight) != 0 {
+		t.Errorf("in-flight values left after the batch: %d", len(a.inflight))
+	}
+}
+
+// TestOllamaBatchFullSendsEarly sends a batch as soon as it reaches
+// ollamaMaxBatch, without waiting for the window.
+func TestOllamaBatchFullSendsEarly(t *testing.T) {
+	var queries atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		queries.Add(1)
+		_, _ = w.Write([]byte(`{"response":"[]"}`))
+	}))
+	defer srv.Close()
+
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      srv.URL,
+		UseAI:               true,
+		OllamaMaxConcurrent: 1,
+		OllamaBatchWindow:   time.Hour,
+	})
+	for i := range ollamaMaxBatch {
+		a.dispatchOllamaAsync(PIIEmail, fmt.Sprintf("user%d@example.com", i))
+	}
+	if !waitUntil(func() bool { return queries.Load() == 1 }) {
+		t.Fatalf("full batch not sent; %d queries", queries.Load())
+	}
+}
@@ -2,6 +2,7 @@ package packs
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -49,6 +50,50 @@ func validateEmailLocalPart(s string) bool {
 	return !strings.Contains(local, "..")
 }
 
+// validateGeoCoordinate accepts "lat,long" pairs whose latitude lies in
+// [-90, 90] and longitude in [-180, 180].
+func validateGeoCoordinate(s string) bool {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	return err == nil && lon >= -180 && lon <= 180
+}
+
+// DefaultAPIKeyMinLength is the shortest value, in characters, the api_key
+// pattern accepts after its keyword.
+const DefaultAPIKeyMinLength = 20
+
+// maxAPIKeyMinLength is the largest repeat count RE2 accepts.
+const maxAPIKeyMinLength = 1000
+
+// apiKeyEntry builds the GLOBAL api_key entry for values of at least minLen
+// characters.
+func apiKeyEntry(minLen int) Entry {
+	return Entry{
+		Name:       "api_key",
+		Pack:       "GLOBAL",
+		Re:         regexp.MustCompile(`(?i)(?:api[_\-]?key|token|secret|bearer)[\s"':=]+([a-zA-Z0-9_\-.]{` + strconv.Itoa(minLen) + `,})`),
+		PIIType:    "APIKEY",
+		Confidence: 0.90,
+	}
+}
+
+// APIKey returns an api_key entry that replaces the registered one, with a
+// different minimum value length, capped at 1000. ok is false if minLen is
+// not positive or is the default, so the registered entry stays in use.
+func APIKey(minLen int) (e Entry, ok bool) {
+	if minLen <= 0 || minLen == DefaultAPIKeyMinLength {
+		return Entry{}, false
+	}
+	return apiKeyEntry(min(minLen, maxAPIKeyMinLength)), true
+}
+
 func init() {
 	Register(
 		// Email: RFC 5322 simplified — unambiguous structural markers (@, domain, TLD).
@@ -66,13 +111,7 @@ func init() {
 		// API key: keyword prefix + long alphanumeric token.
 		// Source: silv3rshi3ld/gdpr-pii-scanner API key detection patterns.
 		// False-positive mitigation: requires keyword prefix (api_key, token, secret, bearer).
-		Entry{
-			Name:       "api_key",
-			Pack:       "GLOBAL",
-			Re:         regexp.MustCompile(`(?i)(?:api[_\-]?key|token|secret|bearer)[\s"':=]+([a-zA-Z0-9_\-.]{20,})`),
-			PIIType:    "APIKEY",
-			Confidence: 0.90,
-		},
+		apiKeyEntry(DefaultAPIKeyMinLength),
 		// Credit card: 13-19 digit pattern with optional group separators, Luhn validated.
 		// Accepts Visa (16), Mastercard (16), Amex (15), Diners (14), Discover (16-19).
 		// Source: ISO/IEC 7812-1, mnestorov/regex-patterns credit card patterns.
@@ -85,5 +124,35 @@ func init() {
 			Confidence: 0.85,
 			Validate:   luhnValid,
 		},
+		// Geographic coordinate: decimal-degree "lat,long" pair (37.7749,-122.4194).
+		// Source: ISO 6709 decimal degrees as emitted by GPS and mapping APIs.
+		// False-positive mitigation: both parts need 3-8 decimals (GPS precision, not
+		// "1.5, 2.0" lists), the pair must not follow a word character or dot so it
+		// is never carved out of an IPv4 address, and the validator enforces ranges.
+		// The leading guard is consumed, so only the value group is tokenized.
+		// Moderate confidence routes ambiguous pairs through AI verification.
+		Entry{
+			Name:       "geo_coordinate",
+			Pack:       "GLOBAL",
+			Re:         regexp.MustCompile(`(?:^|[^\w.])(?P<value>-?\d{1,3}\.\d{3,8},\s?-?\d{1,3}\.\d{3,8})\b`),
+			PIIType:    "GEOCOORD",
+			Confidence: 0.70,
+			Validate:   validateGeoCoordinate,
+		},
+		// Person name: two capitalised words after a lead-in that introduces a
+		// person ("Name:", "my name is", "from", "Dr.", "Mr.", "Mrs.", "Ms.").
+		// Source: common salutation and signature phrasing in prompts and e-mails.
+		// False-positive mitigation: a bare TitleCase pair ("New York City") never
+		// matches, and the words must stay on one line. The lead-in is consumed
+		// but only the value group is tokenized. Confidence is below the default
+		// AI threshold so, with AI on, matches go through cache/Ollama
+		// verification; with AI off they still get a fallback token.
+		Entry{
+			Name:       "context_name",
+			Pack:       "GLOBAL",
+			Re:         regexp.MustCompile(`(?:(?i:\bname[ \t]+is|\bfrom)[ \t]+|(?:(?i:\bname)[ \t]*:|\b(?:Dr|Mr|Mrs|Ms)\.)[ \t]*)(?P<value>[A-Z][a-z]+(?:[-'][A-Z][a-z]+)?[ \t]+[A-Z][a-z]+(?:[-'][A-Z][a-z]+)?)\b`),
+			PIIType:    "NAME",
+			Confidence: 0.60,
+		},
 	)
 }
@@ -1,6 +1,9 @@
 package packs
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestLuhnValid(t *testing.T) {
 	cases := []struct {
@@ -67,7 +70,7 @@ func TestGlobalPackRegistered(t *testing.T) {
 	for _, e := range packEntries {
 		names[e.Name] = true
 	}
-	for _, want := range []string{"email", "api_key", "credit_card"} {
+	for _, want := range []string{"email", "api_key", "credit_card", "geo_coordinate", "context_name"} {
 		if !names[want] {
 			t.Errorf("GLOBAL pack missing pattern %q", want)
 		}
@@ -152,6 +155,35 @@ func TestGlobalAPIKeyPattern(t *testing.T) {
 	}
 }
 
+func TestGlobalAPIKeyMinLength(t *testing.T) {
+	for _, n := range []int{0, -1, DefaultAPIKeyMinLength} {
+		if _, ok := APIKey(n); ok {
+			t.Errorf("APIKey(%d) should return ok=false", n)
+		}
+	}
+	if e, ok := APIKey(5000); !ok || !e.Re.MatchString("token="+strings.Repeat("a", 1000)) || e.Re.MatchString("token="+strings.Repeat("a", 999)) {
+		t.Errorf("APIKey(5000) should cap the minimum at 1000")
+	}
+
+	for _, minLen := range []int{12, 32} {
+		entry, ok := APIKey(minLen)
+		if !ok {
+			t.Fatalf("APIKey(%d) returned ok=false", minLen)
+		}
+		if entry.Name != "api_key" || entry.Pack != "GLOBAL" || entry.PIIType != "APIKEY" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+		atMin := "api_key=" + strings.Repeat("k", minLen)
+		belowMin := "api_key=" + strings.Repeat("k", minLen-1)
+		if !entry.Re.MatchString(atMin) {
+			t.Errorf("minLen %d: should match a %d-character value", minLen, minLen)
+		}
+		if entry.Re.MatchString(belowMin) {
+			t.Errorf("minLen %d: should NOT match a %d-character value", minLen, minLen-1)
+		}
+	}
+}
+
 func TestGlobalCreditCardWithLuhn(t *testing.T) {
 	entry := findEntry("credit_card", "GLOBAL")
 	if entry == nil {
@@ -186,6 +218,93 @@ func TestGlobalCreditCardWithLuhn(t *testing.T) {
 	}
 }
 
+func TestGlobalGeoCoordinatePattern(t *testing.T) {
+	entry := findEntry("geo_coordinate", "GLOBAL")
+	if entry == nil {
+		t.Fatal("geo_coordinate entry not found in GLOBAL pack")
+	}
+	valueIdx := entry.Re.SubexpIndex("value")
+
+	positives := map[string]string{
+		"37.7749,-122.4194":             "37.7749,-122.4194",
+		"pickup at -33.8688, 151.2093.": "-33.8688, 151.2093",
+		"loc=(48.858370,2.294481)":      "48.858370,2.294481",
+	}
+	for s, want := range positives {
+		m := entry.Re.FindStringSubmatch(s)
+		if m == nil {
+			t.Errorf("geo_coordinate pattern should match %q", s)
+			continue
+		}
+		if m[valueIdx] != want || !entry.Validate(m[valueIdx]) {
+			t.Errorf("value for %q = %q, want %q (validated)", s, m[valueIdx], want)
+		}
+	}
+
+	// Regex-level negatives: IPv4 addresses and lists, short decimals.
+	negatives := []string{
+		"192.168.100.200",
+		"10.0.0.1,10.0.0.2",
+		"192.168.1.100,10.200.300.4",
+		"1.5, 2.0",
+		"v1.2345,2.3456",
+	}
+	for _, s := range negatives {
+		if entry.Re.MatchString(s) {
+			t.Errorf("geo_coordinate pattern should NOT match %q", s)
+		}
+	}
+
+	// Validator negatives: out-of-range latitude or longitude.
+	for _, s := range []string{"91.0000,45.0000", "-90.0001,0.0000", "45.0000,180.5000", "12.3456,-999.1234"} {
+		if entry.Validate(s) {
+			t.Errorf("validator should reject out-of-range pair %q", s)
+		}
+	}
+}
+
+func TestGlobalContextNamePattern(t *testing.T) {
+	entry := findEntry("context_name", "GLOBAL")
+	if entry == nil {
+		t.Fatal("context_name entry not found in GLOBAL pack")
+	}
+	valueIdx := entry.Re.SubexpIndex("value")
+
+	positives := map[string]string{
+		"My name is John Smith.":              "John Smith",
+		"Name: Jane Doe":                      "Jane Doe",
+		"name:Mary-Ann Jones":                 "Mary-Ann Jones",
+		"a message from Peter Novak today":    "Peter Novak",
+		"please ask Dr. Alice Example":        "Alice Example",
+		"Mr. Bob Sample and Mrs. Eve Sample.": "Bob Sample",
+	}
+	for s, want := range positives {
+		m := entry.Re.FindStringSubmatch(s)
+		if m == nil {
+			t.Errorf("context_name pattern should match %q", s)
+			continue
+		}
+		if m[valueIdx] != want {
+			t.Errorf("value for %q = %q, want %q", s, m[valueIdx], want)
+		}
+	}
+
+	negatives := []string{
+		"We flew to New York City last week.",
+		"John Smith",
+		"from john smith",
+		"renamed from Foo",
+		"from the Acme Corp office",
+		"Name: Jane\nDoe",
+		"Drive to Main Street",
+	}
+	for _, s := range negatives {
+		if entry.Re.MatchString(s) {
+			t.Errorf("context_name pattern should NOT match %q", s)
+		}
+	}
+}
+
 // --- helpers ---
 
 func filterPack(entries []Entry, pack string) []Entry {
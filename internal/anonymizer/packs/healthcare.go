@@ -1,6 +1,9 @@
 package packs
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 func init() {
 	Register(
@@ -44,3 +47,31 @@ func init() {
 		},
 	)
 }
+
+// customMRNConfidence sits below the default aiConfidenceThreshold (0.7): a
+// site-specific prefix is less distinctive than MRN/MR/PAT, so with AI
+// detection enabled these matches take the Ollama-confirmed path.
+const customMRNConfidence = 0.65
+
+// CustomMRN returns a HEALTHCARE entry for MRNs behind site-specific prefixes
+// (e.g. "CHART", "PID"), in the same shape as the built-in mrn pattern:
+// prefix, optional separator, 6-10 digits. Prefixes are matched literally and
+// case-insensitively. ok is false if no non-empty prefix is given.
+func CustomMRN(prefixes []string) (e Entry, ok bool) {
+	var alts []string
+	for _, p := range prefixes {
+		if p = strings.TrimSpace(p); p != "" {
+			alts = append(alts, regexp.QuoteMeta(p))
+		}
+	}
+	if len(alts) == 0 {
+		return Entry{}, false
+	}
+	return Entry{
+		Name:       "mrn_custom",
+		Pack:       "HEALTHCARE",
+		Re:         regexp.MustCompile(`(?i)\b(?:` + strings.Join(alts, "|") + `)[\s\-:#]?\d{6,10}\b`),
+		PIIType:    "MRN",
+		Confidence: customMRNConfidence,
+	}, true
+}
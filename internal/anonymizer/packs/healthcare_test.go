@@ -51,6 +51,42 @@ func TestHEALTHCAREMRNPattern(t *testing.T) {
 	}
 }
 
+func TestHEALTHCARECustomMRN(t *testing.T) {
+	if _, ok := CustomMRN([]string{"", "  "}); ok {
+		t.Error("CustomMRN with only empty prefixes should return ok=false")
+	}
+	entry, ok := CustomMRN([]string{"CHART", "P.ID"})
+	if !ok {
+		t.Fatal("CustomMRN returned ok=false")
+	}
+	if entry.Pack != "HEALTHCARE" || entry.PIIType != "MRN" || entry.Confidence >= 0.7 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	positives := []string{
+		"CHART-1234567",
+		"chart 12345678",
+		"P.ID#987654",
+	}
+	for _, s := range positives {
+		if !entry.Re.MatchString(s) {
+			t.Errorf("custom mrn pattern should match %q", s)
+		}
+	}
+
+	negatives := []string{
+		"CHART-12345",        // too few digits
+		"PXID#987654",        // prefix is literal, "." is not a wildcard
+		"MRN123456",          // built-in prefixes are left to the mrn entry
+		"chart review today", // no digits
+	}
+	for _, s := range negatives {
+		if entry.Re.MatchString(s) {
+			t.Errorf("custom mrn pattern should NOT match %q", s)
+		}
+	}
+}
+
 func TestHEALTHCAREICD10Pattern(t *testing.T) {
 	entry := findEntry("icd10", "HEALTHCARE")
 	if entry == nil {
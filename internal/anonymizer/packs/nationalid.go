@@ -0,0 +1,132 @@
+package packs
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validateCPF validates a Brazilian Cadastro de Pessoas Físicas number: 11
+// digits, the last two being mod-11 check digits over the first 9 and 10
+// digits with descending weights from 10 and 11. Numbers of one repeated
+// digit pass the arithmetic but are never issued.
+// Source: https://pt.wikipedia.org/wiki/Cadastro_de_pessoas_f%C3%ADsicas
+func validateCPF(s string) bool {
+	digits := make([]int, 0, 11)
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) != 11 {
+		return false
+	}
+	same := true
+	for _, d := range digits[1:] {
+		if d != digits[0] {
+			same = false
+			break
+		}
+	}
+	if same {
+		return false
+	}
+	for n := 9; n <= 10; n++ {
+		sum := 0
+		for i := range n {
+			sum += digits[i] * (n + 1 - i)
+		}
+		check := sum * 10 % 11 % 10
+		if check != digits[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// dniLetters maps the DNI number modulo 23 to its control letter.
+const dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+
+// validateDNI validates a Spanish Documento Nacional de Identidad (8 digits)
+// or Número de Identidad de Extranjero (X, Y or Z, then 7 digits): the final
+// letter is dniLetters[number mod 23], with the NIE prefix read as 0, 1 or 2.
+// Source: https://www.interior.gob.es/opencms/es/servicios-al-ciudadano/tramites-y-gestiones/dni/calculo-del-digito-de-control-del-nif-nie/
+func validateDNI(s string) bool {
+	s = strings.ReplaceAll(s, "-", "")
+	if len(s) != 9 {
+		return false
+	}
+	n := strings.IndexByte("XYZ", s[0])
+	if n < 0 {
+		n = 0
+	} else {
+		s = s[1:]
+	}
+	digits := s[:len(s)-1]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return s[len(s)-1] == dniLetters[n%23]
+}
+
+// nationalIDs holds the country-gated national ID patterns, keyed by ISO
+// 3166-1 alpha-2 code. They are not registered with the global registry:
+// NationalIDs hands out only the countries a deployment asks for. Each joins
+// the GLOBAL pack and relies on its checksum to keep false positives down.
+var nationalIDs = map[string]Entry{
+	// Brazilian CPF: 11 digits, usually written 000.000.000-00.
+	// False-positive mitigation: two mod-11 check digits reject ~99% of
+	// random 11-digit sequences.
+	"BR": {
+		Name:       "cpf_br",
+		Pack:       "GLOBAL",
+		Re:         regexp.MustCompile(`\b\d{3}\.?\d{3}\.?\d{3}-?\d{2}\b`),
+		PIIType:    "NATIONALID",
+		Confidence: 0.80,
+		Validate:   validateCPF,
+	},
+	// Spanish DNI (12345678Z) and NIE (X1234567L).
+	// False-positive mitigation: the mod-23 control letter rejects ~96% of
+	// random candidates; uppercase letters only.
+	"ES": {
+		Name:       "dni_es",
+		Pack:       "GLOBAL",
+		Re:         regexp.MustCompile(`\b(?:\d{8}|[XYZ]\d{7})-?[A-Z]\b`),
+		PIIType:    "NATIONALID",
+		Confidence: 0.80,
+		Validate:   validateDNI,
+	},
+}
+
+// NationalIDs returns the national ID entries for the given country codes,
+// matched case-insensitively, in the order given. Codes without an entry
+// are returned in unknown so the caller can report them.
+func NationalIDs(countries []string) (entries []Entry, unknown []string) {
+	seen := make(map[string]bool)
+	for _, c := range countries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if e, ok := nationalIDs[c]; ok {
+			entries = append(entries, e)
+		} else {
+			unknown = append(unknown, c)
+		}
+	}
+	return entries, unknown
+}
+
+// NationalIDCountries lists the supported country codes, sorted.
+func NationalIDCountries() []string {
+	codes := make([]string, 0, len(nationalIDs))
+	for c := range nationalIDs {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return codes
+}
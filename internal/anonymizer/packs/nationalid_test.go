@@ -0,0 +1,79 @@
+package packs
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateCPF(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		// Synthetic checksum-valid CPFs; 111.444.777-35 is the common test value.
+		{"valid formatted", "111.444.777-35", true},
+		{"valid bare", "11144477735", true},
+		{"valid 529.982.247-25", "529.982.247-25", true},
+		{"wrong first check digit", "111.444.777-45", false},
+		{"wrong second check digit", "111.444.777-36", false},
+		{"repeated digit", "111.111.111-11", false},
+		{"too short", "1114447773", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validateCPF(tc.input); got != tc.want {
+				t.Errorf("validateCPF(%q) = %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateDNI(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		// 12345678 mod 23 = 14 → Z; NIE X1234567: 1234567 mod 23 = 19 → L.
+		{"valid DNI", "12345678Z", true},
+		{"valid DNI with dash", "12345678-Z", true},
+		{"valid NIE", "X1234567L", true},
+		{"wrong DNI letter", "12345678A", false},
+		{"wrong NIE letter", "X1234567Z", false},
+		{"too short", "1234567Z", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validateDNI(tc.input); got != tc.want {
+				t.Errorf("validateDNI(%q) = %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNationalIDs(t *testing.T) {
+	entries, unknown := NationalIDs([]string{"br", " ES", "BR", "XX", ""})
+	if len(entries) != 2 || entries[0].Name != "cpf_br" || entries[1].Name != "dni_es" {
+		t.Errorf("entries = %v, want cpf_br, dni_es", entries)
+	}
+	if !slices.Equal(unknown, []string{"XX"}) {
+		t.Errorf("unknown = %v, want [XX]", unknown)
+	}
+	for _, e := range entries {
+		if e.Pack != "GLOBAL" || e.PIIType != "NATIONALID" || e.Validate == nil {
+			t.Errorf("%s: pack=%s type=%s validate=%v", e.Name, e.Pack, e.PIIType, e.Validate != nil)
+		}
+	}
+	if got := NationalIDCountries(); !slices.Equal(got, []string{"BR", "ES"}) {
+		t.Errorf("NationalIDCountries() = %v", got)
+	}
+}
+
+func TestNationalIDsNotRegistered(t *testing.T) {
+	for _, e := range All() {
+		if e.PIIType == "NATIONALID" {
+			t.Errorf("%s is registered globally; national IDs must stay config-gated", e.Name)
+		}
+	}
+}
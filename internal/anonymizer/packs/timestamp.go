@@ -0,0 +1,31 @@
+package packs
+
+import "regexp"
+
+// timestampValue matches the timestamp formats recognised after a context
+// keyword, most specific first:
+//   - ISO 8601 date-time: 2026-03-14T09:30, 2026-03-14 09:30:00.000+01:00, ...Z
+//   - US / European numeric dates with an optional time: 03/14/2026 9:30 AM,
+//     14.03.2026 09:30
+//   - ISO date alone: 2026-03-14
+//   - clock time alone: 09:30, 9:30:15, 9:30 pm
+const timestampValue = `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?` +
+	`|\d{1,2}[/.]\d{1,2}[/.]\d{2,4}(?:,?\s+\d{1,2}:\d{2}(?::\d{2})?(?:\s?[AaPp][Mm])?)?` +
+	`|\d{4}-\d{2}-\d{2}` +
+	`|\d{1,2}:\d{2}(?::\d{2})?(?:\s?[AaPp][Mm])?`
+
+// Timestamp returns the GLOBAL entry for timestamps that follow a scheduling
+// or admission keyword ("appointment at 09:30", "admitted 2026-03-14
+// 22:10"). Only the timestamp is replaced. A bare timestamp, such as the one
+// leading a log line, does not match: without the keyword it is not PII.
+// The entry is not registered; it is enabled by config.
+func Timestamp() Entry {
+	return Entry{
+		Name: "timestamp_context",
+		Pack: "GLOBAL",
+		Re: regexp.MustCompile(`(?i)\b(?:appointments?|appt|scheduled|visit|admitted|admission|discharged|discharge|check-?in|consultation|surgery|booked)\b` +
+			`[\s:,\-]*(?:(?:at|on|for)\s+)?(?P<value>` + timestampValue + `)\b`),
+		PIIType:    "TIMESTAMP",
+		Confidence: 0.75,
+	}
+}
@@ -0,0 +1,44 @@
+package packs
+
+import "testing"
+
+func TestTimestamp(t *testing.T) {
+	e := Timestamp()
+	value := e.Re.SubexpIndex("value")
+	cases := []struct {
+		name  string
+		input string
+		want  string // "" = no match
+	}{
+		{"appointment ISO", "Appointment at 2026-03-14T09:30:00Z with Dr. Example", "2026-03-14T09:30:00Z"},
+		{"scheduled offset", "scheduled for 2026-03-14 09:30+01:00", "2026-03-14 09:30+01:00"},
+		{"admitted US date", "admitted: 03/14/2026 9:30 PM", "03/14/2026 9:30 PM"},
+		{"visit EU date", "visit on 14.03.2026, 09:30", "14.03.2026, 09:30"},
+		{"check-in time", "check-in 14:05", "14:05"},
+		{"date only", "discharge 2026-03-16", "2026-03-16"},
+		{"log line", "2026-03-14T09:30:00Z INFO server started", ""},
+		{"bare time", "the build took until 14:05", ""},
+		{"keyword without time", "appointment confirmed", ""},
+		{"keyword inside word", "revisit 14:05", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := e.Re.FindStringSubmatch(tc.input)
+			got := ""
+			if m != nil {
+				got = m[value]
+			}
+			if got != tc.want {
+				t.Errorf("value in %q = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTimestampNotRegistered(t *testing.T) {
+	for _, e := range All() {
+		if e.PIIType == "TIMESTAMP" {
+			t.Errorf("%s is registered globally; timestamps must stay config-gated", e.Name)
+		}
+	}
+}
@@ -74,11 +74,14 @@ func init() {
 		// Source: NANPA (North American Numbering Plan).
 		// Pattern reference: mnestorov/regex-patterns common patterns.
 		// False-positive mitigation: validator requires non-dot separator to reject
-		// version strings; low confidence triggers AI fallback.
+		// version strings; low confidence triggers AI fallback. Word boundaries
+		// keep the match to the number itself: the "1" country code is not taken
+		// from a preceding word or number ("Room 101 555-..."), and the digits
+		// must not continue into a longer run.
 		Entry{
 			Name:       "phone_us",
 			Pack:       "US",
-			Re:         regexp.MustCompile(`(?:\+?1[\-\s]?)?\(?[0-9]{3}\)?[\-.\s][0-9]{3}[\-.\s][0-9]{4}`),
+			Re:         regexp.MustCompile(`(?:\+?\b1[\-\s]?)?(?:\(|\b)[0-9]{3}\)?[\-.\s][0-9]{3}[\-.\s][0-9]{4}\b`),
 			PIIType:    "PHONE",
 			Confidence: 0.65,
 			Validate:   validateUSPhone,
@@ -127,6 +127,31 @@ func TestUSPhonePattern(t *testing.T) {
 	}
 }
 
+func TestUSPhonePatternExactSpan(t *testing.T) {
+	entry := findEntry("phone_us", "US")
+	if entry == nil {
+		t.Fatal("phone_us entry not found in US pack")
+	}
+
+	cases := []struct {
+		input string
+		want  string // "" = no match
+	}{
+		{"call 555-867-5309 now", "555-867-5309"},
+		{"Room 101 555-867-5309", "555-867-5309"},
+		{"id1 (555) 867-5309", "(555) 867-5309"},
+		{"tel: +1 555-867-5309.", "+1 555-867-5309"},
+		{"dial 1-555-867-5309", "1-555-867-5309"},
+		{"ref 2555-867-5309", ""},
+		{"ref 555-867-53091", ""},
+	}
+	for _, tc := range cases {
+		if got := entry.Re.FindString(tc.input); got != tc.want {
+			t.Errorf("FindString(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
 func TestUSAddressPattern(t *testing.T) {
 	entry := findEntry("address_us", "US")
 	if entry == nil {
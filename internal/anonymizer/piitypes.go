@@ -0,0 +1,97 @@
+// Package anonymizer — piitypes.go
+//
+// Type metadata for UIs and the management API: which PII types exist,
+// whether a regex can detect them, at what confidence, and whether this
+// instance currently detects them. The declared PIIType constants, the pack
+// registry and the loaded patterns each know part of that; PIITypes joins
+// them in one place.
+package anonymizer
+
+import (
+	"slices"
+
+	"ai-anonymizing-proxy/internal/anonymizer/packs"
+)
+
+// declaredPIITypes lists the PIIType constants in declaration order.
+var declaredPIITypes = []PIIType{
+	PIIEmail, PIIPhone, PIISSN, PIICreditCard, PIIIPAddress,
+	PIIAPIKey, PIIName, PIIAddress, PIIMedical, PIISalary,
+	PIICompany, PIIJobTitle, PIIGeoCoordinate,
+	PIISteuerID, PIISVNR, PIIKFZ,
+	PIISSHKey, PIIJWT, PIIBearer, PIIDBConn, PIIAWSKey, PIIGHToken, PIIURLCred,
+	PIINIR, PIISIRET, PIISIREN,
+	PIIBSN, PIIKVK,
+	PIIIBAN, PIISWIFTBIC, PIIVATID,
+	PIIMRN, PIIICD10, PIIInsuranceID,
+	PIINationalID, PIITimestamp,
+}
+
+// PIITypeInfo describes one PII type as seen by a running Anonymizer.
+type PIITypeInfo struct {
+	Name PIIType `json:"name"`
+	// HasRegex is true if any pack, enabled or not, has a pattern for the
+	// type. Types without one (NAME, SALARY, ...) come only from Ollama.
+	HasRegex bool `json:"hasRegex"`
+	// Confidence is the highest effective confidence among the loaded
+	// patterns for the type, or the highest base confidence in the registry
+	// if none is loaded. 0 for Ollama-only types.
+	Confidence float64 `json:"confidence"`
+	// Enabled reports whether this instance detects the type: a pattern for
+	// it is loaded, or for Ollama-only types, AI detection is on and the
+	// type is not on the Ollama denylist.
+	Enabled bool `json:"enabled"`
+}
+
+// PIITypes returns metadata for every declared PII type, in declaration
+// order, followed by the remaining registry and custom pattern types (mostly
+// SECRETS token kinds) in name order.
+func (a *Anonymizer) PIITypes() []PIITypeInfo {
+	base := make(map[PIIType]float64)
+	entries := packs.All()
+	gated, _ := packs.NationalIDs(packs.NationalIDCountries())
+	gated = append(gated, packs.Timestamp())
+	for _, e := range append(entries, gated...) {
+		t := PIIType(e.PIIType)
+		base[t] = max(base[t], e.Confidence)
+	}
+	loaded := make(map[PIIType]float64)
+	for _, p := range a.allPatterns() {
+		loaded[p.piiType] = max(loaded[p.piiType], p.confidence)
+	}
+
+	info := func(t PIIType) PIITypeInfo {
+		i := PIITypeInfo{Name: t}
+		_, inRegistry := base[t]
+		_, isLoaded := loaded[t]
+		i.HasRegex = inRegistry || isLoaded
+		if c, ok := loaded[t]; ok {
+			i.Confidence, i.Enabled = c, true
+		} else {
+			i.Confidence = base[t]
+			i.Enabled = !inRegistry && a.useAI && !a.ollamaDeny[t]
+		}
+		return i
+	}
+
+	out := make([]PIITypeInfo, 0, len(declaredPIITypes)+len(base))
+	seen := make(map[PIIType]bool, len(declaredPIITypes))
+	for _, t := range declaredPIITypes {
+		seen[t] = true
+		out = append(out, info(t))
+	}
+	var rest []PIIType
+	for _, m := range []map[PIIType]float64{base, loaded} {
+		for t := range m {
+			if !seen[t] {
+				seen[t] = true
+				rest = append(rest, t)
+			}
+		}
+	}
+	slices.Sort(rest)
+	for _, t := range rest {
+		out = append(out, info(t))
+	}
+	return out
+}
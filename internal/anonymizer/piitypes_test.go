@@ -0,0 +1,73 @@
+package anonymizer
+
+import "testing"
+
+func TestPIITypes(t *testing.T) {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:     "http://localhost:11434",
+		UseAI:              true,
+		AIThreshold:        0.7,
+		EnabledPacks:       []string{"SECRETS", "GLOBAL", "DE"},
+		PackDecayRate:      0.05,
+		OllamaTypeDenylist: []string{"SALARY"},
+	})
+	defer func() { _ = a.Close() }()
+
+	got := make(map[PIIType]PIITypeInfo)
+	for _, info := range a.PIITypes() {
+		if _, dup := got[info.Name]; dup {
+			t.Errorf("%s listed twice", info.Name)
+		}
+		got[info.Name] = info
+	}
+
+	// Every declared constant must be listed.
+	for _, pt := range []PIIType{
+		PIIEmail, PIIPhone, PIISSN, PIICreditCard, PIIIPAddress,
+		PIIAPIKey, PIIName, PIIAddress, PIIMedical, PIISalary,
+		PIICompany, PIIJobTitle, PIIGeoCoordinate,
+		PIISteuerID, PIISVNR, PIIKFZ,
+		PIISSHKey, PIIJWT, PIIBearer, PIIDBConn, PIIAWSKey, PIIGHToken, PIIURLCred,
+		PIINIR, PIISIRET, PIISIREN,
+		PIIBSN, PIIKVK,
+		PIIIBAN, PIISWIFTBIC, PIIVATID,
+		PIIMRN, PIIICD10, PIIInsuranceID,
+		PIINationalID, PIITimestamp,
+	} {
+		if _, ok := got[pt]; !ok {
+			t.Errorf("declared type %s missing from PIITypes()", pt)
+		}
+	}
+
+	for _, tc := range []struct {
+		name       PIIType
+		hasRegex   bool
+		confidence float64
+		enabled    bool
+	}{
+		{PIIEmail, true, 0.95 * 0.95, true},      // GLOBAL, second pack: one decay step
+		{PIISteuerID, true, 0.70 * 0.90, true},   // DE, third pack: two decay steps
+		{PIISSN, true, 0.85, false},              // US pack not enabled: base confidence
+		{PIINationalID, true, 0.80, false},       // no country configured
+		{PIITimestamp, true, 0.75, false},        // detectTimestamps off
+		{PIIName, true, 0.60 * 0.95, true},       // GLOBAL context_name
+		{PIICompany, false, 0, true},             // Ollama only, AI on
+		{PIISalary, false, 0, false},             // Ollama only, denylisted
+		{PIIType("OPENAIKEY"), true, 0.95, true}, // registry type without a constant
+	} {
+		info, ok := got[tc.name]
+		if !ok {
+			t.Errorf("%s missing", tc.name)
+			continue
+		}
+		if info.HasRegex != tc.hasRegex || info.Enabled != tc.enabled || !approxEqual(info.Confidence, tc.confidence) {
+			t.Errorf("%s = %+v, want hasRegex=%v confidence=%.4f enabled=%v",
+				tc.name, info, tc.hasRegex, tc.confidence, tc.enabled)
+		}
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
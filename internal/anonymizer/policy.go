@@ -0,0 +1,59 @@
+// Package anonymizer — policy.go
+//
+// A match normally becomes a reversible token, but not every type warrants
+// that. Options.TypePolicies can redact a type outright, for values the reply
+// never needs back (an SSN), or pass it through untouched, for types a
+// deployment considers benign. A redacted value is replaced by a fixed marker
+// and never recorded in the session map, so no response can restore it and
+// the management mappings endpoint never shows it.
+package anonymizer
+
+import (
+	"strings"
+)
+
+// Policy is how matches of one PII type are replaced.
+type Policy string
+
+const (
+	PolicyTokenize    Policy = "tokenize"    // reversible token (the default)
+	PolicyRedact      Policy = "redact"      // fixed marker, not restorable
+	PolicyPassthrough Policy = "passthrough" // left in the text as is
+)
+
+// typePolicies normalises Options.TypePolicies: type names are upper-cased
+// and policies lower-cased. Unknown policies are logged and dropped, as are
+// tokenize entries, which are the default anyway.
+func (a *Anonymizer) typePolicies(m map[PIIType]Policy) map[PIIType]Policy {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[PIIType]Policy, len(m))
+	for t, p := range m {
+		p = Policy(strings.ToLower(strings.TrimSpace(string(p))))
+		switch p {
+		case PolicyTokenize:
+			continue
+		case PolicyRedact, PolicyPassthrough:
+			out[PIIType(strings.ToUpper(strings.TrimSpace(string(t))))] = p
+		default:
+			a.log.Warnf("config", "unknown policy %q for %s, tokenizing", p, t)
+		}
+	}
+	return out
+}
+
+// policy returns the replacement policy of piiType.
+func (a *Anonymizer) policy(piiType PIIType) Policy {
+	if p, ok := a.policies[piiType]; ok {
+		return p
+	}
+	return PolicyTokenize
+}
+
+// redaction returns the marker a redacted value of piiType is replaced with.
+// It carries the type, like a token, but no hash: equal values are not
+// linkable and nothing maps it back.
+func redaction(piiType PIIType) string {
+	return "[REDACTED_" + string(piiType) + "]"
+}
@@ -0,0 +1,86 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+
+	"ai-anonymizing-proxy/internal/anonymizer/packs"
+)
+
+func newPolicyAnonymizer(policies map[PIIType]Policy) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://localhost:11434",
+		OllamaModel:         "test-model",
+		AIThreshold:         0.8,
+		OllamaMaxConcurrent: 1,
+		EnabledPacks:        []string{"SECRETS", "GLOBAL", "DE", "FR", "US", "NL", "FINANCE_EU", "HEALTHCARE"},
+		PackDecayRate:       0.05,
+		NationalIDCountries: packs.NationalIDCountries(),
+		DetectTimestamps:    true,
+		TypePolicies:        policies,
+	})
+}
+
+// TestTypePolicyRedactAndTokenize redacts an SSN and tokenizes an email in
+// the same request: only the email is recorded and restored.
+func TestTypePolicyRedactAndTokenize(t *testing.T) {
+	a := newPolicyAnonymizer(map[PIIType]Policy{"ssn": "Redact"})
+	const sessionID = "sess-policy-redact"
+	input := "Patient SSN 123-45-6789, contact alice@example.com"
+
+	anon := a.AnonymizeText(input, sessionID)
+	if strings.Contains(anon, "123-45-6789") || !strings.Contains(anon, "[REDACTED_SSN]") {
+		t.Fatalf("SSN not redacted: %q", anon)
+	}
+	emailToken := a.replacement(PIIEmail, "alice@example.com")
+	if !strings.Contains(anon, emailToken) {
+		t.Fatalf("email not tokenized: %q", anon)
+	}
+
+	mappings, ok := a.SessionMappings(sessionID)
+	if !ok || len(mappings) != 1 || mappings[emailToken] != "alice@example.com" {
+		t.Errorf("session mappings = %v, want only the email", mappings)
+	}
+	got := a.DeanonymizeText(anon, sessionID)
+	if want := "Patient SSN [REDACTED_SSN], contact alice@example.com"; got != want {
+		t.Errorf("DeanonymizeText = %q, want %q", got, want)
+	}
+}
+
+// TestTypePolicyPassthrough leaves a passthrough type in the text and out of
+// the session map.
+func TestTypePolicyPassthrough(t *testing.T) {
+	a := newPolicyAnonymizer(map[PIIType]Policy{PIIEmail: PolicyPassthrough})
+	const sessionID = "sess-policy-pass"
+	input := "mail support@example.com"
+	if got := a.AnonymizeText(input, sessionID); got != input {
+		t.Errorf("AnonymizeText = %q, want it unchanged", got)
+	}
+	if n := a.SessionTokenCount(sessionID); n != 0 {
+		t.Errorf("session has %d tokens, want 0", n)
+	}
+}
+
+// TestTypePoliciesNormalise drops tokenize entries and unknown policies.
+func TestTypePoliciesNormalise(t *testing.T) {
+	got := newTestAnonymizer().typePolicies(map[PIIType]Policy{"ssn": " REDACT ", "EMAIL": "tokenize", "PHONE": "mask"})
+	if len(got) != 1 || got[PIISSN] != PolicyRedact {
+		t.Errorf("typePolicies = %v, want only SSN: redact", got)
+	}
+	if newTestAnonymizer().typePolicies(nil) != nil {
+		t.Error("typePolicies(nil) should be nil")
+	}
+}
+
+// TestRedactionMarkerNonRetriggering checks that no loaded pattern matches
+// the redaction marker of any type, so a redacted value is never turned into
+// a token on a later pass.
+func TestRedactionMarkerNonRetriggering(t *testing.T) {
+	a := newPolicyAnonymizer(nil)
+	for _, piiType := range declaredPIITypes {
+		marker := redaction(piiType)
+		if got := a.AnonymizeText("see "+marker+" here", "sess-marker"); got != "see "+marker+" here" {
+			t.Errorf("%s: marker retriggered: %q", piiType, got)
+		}
+	}
+}
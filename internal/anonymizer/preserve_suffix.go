@@ -0,0 +1,76 @@
+// Package anonymizer — preserve_suffix.go
+//
+// Some teams want a masked value to stay recognisable to the user, the way a
+// card statement shows "ending in 5309". Options.PreserveSuffix keeps the
+// last N letters and digits of a value's original inside its token, after a
+// colon: [PII_PHONE_c160f8cc4b2e1a3d:5309]. The hash still covers the whole
+// original, so the token stays unique and maps back through the session map
+// like any other.
+//
+// The suffix is visible to the LLM, so it is kept short and only added when
+// the value has at least twice as many letters and digits as N. A suffixed
+// token is checked against every loaded pattern, plain and indexed, before
+// use; if the suffix would make it match one, the plain token is used instead
+// so the proxy never re-tokenizes its own output.
+package anonymizer
+
+import (
+	"strings"
+)
+
+// maxPreservedSuffix caps the characters kept per token.
+const maxPreservedSuffix = 8
+
+// preserveSuffixes normalises Options.PreserveSuffix: type names are
+// upper-cased, non-positive lengths dropped and long ones capped.
+func (a *Anonymizer) preserveSuffixes(m map[PIIType]int) map[PIIType]int {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[PIIType]int, len(m))
+	for t, n := range m {
+		if n <= 0 {
+			continue
+		}
+		if n > maxPreservedSuffix {
+			a.log.Warnf("config", "preserveSuffix for %s capped at %d characters", t, maxPreservedSuffix)
+			n = maxPreservedSuffix
+		}
+		out[PIIType(strings.ToUpper(string(t)))] = n
+	}
+	return out
+}
+
+// withSuffix returns token with the last characters of original appended
+// when piiType is configured for it, or token unchanged. Custom replacement
+// tokens are never altered.
+func (a *Anonymizer) withSuffix(piiType PIIType, original, token string) string {
+	n := a.preserveSuffix[piiType]
+	if n == 0 || a.replaceFn != nil {
+		return token
+	}
+	var alnum []byte
+	for i := 0; i < len(original); i++ {
+		if c := original[i]; c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			alnum = append(alnum, c)
+		}
+	}
+	if len(alnum) < 2*n {
+		return token
+	}
+	suffixed := token[:len(token)-1] + ":" + string(alnum[len(alnum)-n:]) + "]"
+	if a.retriggers(suffixed) || a.retriggers(indexedToken(suffixed, 2)) {
+		return token
+	}
+	return suffixed
+}
+
+// retriggers reports whether any loaded pattern matches token.
+func (a *Anonymizer) retriggers(token string) bool {
+	for _, p := range a.allPatterns() {
+		if p.re.MatchString(token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func newSuffixAnonymizer(suffix map[PIIType]int, custom ...CustomPattern) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://localhost:11434",
+		OllamaModel:         "test-model",
+		AIThreshold:         0.8,
+		OllamaMaxConcurrent: 1,
+		EnabledPacks:        []string{"SECRETS", "GLOBAL", "DE", "FR", "US", "NL", "FINANCE_EU", "HEALTHCARE"},
+		PackDecayRate:       0.05,
+		IndexRepeatedTokens: true,
+		PreserveSuffix:      suffix,
+		CustomPatterns:      custom,
+	})
+}
+
+// TestPreserveSuffixRoundTrip verifies, per type, that the preserved suffix
+// is the last characters of the original, that repeated and single tokens
+// deanonymize, and that no form of the token matches a loaded pattern.
+func TestPreserveSuffixRoundTrip(t *testing.T) {
+	tests := []struct {
+		piiType PIIType
+		n       int
+		value   string
+		suffix  string
+	}{
+		{PIIPhone, 4, "555-867-5309", "5309"},
+		{PIISSN, 4, "123-45-6789", "6789"},
+		{PIICreditCard, 4, "4111-1111-1111-1111", "1111"},
+		{PIIEmail, 3, "alice@example.com", "com"},
+		{PIIIBAN, 4, "DE89 3704 0044 0532 0130 00", "3000"},
+		{PIIIPAddress, 2, "203.0.113.42", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.piiType), func(t *testing.T) {
+			a := newSuffixAnonymizer(map[PIIType]int{tt.piiType: tt.n})
+			sessionID := "sess-suffix-" + string(tt.piiType)
+			original := "first " + tt.value + ", then " + tt.value + "."
+
+			anon := a.AnonymizeText(original, sessionID)
+			base := a.replacement(tt.piiType, tt.value)
+			want := base[:len(base)-1] + ":" + tt.suffix + "]"
+			if !strings.Contains(anon, want) || !strings.Contains(anon, indexedToken(want, 2)) {
+				t.Fatalf("expected %q and its #2 form in %q", want, anon)
+			}
+			if got := a.DeanonymizeText(anon, sessionID); got != original {
+				t.Errorf("round trip: got %q, want %q", got, original)
+			}
+			for _, token := range []string{want, indexedToken(want, 2)} {
+				for _, p := range a.patterns {
+					if p.re.MatchString(token) {
+						t.Errorf("token %q re-triggers pattern %q (pack=%s)", token, p.piiType, p.pack)
+					}
+				}
+				if !preTokenRe.MatchString(token) {
+					t.Errorf("preTokenRe does not recognise %q", token)
+				}
+				if again := a.AnonymizeText(token, sessionID+"-2"); again != token {
+					t.Errorf("token re-anonymized: %q -> %q", token, again)
+				}
+			}
+		})
+	}
+}
+
+// TestPreserveSuffixFallsBack verifies that the plain token is used when the
+// value is too short to keep a suffix or when the suffixed token would match
+// a loaded pattern.
+func TestPreserveSuffixFallsBack(t *testing.T) {
+	t.Run("short value", func(t *testing.T) {
+		a := newSuffixAnonymizer(map[PIIType]int{PIIIPAddress: 4})
+		anon := a.AnonymizeText("host 10.0.0.1", "sess-suffix-short")
+		if want := "host " + a.replacement(PIIIPAddress, "10.0.0.1"); anon != want {
+			t.Errorf("got %q, want %q", anon, want)
+		}
+	})
+	t.Run("suffix re-triggers", func(t *testing.T) {
+		a := newSuffixAnonymizer(map[PIIType]int{PIICreditCard: 4},
+			CustomPattern{Name: "colon_digits", Regex: `:\d{4}\]`})
+		const card = "4111-1111-1111-1111"
+		anon := a.AnonymizeText("card "+card, "sess-suffix-retrigger")
+		if want := "card " + a.replacement(PIICreditCard, card); anon != want {
+			t.Errorf("got %q, want %q", anon, want)
+		}
+	})
+}
+
+func TestPreserveSuffixes(t *testing.T) {
+	got := newTestAnonymizer().preserveSuffixes(map[PIIType]int{"phone": 4, "EMAIL": 0, "IBAN": -1, "CREDITCARD": 20})
+	if len(got) != 2 || got[PIIPhone] != 4 || got[PIICreditCard] != maxPreservedSuffix {
+		t.Errorf("got %v, want PHONE:4 CREDITCARD:%d", got, maxPreservedSuffix)
+	}
+}
@@ -0,0 +1,123 @@
+// Package anonymizer — profiles.go
+//
+// Some upstreams warrant heavier masking than others: a domain that carries
+// customer records may need the broad, low-confidence patterns that would be
+// noise everywhere else. Options.PatternProfiles names alternative pattern
+// sets, each with its own packs and confidence floor, and BeginSessionProfile
+// ties a session to one of them. Every profile runs through the same
+// pipeline — caching, Ollama verification and token format are unchanged;
+// only the pattern list differs.
+//
+// Profiles replace the prose patterns only. Fenced code blocks keep
+// Options.CodeBlockPacks when that is set.
+package anonymizer
+
+import (
+	"maps"
+	"slices"
+
+	"ai-anonymizing-proxy/internal/anonymizer/packs"
+)
+
+// DefaultProfile names the pattern set built from Options.EnabledPacks and
+// Options.MinConfidence. It cannot be redefined in Options.PatternProfiles.
+const DefaultProfile = "default"
+
+// PatternProfile is a named alternative pattern set.
+type PatternProfile struct {
+	EnabledPacks  []string // packs in priority order; nil = Options.EnabledPacks
+	MinConfidence float64  // effective confidence below which patterns are not loaded
+}
+
+// loadProfiles builds the pattern list of every profile in
+// opts.PatternProfiles, with the same extra entries and custom patterns as
+// the default set. opts.EnabledPacks must already be defaulted.
+func (a *Anonymizer) loadProfiles(opts Options, extra []packs.Entry) map[string][]pattern {
+	if len(opts.PatternProfiles) == 0 {
+		return nil
+	}
+	profiles := make(map[string][]pattern, len(opts.PatternProfiles))
+	for _, name := range slices.Sorted(maps.Keys(opts.PatternProfiles)) {
+		if name == "" || name == DefaultProfile {
+			a.log.Warnf("config", "pattern profile name %q is reserved, ignoring", name)
+			continue
+		}
+		prof := opts.PatternProfiles[name]
+		enabled := prof.EnabledPacks
+		if len(enabled) == 0 {
+			enabled = opts.EnabledPacks
+		}
+		patterns := a.loadPacks("packs of profile "+name, enabled, opts.PackDecayRate, prof.MinConfidence, extra...)
+		patterns = append(patterns, a.compileCustomPatterns(opts.CustomPatterns, patterns, prof.MinConfidence)...)
+		profiles[name] = patterns
+	}
+	return profiles
+}
+
+// HasPatternProfile reports whether name selects a pattern set: the default
+// or one loaded from Options.PatternProfiles.
+func (a *Anonymizer) HasPatternProfile(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+	_, ok := a.profiles[name]
+	return ok
+}
+
+// BeginSessionProfile is BeginSession for a session whose text is scanned
+// with the named pattern profile. An empty or unknown profile name selects
+// the default set.
+func (a *Anonymizer) BeginSessionProfile(sessionID, profile string) error {
+	if err := a.BeginSession(sessionID); err != nil {
+		return err
+	}
+	if sessionID == "" || profile == DefaultProfile {
+		return nil
+	}
+	if _, ok := a.profiles[profile]; !ok {
+		return nil
+	}
+	a.sessionMu.Lock()
+	a.sessionProf[sessionID] = profile
+	a.sessionMu.Unlock()
+	return nil
+}
+
+// sessionProfile returns the name of sessionID's pattern profile.
+func (a *Anonymizer) sessionProfile(sessionID string) string {
+	if len(a.profiles) == 0 || sessionID == "" {
+		return DefaultProfile
+	}
+	a.sessionMu.RLock()
+	name, ok := a.sessionProf[sessionID]
+	a.sessionMu.RUnlock()
+	if !ok {
+		return DefaultProfile
+	}
+	return name
+}
+
+// sessionPatterns returns the prose pattern set of sessionID.
+func (a *Anonymizer) sessionPatterns(sessionID string) []pattern {
+	return a.profilePatterns(a.sessionProfile(sessionID))
+}
+
+// profilePatterns returns the prose pattern set of the named profile; the
+// default set for an unknown name, as BeginSessionProfile selects.
+func (a *Anonymizer) profilePatterns(name string) []pattern {
+	if p, ok := a.profiles[name]; ok {
+		return p
+	}
+	return a.patterns
+}
+
+// allPatterns returns every loaded pattern across the default, code-block
+// and profile sets, for checks that must hold whichever set a text is
+// scanned with.
+func (a *Anonymizer) allPatterns() []pattern {
+	all := slices.Concat(a.patterns, a.codePatterns)
+	for _, name := range slices.Sorted(maps.Keys(a.profiles)) {
+		all = append(all, a.profiles[name]...)
+	}
+	return all
+}
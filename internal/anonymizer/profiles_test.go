@@ -0,0 +1,83 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPatternProfileStrict verifies that a session begun with the strict
+// profile masks a ZIP code (confidence 0.40) that the default profile's
+// minConfidence of 0.5 leaves out, while other sessions keep the default.
+func TestPatternProfileStrict(t *testing.T) {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434",
+		EnabledPacks:   []string{"US"},
+		MinConfidence:  0.5,
+		PatternProfiles: map[string]PatternProfile{
+			"strict": {MinConfidence: 0},
+		},
+	})
+	defer func() { _ = a.Close() }()
+
+	const input = "Ship to ZIP 90210 today."
+	if err := a.BeginSessionProfile("sess-strict", "strict"); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.AnonymizeText(input, "sess-strict"); strings.Contains(got, "90210") {
+		t.Errorf("strict profile left the ZIP code: %q", got)
+	}
+	if err := a.BeginSessionProfile("sess-default", DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.AnonymizeText(input, "sess-default"); got != input {
+		t.Errorf("default profile changed the text: %q", got)
+	}
+}
+
+// TestPatternProfileUnknown verifies that an unknown profile name falls back
+// to the default pattern set and that the reserved name cannot be redefined.
+func TestPatternProfileUnknown(t *testing.T) {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434",
+		EnabledPacks:   []string{"US"},
+		MinConfidence:  0.5,
+		PatternProfiles: map[string]PatternProfile{
+			DefaultProfile: {MinConfidence: 0},
+		},
+	})
+	defer func() { _ = a.Close() }()
+
+	if a.HasPatternProfile("strict") || !a.HasPatternProfile(DefaultProfile) {
+		t.Error("only the default profile should exist")
+	}
+	if err := a.BeginSessionProfile("sess-unknown", "strict"); err != nil {
+		t.Fatal(err)
+	}
+	const input = "Ship to ZIP 90210 today."
+	if got := a.AnonymizeText(input, "sess-unknown"); got != input {
+		t.Errorf("unknown profile should use the default set: %q", got)
+	}
+}
+
+// TestPatternProfileSessionCleared verifies that DeleteSession forgets the
+// session's profile, so a reused ID starts on the default set.
+func TestPatternProfileSessionCleared(t *testing.T) {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434",
+		EnabledPacks:   []string{"US"},
+		MinConfidence:  0.5,
+		PatternProfiles: map[string]PatternProfile{
+			"strict": {MinConfidence: 0},
+		},
+	})
+	defer func() { _ = a.Close() }()
+
+	if err := a.BeginSessionProfile("sess-reuse", "strict"); err != nil {
+		t.Fatal(err)
+	}
+	a.DeleteSession("sess-reuse")
+	const input = "Ship to ZIP 90210 today."
+	if got := a.AnonymizeText(input, "sess-reuse"); got != input {
+		t.Errorf("deleted session kept its profile: %q", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Package anonymizer — replacement.go
+//
+// Integrators can take over token generation with Options.ReplacementFunc,
+// for example to have an external vault issue surrogates. Custom tokens must
+// keep the properties the rest of the pipeline relies on: they start with
+// "[PII_" and end with the only ']' in the token, so the streaming
+// deanonymizer recognises them when split across chunks, and they match no
+// detection pattern, so the proxy never re-tokenizes its own output. The
+// constructor samples the function once per PII type and falls back to the
+// built-in format if any output breaks these rules.
+//
+// Built-in tokens hash the value with MD5, so every deployment turns the
+// same value into the same token and leaked tokens can be correlated across
+// them. Options.TokenSalt keys the hash (HMAC-MD5) to make tokens
+// deployment-specific. Restoring is unaffected: it looks tokens up in the
+// session map rather than recomputing them.
+package anonymizer
+
+import (
+	"crypto/hmac"
+	"crypto/md5" // #nosec G501 -- MD5 used for deterministic PII tokens, not cryptographic security
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ReplacementFunc returns the token for one detected value. It must be
+// deterministic and give distinct originals distinct tokens, since tokens key
+// the session map used to restore responses.
+type ReplacementFunc func(piiType PIIType, original string) string
+
+// replacementSample is the synthetic original passed to a ReplacementFunc
+// during validation.
+const replacementSample = "alice@example.com"
+
+// validateReplacementFunc checks fn's output for every PII type the loaded
+// patterns can produce and returns the first rule it breaks.
+func (a *Anonymizer) validateReplacementFunc(fn ReplacementFunc) error {
+	all := a.allPatterns()
+	seen := make(map[PIIType]bool)
+	for _, p := range all {
+		if seen[p.piiType] {
+			continue
+		}
+		seen[p.piiType] = true
+		token := fn(p.piiType, replacementSample)
+		if !strings.HasPrefix(token, tokenPrefix) || strings.IndexByte(token, ']') != len(token)-1 {
+			return fmt.Errorf("%s token %q must start with %q and end with its only ']'", p.piiType, token, tokenPrefix)
+		}
+		for _, q := range all {
+			if q.re.MatchString(token) {
+				return fmt.Errorf("%s token %q re-triggers the %s pattern", p.piiType, token, q.piiType)
+			}
+		}
+	}
+	return nil
+}
+
+// setTokenSalt keys the built-in token hash with salt. The Ollama cache
+// stores finished tokens, so its keys get a tag derived from the salt: a
+// cache file written under another salt, or none, then misses instead of
+// handing back that salt's tokens.
+func (a *Anonymizer) setTokenSalt(salt string) {
+	if salt == "" {
+		return
+	}
+	a.tokenSalt = []byte(salt)
+	sum := sha256.Sum256(a.tokenSalt)
+	a.saltTag = "salt:" + hex.EncodeToString(sum[:8]) + ":"
+}
+
+// tokenHash returns the 16 hex digits of a built-in token for original.
+func (a *Anonymizer) tokenHash(original string) string {
+	if a.tokenSalt == nil {
+		sum := md5.Sum([]byte(original)) // #nosec G401 -- deterministic token, not crypto
+		return hex.EncodeToString(sum[:8])
+	}
+	mac := hmac.New(md5.New, a.tokenSalt)
+	mac.Write([]byte(original))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// valueCacheKey is the Ollama cache key for original.
+func (a *Anonymizer) valueCacheKey(original string) string {
+	return a.saltTag + a.enc.cacheKey(original)
+}
+
+// setReplacementFunc installs fn if it passes validation, logging and keeping
+// the built-in token format otherwise.
+func (a *Anonymizer) setReplacementFunc(fn ReplacementFunc) {
+	if fn == nil {
+		return
+	}
+	if err := a.validateReplacementFunc(fn); err != nil {
+		a.log.Warnf("config", "custom replacement function rejected, using built-in tokens: %v", err)
+		return
+	}
+	a.replaceFn = fn
+}
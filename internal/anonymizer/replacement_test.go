@@ -0,0 +1,99 @@
+package anonymizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// vaultStub issues sequential surrogates per original, like an external
+// vault would.
+type vaultStub struct {
+	mu  sync.Mutex
+	ids map[string]int
+}
+
+func (v *vaultStub) token(piiType PIIType, original string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	id, ok := v.ids[original]
+	if !ok {
+		id = len(v.ids) + 1
+		v.ids[original] = id
+	}
+	return fmt.Sprintf("[PII_%s_VAULT%d]", piiType, id)
+}
+
+func TestReplacementFuncRoundTrip(t *testing.T) {
+	v := &vaultStub{ids: make(map[string]int)}
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:  "http://localhost:11434",
+		EnabledPacks:    []string{"SECRETS", "GLOBAL", "US"},
+		ReplacementFunc: v.token,
+	})
+	defer func() { _ = a.Close() }()
+
+	const input = "mail bob@example.com or carol@example.com"
+	got := a.AnonymizeText(input, "sess-vault")
+	// The validation sample takes surrogate 1.
+	if !strings.Contains(got, "[PII_EMAIL_VAULT2]") || !strings.Contains(got, "[PII_EMAIL_VAULT3]") {
+		t.Fatalf("custom tokens not used: %s", got)
+	}
+	if back := a.DeanonymizeText(got, "sess-vault"); back != input {
+		t.Errorf("round trip = %q, want %q", back, input)
+	}
+}
+
+func TestReplacementFuncRejected(t *testing.T) {
+	for name, fn := range map[string]ReplacementFunc{
+		"re-triggers": func(PIIType, string) string { return "[PII_vault@example.com]" },
+		"no prefix":   func(t PIIType, _ string) string { return "<" + string(t) + ">" },
+		"inner ]":     func(t PIIType, _ string) string { return "[PII_" + string(t) + "]x]" },
+	} {
+		a := NewWithCacheAndCapacity(Options{
+			OllamaEndpoint:  "http://localhost:11434",
+			EnabledPacks:    []string{"GLOBAL"},
+			ReplacementFunc: fn,
+		})
+		got := a.AnonymizeText("mail bob@example.com", "sess-rejected")
+		if want := "mail " + a.replacement(PIIEmail, "bob@example.com"); got != want || a.replaceFn != nil {
+			t.Errorf("%s: got %q, want built-in token %q", name, got, want)
+		}
+		_ = a.Close()
+	}
+}
+
+func TestTokenSalt(t *testing.T) {
+	newSalted := func(salt string) *Anonymizer {
+		return NewWithCacheAndCapacity(Options{
+			OllamaEndpoint: "http://localhost:11434",
+			EnabledPacks:   []string{"GLOBAL"},
+			TokenSalt:      salt,
+		})
+	}
+	plain, saltA, saltB := newSalted(""), newSalted("deployment-a"), newSalted("deployment-b")
+	defer func() { _, _, _ = plain.Close(), saltA.Close(), saltB.Close() }()
+
+	const input = "mail alice@example.com"
+	tokens := map[string]bool{}
+	for _, a := range []*Anonymizer{plain, saltA, saltB} {
+		got := a.AnonymizeText(input, "sess-salt")
+		if !tokenTypeRe.MatchString(strings.TrimPrefix(got, "mail ")) {
+			t.Errorf("salted token breaks the built-in format: %q", got)
+		}
+		tokens[got] = true
+		if back := a.DeanonymizeText(got, "sess-salt"); back != input {
+			t.Errorf("round trip = %q, want %q", back, input)
+		}
+	}
+	if len(tokens) != 3 {
+		t.Errorf("unsalted and two salts gave %d distinct tokens, want 3: %v", len(tokens), tokens)
+	}
+	if again := newSalted("deployment-a").AnonymizeText(input, "other"); !tokens[again] {
+		t.Errorf("same salt gave a different token %q", again)
+	}
+	if plain.valueCacheKey("x") == saltA.valueCacheKey("x") || saltA.valueCacheKey("x") == saltB.valueCacheKey("x") {
+		t.Error("Ollama cache keys do not separate salts")
+	}
+}
@@ -0,0 +1,128 @@
+// Package anonymizer — retry_cache.go
+//
+// Clients that retry a failed call resend the same body on a new connection,
+// and each attempt used to be anonymized from scratch. With
+// Options.RetryCacheTTL set, the anonymized body and its token map are kept
+// for that long, keyed by a hash of the original body, and an exact retry
+// reuses them. Sessions stay isolated: the retry gets its own session, into
+// which the cached mappings are copied, so deleting either session leaves
+// the other intact.
+//
+// The cache holds anonymized bodies (what is sent upstream anyway) and
+// sealed originals, the same form the session map keeps them in. It is
+// bounded by retryCacheMaxEntries and expired entries are swept on insert.
+package anonymizer
+
+import (
+	"crypto/sha256"
+	"maps"
+	"sync"
+	"time"
+)
+
+// retryCacheMaxEntries bounds the number of cached request bodies. A full
+// cache stores nothing new until entries expire.
+const retryCacheMaxEntries = 128
+
+// retryKey identifies a request body, the framing it was anonymized with and
+// the pattern profile it was scanned with: a body first seen under the
+// default profile must not satisfy a session that needs a stricter one.
+type retryKey struct {
+	sum     [sha256.Size]byte
+	sse     bool
+	profile string
+}
+
+// retryEntry is one cached anonymization.
+type retryEntry struct {
+	body    []byte
+	tokens  map[string]string // token → sealed original
+	matches int               // tokenCounts value, so token limits apply alike
+	expires time.Time
+}
+
+// retryCache maps body hashes to their anonymization for a short TTL.
+type retryCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[retryKey]*retryEntry
+}
+
+func newRetryCache(ttl time.Duration) *retryCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &retryCache{ttl: ttl, entries: make(map[retryKey]*retryEntry)}
+}
+
+func (c *retryCache) get(k retryKey) *retryEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[k]
+	if e == nil || time.Now().After(e.expires) {
+		return nil
+	}
+	return e
+}
+
+func (c *retryCache) put(k retryKey, e *retryEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for key, old := range c.entries {
+		if now.After(old.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= retryCacheMaxEntries {
+		return
+	}
+	e.expires = now.Add(c.ttl)
+	c.entries[k] = e
+}
+
+// AnonymizeRequest anonymizes a request body into sessionID: as SSE events
+// if sse is set (see AnonymizeSSE), otherwise with AnonymizeJSON. When the
+// retry cache is on and the same body was anonymized within its TTL, the
+// cached result is returned and its mappings are copied into sessionID.
+func (a *Anonymizer) AnonymizeRequest(body []byte, sessionID string, sse bool) []byte {
+	anonymize := a.AnonymizeJSON
+	if sse {
+		anonymize = a.AnonymizeSSE
+	}
+	if a.retries == nil || sessionID == "" {
+		return anonymize(body, sessionID)
+	}
+
+	k := retryKey{sum: sha256.Sum256(body), sse: sse, profile: a.sessionProfile(sessionID)}
+	if e := a.retries.get(k); e != nil {
+		a.sessionMu.Lock()
+		a.sessions[sessionID] = maps.Clone(e.tokens)
+		if _, ok := a.started[sessionID]; !ok {
+			a.started[sessionID] = time.Now()
+		}
+		if e.matches > 0 {
+			a.tokenCounts[sessionID] = e.matches
+		}
+		for token, sealed := range e.tokens {
+			a.queueStoreLocked(sessionID, token, sealed)
+		}
+		a.sessionMu.Unlock()
+		a.flushStore(sessionID)
+		if a.m != nil {
+			a.m.RetryReuses.Add(1)
+		}
+		return e.body
+	}
+
+	out := anonymize(body, sessionID)
+	a.sessionMu.RLock()
+	e := &retryEntry{
+		body:    out,
+		tokens:  maps.Clone(a.sessions[sessionID]),
+		matches: a.tokenCounts[sessionID],
+	}
+	a.sessionMu.RUnlock()
+	a.retries.put(k, e)
+	return out
+}
@@ -0,0 +1,90 @@
+package anonymizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-anonymizing-proxy/internal/metrics"
+)
+
+func newRetryAnonymizer(m *metrics.Metrics) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434",
+		EnabledPacks:   []string{"GLOBAL"},
+		Metrics:        m,
+		RetryCacheTTL:  time.Minute,
+	})
+}
+
+func TestRetryCacheReusesAnonymization(t *testing.T) {
+	m := metrics.New()
+	a := newRetryAnonymizer(m)
+	defer func() { _ = a.Close() }()
+
+	body := []byte(`{"messages":[{"role":"user","content":"mail alice@example.com"}]}`)
+	for _, id := range []string{"sess-try-1", "sess-try-2"} {
+		if err := a.BeginSession(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := a.AnonymizeRequest(body, "sess-try-1", false)
+	replaced := m.TokensReplaced.Load()
+	second := a.AnonymizeRequest(body, "sess-try-2", false)
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("retry anonymized differently:\n%s\n%s", first, second)
+	}
+	if got := m.RetryReuses.Load(); got != 1 {
+		t.Errorf("RetryReuses = %d, want 1", got)
+	}
+	if got := m.TokensReplaced.Load(); got != replaced {
+		t.Errorf("retry was anonymized again: TokensReplaced %d → %d", replaced, got)
+	}
+
+	// Each attempt has its own session: ending the first leaves the retry
+	// able to restore its response.
+	a.DeleteSession("sess-try-1")
+	token := a.replacement(PIIEmail, "alice@example.com")
+	if got := a.DeanonymizeText("reply to "+token, "sess-try-2"); got != "reply to alice@example.com" {
+		t.Errorf("retry session lost its mapping: %q", got)
+	}
+
+	// A different body, or the same bytes as SSE, is anonymized afresh.
+	a.AnonymizeRequest([]byte(`{"content":"mail bob@example.com"}`), "sess-try-2", false)
+	a.AnonymizeRequest(body, "sess-try-2", true)
+	if got := m.RetryReuses.Load(); got != 1 {
+		t.Errorf("RetryReuses = %d after distinct bodies, want 1", got)
+	}
+}
+
+func TestRetryCacheExpires(t *testing.T) {
+	m := metrics.New()
+	a := newRetryAnonymizer(m)
+	defer func() { _ = a.Close() }()
+
+	body := []byte(`mail alice@example.com`)
+	a.AnonymizeRequest(body, "sess-exp-1", false)
+	for _, e := range a.retries.entries {
+		e.expires = time.Now().Add(-time.Second)
+	}
+	a.AnonymizeRequest(body, "sess-exp-2", false)
+	if got := m.RetryReuses.Load(); got != 0 {
+		t.Errorf("expired entry reused: RetryReuses = %d", got)
+	}
+	if len(a.retries.entries) != 1 {
+		t.Errorf("expired entry not swept: %d entries", len(a.retries.entries))
+	}
+}
+
+func TestRetryCacheOff(t *testing.T) {
+	a := newTestAnonymizer()
+	if a.retries != nil {
+		t.Fatal("retry cache should be off by default")
+	}
+	out := a.AnonymizeRequest([]byte(`mail alice@example.com`), "sess-off", false)
+	if strings.Contains(string(out), "alice@example.com") {
+		t.Errorf("not anonymized: %s", out)
+	}
+}
@@ -9,9 +9,9 @@
 // S3-FIFO ("Simple, Scalable, FIFO-based cache eviction", Yang et al., 2023)
 // uses two FIFO queues and a bounded ghost set:
 //
-//   - S (small, ~10% of capacity): probationary queue.
+//   - S (small, sRatio of capacity, default 10%): probationary queue.
 //     All new keys are inserted here.
-//   - M (main, ~90% of capacity): protected queue.
+//   - M (main, the remainder): protected queue.
 //     Keys promoted from S after at least one access (freq > 0) land here.
 //   - G (ghost): a circular-buffer set of keys recently evicted from S,
 //     bounded to 2× sTarget. A key found in G on insert bypasses S and goes
@@ -38,20 +38,38 @@
 // # Concurrency
 //
 // All public methods acquire a single mutex for in-memory state. bbolt I/O
-// (which carries its own locking) is performed without holding c.mu, via
-// goroutines for deletions and direct calls for reads/writes on the hot path.
+// (which carries its own locking) is performed without holding c.mu: reads
+// and writes on the hot path call the backing store directly, while evicted
+// keys are queued on a buffered channel drained by a single background
+// worker. The worker batches whatever is queued into one DeleteMany call
+// (one bbolt transaction), so a burst of evictions neither spawns a
+// goroutine per key nor serializes on the bbolt write lock key by key.
 //
 // # Sizing
 //
-//	sTarget   = max(1, capacity/10)
+//	sTarget   = max(1, capacity × sRatio)   sRatio ∈ [0.01, 0.5], default 0.1
 //	mTarget   = capacity − sTarget
 //	ghostCap  = 2 × sTarget   (min 4)
+//
+// A larger sRatio gives new keys a longer probation before eviction, which
+// suits workloads where a value's second access arrives after many other
+// one-off values.
 package anonymizer
 
 import (
 	"container/list"
-	"log"
 	"sync"
+	"sync/atomic"
+
+	"ai-anonymizing-proxy/internal/logger"
+)
+
+// S-queue ratio bounds. Below 1% the probationary queue is too short for
+// any second access to land; above 50% S crowds out the protected queue.
+const (
+	defaultS3FIFOSRatio = 0.1
+	minS3FIFOSRatio     = 0.01
+	maxS3FIFOSRatio     = 0.5
 )
 
 // s3fifoEntry holds the in-memory state for a single cached item.
@@ -67,7 +85,8 @@ type s3fifoCache struct {
 	mu sync.Mutex
 
 	capacity int // S + M max items
-	sTarget  int // desired S queue size (~10%)
+	sTarget  int // desired S queue size (capacity × sRatio)
+	mTarget  int // desired M queue size (capacity − sTarget)
 	ghostCap int // maximum ghost set cardinality
 
 	// Hot in-memory index.
@@ -84,16 +103,47 @@ type s3fifoCache struct {
 	ghostCount int                 // current number of ghost entries
 
 	backing PersistentCache
+
+	// Get hits by where they were found; see Stats.
+	memoryHits atomic.Int64
+	coldHits   atomic.Int64
+
+	// Background eviction deleter. evictCh is closed by Close; closed is
+	// set under mu first so eviction never sends on a closed channel.
+	evictCh    chan string
+	deleteDone chan struct{}
+	closed     bool
+	overflow   []string // evicted keys that did not fit in evictCh; under mu
 }
 
+// Eviction deleter sizing. The channel absorbs bursts without blocking the
+// insert path (keys that do not fit are deleted by the inserting caller);
+// maxDeleteBatch caps the size of a single bbolt transaction.
+const (
+	evictQueueSize = 1024
+	maxDeleteBatch = 256
+)
+
 // newS3FIFOCache returns a PersistentCache that applies S3-FIFO eviction in
 // front of the given backing store. capacity is the maximum number of items
-// kept in memory (and on disk); values < 2 are clamped to 2.
-func newS3FIFOCache(backing PersistentCache, capacity int) PersistentCache {
+// kept in memory (and on disk); values < 2 are clamped to 2. sRatio is the
+// fraction of capacity given to the S queue; 0 selects the default (0.1) and
+// other values are clamped to [0.01, 0.5].
+func newS3FIFOCache(backing PersistentCache, capacity int, sRatio float64, lg *logger.Logger) PersistentCache {
 	if capacity < 2 {
 		capacity = 2
 	}
-	sTarget := capacity / 10
+	switch {
+	case sRatio == 0:
+		sRatio = defaultS3FIFOSRatio
+	case sRatio < minS3FIFOSRatio:
+		lg.Warnf("cache_config", "S3-FIFO sRatio %g below %g, clamping", sRatio, minS3FIFOSRatio)
+		sRatio = minS3FIFOSRatio
+	case sRatio > maxS3FIFOSRatio:
+		lg.Warnf("cache_config", "S3-FIFO sRatio %g above %g, clamping", sRatio, maxS3FIFOSRatio)
+		sRatio = maxS3FIFOSRatio
+	}
+	sTarget := int(float64(capacity) * sRatio)
 	if sTarget < 1 {
 		sTarget = 1
 	}
@@ -101,10 +151,11 @@ func newS3FIFOCache(backing PersistentCache, capacity int) PersistentCache {
 	if ghostCap < 4 {
 		ghostCap = 4
 	}
-	log.Printf("[ANONYMIZER] S3-FIFO cache capacity=%d sTarget=%d ghostCap=%d", capacity, sTarget, ghostCap)
-	return &s3fifoCache{
+	lg.Infof("cache_config", "S3-FIFO cache capacity=%d sTarget=%d ghostCap=%d", capacity, sTarget, ghostCap)
+	c := &s3fifoCache{
 		capacity: capacity,
 		sTarget:  sTarget,
+		mTarget:  capacity - sTarget,
 		ghostCap: ghostCap,
 		entries:  make(map[string]*s3fifoEntry, capacity),
 		sQueue:   list.New(),
@@ -112,7 +163,12 @@ func newS3FIFOCache(backing PersistentCache, capacity int) PersistentCache {
 		ghostBuf: make([]string, ghostCap),
 		ghostSet: make(map[string]struct{}, ghostCap),
 		backing:  backing,
+
+		evictCh:    make(chan string, evictQueueSize),
+		deleteDone: make(chan struct{}),
 	}
+	go c.runDeleter()
+	return c
 }
 
 // ── PersistentCache ─────────────────────────────────────────────────────────
@@ -128,6 +184,7 @@ func (c *s3fifoCache) Get(original string) (string, bool) {
 		}
 		v := e.value
 		c.mu.Unlock()
+		c.memoryHits.Add(1)
 		return v, true
 	}
 	c.mu.Unlock()
@@ -137,6 +194,7 @@ func (c *s3fifoCache) Get(original string) (string, bool) {
 	if !ok {
 		return "", false
 	}
+	c.coldHits.Add(1)
 	// Re-warm entry. insertLocked handles its own locking.
 	c.insertLocked(original, token)
 	return token, true
@@ -149,6 +207,15 @@ func (c *s3fifoCache) Set(original, token string) {
 	c.backing.Set(original, token)
 }
 
+// SetMany stores every pair in memory, then writes the batch to the backing
+// store in one call.
+func (c *s3fifoCache) SetMany(pairs map[string]string) {
+	for k, v := range pairs {
+		c.insertLocked(k, v)
+	}
+	c.backing.SetMany(pairs)
+}
+
 // Delete removes original from memory and from the backing store.
 func (c *s3fifoCache) Delete(original string) {
 	c.mu.Lock()
@@ -157,18 +224,81 @@ func (c *s3fifoCache) Delete(original string) {
 	c.backing.Delete(original)
 }
 
-// Close closes the backing store. In-memory state is discarded.
+// Len returns the number of entries resident in memory (S + M queues).
+// Entries that were evicted to the backing store are not counted.
+func (c *s3fifoCache) Len() int {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return n
+}
+
+// Cap returns the configured in-memory capacity.
+func (c *s3fifoCache) Cap() int { return c.capacity }
+
+// Stats reports the queue occupancy and the memory/cold split of Get hits.
+// A high cold share means the hot set is too small for the working set, or
+// the process restarted recently.
+func (c *s3fifoCache) Stats() CacheLayerStats {
+	c.mu.Lock()
+	st := CacheLayerStats{
+		SQueueLen:  c.sQueue.Len(),
+		MQueueLen:  c.mQueue.Len(),
+		GhostCount: c.ghostCount,
+		Capacity:   c.capacity,
+	}
+	c.mu.Unlock()
+	st.MemoryHits = c.memoryHits.Load()
+	st.ColdHits = c.coldHits.Load()
+	return st
+}
+
+// Probe checks the backing store; the in-memory layer cannot fail.
+func (c *s3fifoCache) Probe() error { return c.backing.Probe() }
+
+// DeleteMany removes all keys from memory and from the backing store.
+func (c *s3fifoCache) DeleteMany(originals []string) {
+	c.mu.Lock()
+	for _, k := range originals {
+		c.removeFromMemory(k)
+	}
+	c.mu.Unlock()
+	c.backing.DeleteMany(originals)
+}
+
+// Close stops the eviction deleter after it has flushed all queued keys,
+// then closes the backing store. In-memory state is discarded.
 func (c *s3fifoCache) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.evictCh)
+	}
+	c.mu.Unlock()
+	<-c.deleteDone
 	return c.backing.Close()
 }
 
 // ── Internal ────────────────────────────────────────────────────────────────
 
 // insertLocked performs the in-memory S3-FIFO insert/update under c.mu.
+// Evicted keys the deleter queue had no room for are deleted from the
+// backing store here, after c.mu is released, so a slow disk never holds
+// up other cache calls.
 func (c *s3fifoCache) insertLocked(key, value string) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.insert(key, value)
+	overflow := c.overflow
+	c.overflow = nil
+	c.mu.Unlock()
+	if len(overflow) > 0 {
+		c.backing.DeleteMany(overflow)
+	}
+}
 
+// insert adds or updates key in memory, evicting down to capacity.
+// Must be called with c.mu held.
+func (c *s3fifoCache) insert(key, value string) {
 	// Update existing entry in-place; do not change its queue position.
 	if e, ok := c.entries[key]; ok {
 		e.value = value
@@ -226,15 +356,14 @@ func (c *s3fifoCache) evictFromS() {
 		e.inM = true
 		e.elem = c.mQueue.PushBack(key)
 		// If M now exceeds its target, immediately evict its head.
-		mTarget := c.capacity - c.sTarget
-		if c.mQueue.Len() > mTarget {
+		if c.mQueue.Len() > c.mTarget {
 			c.evictFromM()
 		}
 	} else {
 		// Full eviction: remove from memory, record in ghost, delete from disk.
 		delete(c.entries, key)
 		c.ghostAdd(key)
-		go c.backing.Delete(key) // async: avoid blocking the hot path
+		c.enqueueDelete(key)
 	}
 }
 
@@ -252,7 +381,47 @@ func (c *s3fifoCache) evictFromM() {
 	}
 	c.mQueue.Remove(front)
 	delete(c.entries, key)
-	go c.backing.Delete(key) // async: avoid blocking the hot path
+	c.enqueueDelete(key)
+}
+
+// enqueueDelete hands an evicted key to the background deleter. If the
+// queue is full the key goes to c.overflow instead, for insertLocked to
+// delete once c.mu is released: the delete is neither dropped, which would
+// leak the on-disk entry, nor waited for under the lock.
+// Must be called with c.mu held.
+func (c *s3fifoCache) enqueueDelete(key string) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.evictCh <- key:
+	default:
+		c.overflow = append(c.overflow, key)
+	}
+}
+
+// runDeleter drains evictCh, batching every key already queued (up to
+// maxDeleteBatch) into a single backing DeleteMany call. It exits after
+// evictCh is closed and fully drained.
+func (c *s3fifoCache) runDeleter() {
+	defer close(c.deleteDone)
+	batch := make([]string, 0, maxDeleteBatch)
+	for key := range c.evictCh {
+		batch = append(batch[:0], key)
+	drain:
+		for len(batch) < maxDeleteBatch {
+			select {
+			case k, ok := <-c.evictCh:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, k)
+			default:
+				break drain
+			}
+		}
+		c.backing.DeleteMany(batch)
+	}
 }
 
 // removeFromMemory removes key from whichever queue it lives in and from
@@ -2,14 +2,16 @@ package anonymizer
 
 import (
 	"fmt"
+	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 // newTestS3FIFO creates a small S3-FIFO wrapping an in-memory backing cache
 // for tests that do not need bbolt.
 func newTestS3FIFO(capacity int) *s3fifoCache {
-	c, ok := newS3FIFOCache(newMemoryCache(), capacity).(*s3fifoCache)
+	c, ok := newS3FIFOCache(newMemoryCache(), capacity, 0, testLog).(*s3fifoCache)
 	if !ok {
 		panic("newS3FIFOCache did not return *s3fifoCache")
 	}
@@ -185,7 +187,7 @@ func TestS3FIFOColdReadRewarmsMemory(t *testing.T) {
 	// Pre-populate the backing store (simulates data written by a previous process).
 	backing.Set("cold-key", "tok-cold")
 
-	c, ok := newS3FIFOCache(backing, 10).(*s3fifoCache)
+	c, ok := newS3FIFOCache(backing, 10, 0, testLog).(*s3fifoCache)
 	if !ok {
 		t.Fatal("newS3FIFOCache did not return *s3fifoCache")
 	}
@@ -214,6 +216,51 @@ func TestS3FIFOColdReadRewarmsMemory(t *testing.T) {
 	}
 }
 
+func TestS3FIFOStatsHitCounters(t *testing.T) {
+	t.Parallel()
+	backing := newMemoryCache()
+	backing.Set("cold-key", "tok-cold")
+
+	c, ok := newS3FIFOCache(backing, 10, 0, testLog).(*s3fifoCache)
+	if !ok {
+		t.Fatal("newS3FIFOCache did not return *s3fifoCache")
+	}
+	defer func() { _ = c.Close() }()
+
+	check := func(step string, memory, cold int64) {
+		t.Helper()
+		st := c.Stats()
+		if st.MemoryHits != memory || st.ColdHits != cold {
+			t.Errorf("%s: memoryHits=%d coldHits=%d, want %d and %d", step, st.MemoryHits, st.ColdHits, memory, cold)
+		}
+	}
+
+	c.Get("cold-key")
+	check("cold re-warm", 0, 1)
+	c.Get("cold-key")
+	check("memory hit after re-warm", 1, 1)
+	c.Set("warm-key", "tok-warm")
+	c.Get("warm-key")
+	check("memory hit after Set", 2, 1)
+	c.Get("missing")
+	check("miss", 2, 1)
+
+	st := c.Stats()
+	if st.Capacity != 10 {
+		t.Errorf("Capacity: got %d, want 10", st.Capacity)
+	}
+	if st.SQueueLen+st.MQueueLen != 2 || st.GhostCount != 0 {
+		t.Errorf("queues: S=%d M=%d ghost=%d, want 2 entries and no ghosts", st.SQueueLen, st.MQueueLen, st.GhostCount)
+	}
+}
+
+func TestCacheStatsWithoutLayer(t *testing.T) {
+	t.Parallel()
+	if st := newMemoryCache().Stats(); st != (CacheLayerStats{}) {
+		t.Errorf("memoryCache Stats: got %+v, want zero value", st)
+	}
+}
+
 // ── Concurrent safety ────────────────────────────────────────────────────────
 
 func TestS3FIFOConcurrentAccess(t *testing.T) {
@@ -285,12 +332,12 @@ func TestS3FIFOFrequencySaturation(t *testing.T) {
 func TestS3FIFOWithBboltBacking(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
-	bbolt, err := newBboltCache(dir + "/test.db")
+	bbolt, err := newBboltCache(dir+"/test.db", testLog)
 	if err != nil {
 		t.Fatalf("newBboltCache: %v", err)
 	}
 
-	c := newS3FIFOCache(bbolt, 100)
+	c := newS3FIFOCache(bbolt, 100, 0, testLog)
 	defer func() { _ = c.Close() }()
 
 	c.Set("persist@example.com", "[PII_feedbeef12345678]")
@@ -443,3 +490,223 @@ func TestS3FIFOEvictFromMPath(t *testing.T) {
 		t.Errorf("expected mQueue len ≤1 after eviction, got %d", mLen)
 	}
 }
+
+// TestS3FIFOSRatioSizing verifies sTarget/mTarget/ghostCap follow the
+// configured S-queue ratio, including default selection and clamping.
+func TestS3FIFOSRatioSizing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		capacity  int
+		sRatio    float64
+		wantS     int
+		wantGhost int
+	}{
+		{"default", 100, 0, 10, 20},
+		{"quarter", 100, 0.25, 25, 50},
+		{"clamp low", 1000, 0.001, 10, 20},
+		{"clamp high", 100, 0.9, 50, 100},
+		{"tiny capacity", 4, 0.25, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := newS3FIFOCache(newMemoryCache(), tt.capacity, tt.sRatio, testLog).(*s3fifoCache)
+			if !ok {
+				t.Fatal("newS3FIFOCache did not return *s3fifoCache")
+			}
+			if c.sTarget != tt.wantS {
+				t.Errorf("sTarget = %d, want %d", c.sTarget, tt.wantS)
+			}
+			if c.mTarget != tt.capacity-tt.wantS {
+				t.Errorf("mTarget = %d, want %d", c.mTarget, tt.capacity-tt.wantS)
+			}
+			if c.ghostCap != tt.wantGhost {
+				t.Errorf("ghostCap = %d, want %d", c.ghostCap, tt.wantGhost)
+			}
+		})
+	}
+}
+
+// TestS3FIFOSRatioBoundsEntries verifies eviction keeps S+M within capacity
+// and M within mTarget for a non-default ratio.
+func TestS3FIFOSRatioBoundsEntries(t *testing.T) {
+	t.Parallel()
+	c, ok := newS3FIFOCache(newMemoryCache(), 20, 0.4, testLog).(*s3fifoCache)
+	if !ok {
+		t.Fatal("newS3FIFOCache did not return *s3fifoCache")
+	}
+	defer func() { _ = c.Close() }()
+
+	for i := range 200 {
+		key := fmt.Sprintf("k%d", i)
+		c.Set(key, "v")
+		if i%3 == 0 {
+			c.Get(key) // promote a third of the keys to M
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.sQueue.Len() + c.mQueue.Len(); n > 20 {
+		t.Errorf("resident entries %d exceed capacity 20", n)
+	}
+	if c.mQueue.Len() > c.mTarget {
+		t.Errorf("M queue %d exceeds mTarget %d", c.mQueue.Len(), c.mTarget)
+	}
+	if len(c.entries) != c.sQueue.Len()+c.mQueue.Len() {
+		t.Errorf("entries map (%d) out of sync with queues (%d)", len(c.entries), c.sQueue.Len()+c.mQueue.Len())
+	}
+}
+
+// countingBacking wraps a PersistentCache and counts delete calls, standing
+// in for bbolt Update transactions issued on the eviction path.
+type countingBacking struct {
+	PersistentCache
+	mu          sync.Mutex
+	deleteCalls int // Delete + DeleteMany calls (one transaction each)
+	deletedKeys int
+}
+
+func (b *countingBacking) Delete(original string) {
+	b.mu.Lock()
+	b.deleteCalls++
+	b.deletedKeys++
+	b.mu.Unlock()
+	b.PersistentCache.Delete(original)
+}
+
+func (b *countingBacking) DeleteMany(originals []string) {
+	b.mu.Lock()
+	b.deleteCalls++
+	b.deletedKeys += len(originals)
+	b.mu.Unlock()
+	b.PersistentCache.DeleteMany(originals)
+}
+
+// TestS3FIFOEvictionDeletesAreBatched floods inserts far beyond capacity and
+// verifies evicted keys reach the backing store in batched calls from a
+// single worker rather than one goroutine per eviction.
+func TestS3FIFOEvictionDeletesAreBatched(t *testing.T) {
+	backing := &countingBacking{PersistentCache: newMemoryCache()}
+	c, ok := newS3FIFOCache(backing, 10, 0, testLog).(*s3fifoCache)
+	if !ok {
+		t.Fatal("newS3FIFOCache did not return *s3fifoCache")
+	}
+
+	baseline := runtime.NumGoroutine()
+	const inserts = 5000
+	var peak int
+	for i := range inserts {
+		c.Set(fmt.Sprintf("flood-%d", i), "v")
+		if i%100 == 0 {
+			peak = max(peak, runtime.NumGoroutine())
+		}
+	}
+	if peak > baseline+2 {
+		t.Errorf("goroutine count grew from %d to %d during eviction flood", baseline, peak)
+	}
+
+	// Close flushes the deleter queue before returning.
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	backing.mu.Lock()
+	defer backing.mu.Unlock()
+	if want := inserts - 10; backing.deletedKeys != want {
+		t.Errorf("deleted %d keys from backing, want %d", backing.deletedKeys, want)
+	}
+	if backing.deleteCalls >= backing.deletedKeys {
+		t.Errorf("expected batched deletes: %d calls for %d keys", backing.deleteCalls, backing.deletedKeys)
+	}
+	if n := backing.Len(); n != 10 {
+		t.Errorf("backing holds %d entries after eviction, want 10 (capacity)", n)
+	}
+}
+
+// stallingBacking blocks every DeleteMany until release is closed, standing
+// in for bbolt deletes stuck behind a slow fsync.
+type stallingBacking struct {
+	PersistentCache
+	release chan struct{}
+	stalled chan struct{} // receives once per DeleteMany call
+}
+
+func (b *stallingBacking) DeleteMany(originals []string) {
+	b.stalled <- struct{}{}
+	<-b.release
+	b.PersistentCache.DeleteMany(originals)
+}
+
+// TestS3FIFOStalledDeletesDoNotBlockGet fills the eviction queue while the
+// backing store's deletes hang and verifies Get and Stats still return: the
+// overflow is deleted by the inserting caller, outside the cache lock.
+func TestS3FIFOStalledDeletesDoNotBlockGet(t *testing.T) {
+	backing := &stallingBacking{
+		PersistentCache: newMemoryCache(),
+		release:         make(chan struct{}),
+		stalled:         make(chan struct{}, 4),
+	}
+	c, ok := newS3FIFOCache(backing, 4, 0, testLog).(*s3fifoCache)
+	if !ok {
+		t.Fatal("newS3FIFOCache did not return *s3fifoCache")
+	}
+	c.Set("hot", "token")
+
+	flooded := make(chan struct{})
+	go func() {
+		defer close(flooded)
+		for i := range evictQueueSize + 100 {
+			c.Set(fmt.Sprintf("flood-%d", i), "v")
+		}
+	}()
+	// One stall is the background deleter; the second is an inserting
+	// caller deleting the overflow of the full queue.
+	for range 2 {
+		select {
+		case <-backing.stalled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("eviction queue never overflowed")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Get("hot")
+		c.Stats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get blocked behind stalled backing deletes")
+	}
+
+	close(backing.release)
+	go func() {
+		for range backing.stalled {
+		}
+	}()
+	<-flooded
+	err := c.Close()
+	close(backing.stalled)
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestS3FIFOCloseIdempotent verifies a second Close does not panic on the
+// already-closed eviction channel.
+func TestS3FIFOCloseIdempotent(t *testing.T) {
+	t.Parallel()
+	c := newTestS3FIFO(4)
+	if err := c.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	c.mu.Lock()
+	c.enqueueDelete("after-close") // must be a no-op, not a send on closed channel
+	c.mu.Unlock()
+}
@@ -0,0 +1,165 @@
+// Package anonymizer — session_store.go
+//
+// A session's token map lives in the memory of the Anonymizer that created
+// it, so behind a load balancer only the instance that anonymized a request
+// can restore its tokens. With Options.SessionStore set, every mapping is also
+// written to that store, and deanonymization merges in what the store holds,
+// so any instance sharing it can restore any session. The local map remains
+// the record of the sessions this instance opened: MaxSessions admission,
+// token budgets and SessionStats stay per instance.
+//
+// Originals are handed to the store as they are kept locally: sealed when
+// EncryptionKey is set. A remote store then never sees plaintext, provided
+// every instance is configured with the same key.
+//
+// New mappings are queued while a request is anonymized and written in one
+// Put when the public Anonymize method returns, so a request costs a single
+// store round trip however many tokens it adds. After a store call fails,
+// the store is left alone for storeRetryAfter: an unreachable server would
+// otherwise cost every request a connection timeout.
+package anonymizer
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// storeRetryAfter is how long the shared store is skipped after a failed
+// call. Meanwhile sessions can be restored only by the instance that opened
+// them, and sessions deleted in the pause are left to the store's expiry.
+const storeRetryAfter = 30 * time.Second
+
+// SessionStore holds token → original mappings shared between Anonymizers.
+// Implementations must be safe for concurrent use, and binary-safe: a sealed
+// original is arbitrary bytes, not UTF-8.
+type SessionStore interface {
+	// Put records each token → original of mappings in sessionID, keeping
+	// the mapping the session already has for a token.
+	Put(sessionID string, mappings map[string]string) error
+
+	// Get returns a copy of sessionID's mappings. An unknown session has
+	// none; that is not an error.
+	Get(sessionID string) (map[string]string, error)
+
+	// Delete removes sessionID and all its mappings.
+	Delete(sessionID string) error
+}
+
+// MemorySessionStore is a SessionStore in process memory. It shares sessions
+// between Anonymizers in one process; across processes use a networked store
+// such as RedisSessionStore.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]map[string]string
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]map[string]string)}
+}
+
+// Put implements SessionStore.
+func (s *MemorySessionStore) Put(sessionID string, mappings map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.sessions[sessionID]
+	if m == nil {
+		m = make(map[string]string, len(mappings))
+		s.sessions[sessionID] = m
+	}
+	for token, original := range mappings {
+		if _, ok := m[token]; !ok {
+			m[token] = original
+		}
+	}
+	return nil
+}
+
+// Get implements SessionStore.
+func (s *MemorySessionStore) Get(sessionID string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.sessions[sessionID]), nil
+}
+
+// Delete implements SessionStore.
+func (s *MemorySessionStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	return nil
+}
+
+// storeUsable reports whether there is a shared store and it is not in the
+// pause that follows a failed call.
+func (a *Anonymizer) storeUsable() bool {
+	return a.store != nil && time.Now().UnixNano() >= a.storeDownUntil.Load()
+}
+
+// storeFailed starts the pause and logs err. Calls skipped during the pause
+// are not logged, so an outage logs once per storeRetryAfter.
+func (a *Anonymizer) storeFailed(what string, err error) {
+	a.storeDownUntil.Store(time.Now().Add(storeRetryAfter).UnixNano())
+	a.log.Errorf("session_store", "%s: %v (not using the store for %s)", what, err, storeRetryAfter)
+}
+
+// queueStoreLocked queues one sealed mapping for the next flushStore.
+// a.sessionMu must be held for writing.
+func (a *Anonymizer) queueStoreLocked(sessionID, token, sealed string) {
+	if a.store == nil {
+		return
+	}
+	m := a.storePending[sessionID]
+	if m == nil {
+		m = make(map[string]string)
+		a.storePending[sessionID] = m
+	}
+	m[token] = sealed
+}
+
+// flushStore writes sessionID's queued mappings to the shared store in one
+// call. A failed write is logged: the tokens are already in the request, so
+// the worst case is that another instance cannot restore them.
+func (a *Anonymizer) flushStore(sessionID string) {
+	if a.store == nil || sessionID == "" {
+		return
+	}
+	a.sessionMu.Lock()
+	m := a.storePending[sessionID]
+	delete(a.storePending, sessionID)
+	a.sessionMu.Unlock()
+	if len(m) == 0 || !a.storeUsable() {
+		return
+	}
+	if err := a.store.Put(sessionID, m); err != nil {
+		a.storeFailed(fmt.Sprintf("cannot store %d tokens of session %s", len(m), sessionID), err)
+	}
+}
+
+// storeGet returns the shared store's sealed mappings for sessionID; nil
+// without a usable store or when the read fails.
+func (a *Anonymizer) storeGet(sessionID string) map[string]string {
+	if !a.storeUsable() {
+		return nil
+	}
+	m, err := a.store.Get(sessionID)
+	if err != nil {
+		a.storeFailed("cannot read session "+sessionID, err)
+		return nil
+	}
+	return m
+}
+
+// storeDelete removes sessions from the shared store, if it is usable.
+func (a *Anonymizer) storeDelete(sessionIDs ...string) {
+	for _, id := range sessionIDs {
+		if !a.storeUsable() {
+			return
+		}
+		if err := a.store.Delete(id); err != nil {
+			a.storeFailed("cannot delete session "+id, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package anonymizer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// redisKeyPrefix namespaces session hashes in a shared Redis database.
+	redisKeyPrefix = "ai-anonymizing-proxy:session:"
+
+	// redisSessionExpiry is how long a session hash outlives its last write.
+	// Instances delete their sessions when done; the expiry only reclaims
+	// those of an instance that died first.
+	redisSessionExpiry = time.Hour
+
+	redisTimeout  = 2 * time.Second
+	redisMaxIdle  = 8
+	redisMaxReply = 64 << 20 // bytes; guards against a corrupt length prefix
+)
+
+// RedisSessionStore is a SessionStore on a Redis server, so proxy instances
+// behind one load balancer can restore each other's tokens. Each session is
+// a hash of token → original. It speaks the plain RESP protocol over TCP;
+// TLS is not supported, so keep the server on a private network and set
+// EncryptionKey so it only ever holds sealed originals.
+type RedisSessionStore struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *redisConn
+}
+
+// redisConn is one connection with its reply reader.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewRedisSessionStore returns a store for a redis://[:password@]host[:port][/db]
+// URL. Connections are opened on first use, so an unreachable server shows
+// up as logged store errors rather than here.
+func NewRedisSessionStore(rawURL string) (*RedisSessionStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("session store URL: %w", err)
+	}
+	if u.Scheme != "redis" || u.Hostname() == "" {
+		return nil, fmt.Errorf("session store URL %q: want redis://host[:port][/db]", u.Redacted())
+	}
+	s := &RedisSessionStore{
+		addr: u.Host,
+		idle: make(chan *redisConn, redisMaxIdle),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if pw, ok := u.User.Password(); ok {
+		s.password = pw
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil || s.db < 0 {
+			return nil, fmt.Errorf("session store URL %q: database %q is not a number", u.Redacted(), db)
+		}
+	}
+	return s, nil
+}
+
+// Put implements SessionStore with one HSETNX per mapping, pipelined in a
+// single round trip. The hash's expiry is renewed on every write.
+func (s *RedisSessionStore) Put(sessionID string, mappings map[string]string) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	key := redisKeyPrefix + sessionID
+	cmds := make([][]string, 0, len(mappings)+1)
+	for token, original := range mappings {
+		cmds = append(cmds, []string{"HSETNX", key, token, original})
+	}
+	cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(int(redisSessionExpiry.Seconds()))})
+	_, err := s.do(cmds...)
+	return err
+}
+
+// Get implements SessionStore.
+func (s *RedisSessionStore) Get(sessionID string) (map[string]string, error) {
+	replies, err := s.do([]string{"HGETALL", redisKeyPrefix + sessionID})
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := replies[0].([]any)
+	if !ok || len(fields)%2 != 0 {
+		return nil, fmt.Errorf("redis: unexpected HGETALL reply %T", replies[0])
+	}
+	m := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		k, _ := fields[i].(string)
+		v, _ := fields[i+1].(string)
+		m[k] = v
+	}
+	return m, nil
+}
+
+// Delete implements SessionStore.
+func (s *RedisSessionStore) Delete(sessionID string) error {
+	_, err := s.do([]string{"DEL", redisKeyPrefix + sessionID})
+	return err
+}
+
+// Close closes the idle connections.
+func (s *RedisSessionStore) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			_ = c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends cmds in one round trip and returns their replies in order. A
+// connection that saw any error is closed rather than reused, since its
+// reply stream may be out of step.
+func (s *RedisSessionStore) do(cmds ...[]string) ([]any, error) {
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := c.roundTrip(cmds...)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- c:
+	default:
+		_ = c.Close()
+	}
+	return replies, nil
+}
+
+// conn returns an idle connection or dials a new one, authenticated and on
+// the configured database.
+func (s *RedisSessionStore) conn() (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", s.addr, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	var setup [][]string
+	if s.password != "" {
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := c.roundTrip(setup...); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// roundTrip writes cmds and reads one reply per command. An error reply to
+// any command is returned after all replies have been read.
+func (c *redisConn) roundTrip(cmds ...[]string) ([]any, error) {
+	if err := c.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	replies := make([]any, len(cmds))
+	var replyErr error
+	for i := range replies {
+		v, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := v.(redisError); ok && replyErr == nil {
+			replyErr = e
+		}
+		replies[i] = v
+	}
+	return replies, replyErr
+}
+
+// readReply reads one RESP value: a string, int64, redisError, nil or []any.
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > redisMaxReply {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > redisMaxReply {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line)
+}
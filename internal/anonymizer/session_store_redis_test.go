@@ -0,0 +1,187 @@
+package anonymizer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis serves the handful of commands RedisSessionStore sends, enough
+// to check the protocol code without a real server.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	cmds   []string // command names in arrival order
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, hashes: map[string]map[string]string{}}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer func() { _ = c.Close() }()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.cmds = append(f.cmds, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "HSETNX":
+			h := f.hashes[args[1]]
+			if h == nil {
+				h = map[string]string{}
+				f.hashes[args[1]] = h
+			}
+			n := 0
+			if _, ok := h[args[2]]; !ok {
+				h[args[2]] = args[3]
+				n = 1
+			}
+			reply = fmt.Sprintf(":%d\r\n", n)
+		case args[0] == "EXPIRE":
+			reply = ":1\r\n"
+		case args[0] == "HGETALL":
+			h := f.hashes[args[1]]
+			var b strings.Builder
+			fmt.Fprintf(&b, "*%d\r\n", 2*len(h))
+			for k, v := range h {
+				fmt.Fprintf(&b, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(k), k, len(v), v)
+			}
+			reply = b.String()
+		case args[0] == "DEL":
+			delete(f.hashes, args[1])
+			reply = ":1\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads one RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	s, err := NewRedisSessionStore("redis://:s3cret@" + f.ln.Addr().String() + "/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+
+	if err := s.Put("sid", map[string]string{"[PII_EMAIL_1]": "alice@example.com", "[PII_PHONE_2]": "555-0100"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("sid", map[string]string{"[PII_EMAIL_1]": "other@example.com"}); err != nil {
+		t.Fatalf("second Put: %v", err)
+	}
+	m, err := s.Get("sid")
+	if err != nil || len(m) != 2 || m["[PII_EMAIL_1]"] != "alice@example.com" {
+		t.Errorf("Get = %v, %v; want both first mappings", m, err)
+	}
+	if m, err := s.Get("unknown"); err != nil || len(m) != 0 {
+		t.Errorf("Get(unknown) = %v, %v; want empty, nil", m, err)
+	}
+	if err := s.Delete("sid"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if m, _ := s.Get("sid"); len(m) != 0 {
+		t.Errorf("Get after Delete = %v, want empty", m)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := strings.Join(f.cmds[:2], " "); got != "AUTH SELECT" {
+		t.Errorf("connection setup = %q, want AUTH SELECT", got)
+	}
+	if _, ok := f.hashes[redisKeyPrefix+"sid"]; ok {
+		t.Error("hash left behind after Delete")
+	}
+}
+
+func TestRedisSessionStore_ErrorReply(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	s, err := NewRedisSessionStore("redis://:wrong@" + f.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("sid", map[string]string{"tok": "val"}); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Put with a bad password: err = %v, want WRONGPASS", err)
+	}
+}
+
+func TestNewRedisSessionStore_BadURL(t *testing.T) {
+	for _, u := range []string{"http://cache:6379", "redis://", "redis://cache/notadb", "redis://cache/-1"} {
+		if _, err := NewRedisSessionStore(u); err == nil {
+			t.Errorf("%q: expected an error", u)
+		}
+	}
+	s, err := NewRedisSessionStore("redis://cache")
+	if err != nil || s.addr != "cache:6379" {
+		t.Errorf("default port: addr %q, err %v", s.addr, err)
+	}
+}
@@ -0,0 +1,217 @@
+package anonymizer
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newStoreTestAnonymizer(store SessionStore, key []byte) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:      "http://127.0.0.1:1",
+		OllamaModel:         "test-model",
+		AIThreshold:         0.8,
+		OllamaMaxConcurrent: 1,
+		EncryptionKey:       key,
+		SessionStore:        store,
+	})
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	s := NewMemorySessionStore()
+	if m, err := s.Get("missing"); err != nil || len(m) != 0 {
+		t.Errorf("Get(missing) = %v, %v; want empty, nil", m, err)
+	}
+	_ = s.Put("s1", map[string]string{"[PII_EMAIL_1]": "alice@example.com"})
+	_ = s.Put("s1", map[string]string{"[PII_EMAIL_1]": "overwritten@example.com", "[PII_PHONE_2]": "555-0100"})
+
+	m, _ := s.Get("s1")
+	if len(m) != 2 || m["[PII_EMAIL_1]"] != "alice@example.com" {
+		t.Errorf("Get(s1) = %v; want two mappings, first write kept", m)
+	}
+	m["[PII_EMAIL_1]"] = "changed"
+	if again, _ := s.Get("s1"); again["[PII_EMAIL_1]"] != "alice@example.com" {
+		t.Error("Get returned the store's own map, not a copy")
+	}
+
+	_ = s.Delete("s1")
+	if m, _ := s.Get("s1"); len(m) != 0 {
+		t.Errorf("Get after Delete = %v, want empty", m)
+	}
+}
+
+func TestSessionStore_SharedMemory(t *testing.T) {
+	store := NewMemorySessionStore()
+	a := newStoreTestAnonymizer(store, nil)
+	b := newStoreTestAnonymizer(store, nil)
+
+	const sid = "shared"
+	masked := a.AnonymizeText("Mail alice@example.com", sid)
+	if got := b.DeanonymizeText(masked, sid); got != "Mail alice@example.com" {
+		t.Errorf("other instance restored %q", got)
+	}
+	if _, ok := b.SessionMappings(sid); !ok {
+		t.Error("SessionMappings on the other instance did not find the session")
+	}
+
+	a.DeleteSession(sid)
+	if got := b.DeanonymizeText(masked, sid); got != masked {
+		t.Errorf("session still restorable after DeleteSession: %q", got)
+	}
+}
+
+// remoteStore stands in for a networked SessionStore: every session crosses
+// a JSON encoding, as it would a wire, and the stored bytes can be inspected.
+// Values are encoded as []byte (base64) since sealed originals are binary.
+type remoteStore struct {
+	mu    sync.Mutex
+	data  map[string][]byte // sessionID → JSON-encoded map
+	fail  bool
+	calls int // round trips, failed ones included
+	puts  int
+}
+
+var errStoreDown = errors.New("store unreachable")
+
+func (r *remoteStore) Put(sessionID string, mappings map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	r.puts++
+	if r.fail {
+		return errStoreDown
+	}
+	m := map[string][]byte{}
+	if raw, ok := r.data[sessionID]; ok {
+		_ = json.Unmarshal(raw, &m)
+	}
+	for token, original := range mappings {
+		if _, ok := m[token]; !ok {
+			m[token] = []byte(original)
+		}
+	}
+	r.data[sessionID], _ = json.Marshal(m)
+	return nil
+}
+
+func (r *remoteStore) Get(sessionID string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail {
+		return nil, errStoreDown
+	}
+	m := map[string][]byte{}
+	if raw, ok := r.data[sessionID]; ok {
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, err
+		}
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = string(v)
+	}
+	return out, nil
+}
+
+func (r *remoteStore) Delete(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail {
+		return errStoreDown
+	}
+	delete(r.data, sessionID)
+	return nil
+}
+
+func TestSessionStore_CrossInstanceRestore(t *testing.T) {
+	store := &remoteStore{data: map[string][]byte{}}
+	a := newStoreTestAnonymizer(store, testEncryptionKey)
+	b := newStoreTestAnonymizer(store, testEncryptionKey)
+
+	const sid = "req-1"
+	const input = "Mail alice@example.com about SSN 123-45-6789"
+	masked := a.AnonymizeText(input, sid)
+	if masked == input {
+		t.Fatal("nothing was anonymized")
+	}
+
+	raw := string(store.data[sid])
+	if raw == "" {
+		t.Fatal("no mappings reached the store")
+	}
+	if strings.Contains(raw, "alice@example.com") || strings.Contains(raw, "123-45-6789") {
+		t.Errorf("store holds plaintext originals: %s", raw)
+	}
+
+	// b never saw the request: restoring relies on the store alone.
+	if got := b.DeanonymizeText(masked, sid); got != input {
+		t.Errorf("cross-instance restore = %q, want %q", got, input)
+	}
+	if n := b.ActiveSessions(); n != 0 {
+		t.Errorf("reading a session opened b's own count to %d, want 0", n)
+	}
+
+	a.DeleteSession(sid)
+	if _, ok := store.data[sid]; ok {
+		t.Error("DeleteSession left the session in the store")
+	}
+}
+
+// TestSessionStore_OnePutPerRequest verifies that a request's new mappings
+// reach the store in a single Put, not one round trip per token.
+func TestSessionStore_OnePutPerRequest(t *testing.T) {
+	store := &remoteStore{data: map[string][]byte{}}
+	a := newStoreTestAnonymizer(store, nil)
+
+	const sid = "batched"
+	body := []byte(`{"messages":[{"role":"user","content":"Mail alice@example.com"},` +
+		`{"role":"user","content":"and bob@example.org, SSN 123-45-6789"}]}`)
+	a.AnonymizeJSON(body, sid)
+	if store.puts != 1 {
+		t.Errorf("Put called %d times for one request, want 1", store.puts)
+	}
+	m, _ := store.Get(sid)
+	if len(m) != 3 {
+		t.Errorf("store holds %d mappings, want 3: %v", len(m), m)
+	}
+}
+
+func TestSessionStore_Unavailable(t *testing.T) {
+	store := &remoteStore{data: map[string][]byte{}, fail: true}
+	a := newStoreTestAnonymizer(store, nil)
+
+	const sid = "local"
+	const input = "Mail alice@example.com"
+	masked := a.AnonymizeText(input, sid)
+	if masked == input {
+		t.Fatal("store errors must not stop anonymization")
+	}
+	if got := a.DeanonymizeText(masked, sid); got != input {
+		t.Errorf("local restore with store down = %q, want %q", got, input)
+	}
+	a.DeleteSession(sid)
+
+	// The failed Put paused the store: later requests do not wait on it.
+	if store.calls != 1 {
+		t.Errorf("store called %d times after a failure, want 1", store.calls)
+	}
+	a.AnonymizeText("Mail bob@example.org", "next")
+	a.DeleteSession("next")
+	if store.calls != 1 {
+		t.Errorf("store called again during the pause: %d calls", store.calls)
+	}
+
+	// Once the pause is over the store is tried again.
+	store.mu.Lock()
+	store.fail = false
+	store.mu.Unlock()
+	a.storeDownUntil.Store(0)
+	a.AnonymizeText("Mail carol@example.net", "after")
+	if m, _ := store.Get("after"); len(m) != 1 {
+		t.Errorf("store not used after the pause: %v", m)
+	}
+}
@@ -0,0 +1,80 @@
+// Package anonymizer — session_ttl.go
+//
+// The proxy deletes a request's session as soon as its response has been
+// deanonymized. A client that retries and sends earlier tokens back can then
+// get a response whose tokens nothing restores. With Options.SessionTTL set,
+// DeleteSession only marks the session as ending; its token map stays
+// readable for the TTL and a background sweeper removes it afterwards.
+//
+// An ending session no longer counts as active, so it does not hold a
+// MaxSessions slot while it lingers.
+package anonymizer
+
+import (
+	"sync"
+	"time"
+)
+
+// minSessionSweepInterval bounds how often the sweeper runs for very short
+// TTLs.
+const minSessionSweepInterval = time.Millisecond
+
+// endSessionLocked marks sessionID as ending, to be removed by the sweeper
+// once the TTL has passed. a.sessionMu must be held for writing.
+func (a *Anonymizer) endSessionLocked(sessionID string) {
+	if _, ok := a.sessions[sessionID]; !ok {
+		delete(a.tokenCounts, sessionID)
+		delete(a.sessionProf, sessionID)
+		delete(a.started, sessionID)
+		return
+	}
+	if _, ending := a.ending[sessionID]; !ending {
+		a.ending[sessionID] = time.Now().Add(a.sessionTTL)
+	}
+}
+
+// sweepSessions removes the ending sessions whose TTL ran out before now,
+// from the shared SessionStore too.
+func (a *Anonymizer) sweepSessions(now time.Time) {
+	var expired []string
+	defer func() { a.storeDelete(expired...) }()
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	for id, expires := range a.ending {
+		if now.After(expires) {
+			expired = append(expired, id)
+			delete(a.sessions, id)
+			delete(a.tokenCounts, id)
+			delete(a.ending, id)
+			delete(a.sessionProf, id)
+			delete(a.started, id)
+			delete(a.storePending, id)
+		}
+	}
+}
+
+// startSessionSweeper runs sweepSessions every half TTL in a background
+// goroutine. The returned stop function ends it and waits for it to exit;
+// it is safe to call more than once.
+func (a *Anonymizer) startSessionSweeper() (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(max(a.sessionTTL/2, minSessionSweepInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				a.sweepSessions(now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
@@ -0,0 +1,98 @@
+package anonymizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSessionTTLAnonymizer(ttl time.Duration, maxSessions int) *Anonymizer {
+	return NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: "http://localhost:11434",
+		EnabledPacks:   []string{"GLOBAL"},
+		SessionTTL:     ttl,
+		MaxSessions:    maxSessions,
+	})
+}
+
+func TestSessionTTLKeepsDeletedSession(t *testing.T) {
+	a := newSessionTTLAnonymizer(100*time.Millisecond, 0)
+	defer func() { _ = a.Close() }()
+
+	anonymized := a.AnonymizeText("mail alice@example.com", "sess-ttl")
+	a.DeleteSession("sess-ttl")
+
+	if got := a.DeanonymizeText(anonymized, "sess-ttl"); got != "mail alice@example.com" {
+		t.Errorf("within TTL: got %q, want the original restored", got)
+	}
+	if n := a.ActiveSessions(); n != 0 {
+		t.Errorf("ActiveSessions = %d, want 0 for a deleted session", n)
+	}
+
+	if !waitUntil(func() bool { return a.SessionTokenCount("sess-ttl") == 0 }) {
+		t.Fatal("session not swept after the TTL")
+	}
+	if got := a.DeanonymizeText(anonymized, "sess-ttl"); strings.Contains(got, "alice@example.com") {
+		t.Errorf("after TTL: got %q, want the token left in place", got)
+	}
+	a.sessionMu.RLock()
+	defer a.sessionMu.RUnlock()
+	if len(a.sessions) != 0 || len(a.ending) != 0 {
+		t.Errorf("state left after sweep: sessions=%d ending=%d", len(a.sessions), len(a.ending))
+	}
+}
+
+func TestSessionTTLZeroDeletesAtOnce(t *testing.T) {
+	a := newSessionTTLAnonymizer(0, 0)
+	defer func() { _ = a.Close() }()
+
+	anonymized := a.AnonymizeText("mail alice@example.com", "sess-now")
+	a.DeleteSession("sess-now")
+	if got := a.DeanonymizeText(anonymized, "sess-now"); got != anonymized {
+		t.Errorf("got %q, want %q unchanged", got, anonymized)
+	}
+}
+
+func TestSessionTTLFreesSessionSlot(t *testing.T) {
+	a := newSessionTTLAnonymizer(time.Minute, 1)
+	defer func() { _ = a.Close() }()
+
+	if err := a.BeginSession("sess-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.BeginSession("sess-b"); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("second session: err = %v, want ErrTooManySessions", err)
+	}
+	a.DeleteSession("sess-a")
+	if err := a.BeginSession("sess-b"); err != nil {
+		t.Fatalf("slot not freed by DeleteSession: %v", err)
+	}
+
+	// Reopening an ending session takes a slot again.
+	if err := a.BeginSession("sess-a"); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("reopen over limit: err = %v, want ErrTooManySessions", err)
+	}
+	a.DeleteSession("sess-b")
+	if err := a.BeginSession("sess-a"); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if n := a.ActiveSessions(); n != 1 {
+		t.Errorf("ActiveSessions = %d, want 1", n)
+	}
+}
+
+func TestSessionTTLCloseStopsSweeper(t *testing.T) {
+	a := newSessionTTLAnonymizer(time.Hour, 0)
+	done := make(chan struct{})
+	go func() {
+		_ = a.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return; sweeper not stopped")
+	}
+	a.stopSweep() // safe to call again
+}
@@ -0,0 +1,112 @@
+// Package anonymizer — shadow.go
+//
+// Shadow mode measures what Ollama would change about detection without
+// touching the live path. For a sampled fraction of requests the text is
+// scanned by the regex patterns alone and also sent to Ollama; the per-type
+// counts of the two views are compared and the difference is logged. The
+// live request is anonymized as configured and never waits for the
+// comparison. Only type names and counts are logged, never values.
+package anonymizer
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// maybeShadow samples one request body for shadow comparison. A selected
+// body is compared in a background goroutine; at most one comparison runs
+// at a time and further samples are dropped while it does.
+func (a *Anonymizer) maybeShadow(body []byte) {
+	if a.shadowRate <= 0 || len(body) == 0 || rand.Float64() >= a.shadowRate { // #nosec G404 -- sampling, not security
+		return
+	}
+	select {
+	case a.shadowSem <- struct{}{}:
+	default:
+		return
+	}
+	text := shadowText(body)
+	go func() {
+		defer func() { <-a.shadowSem }()
+		added, removed, err := a.shadowCompare(text)
+		if err != nil {
+			a.log.Errorf("shadow", "shadow comparison failed: %v", err)
+			return
+		}
+		a.log.Infof("shadow", "shadow diff (regex+Ollama vs regex-only): added %v, removed %v", added, removed)
+	}()
+}
+
+// shadowText returns the text the live path would scan: the string values of
+// a JSON body joined by newlines, or the body itself if it is not JSON.
+func shadowText(body []byte) string {
+	var parts []string
+	if _, ok := scanJSON(body, func(s string) string {
+		parts = append(parts, s)
+		return s
+	}); ok {
+		return strings.Join(parts, "\n")
+	}
+	return string(body)
+}
+
+// shadowCompare runs regex-only and regex+Ollama detection over text and
+// returns, per PII type, how many more (added) or fewer (removed) detections
+// the Ollama view has. In the Ollama view, high-confidence regex matches are
+// kept, low-confidence ones count only if Ollama confirms the value (under
+// Ollama's type), and values Ollama finds that no pattern matched are added.
+//
+// Values of types on the Ollama denylist are replaced by their tokens before
+// the text is sent, so shadow mode never shows them to Ollama either.
+func (a *Anonymizer) shadowCompare(text string) (added, removed map[PIIType]int, err error) {
+	_, hits := a.detect(text, a.patterns)
+	query := text
+	for _, h := range hits {
+		if a.ollamaDeny[h.Type] {
+			query = strings.ReplaceAll(query, h.Value, a.replacement(h.Type, h.Value))
+		}
+	}
+	detections, err := a.queryOllamaHTTP(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	confirmed := make(map[string]PIIType, len(detections))
+	for _, d := range detections {
+		// An allowlisted value is never masked, whoever finds it.
+		if d.Original != "" && d.Confidence >= a.threshold() && !a.allowlisted(d.Original) {
+			confirmed[d.Original] = PIIType(strings.ToUpper(string(d.PIIType)))
+		}
+	}
+
+	regexOnly := make(map[PIIType]int)
+	withAI := make(map[PIIType]int)
+	matched := make(map[string]bool)
+	for _, h := range hits {
+		regexOnly[h.Type]++
+		matched[h.Value] = true
+		if h.Confidence >= a.threshold() {
+			withAI[h.Type]++
+		} else if t, ok := confirmed[h.Value]; ok {
+			withAI[t]++
+		}
+	}
+	for v, t := range confirmed {
+		if !matched[v] {
+			withAI[t]++
+		}
+	}
+
+	added = make(map[PIIType]int)
+	removed = make(map[PIIType]int)
+	for t, n := range withAI {
+		if d := n - regexOnly[t]; d > 0 {
+			added[t] = d
+		}
+	}
+	for t, n := range regexOnly {
+		if d := n - withAI[t]; d > 0 {
+			removed[t] = d
+		}
+	}
+	return added, removed, nil
+}
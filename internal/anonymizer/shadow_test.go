@@ -0,0 +1,163 @@
+package anonymizer
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newShadowOllama stubs Ollama: it confirms the email, finds a name no
+// pattern covers, and does not report the phone number.
+func newShadowOllama(t *testing.T, calls *atomic.Int64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"response":"[` +
+			`{\"original\":\"alice@example.com\",\"type\":\"email\",\"confidence\":0.95},` +
+			`{\"original\":\"Jane Roe\",\"type\":\"name\",\"confidence\":0.9}]"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newShadowAnonymizer(ollamaURL string, rate float64) *Anonymizer {
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:   ollamaURL,
+		AIThreshold:      0.8,
+		EnabledPacks:     []string{"GLOBAL", "US"},
+		ShadowSampleRate: rate,
+	})
+	a.ollamaURL = ollamaURL
+	return a
+}
+
+const shadowInput = "mail alice@example.com or call 555-867-5309, ask for Jane Roe"
+
+func TestShadowCompare(t *testing.T) {
+	var calls atomic.Int64
+	a := newShadowAnonymizer(newShadowOllama(t, &calls).URL, 0)
+
+	added, removed, err := a.shadowCompare(shadowInput)
+	if err != nil {
+		t.Fatalf("shadowCompare: %v", err)
+	}
+	if len(added) != 1 || added[PIIName] != 1 {
+		t.Errorf("added = %v, want map[NAME:1]", added)
+	}
+	if len(removed) != 1 || removed[PIIPhone] != 1 {
+		t.Errorf("removed = %v, want map[PHONE:1]", removed)
+	}
+}
+
+// TestShadowCompareAllowlist verifies that allowlisted values count in
+// neither view, whether a pattern or Ollama finds them.
+func TestShadowCompareAllowlist(t *testing.T) {
+	var calls atomic.Int64
+	srv := newShadowOllama(t, &calls)
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint: srv.URL,
+		AIThreshold:    0.8,
+		EnabledPacks:   []string{"GLOBAL", "US"},
+		Allowlist:      []string{"Alice@Example.com", "Jane Roe"},
+	})
+	a.ollamaURL = srv.URL
+
+	added, removed, err := a.shadowCompare(shadowInput)
+	if err != nil {
+		t.Fatalf("shadowCompare: %v", err)
+	}
+	if len(added) != 0 {
+		t.Errorf("added = %v, want none", added)
+	}
+	if len(removed) != 1 || removed[PIIPhone] != 1 {
+		t.Errorf("removed = %v, want map[PHONE:1]", removed)
+	}
+}
+
+func TestShadowCompareMasksDenylistedTypes(t *testing.T) {
+	var prompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		prompt = string(body)
+		_, _ = w.Write([]byte(`{"response":"[]"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	a := NewWithCacheAndCapacity(Options{
+		OllamaEndpoint:     srv.URL,
+		AIThreshold:        0.8,
+		EnabledPacks:       []string{"GLOBAL", "US"},
+		OllamaTypeDenylist: []string{"PHONE"},
+	})
+	a.ollamaURL = srv.URL
+
+	if _, _, err := a.shadowCompare(shadowInput); err != nil {
+		t.Fatalf("shadowCompare: %v", err)
+	}
+	if strings.Contains(prompt, "555-867-5309") {
+		t.Error("denylisted phone number was sent to Ollama")
+	}
+	if !strings.Contains(prompt, "alice@example.com") {
+		t.Error("non-denylisted text should still be sent")
+	}
+}
+
+// syncBuffer is a log sink safe to read while the shadow goroutine writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestShadowModeLogsDiffForSampledRequest(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var calls atomic.Int64
+	srv := newShadowOllama(t, &calls)
+	body := []byte(`{"messages":[{"role":"user","content":"` + shadowInput + `"}]}`)
+
+	live := newShadowAnonymizer(srv.URL, 0).AnonymizeJSON(body, "sess-live")
+	if calls.Load() != 0 {
+		t.Fatalf("unsampled request queried Ollama %d times", calls.Load())
+	}
+
+	got := newShadowAnonymizer(srv.URL, 1).AnonymizeJSON(body, "sess-shadow")
+	if !bytes.Equal(got, live) {
+		t.Errorf("shadow mode changed the live result:\n got %s\nwant %s", got, live)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "shadow diff") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "added map[NAME:1], removed map[PHONE:1]") {
+		t.Errorf("shadow diff not logged as expected:\n%s", out)
+	}
+	for _, original := range []string{"alice@example.com", "555-867-5309", "Jane Roe"} {
+		if strings.Contains(out, original) {
+			t.Errorf("log contains original value %q", original)
+		}
+	}
+}
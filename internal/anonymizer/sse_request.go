@@ -0,0 +1,128 @@
+// Package anonymizer — sse_request.go
+//
+// Some agent frameworks send their requests framed as server-sent events
+// (Content-Type: text/event-stream). Such a body is not one JSON document,
+// so AnonymizeJSON would scan it as plain text and miss PII that the event
+// payloads JSON-escape (alice\u0040example.com). AnonymizeSSE is the
+// response-side streaming path in reverse: it parses the events and
+// anonymizes each event's data payload on its own — string values for JSON
+// payloads, the whole payload otherwise — and keeps the framing intact.
+//
+// The body has already been buffered in full by the proxy. No PII
+// instruction is injected: an event is a fragment, not a request document
+// with a system prompt.
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// sseLine is one line of an SSE-framed body. For a data line, prefix is
+// "data:" with its optional space and payload the rest, up to eol.
+type sseLine struct {
+	raw                  []byte
+	data                 bool
+	prefix, payload, eol []byte
+}
+
+// AnonymizeSSE anonymizes the data lines of an SSE-framed request body,
+// recording mappings under sessionID. Comments, event/id/retry fields,
+// blank lines and line endings are copied through unchanged.
+func (a *Anonymizer) AnonymizeSSE(body []byte, sessionID string) []byte {
+	defer a.flushStore(sessionID)
+	var out bytes.Buffer
+	out.Grow(len(body))
+	var event []sseLine // lines read since the blank line ending the last event
+	for len(body) > 0 {
+		line := body
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			line = body[:i+1]
+		}
+		body = body[len(line):]
+
+		content := bytes.TrimRight(line, "\r\n")
+		l := sseLine{raw: line}
+		if payload, ok := bytes.CutPrefix(content, []byte("data:")); ok {
+			payload, _ = bytes.CutPrefix(payload, []byte(" "))
+			l.data = true
+			l.prefix = content[:len(content)-len(payload)]
+			l.payload = payload
+			l.eol = line[len(content):]
+		}
+		event = append(event, l)
+		if len(content) == 0 {
+			a.writeSSEEvent(&out, event, sessionID)
+			event = event[:0]
+		}
+	}
+	a.writeSSEEvent(&out, event, sessionID)
+	return out.Bytes()
+}
+
+// writeSSEEvent writes the lines of one event to out. Its data lines are
+// joined with "\n" into one payload, as an SSE client reads them, so a JSON
+// payload spread over several lines is still parsed as JSON. The anonymized
+// payload is split back over the data lines; when anonymizing changed the
+// line count (a re-encoded JSON payload is one line), surplus data lines are
+// dropped and extra ones follow the last.
+func (a *Anonymizer) writeSSEEvent(out *bytes.Buffer, event []sseLine, sessionID string) {
+	var payloads [][]byte
+	for _, l := range event {
+		if l.data {
+			payloads = append(payloads, l.payload)
+		}
+	}
+	var parts [][]byte
+	if len(payloads) > 0 {
+		parts = bytes.Split(a.anonymizeEventData(bytes.Join(payloads, []byte("\n")), sessionID), []byte("\n"))
+	}
+	seen := 0
+	for _, l := range event {
+		if !l.data {
+			out.Write(l.raw)
+			continue
+		}
+		seen++
+		n := min(1, len(parts))
+		if seen == len(payloads) {
+			n = len(parts) // the last data line takes the rest
+		}
+		for i, p := range parts[:n] {
+			out.Write(l.prefix)
+			out.Write(p)
+			if i < n-1 && len(l.eol) == 0 {
+				out.WriteByte('\n')
+			} else {
+				out.Write(l.eol)
+			}
+		}
+		parts = parts[n:]
+	}
+}
+
+// anonymizeEventData anonymizes one event's data payload. A payload that
+// cannot be re-encoded falls back to plain-text scanning rather than being
+// forwarded as-is. With PreserveJSONFormat a JSON payload is edited in
+// place, as request bodies are.
+func (a *Anonymizer) anonymizeEventData(payload []byte, sessionID string) []byte {
+	if a.preserveJSON {
+		e, ok := scanJSON(payload, func(s string) string {
+			return a.anonymizeText(s, sessionID)
+		})
+		if !ok {
+			return []byte(a.anonymizeText(string(payload), sessionID))
+		}
+		return e.result()
+	}
+	var doc any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return []byte(a.anonymizeText(string(payload), sessionID))
+	}
+	out, err := jsonMarshal(a.walkValue(context.Background(), doc, sessionID))
+	if err != nil {
+		return []byte(a.anonymizeText(string(payload), sessionID))
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package anonymizer
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAnonymizeSSE verifies that each data payload of a client SSE body is
+// anonymized on its own — JSON payloads after unescaping — and that every
+// other byte of the framing is kept.
+func TestAnonymizeSSE(t *testing.T) {
+	a := newTestAnonymizer()
+	const sessionID = "sess-sse-request"
+	body := ": keep-alive\r\n" +
+		"event: message\r\n" +
+		"id: 7\r\n" +
+		`data: {"role":"user","content":"mail alice\u0040example.com"}` + "\r\n" +
+		"\r\n" +
+		"data:call 555-867-5309 or bob@example.com\n" +
+		"\n" +
+		// One JSON payload over two data lines, joined with "\n".
+		`data: {"role":"user",` + "\n" +
+		"id: 8\n" +
+		`data:  "content":"mail carol\u0040example.com"}` + "\n" +
+		"\n" +
+		"data: [DONE]"
+
+	out := string(a.AnonymizeSSE([]byte(body), sessionID))
+
+	for _, pii := range []string{"alice", "bob@example.com", "555-867-5309", "carol"} {
+		if strings.Contains(out, pii) {
+			t.Errorf("PII %q forwarded: %q", pii, out)
+		}
+	}
+	alice := a.replacement(PIIEmail, "alice@example.com")
+	bob := a.replacement(PIIEmail, "bob@example.com")
+	carol := a.replacement(PIIEmail, "carol@example.com")
+	phone := a.replacement(PIIPhone, "555-867-5309")
+	want := ": keep-alive\r\n" +
+		"event: message\r\n" +
+		"id: 7\r\n" +
+		`data: {"content":"mail ` + alice + `","role":"user"}` + "\r\n" +
+		"\r\n" +
+		"data:call " + phone + " or " + bob + "\n" +
+		"\n" +
+		`data: {"content":"mail ` + carol + `","role":"user"}` + "\n" +
+		"id: 8\n" +
+		"\n" +
+		"data: [DONE]"
+	if out != want {
+		t.Errorf("framing not preserved:\n got %q\nwant %q", out, want)
+	}
+	if got := a.DeanonymizeText(out, sessionID); !strings.Contains(got, "alice@example.com") || !strings.Contains(got, "bob@example.com") {
+		t.Errorf("round trip lost originals: %q", got)
+	}
+}
+
+// TestAnonymizeSSEPreserveFormat verifies that with PreserveJSONFormat an
+// event's JSON keeps its key order and spacing; only the PII is replaced.
+func TestAnonymizeSSEPreserveFormat(t *testing.T) {
+	a := newPreserveJSONTestAnonymizer()
+	const sessionID = "sess-sse-preserve"
+	body := `data: {"role": "user", "content": "mail alice@example.com", "n": 1.50}` + "\n\n" +
+		`data: {"role": "user",` + "\n" +
+		`data:  "content": "mail carol\u0040example.com"}` + "\n\n"
+
+	out := string(a.AnonymizeSSE([]byte(body), sessionID))
+
+	alice := a.replacement(PIIEmail, "alice@example.com")
+	carol := a.replacement(PIIEmail, "carol@example.com")
+	want := `data: {"role": "user", "content": "mail ` + alice + `", "n": 1.50}` + "\n\n" +
+		`data: {"role": "user",` + "\n" +
+		`data:  "content": "mail ` + carol + `"}` + "\n\n"
+	if out != want {
+		t.Errorf("event not edited in place:\n got %q\nwant %q", out, want)
+	}
+}
@@ -3,8 +3,9 @@ package anonymizer
 import (
 	"bytes"
 	"io"
-	"log"
 	"strings"
+
+	"ai-anonymizing-proxy/internal/logger"
 )
 
 // tokenSuffixLen is the number of bytes kept unflushed in the streaming
@@ -12,9 +13,12 @@ import (
 // token is [PII_CREDITCARD_XXXXXXXXXXXXXXXX] at 33 bytes (5 + 10 + 1 + 16 + 1).
 const tokenSuffixLen = 33
 
+// tokenPrefix starts every PII token; see replacement.
+const tokenPrefix = "[PII_"
+
 // safeCutPoint returns the byte index up to which accumulated text can be
 // safely flushed without splitting a partial PII token. It scans backward
-// from the suffix guard boundary looking for an unmatched '['.
+// from the suffix guard boundary looking for an unmatched token start.
 // Returns 0 if all text should be held in the accumulator.
 func safeCutPoint(accumulated string) int {
 	if len(accumulated) <= tokenSuffixLen {
@@ -22,13 +26,16 @@ func safeCutPoint(accumulated string) int {
 	}
 
 	cutAt := len(accumulated) - tokenSuffixLen
-	// Scan backward from the end of the string looking for '['.
-	// If an unmatched '[' is found, pull cutAt back to avoid splitting a token.
+	// Scan backward from the end of the string for the last '[' that can
+	// begin a token: followed by "PII_", or by a prefix of it at the end of
+	// the text. Other brackets (markdown links, array indexes) are skipped so
+	// they never hold text back.
+	// If the token start is unmatched, pull cutAt back to avoid splitting it.
 	// If a matched '[' ... ']' bracket straddles cutAt (i.e. '[' is before cutAt
 	// but ']' is at or after cutAt), pull cutAt back to the '[' position.
 	// Complete brackets entirely before cutAt are safe to flush.
 	for i := len(accumulated) - 1; i >= 0; i-- {
-		if accumulated[i] == '[' {
+		if accumulated[i] == '[' && mayStartToken(accumulated[i:]) {
 			closeBracket := strings.IndexByte(accumulated[i:], ']')
 			if closeBracket == -1 {
 				// Unmatched '[' — hold everything from here.
@@ -44,6 +51,15 @@ func safeCutPoint(accumulated string) int {
 	return cutAt
 }
 
+// mayStartToken reports whether s, which begins with '[', is or could grow
+// into the start of a token.
+func mayStartToken(s string) bool {
+	if len(s) < len(tokenPrefix) {
+		return strings.HasPrefix(tokenPrefix, s)
+	}
+	return strings.HasPrefix(s, tokenPrefix)
+}
+
 // pipeWriter is the subset of *io.PipeWriter the streaming framework uses.
 // Abstracting it lets tests inject a writer whose CloseWithError returns a
 // non-nil error, exercising the failure-logging path that a real
@@ -54,12 +70,21 @@ type pipeWriter interface {
 	CloseWithError(err error) error
 }
 
+// textReplacer is the token → original substitution applied to streamed
+// text. *strings.Replacer satisfies it; StreamingDeanonymize passes a
+// *tokenReplacer so it can also count the tokens that came back.
+type textReplacer interface {
+	Replace(s string) string
+}
+
 // streamContext holds the mutable state shared by the streaming framework
 // functions during a single StreamingDeanonymize invocation.
 type streamContext struct {
 	pw       pipeWriter
-	replacer *strings.Replacer
+	replacer textReplacer
 	provider StreamingDeanonymizer
+	onEnd    func() // optional; runs after the final flush, before the pipe closes
+	log      *logger.Logger
 }
 
 // writePipe writes multiple byte slices to a PipeWriter, stopping on the
@@ -90,6 +115,9 @@ func processLine(ctx *streamContext, line []byte) {
 	payload := line[len(sseDataPrefix):]
 	if !ctx.provider.ProcessDataPayload(payload) {
 		// Provider could not parse the payload — fall back to raw replacement.
+		// Flush first so text still held in the accumulator is emitted ahead
+		// of a terminator like [DONE]; clients stop reading there.
+		ctx.provider.Flush()
 		writePipe(ctx.pw, []byte(sseDataPrefix), []byte(ctx.replacer.Replace(string(payload))), []byte("\n"))
 	}
 }
@@ -120,10 +148,13 @@ func handleStreamEnd(lineBuf []byte, readErr error, ctx *streamContext) {
 		writePipe(ctx.pw, []byte(ctx.replacer.Replace(string(lineBuf))))
 	}
 	ctx.provider.Flush()
+	if ctx.onEnd != nil {
+		ctx.onEnd()
+	}
 	if readErr != io.EOF {
-		log.Printf("[ANONYMIZER] StreamingDeanonymize read error: %v", readErr)
+		ctx.log.Errorf("stream_read", "StreamingDeanonymize read error: %v", readErr)
 		if err := ctx.pw.CloseWithError(readErr); err != nil {
-			log.Printf("[ANONYMIZER] StreamingDeanonymize CloseWithError failed: %v", err)
+			ctx.log.Errorf("stream_close", "StreamingDeanonymize CloseWithError failed: %v", err)
 		}
 	}
 }
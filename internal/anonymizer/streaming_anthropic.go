@@ -2,7 +2,6 @@ package anonymizer
 
 import (
 	"encoding/json"
-	"log"
 	"strings"
 )
 
@@ -14,12 +13,41 @@ type sseEnvelope struct {
 	Index int       `json:"index"`
 }
 
+// sseDelta is a content_block_delta payload. Anthropic carries the text of
+// a thinking_delta in "thinking" and of a text_delta in "text".
 type sseDelta struct {
 	Type        string `json:"type"`
-	Text        string `json:"text"`
+	Text        string `json:"text,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
 	PartialJSON string `json:"partial_json,omitempty"`
 }
 
+// deltaTextField returns the JSON field that holds the text of a delta of
+// type deltaType.
+func deltaTextField(deltaType string) string {
+	if deltaType == "thinking_delta" {
+		return "thinking"
+	}
+	return "text"
+}
+
+// content returns the delta's text, from the field its type uses.
+func (d *sseDelta) content() string {
+	if deltaTextField(d.Type) == "thinking" {
+		return d.Thinking
+	}
+	return d.Text
+}
+
+// setContent replaces the delta's text in the field its type uses.
+func (d *sseDelta) setContent(s string) {
+	if deltaTextField(d.Type) == "thinking" {
+		d.Thinking = s
+		return
+	}
+	d.Text = s
+}
+
 // agentContentBlock represents a text block within a Managed Agents event.
 type agentContentBlock struct {
 	Type string `json:"type"`
@@ -41,8 +69,9 @@ type anthropicDeanonymizer struct {
 	opts          streamDeanonymizerOpts
 	textAccum     strings.Builder
 	jsonAccum     strings.Builder
-	lastIndex     int // content block index from the most recent text_delta
-	lastJSONIndex int // content block index from the most recent input_json_delta
+	lastIndex     int    // content block index of the text held in textAccum
+	lastTextType  string // delta type of the text held in textAccum
+	lastJSONIndex int    // content block index of the JSON held in jsonAccum
 }
 
 func newAnthropicDeanonymizer(opts streamDeanonymizerOpts) *anthropicDeanonymizer {
@@ -81,8 +110,13 @@ func (a *anthropicDeanonymizer) ProcessDataPayload(payload []byte) bool {
 		return a.processAgentEvent(payload)
 	}
 
-	// Non-delta event: flush accumulators, then pass through with replacement.
+	// Non-delta event (content_block_start/stop, message_delta with usage
+	// and stop_reason, ...): flush accumulators under the index of the block
+	// their text came from, then pass through with replacement.
 	a.Flush()
+	if envelope.Type == "content_block_start" {
+		a.lastIndex, a.lastJSONIndex = envelope.Index, envelope.Index
+	}
 	writePipe(a.opts.pw,
 		[]byte(a.opts.replacer.Replace(sseDataPrefix+string(payload))),
 		[]byte("\n"))
@@ -94,9 +128,16 @@ func (a *anthropicDeanonymizer) ProcessDataPayload(payload []byte) bool {
 //
 // json.Marshal on *sseEnvelope (string/int/*sseDelta fields) never returns an
 // error, so this function is infallible and has no error return.
+//
+// Held-back text belongs to the block it arrived in: if a delta for another
+// block (or of another type) arrives first, the remainder is flushed under
+// its own index and type rather than prepended to the new block's text.
 func (a *anthropicDeanonymizer) processTextDelta(envelope *sseEnvelope) {
-	a.lastIndex = envelope.Index
-	a.textAccum.WriteString(envelope.Delta.Text)
+	if envelope.Index != a.lastIndex || envelope.Delta.Type != a.lastTextType {
+		a.flushText()
+	}
+	a.lastIndex, a.lastTextType = envelope.Index, envelope.Delta.Type
+	a.textAccum.WriteString(envelope.Delta.content())
 	accumulated := a.textAccum.String()
 
 	flushUpTo := safeCutPoint(accumulated)
@@ -107,10 +148,10 @@ func (a *anthropicDeanonymizer) processTextDelta(envelope *sseEnvelope) {
 	toReplace := accumulated[:flushUpTo]
 	replaced := a.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && a.opts.verbose {
-		log.Printf("[DEANON] text replaced: sessionID=%s tokens=%d", a.opts.sessionID, a.opts.tokenCount)
+		a.opts.log.Debugf("deanon_text", "text replaced: sessionID=%s tokens=%d", a.opts.sessionID, a.opts.tokenCount)
 	}
 
-	envelope.Delta.Text = replaced
+	envelope.Delta.setContent(replaced)
 	newPayload, _ := json.Marshal(envelope) // error impossible: only string/int fields
 
 	writePipe(a.opts.pw, []byte(sseDataPrefix), newPayload, []byte("\n"))
@@ -126,6 +167,9 @@ func (a *anthropicDeanonymizer) processTextDelta(envelope *sseEnvelope) {
 // json.Marshal on *sseEnvelope (string/int/*sseDelta fields) never returns an
 // error, so this function is infallible and has no error return.
 func (a *anthropicDeanonymizer) processJSONDelta(envelope *sseEnvelope) {
+	if envelope.Index != a.lastJSONIndex {
+		a.flushJSON()
+	}
 	a.lastJSONIndex = envelope.Index
 	a.jsonAccum.WriteString(envelope.Delta.PartialJSON)
 	accumulated := a.jsonAccum.String()
@@ -138,7 +182,7 @@ func (a *anthropicDeanonymizer) processJSONDelta(envelope *sseEnvelope) {
 	toReplace := accumulated[:flushUpTo]
 	replaced := a.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && a.opts.verbose {
-		log.Printf("[DEANON] json replaced: sessionID=%s tokens=%d", a.opts.sessionID, a.opts.tokenCount)
+		a.opts.log.Debugf("deanon_json", "json replaced: sessionID=%s tokens=%d", a.opts.sessionID, a.opts.tokenCount)
 	}
 
 	envelope.Delta.PartialJSON = replaced
@@ -241,7 +285,7 @@ func (a *anthropicDeanonymizer) processAgentContentEvent(payload []byte, _ *agen
 	writePipe(a.opts.pw, []byte(sseDataPrefix), out, []byte("\n"))
 
 	if a.opts.verbose {
-		log.Printf("[DEANON] agent content replaced: sessionID=%s type=%s", a.opts.sessionID, raw["type"])
+		a.opts.log.Debugf("deanon_agent", "agent content replaced: sessionID=%s type=%s", a.opts.sessionID, raw["type"])
 	}
 	return true
 }
@@ -284,14 +328,14 @@ func (a *anthropicDeanonymizer) processAgentInputEvent(payload []byte, agent *ag
 	writePipe(a.opts.pw, []byte(sseDataPrefix), out, []byte("\n"))
 
 	if a.opts.verbose {
-		log.Printf("[DEANON] agent input replaced: sessionID=%s type=%s", a.opts.sessionID, agent.Type)
+		a.opts.log.Debugf("deanon_agent", "agent input replaced: sessionID=%s type=%s", a.opts.sessionID, agent.Type)
 	}
 	return true
 }
 
 // replaceStringValues recursively walks a parsed JSON object and applies
 // the replacer to all string values. Returns true if any value was changed.
-func replaceStringValues(obj map[string]any, replacer *strings.Replacer) bool {
+func replaceStringValues(obj map[string]any, replacer textReplacer) bool {
 	changed := false
 	for k, v := range obj {
 		switch val := v.(type) {
@@ -316,7 +360,7 @@ func replaceStringValues(obj map[string]any, replacer *strings.Replacer) bool {
 
 // replaceSliceValues recursively walks a JSON array and applies the
 // replacer to all string values. Returns true if any value was changed.
-func replaceSliceValues(arr []any, replacer *strings.Replacer) bool {
+func replaceSliceValues(arr []any, replacer textReplacer) bool {
 	changed := false
 	for i, v := range arr {
 		switch val := v.(type) {
@@ -345,16 +389,23 @@ func (a *anthropicDeanonymizer) Flush() {
 	a.flushJSON()
 }
 
+// flushText emits the held text as a synthetic delta for the block it came
+// from: same index, and for a thinking block a thinking_delta with the text
+// in "thinking", so the client appends it to the right block.
 func (a *anthropicDeanonymizer) flushText() {
 	if a.textAccum.Len() == 0 {
 		return
 	}
 	flushed := a.opts.replacer.Replace(a.textAccum.String())
 	if flushed != "" {
+		deltaType := a.lastTextType
+		if deltaType == "" {
+			deltaType = "text_delta"
+		}
 		synth := map[string]any{
 			"type":  "content_block_delta",
 			"index": a.lastIndex,
-			"delta": map[string]string{"type": "text_delta", "text": flushed},
+			"delta": map[string]string{"type": deltaType, deltaTextField(deltaType): flushed},
 		}
 		if b, err := json.Marshal(synth); err == nil {
 			writePipe(a.opts.pw, []byte(sseDataPrefix), b, []byte("\n\n"))
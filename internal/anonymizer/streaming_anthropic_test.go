@@ -421,3 +421,168 @@ func TestContentBlockDeltaJSONReplacement(t *testing.T) {
 		t.Errorf("input_json_delta token not replaced:\n%s", got)
 	}
 }
+
+// --- Content block index of flushed remainders ---
+
+// makeSSEEvent builds an SSE line for an arbitrary Anthropic event.
+func makeSSEEvent(event map[string]any) string {
+	b, _ := json.Marshal(event)
+	return "data: " + string(b) + "\n"
+}
+
+// makeSSETextDeltaAt builds a text_delta SSE line for content block index.
+func makeSSETextDeltaAt(index int, text string) string {
+	return makeSSEEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]string{"type": "text_delta", "text": text},
+	})
+}
+
+// textByIndex collects the text_delta text of a stream per content block.
+func textByIndex(t *testing.T, out string) map[int]string {
+	t.Helper()
+	texts := make(map[int]string)
+	for _, line := range strings.Split(out, "\n") {
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var env sseEnvelope
+		if err := json.Unmarshal([]byte(payload), &env); err != nil {
+			t.Fatalf("invalid event %q: %v", payload, err)
+		}
+		if env.Type == "content_block_delta" && env.Delta != nil && env.Delta.Type == "text_delta" {
+			texts[env.Index] += env.Delta.Text
+		}
+	}
+	return texts
+}
+
+// TestAnthropicFlushUsesBlockIndex verifies that a token held back at the end
+// of a text block, then flushed by message_delta, is emitted under that
+// block's index (1, after a tool_use block at 0), not index 0.
+func TestAnthropicFlushUsesBlockIndex(t *testing.T) {
+	token := "[PII_EMAIL_c160f8cc4b2e1a3d]"
+	original := "earl@example.com"
+	tokenMap := map[string]string{token: original}
+
+	sseInput := makeSSEEvent(map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": map[string]any{}}}) +
+		makeSSEEvent(map[string]any{"type": "content_block_stop", "index": 0}) +
+		makeSSEEvent(map[string]any{"type": "content_block_start", "index": 1, "content_block": map[string]any{"type": "text", "text": ""}}) +
+		makeSSETextDeltaAt(1, "Reach out to ") +
+		makeSSETextDeltaAt(1, token) +
+		makeSSEEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "end_turn"}, "usage": map[string]int{"output_tokens": 12}}) +
+		"\n"
+
+	got := textByIndex(t, readStreamResult(t, sseInput, tokenMap))
+	if want := "Reach out to " + original; got[1] != want {
+		t.Errorf("block 1 text: got %q, want %q", got[1], want)
+	}
+	if text, ok := got[0]; ok {
+		t.Errorf("unexpected text under block 0: %q", text)
+	}
+}
+
+// TestAnthropicFlushOnIndexChange verifies that text held back for one block
+// is flushed under its own index when a delta for another block arrives.
+func TestAnthropicFlushOnIndexChange(t *testing.T) {
+	token := "[PII_EMAIL_c160f8cc4b2e1a3d]"
+	original := "earl@example.com"
+	tokenMap := map[string]string{token: original}
+
+	sseInput := makeSSETextDeltaAt(0, "first "+token) +
+		makeSSETextDeltaAt(1, "second") +
+		"\n"
+
+	got := textByIndex(t, readStreamResult(t, sseInput, tokenMap))
+	if want := "first " + original; got[0] != want {
+		t.Errorf("block 0 text: got %q, want %q", got[0], want)
+	}
+	if got[1] != "second" {
+		t.Errorf("block 1 text: got %q, want %q", got[1], "second")
+	}
+}
+
+// TestAnthropicFlushMultipleBlocks verifies, across a thinking block and two
+// text blocks, that each held-back remainder is flushed with the index and
+// delta type of the block it belongs to.
+func TestAnthropicFlushMultipleBlocks(t *testing.T) {
+	token := "[PII_EMAIL_c160f8cc4b2e1a3d]"
+	original := "earl@example.com"
+	tokenMap := map[string]string{token: original}
+
+	delta := func(index int, deltaType, text string) string {
+		return makeSSEEvent(map[string]any{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]string{"type": deltaType, deltaTextField(deltaType): text},
+		})
+	}
+	block := func(index int, blockType string, deltas ...string) string {
+		out := makeSSEEvent(map[string]any{"type": "content_block_start", "index": index, "content_block": map[string]any{"type": blockType}})
+		for _, d := range deltas {
+			out += d
+		}
+		return out + makeSSEEvent(map[string]any{"type": "content_block_stop", "index": index})
+	}
+	sseInput := block(0, "thinking", delta(0, "thinking_delta", "user is "+token)) +
+		block(1, "text", delta(1, "text_delta", "Hi "+token)) +
+		block(2, "text", delta(2, "text_delta", "Bye "+token)) +
+		makeSSEEvent(map[string]any{"type": "message_stop"}) +
+		"\n"
+
+	type event struct {
+		deltaType string
+		text      string
+	}
+	// Decoded separately from sseDelta so a thinking tail sent under "text"
+	// shows up as a missing "thinking" field.
+	type wireDelta struct {
+		Type     string  `json:"type"`
+		Text     *string `json:"text"`
+		Thinking *string `json:"thinking"`
+	}
+	got := make(map[int]event)
+	for _, line := range strings.Split(readStreamResult(t, sseInput, tokenMap), "\n") {
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var env struct {
+			Type  string     `json:"type"`
+			Index int        `json:"index"`
+			Delta *wireDelta `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(payload), &env); err != nil {
+			t.Fatalf("invalid event %q: %v", payload, err)
+		}
+		if env.Type != "content_block_delta" || env.Delta == nil {
+			continue
+		}
+		e := got[env.Index]
+		if e.deltaType != "" && e.deltaType != env.Delta.Type {
+			t.Errorf("block %d: mixed delta types %q and %q", env.Index, e.deltaType, env.Delta.Type)
+		}
+		text, other := env.Delta.Text, env.Delta.Thinking
+		if env.Delta.Type == "thinking_delta" {
+			text, other = other, text
+		}
+		if text == nil || other != nil {
+			t.Errorf("block %d: %s event with the wrong text field: %s", env.Index, env.Delta.Type, payload)
+			continue
+		}
+		got[env.Index] = event{env.Delta.Type, e.text + *text}
+	}
+
+	want := map[int]event{
+		0: {"thinking_delta", "user is " + original},
+		1: {"text_delta", "Hi " + original},
+		2: {"text_delta", "Bye " + original},
+	}
+	for index, w := range want {
+		if got[index] != w {
+			t.Errorf("block %d: got %+v, want %+v", index, got[index], w)
+		}
+	}
+}
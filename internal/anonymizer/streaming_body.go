@@ -0,0 +1,73 @@
+// Package anonymizer — streaming_body.go
+//
+// Plain (non-SSE) response bodies are normally buffered and deanonymized in
+// one pass. A large one, or one of unknown length, can instead be restored as
+// it arrives. The body has no event framing to align tokens with, so a token
+// may be split at any byte; text is released only up to safeCutPoint, the
+// same boundary the SSE accumulators flush at, and the rest is held until
+// the next read completes it.
+package anonymizer
+
+import (
+	"io"
+
+	"ai-anonymizing-proxy/internal/logger"
+)
+
+// DeanonymizeStream wraps src, a plain response body, in a reader that
+// restores the session's tokens as the body is read. Like
+// StreamingDeanonymize it snapshots the token map up front and records token
+// fidelity at EOF. The stripped-token notice is never added: by the time a
+// response is known to have lost its tokens, its start has been sent.
+func (a *Anonymizer) DeanonymizeStream(src io.ReadCloser, sessionID string) io.ReadCloser {
+	tokenMap := a.sessionTokens(sessionID)
+	if len(tokenMap) == 0 {
+		return src
+	}
+	if a.m != nil {
+		a.m.TokensDeanonymized.Add(int64(len(tokenMap)))
+	}
+
+	replacer := newTokenReplacer(tokenMap)
+	pr, pw := io.Pipe()
+	go copyDeanonymized(src, pw, replacer, a.log, func() {
+		a.checkFidelity(replacer.found(), len(tokenMap), sessionID)
+	})
+	return pr
+}
+
+// copyDeanonymized reads src to EOF, writing it to pw with tokens replaced.
+// Each read is appended to the held tail and everything before safeCutPoint
+// is replaced and written. At EOF the tail is written too and onEnd runs
+// before the pipe closes. A read error other than io.EOF is logged to lg.
+func copyDeanonymized(src io.ReadCloser, pw pipeWriter, replacer textReplacer, lg *logger.Logger, onEnd func()) {
+	defer func() { _ = src.Close() }()
+
+	var pending []byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			if cut := safeCutPoint(string(pending)); cut > 0 {
+				if _, err := pw.Write([]byte(replacer.Replace(string(pending[:cut])))); err != nil {
+					return // client went away; the reader side is closed
+				}
+				pending = append(pending[:0], pending[cut:]...)
+			}
+		}
+		if readErr != nil {
+			writePipe(pw, []byte(replacer.Replace(string(pending))))
+			onEnd()
+			if readErr != io.EOF {
+				lg.Errorf("stream_read", "DeanonymizeStream read error: %v", readErr)
+				if err := pw.CloseWithError(readErr); err != nil {
+					lg.Errorf("stream_close", "DeanonymizeStream CloseWithError failed: %v", err)
+				}
+				return
+			}
+			_ = pw.Close()
+			return
+		}
+	}
+}
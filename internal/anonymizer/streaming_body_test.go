@@ -0,0 +1,90 @@
+package anonymizer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"ai-anonymizing-proxy/internal/metrics"
+)
+
+// TestDeanonymizeStreamBytewiseJSON delivers a plain JSON body one byte per
+// Read, so every token is split at every possible offset, and checks that
+// the output equals the original with no token fragment left behind.
+func TestDeanonymizeStreamBytewiseJSON(t *testing.T) {
+	a := newTestAnonymizer()
+	sessionID := "sess-plain-bytewise"
+
+	input := `{"id":"msg_1","content":[{"type":"text","text":"Mail alice@company.org or call +1-800-555-1234. Done."}],"usage":{"output_tokens":12}}`
+	anonymized := a.AnonymizeText(input, sessionID)
+	if anonymized == input {
+		t.Fatal("AnonymizeText did not change the body")
+	}
+
+	rc := a.DeanonymizeStream(&bytewiseReader{data: []byte(anonymized)}, sessionID)
+	defer func() { _ = rc.Close() }() // test cleanup
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	if string(got) != input {
+		t.Errorf("bytewise round-trip failed\n  want: %q\n   got: %q", input, got)
+	}
+	if strings.Contains(string(got), tokenPrefix) {
+		t.Errorf("token fragment leaked: %q", got)
+	}
+}
+
+// TestDeanonymizeStreamNoTokens returns src unchanged when the session has
+// nothing to restore.
+func TestDeanonymizeStreamNoTokens(t *testing.T) {
+	a := newTestAnonymizer()
+	src := io.NopCloser(strings.NewReader("plain"))
+	if got := a.DeanonymizeStream(src, "sess-none"); got != src {
+		t.Error("expected src to be returned for a session without tokens")
+	}
+}
+
+// TestDeanonymizeStreamFidelity records token fidelity once the body ends.
+func TestDeanonymizeStreamFidelity(t *testing.T) {
+	m := metrics.New()
+	a := NewWithCacheAndCapacity(Options{OllamaEndpoint: "http://localhost:11434", Metrics: m})
+	sessionID := "sess-plain-fidelity"
+	anonymized := a.AnonymizeText("reach alice@company.org", sessionID)
+
+	rc := a.DeanonymizeStream(io.NopCloser(strings.NewReader(anonymized)), sessionID)
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	if snap := m.Snapshot().PIITokens; snap.FidelityResponses != 1 || snap.TokenFidelity != 1 {
+		t.Errorf("fidelity = %v over %d responses, want 1 over 1", snap.TokenFidelity, snap.FidelityResponses)
+	}
+}
+
+// TestCopyDeanonymizedReadError flushes the held tail and closes the pipe
+// with the upstream read error.
+func TestCopyDeanonymizedReadError(t *testing.T) {
+	readErr := errors.New("upstream reset")
+	w := &fakePipeWriter{}
+	ended := false
+	src := io.NopCloser(io.MultiReader(strings.NewReader("tail [PII_EM"), iotestErrReader{readErr}))
+
+	copyDeanonymized(src, w, strings.NewReplacer(), testLog, func() { ended = true })
+
+	if string(w.written) != "tail [PII_EM" {
+		t.Errorf("written = %q, want the held tail flushed", w.written)
+	}
+	if !ended {
+		t.Error("onEnd did not run")
+	}
+	if !errors.Is(w.closeErrArg, readErr) {
+		t.Errorf("CloseWithError(%v), want %v", w.closeErrArg, readErr)
+	}
+}
+
+// iotestErrReader returns err on every Read.
+type iotestErrReader struct{ err error }
+
+func (r iotestErrReader) Read([]byte) (int, error) { return 0, r.err }
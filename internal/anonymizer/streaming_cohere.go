@@ -2,7 +2,6 @@ package anonymizer
 
 import (
 	"encoding/json"
-	"log"
 	"strings"
 )
 
@@ -78,7 +77,7 @@ func (c *cohereDeanonymizer) ProcessDataPayload(payload []byte) bool {
 	toReplace := accumulated[:flushUpTo]
 	replaced := c.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && c.opts.verbose {
-		log.Printf("[DEANON] cohere text replaced: sessionID=%s tokens=%d", c.opts.sessionID, c.opts.tokenCount)
+		c.opts.log.Debugf("deanon_text", "cohere text replaced: sessionID=%s tokens=%d", c.opts.sessionID, c.opts.tokenCount)
 	}
 
 	envelope.Delta.Message.Content.Text = replaced
@@ -79,6 +79,7 @@ func TestHandleStreamEndCloseWithErrorLog(t *testing.T) {
 		pw:       fw,
 		replacer: strings.NewReplacer("[PII_X]", "alice"),
 		provider: prov,
+		log:      testLog,
 	}
 
 	readErr := errors.New("read boom")
@@ -118,6 +119,7 @@ func TestHandleStreamEndEOFSkipsClose(t *testing.T) {
 		pw:       fw,
 		replacer: strings.NewReplacer(),
 		provider: prov,
+		log:      testLog,
 	}
 
 	handleStreamEnd(nil, io.EOF, ctx)
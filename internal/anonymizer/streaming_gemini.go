@@ -2,7 +2,6 @@ package anonymizer
 
 import (
 	"encoding/json"
-	"log"
 	"strings"
 )
 
@@ -72,7 +71,7 @@ func (g *geminiDeanonymizer) ProcessDataPayload(payload []byte) bool {
 	toReplace := accumulated[:flushUpTo]
 	replaced := g.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && g.opts.verbose {
-		log.Printf("[DEANON] gemini text replaced: sessionID=%s tokens=%d", g.opts.sessionID, g.opts.tokenCount)
+		g.opts.log.Debugf("deanon_text", "gemini text replaced: sessionID=%s tokens=%d", g.opts.sessionID, g.opts.tokenCount)
 	}
 
 	envelope.Candidates[0].Content.Parts[0].Text = replaced
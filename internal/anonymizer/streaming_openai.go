@@ -2,7 +2,6 @@ package anonymizer
 
 import (
 	"encoding/json"
-	"log"
 	"strings"
 )
 
@@ -109,7 +108,7 @@ func (o *openAIDeanonymizer) emitReasoning(envelope *openAIEnvelope, choice *ope
 	toReplace := accumulated[:flushUpTo]
 	replaced := o.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && o.opts.verbose {
-		log.Printf("[DEANON] openai reasoning replaced: sessionID=%s tokens=%d", o.opts.sessionID, o.opts.tokenCount)
+		o.opts.log.Debugf("deanon_reasoning", "openai reasoning replaced: sessionID=%s tokens=%d", o.opts.sessionID, o.opts.tokenCount)
 	}
 
 	out := openAIEnvelope{
@@ -144,7 +143,7 @@ func (o *openAIDeanonymizer) emitContent(envelope *openAIEnvelope, choice *openA
 	toReplace := accumulated[:flushUpTo]
 	replaced := o.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && o.opts.verbose {
-		log.Printf("[DEANON] openai text replaced: sessionID=%s tokens=%d", o.opts.sessionID, o.opts.tokenCount)
+		o.opts.log.Debugf("deanon_text", "openai text replaced: sessionID=%s tokens=%d", o.opts.sessionID, o.opts.tokenCount)
 	}
 
 	out := openAIEnvelope{
@@ -164,6 +164,33 @@ func TestOpenAIStreamingDoneSentinel(t *testing.T) {
 	}
 }
 
+// TestOpenAIStreamingDoneFlushesPendingToken verifies that a token still held
+// in the accumulator when "data: [DONE]" arrives is restored and emitted
+// before the sentinel, not after it at EOF.
+func TestOpenAIStreamingDoneFlushesPendingToken(t *testing.T) {
+	token := "[PII_EMAIL_c160f8cc4b2e1a3d]"
+	original := "user@example.com"
+	tokenMap := map[string]string{token: original}
+
+	mid := len(token) / 2
+	sseInput := makeOpenAITextDelta("Reply to "+token[:mid]) +
+		makeOpenAITextDelta(token[mid:]) +
+		"data: [DONE]\n\n"
+
+	got := readStreamResultForDomain(t, sseInput, tokenMap, openAIDomain)
+
+	done := strings.Index(got, "data: [DONE]")
+	if done < 0 {
+		t.Fatalf("OpenAI [DONE] flush: sentinel not passed through:\n%s", got)
+	}
+	if !strings.Contains(got[:done], original) {
+		t.Errorf("OpenAI [DONE] flush: pending token not restored before sentinel:\n%s", got)
+	}
+	if strings.Contains(got, token) {
+		t.Errorf("OpenAI [DONE] flush: unreplaced token in output:\n%s", got)
+	}
+}
+
 // TestOpenAIStreamingRoleOnlyChunk verifies that the first assistant chunk
 // (delta with only a role, no content) passes through without disrupting
 // subsequent token accumulation.
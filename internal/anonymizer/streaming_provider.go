@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"ai-anonymizing-proxy/internal/domainmatch"
+	"ai-anonymizing-proxy/internal/logger"
 )
 
 // Provider identifies an AI API provider's SSE streaming format.
@@ -127,10 +128,11 @@ func ProviderForDomain(domain string) Provider {
 // implementations.
 type streamDeanonymizerOpts struct {
 	pw         *io.PipeWriter
-	replacer   *strings.Replacer
+	replacer   textReplacer
 	sessionID  string
 	verbose    bool
 	tokenCount int
+	log        *logger.Logger // replacement lines at debug, when verbose
 }
 
 // NewStreamingDeanonymizer creates the appropriate provider implementation
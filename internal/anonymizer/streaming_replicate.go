@@ -1,7 +1,6 @@
 package anonymizer
 
 import (
-	"log"
 	"strings"
 )
 
@@ -41,7 +40,7 @@ func (r *replicateDeanonymizer) ProcessDataPayload(payload []byte) bool {
 	toReplace := accumulated[:flushUpTo]
 	replaced := r.opts.replacer.Replace(toReplace)
 	if toReplace != replaced && r.opts.verbose {
-		log.Printf("[DEANON] replicate text replaced: sessionID=%s tokens=%d", r.opts.sessionID, r.opts.tokenCount)
+		r.opts.log.Debugf("deanon_text", "replicate text replaced: sessionID=%s tokens=%d", r.opts.sessionID, r.opts.tokenCount)
 	}
 
 	writePipe(r.opts.pw, []byte(sseDataPrefix), []byte(replaced), []byte("\n"))
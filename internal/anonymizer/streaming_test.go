@@ -1,12 +1,14 @@
 package anonymizer
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"time"
 )
 
 // --- Unit tests for extracted helpers ---
@@ -22,6 +24,9 @@ func TestSafeCutPoint(t *testing.T) {
 		{"long text without bracket", strings.Repeat("a", 50), 50 - tokenSuffixLen},
 		{"open bracket in suffix", strings.Repeat("a", 30) + "[PII_EMAIL", 30},
 		{"closed bracket in suffix", strings.Repeat("a", 30) + "[PII_EMAIL_abc12345deadbeef]rest", 30 + len("[PII_EMAIL_abc12345deadbeef]rest") - tokenSuffixLen},
+		{"partial token prefix at end", strings.Repeat("a", 40) + "[PI", 40},
+		{"unclosed ordinary bracket ignored", "arr[" + strings.Repeat("a", 50), 54 - tokenSuffixLen},
+		{"token start behind markdown link", strings.Repeat("a", 40) + "[PII_EM [docs](https://example.com)", 40},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -33,6 +38,53 @@ func TestSafeCutPoint(t *testing.T) {
 	}
 }
 
+// TestStreamingMarkdownBracketsFlushPromptly streams content mixing markdown
+// links, an unclosed ordinary bracket and a split token. Text after the
+// ordinary bracket must be flushed while the stream is still open, and the
+// token must still be restored.
+func TestStreamingMarkdownBracketsFlushPromptly(t *testing.T) {
+	a := newTestAnonymizer()
+	const sessionID = "sess-md-brackets"
+	a.AnonymizeText("alice@example.com", sessionID)
+	token := a.replacement(PIIEmail, "alice@example.com")
+
+	pr, pw := io.Pipe()
+	rc := a.StreamingDeanonymize(pr, sessionID, "api.anthropic.com")
+	defer func() { _ = rc.Close() }()
+
+	first := "See [the docs](https://example.com/docs), then arr[" + strings.Repeat("x", 60)
+	if _, err := pw.Write([]byte(makeSSETextDelta(first))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := bufio.NewReader(rc)
+	chunk := make(chan string, 1)
+	go func() {
+		line, _ := out.ReadString('\n')
+		chunk <- line
+	}()
+	select {
+	case got := <-chunk:
+		if !strings.Contains(got, "arr[xxxx") {
+			t.Errorf("text after an ordinary bracket was held back: %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing flushed while the stream was open")
+	}
+
+	go func() {
+		_, _ = pw.Write([]byte(makeSSETextDelta(" [link](https://example.com) mail " + token[:7])))
+		_, _ = pw.Write([]byte(makeSSETextDelta(token[7:] + " [done]")))
+		_ = pw.Close()
+	}()
+	rest, _ := io.ReadAll(out)
+	if !strings.Contains(string(rest), "alice@example.com") || strings.Contains(string(rest), "[PII_") {
+		t.Errorf("split token not restored: %s", rest)
+	}
+	if !strings.Contains(string(rest), "[link](https://example.com)") {
+		t.Errorf("markdown link altered: %s", rest)
+	}
+}
+
 // --- Issue #34 gap tests ---
 
 // makeSSETextDelta builds an SSE line for a content_block_delta text_delta event.
@@ -62,7 +114,7 @@ func makeSSEThinkingDelta(text string) string {
 	env := sseEnvelope{
 		Type:  "content_block_delta",
 		Index: 0,
-		Delta: &sseDelta{Type: "thinking_delta", Text: text},
+		Delta: &sseDelta{Type: "thinking_delta", Thinking: text},
 	}
 	b, _ := json.Marshal(env)
 	return "data: " + string(b) + "\n"
@@ -621,6 +673,49 @@ func TestStreamingDeanonymizeJsonDeltaTokenSplit(t *testing.T) {
 	}
 }
 
+// TestStreamingDeanonymizeJsonDeltaToolInput verifies that a token split
+// into four small input_json_delta fragments of a Write tool call, with no
+// leading text to push it past the suffix guard, is restored and that the
+// reassembled partial_json still decodes to the tool input.
+func TestStreamingDeanonymizeJsonDeltaToolInput(t *testing.T) {
+	token := "[PII_PHONE_d4bc1884a0e5f321]"
+	original := "555-0199"
+	tokenMap := map[string]string{token: original}
+
+	fragments := []string{
+		`{"file_path":"notes.txt","content":"call [PII_PHO`,
+		`NE_d4bc18`,
+		`84a0e5f3`,
+		`21] today"}`,
+	}
+	var sseInput strings.Builder
+	for _, f := range fragments {
+		sseInput.WriteString(makeSSEJsonDelta(f))
+	}
+	sseInput.WriteString("data: {\"type\":\"content_block_stop\",\"index\":0}\n\n")
+
+	got := readStreamResult(t, sseInput.String(), tokenMap)
+
+	var partial strings.Builder
+	for line := range strings.SplitSeq(got, "\n") {
+		var env sseEnvelope
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok || json.Unmarshal([]byte(payload), &env) != nil || env.Delta == nil {
+			continue
+		}
+		partial.WriteString(env.Delta.PartialJSON)
+	}
+	var input struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(partial.String()), &input); err != nil {
+		t.Fatalf("reassembled partial_json is not valid JSON (%v): %s", err, partial.String())
+	}
+	if input.Content != "call "+original+" today" {
+		t.Errorf("content = %q, want the token restored", input.Content)
+	}
+}
+
 // TestStreamingDeanonymizeJsonDeltaShortNoMatch verifies that short
 // input_json_delta content without tokens is flushed correctly at
 // content_block_stop (same pattern as #55 but for JSON deltas).
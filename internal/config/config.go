@@ -5,10 +5,13 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // piiInstructionPrefix is the common prefix for all PII instruction strings.
@@ -32,32 +35,370 @@ type Config struct {
 	OllamaMaxConcurrent int     `json:"ollamaMaxConcurrent"`
 	LogLevel            string  `json:"logLevel"`
 
+	// MinConfidence is the floor below which regex matches are ignored
+	// entirely: patterns whose effective confidence (after pack decay) falls
+	// under it are left unmasked rather than routed to the cache/Ollama path
+	// like matches under aiConfidenceThreshold. Default: 0 (keep all).
+	MinConfidence float64 `json:"minConfidence"`
+
+	// TokenLogSampleRate is the fraction (0.0-1.0] of per-token debug lines,
+	// such as low-confidence cache misses, that are written at logLevel
+	// "debug". Lower it on high-volume deployments. Default: 1.0.
+	TokenLogSampleRate float64 `json:"tokenLogSampleRate"`
+
+	// LogFormat is "text" (fixed-width columns) or "json" (one object per
+	// line with ts, module, action, level and msg) for the leveled log
+	// lines, such as per-token debug lines. Default: "text".
+	LogFormat string `json:"logFormat"`
+
+	// OllamaTypeDenylist lists PII types (e.g. "SSN", "CREDITCARD") whose
+	// values are never sent to Ollama, not even for verification; they keep
+	// the deterministic token. Default: none.
+	OllamaTypeDenylist []string `json:"ollamaTypeDenylist"`
+
+	// Allowlist lists literal values that are never anonymized, such as a
+	// public support address or the office IP. Emails match regardless of
+	// case, other values exactly. Default: none.
+	Allowlist []string `json:"allowlist"`
+
+	// OllamaHeaders are set on every Ollama request, e.g. an API key for an
+	// auth gateway in front of Ollama. Values are never logged. Config file
+	// only. Default: none.
+	OllamaHeaders map[string]string `json:"ollamaHeaders"`
+
+	// OllamaDispatchDelayMs holds a low-confidence cache miss this long
+	// before querying Ollama, so repeat misses of the same value in quick
+	// succession share one query. Default: 0 (query at once).
+	OllamaDispatchDelayMs int `json:"ollamaDispatchDelayMs"`
+
+	// OllamaBatchWindowMs collects low-confidence cache misses for this long
+	// and classifies them in one Ollama query rather than one query per
+	// value. Replaces ollamaDispatchDelayMs when set. Default: 0 (no batching).
+	OllamaBatchWindowMs int `json:"ollamaBatchWindowMs"`
+
 	CACertFile      string `json:"caCertFile"`
 	CAKeyFile       string `json:"caKeyFile"`
 	BindAddress     string `json:"bindAddress"`
 	ManagementToken string `json:"managementToken"`
 	UpstreamProxy   string `json:"upstreamProxy"`
+
+	// ManagementReadToken is a second bearer token that authorizes only
+	// read-only (GET/HEAD) management endpoints such as /status and /metrics,
+	// for monitoring systems. ManagementToken authorizes everything.
+	ManagementReadToken string `json:"managementReadToken"`
+
+	// ManagementTLSCert and ManagementTLSKey are PEM files for serving the
+	// management API over HTTPS. Both or neither must be set; with neither the
+	// API is plain HTTP. Default: none.
+	ManagementTLSCert string `json:"managementTLSCert"`
+	ManagementTLSKey  string `json:"managementTLSKey"`
+
+	// ManagementAuthMaxFailures is the number of failed management auth
+	// attempts from one client IP within ManagementAuthWindowSecs that
+	// triggers a lockout. The lockout lasts ManagementAuthWindowSecs.
+	// 0 disables throttling. Defaults: 5 failures, 300 seconds.
+	ManagementAuthMaxFailures int `json:"managementAuthMaxFailures"`
+	ManagementAuthWindowSecs  int `json:"managementAuthWindowSecs"`
+
+	// ManagementCORSOrigins lists browser origins (e.g. "https://dash.example.com")
+	// allowed to call the management API cross-origin. "*" allows any origin.
+	// Empty disables CORS headers entirely. Default: empty.
+	ManagementCORSOrigins []string `json:"managementCORSOrigins"`
+
+	// DebugEndpointsEnabled turns on management endpoints that expose PII
+	// originals for debugging, such as GET /sessions/{id}/mappings. They
+	// also require ManagementToken. Never enable in production. Default: false.
+	DebugEndpointsEnabled bool `json:"debugEndpointsEnabled"`
+
 	OllamaCacheFile string `json:"ollamaCacheFile"` // path to bbolt persistent cache; empty = in-memory only
 
+	// CacheSRatio is the share of the S3-FIFO cache capacity given to the
+	// probationary (S) queue. Larger values tolerate longer gaps between a
+	// value's first and second use. Range [0.01, 0.5]. Default: 0.1.
+	CacheSRatio float64 `json:"cacheSRatio"`
+
+	// SessionEncryptionKey is a base64-encoded AES key (16, 24 or 32 bytes).
+	// When set, originals in the session map are held AES-GCM encrypted and the
+	// Ollama cache is keyed by an HMAC of the value instead of the value itself.
+	// Prefer the SESSION_ENCRYPTION_KEY env var. Empty disables. Default: "".
+	SessionEncryptionKey string `json:"sessionEncryptionKey"`
+
+	// TokenSalt keys the hash in PII tokens, so the same value gets a
+	// different token in each deployment and leaked tokens cannot be matched
+	// across them. Keep it secret and stable: changing it changes every
+	// token. Prefer the TOKEN_SALT env var. Empty = unsalted. Default: "".
+	TokenSalt string `json:"tokenSalt"`
+
+	// MaxSessions caps the number of requests being anonymized concurrently
+	// (each holds a token map until its response is restored). Requests over
+	// the cap get 503 with Retry-After. 0 disables the cap. Default: 10000.
+	MaxSessions int `json:"maxSessions"`
+
+	// MaxConcurrentAnonymizations caps how many request bodies are being
+	// anonymized at the same instant, bounding CPU and memory under bursts.
+	// A request over the cap waits up to AnonymizeQueueMs for a slot, then
+	// gets 503 with Retry-After. 0 disables the cap. Default: 0.
+	MaxConcurrentAnonymizations int `json:"maxConcurrentAnonymizations"`
+	// AnonymizeQueueMs is how long a request waits for an anonymization slot.
+	// 0 rejects immediately when all slots are busy. Default: 1000.
+	AnonymizeQueueMs int `json:"anonymizeQueueMs"`
+	// DryRun runs detection on AI-domain request bodies and logs and counts
+	// what would be masked, but forwards every body unmodified and records no
+	// session, so responses are not deanonymized. It never rejects a request.
+	// Meant for measuring false positives on real traffic before rollout.
+	// Default: false.
+	DryRun bool `json:"dryRun"`
+	// FailClosed blocks forwarding whenever a request body cannot be
+	// anonymized. Set false to forward the original body instead when the
+	// proxy is only over capacity (MaxSessions or MaxConcurrentAnonymizations),
+	// trading PII protection for availability; unreadable or oversized bodies
+	// are always blocked. Default: true.
+	FailClosed bool `json:"failClosed"`
+
+	// MaxRequestBodyMB is the largest AI-domain request body, in MB, the proxy
+	// buffers for anonymization; bigger bodies are refused with 413. 0 uses the
+	// default. Default: 50.
+	MaxRequestBodyMB int `json:"maxRequestBodyMB"`
+
+	// MaxResponseBufferKB bounds how much of a successful non-SSE AI-domain
+	// response is buffered for deanonymization. Larger responses, and those
+	// of unknown length, are restored as they stream to the client instead,
+	// without the stripped-token notice. 0 always buffers. Default: 0.
+	MaxResponseBufferKB int `json:"maxResponseBufferKB"`
+
+	// MaxResponseBodyMB is the most of a buffered AI-domain response, in MB,
+	// the proxy reads into memory for deanonymization. Past it the rest of
+	// the body is streamed to the client as received, so tokens in it are not
+	// restored. 0 uses the default. Default: 50.
+	MaxResponseBodyMB int `json:"maxResponseBodyMB"`
+
+	// UpstreamTimeoutSecs bounds each proxied upstream request, from sending
+	// it to the end of its response body, so a hung upstream cannot hold a
+	// client connection forever. SSE responses and gRPC calls are exempt once
+	// their headers arrive. On timeout before the headers the client gets 504. 0 disables.
+	// Default: 120.
+	UpstreamTimeoutSecs int `json:"upstreamTimeoutSecs"`
+
+	// MaxTokensPerRequest caps the number of PII matches tokenized in a single
+	// request, counting every occurrence (repeats included). What happens past
+	// the cap is set by OverTokenPolicy. 0 disables the cap. Default: 0.
+	MaxTokensPerRequest int `json:"maxTokensPerRequest"`
+	// OverTokenPolicy is "reject" (answer 413, nothing is forwarded) or "stop"
+	// (forward with matches past the cap left unmasked). Default: "reject".
+	OverTokenPolicy string `json:"overTokenPolicy"`
+
 	AIAPIDomains []string `json:"aiApiDomains"`
 	AuthDomains  []string `json:"authDomains"`
 	AuthPaths    []string `json:"authPaths"`
 
+	// BypassUserAgents lists User-Agent patterns whose AI-domain requests are
+	// forwarded without anonymization, for health checks and monitoring
+	// probes. An entry matches as a case-insensitive substring; one wrapped in
+	// slashes ("/^probe-[0-9]+$/") is a regular expression. Default: none.
+	BypassUserAgents []string `json:"bypassUserAgents"`
+
+	// AnonymizeContentTypes lists the request body media types that are
+	// anonymized on AI domains: exact types, or "type/*" for a whole family.
+	// Bodies of other types (protobuf, images, octet-stream) are forwarded
+	// unscanned so rewriting cannot corrupt them. A body without a
+	// Content-Type is always scanned. An empty list scans every body.
+	// multipart/form-data is scanned part by part, so uploads keep their
+	// binary parts intact. Default: application/json, text/*,
+	// multipart/form-data.
+	AnonymizeContentTypes []string `json:"anonymizeContentTypes"`
+
+	// DomainsURL points to a JSON array of AI API domains fetched at startup
+	// and merged with ai-domains.json, or aiApiDomains when that file is
+	// absent. On failure the local list is used alone. Empty disables.
+	// Default: "".
+	DomainsURL string `json:"domainsURL"`
+
+	// DomainsRefreshSecs re-fetches DomainsURL on this interval and applies
+	// additions and removals. Domains added through the management API are
+	// kept even if the remote list drops them. 0 disables. Default: 0.
+	DomainsRefreshSecs int `json:"domainsRefreshSecs"`
+
+	// AnonymizePaths enables PII detection in the URL path of AI-domain
+	// requests (e.g. /v1/users/alice@example.com/messages). Each path segment
+	// is scanned independently. Auth paths are never rewritten. Default: false.
+	AnonymizePaths bool `json:"anonymizePaths"`
+
+	// PreserveJSONFormat edits JSON request bodies in place: only string values
+	// containing PII are rewritten, and numbers, key order and whitespace are
+	// left byte-identical, for APIs that sign or hash the body. Default: false.
+	PreserveJSONFormat bool `json:"preserveJsonFormat"`
+
+	// IndexRepeatedTokens suffixes the second and later occurrences of the
+	// same token within one text value with an index ([PII_EMAIL_<hash>#2]),
+	// so the LLM can tell repeated mentions apart. Every indexed form still
+	// deanonymizes to the same original. Default: false.
+	IndexRepeatedTokens bool `json:"indexRepeatedTokens"`
+
+	// PreserveSuffix maps PII types to a number of trailing letters and
+	// digits of the original kept in their tokens for user recognition, e.g.
+	// {"PHONE": 4} gives [PII_PHONE_<hash>:5309]. At most 8. Config file
+	// only. Default: none.
+	PreserveSuffix map[string]int `json:"preserveSuffix"`
+
+	// TypePolicies maps PII types to how their matches are replaced:
+	// "tokenize" (a reversible token), "redact" (a fixed [REDACTED_<TYPE>]
+	// marker that is never restored) or "passthrough" (left unmasked).
+	// Unlisted types are tokenized. Config file only. Default: none.
+	TypePolicies map[string]string `json:"typePolicies"`
+
+	// JSONErrors makes errors generated by the proxy itself (bad gateway,
+	// busy, payload too large) JSON bodies in the target provider's error
+	// envelope instead of plain text, for clients that only parse JSON API
+	// errors. Default: false.
+	JSONErrors bool `json:"jsonErrors"`
+
+	// TokenStrippedNotice is prepended to the reply of a buffered response
+	// that contains none of its request's tokens, warning the user that any
+	// personal data in it may be invented by the model. Such responses are
+	// always logged and counted; empty disables only the notice. Default: "".
+	TokenStrippedNotice string `json:"tokenStrippedNotice"`
+
+	// RetryCacheSecs keeps each request's anonymized body and token map for
+	// this many seconds; a retry with a byte-identical body reuses them
+	// instead of anonymizing again, under its own session. 0 disables.
+	// Default: 0.
+	RetryCacheSecs int `json:"retryCacheSecs"`
+
+	// SessionTTLSecs keeps a request's token map in memory for this many
+	// seconds after its response completes instead of deleting it at once.
+	// Kept sessions do not count against maxSessions. Default: 0.
+	SessionTTLSecs int `json:"sessionTtlSecs"`
+
+	// SessionStoreURL shares session token maps between proxy instances
+	// through a Redis server (redis://[:password@]host[:port][/db]), so a
+	// response can be deanonymized by an instance other than the one that
+	// anonymized its request. It requires SessionEncryptionKey: the proxy
+	// refuses to start with a store but no key. Empty keeps sessions in
+	// process. Default: "".
+	SessionStoreURL string `json:"sessionStoreURL"`
+
+	// ShadowSampleRate is the fraction (0.0-1.0) of requests that are also run
+	// through regex-only and regex+Ollama detection in the background, with
+	// the per-type difference logged. Works whether or not useAIDetection is
+	// on; the live path is unaffected. 0 disables. Default: 0.
+	ShadowSampleRate float64 `json:"shadowSampleRate"`
+
+	// AccessLogFormat enables a per-request access log in addition to the
+	// structured log: "clf" (Common Log Format) or "combined" (adds Referer
+	// and User-Agent). Empty disables it. Default: "".
+	AccessLogFormat string `json:"accessLogFormat"`
+	// AccessLogFile is the access log destination: a file path (appended),
+	// "stdout", or "stderr". Empty means stdout.
+	AccessLogFile string `json:"accessLogFile"`
+
 	// EnabledPacks lists the PII detection packs that are active at startup.
 	// Defaults: ["SECRETS", "GLOBAL", "DE"]. All patterns must belong to an
 	// enabled pack to participate in detection. Zero enabled packs is fatal.
 	EnabledPacks []string `json:"enabledPacks"`
 
+	// CodeBlockPacks, when non-empty, is the pack list used inside ``` fenced
+	// code blocks in place of EnabledPacks, e.g. ["SECRETS"] to mask keys in
+	// pasted code without misreading its numbers as phone numbers. Default:
+	// none (the same packs everywhere).
+	CodeBlockPacks []string `json:"codeBlockPacks"`
+
+	// PatternProfiles names alternative pattern sets, e.g. a "strict" profile
+	// with a lower minConfidence, that DomainProfiles can select for
+	// individual upstreams. "default" is reserved for enabledPacks and
+	// minConfidence. Config file only. Default: none.
+	PatternProfiles map[string]PatternProfile `json:"patternProfiles"`
+
+	// DomainProfiles maps a domain or glob (*.example.com) to the
+	// PatternProfiles entry its request bodies and paths are scanned with.
+	// An exact domain wins over a glob. Entries naming an undefined profile
+	// are dropped at startup. Config file only. Default: none (every domain
+	// uses "default").
+	DomainProfiles map[string]string `json:"domainProfiles"`
+
 	// PackDecayRate controls the likelihood multiplier decay per pack position.
 	// effectiveConfidence = baseConfidence * (1.0 - (position-1) * PackDecayRate)
 	// Default: 0.05. Set to 0.0 to disable positional decay.
 	PackDecayRate float64 `json:"packDecayRate"`
 
+	// MRNPrefixes adds site-specific medical record number prefixes (e.g.
+	// "CHART") to the HEALTHCARE pack, matched like MRN/MR/PAT: prefix,
+	// optional separator, 6-10 digits. Default: none.
+	MRNPrefixes []string `json:"mrnPrefixes"`
+
+	// APIKeyMinLength is the shortest value, in characters, the GLOBAL api_key
+	// pattern masks after its keyword (api_key=, token:, secret, bearer).
+	// Lower it for short keys, raise it to cut noise. 0 uses the default;
+	// values above 1000 are clamped. Default: 20.
+	APIKeyMinLength int `json:"apiKeyMinLength"`
+
+	// SecretTokenPrefixes adds provider token prefixes (e.g. "hf_", "xoxe-")
+	// to the SECRETS pack: the prefix followed by 16+ token characters is
+	// masked as APIKEY without Ollama. For formats no built-in pattern covers
+	// yet. Default: none.
+	SecretTokenPrefixes []string `json:"secretTokenPrefixes"`
+
+	// NationalIDCountries enables checksum-validated national ID detection
+	// for the listed ISO 3166-1 country codes: "BR" (CPF), "ES" (DNI/NIE).
+	// Matches are tokenized as NATIONALID with the GLOBAL pack. Default: none.
+	NationalIDCountries []string `json:"nationalIDCountries"`
+
+	// DetectTimestamps masks dates and times that follow a scheduling or
+	// admission keyword ("appointment at 09:30") as TIMESTAMP, with the
+	// GLOBAL pack. Timestamps without such a keyword, e.g. in logs, are left
+	// alone. Default: false.
+	DetectTimestamps bool `json:"detectTimestamps"`
+
+	// NormalizeUnicode matches patterns against the NFKC form of the text,
+	// so PII written with full-width digits or other compatibility
+	// characters is still detected. The value is tokenized and restored in
+	// the form it was sent. Default: false.
+	NormalizeUnicode bool `json:"normalizeUnicode"`
+
+	// CustomPatterns adds operator-defined regex detectors, run after all
+	// pack patterns. Invalid patterns are logged and skipped at startup.
+	// Config file only. Default: none.
+	CustomPatterns []CustomPattern `json:"customPatterns"`
+
 	// PIIInstructions maps LLM family prefix (e.g. "claude", "gpt") to the
 	// system instruction injected when PII tokens are present in a request.
 	// Lookup is prefix-based: "claude-sonnet-4-6" matches key "claude".
 	// The special key "default" is used when no prefix matches.
 	PIIInstructions map[string]string `json:"piiInstructions"`
+
+	// MaxPIIInstructionChars truncates longer piiInstructions entries at
+	// startup. An instruction is sent with every anonymized request, so a
+	// long one costs tokens each time; entries over 1000 characters are
+	// warned about even without a cap. 0 disables the cap. Default: 0.
+	MaxPIIInstructionChars int `json:"maxPIIInstructionChars"`
+
+	// InstructionInjectionMode is "append" (the instruction is appended to
+	// the request's system prompt) or "separate" (it is sent as its own
+	// system message or content block). Default: "append".
+	InstructionInjectionMode string `json:"instructionInjectionMode"`
+}
+
+// CustomPattern is one entry of Config.CustomPatterns.
+type CustomPattern struct {
+	// Name identifies the pattern in logs.
+	Name string `json:"name"`
+	// Regex is the pattern in Go RE2 syntax. A named group (?P<value>...)
+	// limits replacement to that part of the match.
+	Regex string `json:"regex"`
+	// Confidence is the match confidence in [0, 1]. Default: 0.90.
+	Confidence float64 `json:"confidence"`
+	// PIIType is the token type, as in [PII_<TYPE>_...]: A-Z, 0-9 and _.
+	// Default: Name upper-cased.
+	PIIType string `json:"piiType"`
+}
+
+// PatternProfile is one entry of Config.PatternProfiles.
+type PatternProfile struct {
+	// EnabledPacks lists the profile's packs in priority order. Default:
+	// the top-level enabledPacks.
+	EnabledPacks []string `json:"enabledPacks"`
+	// MinConfidence is the effective confidence below which the profile's
+	// patterns are not loaded, as the top-level minConfidence. Default: 0.
+	MinConfidence float64 `json:"minConfidence"`
 }
 
 // Load returns config with defaults overridden by proxy-config.json,
@@ -66,7 +407,49 @@ type Config struct {
 // domain admins must be able to override local user state.
 func Load() *Config {
 	cfg := defaults()
-	loadFile(cfg, "proxy-config.json")
+	loadFile(cfg, configFile)
+	return finish(cfg)
+}
+
+// Reload layers proxy-config.json, the environment and policy over the
+// defaults like Load, for a running proxy. Unlike Load it fails when the
+// file cannot be read or parsed, so a broken edit leaves the running
+// settings in place instead of resetting them to the defaults.
+func Reload() (*Config, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := defaults()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configFile, err)
+	}
+	log.Printf("[CONFIG] Reloaded %s", configFile)
+	return finish(cfg), nil
+}
+
+// configFile is the config file read by Load and Reload, relative to the
+// working directory.
+const configFile = "proxy-config.json"
+
+// ChangedFields returns the JSON names of the top-level fields whose values
+// differ between old and next, in declaration order.
+func ChangedFields(old, next *Config) []string {
+	var changed []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	for i := range ov.NumField() {
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(ov.Type().Field(i).Tag.Get("json"), ",")
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// finish applies the environment and policy layers to cfg and clamps
+// out-of-range values.
+func finish(cfg *Config) *Config {
 	loadEnv(cfg)
 	loadPolicy(cfg)
 	// Clamp PackDecayRate to [0, 1].
@@ -78,6 +461,102 @@ func Load() *Config {
 		log.Printf("[CONFIG] Warning: packDecayRate %f exceeds 1.0, clamping to 1.0", cfg.PackDecayRate)
 		cfg.PackDecayRate = 1
 	}
+	if cfg.MaxSessions < 0 {
+		log.Printf("[CONFIG] Warning: maxSessions %d is negative, treating as 0 (unlimited)", cfg.MaxSessions)
+		cfg.MaxSessions = 0
+	}
+	if cfg.MaxConcurrentAnonymizations < 0 {
+		log.Printf("[CONFIG] Warning: maxConcurrentAnonymizations %d is negative, treating as 0 (unlimited)", cfg.MaxConcurrentAnonymizations)
+		cfg.MaxConcurrentAnonymizations = 0
+	}
+	if cfg.APIKeyMinLength < 0 {
+		log.Printf("[CONFIG] Warning: apiKeyMinLength %d is negative, treating as 0 (default)", cfg.APIKeyMinLength)
+		cfg.APIKeyMinLength = 0
+	}
+	if cfg.APIKeyMinLength > 1000 {
+		log.Printf("[CONFIG] Warning: apiKeyMinLength %d exceeds 1000, clamping to 1000", cfg.APIKeyMinLength)
+		cfg.APIKeyMinLength = 1000
+	}
+	if cfg.MaxRequestBodyMB < 0 {
+		log.Printf("[CONFIG] Warning: maxRequestBodyMB %d is negative, treating as 0 (default)", cfg.MaxRequestBodyMB)
+		cfg.MaxRequestBodyMB = 0
+	}
+	if cfg.MaxResponseBufferKB < 0 {
+		log.Printf("[CONFIG] Warning: maxResponseBufferKB %d is negative, treating as 0 (always buffer)", cfg.MaxResponseBufferKB)
+		cfg.MaxResponseBufferKB = 0
+	}
+	if cfg.MaxResponseBodyMB < 0 {
+		log.Printf("[CONFIG] Warning: maxResponseBodyMB %d is negative, treating as 0 (default)", cfg.MaxResponseBodyMB)
+		cfg.MaxResponseBodyMB = 0
+	}
+	if cfg.UpstreamTimeoutSecs < 0 {
+		log.Printf("[CONFIG] Warning: upstreamTimeoutSecs %d is negative, treating as 0 (no timeout)", cfg.UpstreamTimeoutSecs)
+		cfg.UpstreamTimeoutSecs = 0
+	}
+	if cfg.MaxTokensPerRequest < 0 {
+		log.Printf("[CONFIG] Warning: maxTokensPerRequest %d is negative, treating as 0 (unlimited)", cfg.MaxTokensPerRequest)
+		cfg.MaxTokensPerRequest = 0
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		log.Printf("[CONFIG] Warning: logFormat %q is not \"text\" or \"json\", using \"text\"", cfg.LogFormat)
+		cfg.LogFormat = "text"
+	}
+	if cfg.TokenLogSampleRate <= 0 || cfg.TokenLogSampleRate > 1 {
+		log.Printf("[CONFIG] Warning: tokenLogSampleRate %f outside (0, 1], using 1.0", cfg.TokenLogSampleRate)
+		cfg.TokenLogSampleRate = 1
+	}
+	if cfg.ShadowSampleRate < 0 {
+		log.Printf("[CONFIG] Warning: shadowSampleRate %f is negative, clamping to 0", cfg.ShadowSampleRate)
+		cfg.ShadowSampleRate = 0
+	}
+	if cfg.ShadowSampleRate > 1 {
+		log.Printf("[CONFIG] Warning: shadowSampleRate %f exceeds 1.0, clamping to 1.0", cfg.ShadowSampleRate)
+		cfg.ShadowSampleRate = 1
+	}
+	if cfg.SessionTTLSecs < 0 {
+		log.Printf("[CONFIG] Warning: sessionTtlSecs %d is negative, clamping to 0", cfg.SessionTTLSecs)
+		cfg.SessionTTLSecs = 0
+	}
+	if cfg.OllamaDispatchDelayMs < 0 {
+		log.Printf("[CONFIG] Warning: ollamaDispatchDelayMs %d is negative, clamping to 0", cfg.OllamaDispatchDelayMs)
+		cfg.OllamaDispatchDelayMs = 0
+	}
+	if cfg.OllamaBatchWindowMs < 0 {
+		log.Printf("[CONFIG] Warning: ollamaBatchWindowMs %d is negative, clamping to 0", cfg.OllamaBatchWindowMs)
+		cfg.OllamaBatchWindowMs = 0
+	}
+	if cfg.DomainsRefreshSecs < 0 {
+		log.Printf("[CONFIG] Warning: domainsRefreshSecs %d is negative, treating as 0 (no refresh)", cfg.DomainsRefreshSecs)
+		cfg.DomainsRefreshSecs = 0
+	}
+	if cfg.OverTokenPolicy != "reject" && cfg.OverTokenPolicy != "stop" {
+		log.Printf("[CONFIG] Warning: overTokenPolicy %q is not \"reject\" or \"stop\", using \"reject\"", cfg.OverTokenPolicy)
+		cfg.OverTokenPolicy = "reject"
+	}
+	for domain, profile := range cfg.DomainProfiles {
+		if _, ok := cfg.PatternProfiles[profile]; !ok && profile != "default" {
+			log.Printf("[CONFIG] Warning: domainProfiles %q names undefined pattern profile %q, using \"default\"", domain, profile)
+			delete(cfg.DomainProfiles, domain)
+		}
+	}
+	// Clamp CacheSRatio to [0.01, 0.5].
+	if cfg.CacheSRatio < 0.01 {
+		log.Printf("[CONFIG] Warning: cacheSRatio %f below 0.01, clamping to 0.01", cfg.CacheSRatio)
+		cfg.CacheSRatio = 0.01
+	}
+	if cfg.CacheSRatio > 0.5 {
+		log.Printf("[CONFIG] Warning: cacheSRatio %f exceeds 0.5, clamping to 0.5", cfg.CacheSRatio)
+		cfg.CacheSRatio = 0.5
+	}
+	if cfg.MaxPIIInstructionChars < 0 {
+		log.Printf("[CONFIG] Warning: maxPIIInstructionChars %d is negative, treating as 0 (no cap)", cfg.MaxPIIInstructionChars)
+		cfg.MaxPIIInstructionChars = 0
+	}
+	capPIIInstructions(cfg)
+	if cfg.InstructionInjectionMode != "append" && cfg.InstructionInjectionMode != "separate" {
+		log.Printf("[CONFIG] Warning: instructionInjectionMode %q is not \"append\" or \"separate\", using \"append\"", cfg.InstructionInjectionMode)
+		cfg.InstructionInjectionMode = "append"
+	}
 	return cfg
 }
 
@@ -91,10 +570,12 @@ func defaults() *Config {
 		AIConfidence:        0.7,
 		OllamaMaxConcurrent: 1,
 		LogLevel:            "info",
+		LogFormat:           "text",
 		CACertFile:          "ca-cert.pem",
 		CAKeyFile:           "ca-key.pem",
 		BindAddress:         "127.0.0.1",
 		OllamaCacheFile:     "ollama-cache.db",
+		CacheSRatio:         0.1,
 		EnabledPacks:        []string{"SECRETS", "GLOBAL", "DE"},
 		PackDecayRate:       0.05,
 		AIAPIDomains: []string{
@@ -148,6 +629,7 @@ func defaults() *Config {
 			"/token", "/oauth", "/authenticate", "/session",
 			"/v1/auth", "/api/auth", "/api/login", "/api/token",
 		},
+		AnonymizeContentTypes: []string{"application/json", "text/*", "multipart/form-data"},
 		PIIInstructions: map[string]string{
 			"claude": piiInstructionPrefix +
 				"You MUST reproduce every such token EXACTLY as written in your response. Do NOT replace them with" +
@@ -156,6 +638,18 @@ func defaults() *Config {
 			"gpt":     piiInstructionDefault,
 			"default": piiInstructionDefault,
 		},
+		ManagementAuthMaxFailures: 5,
+		ManagementAuthWindowSecs:  300,
+		MaxSessions:               10000,
+		AnonymizeQueueMs:          1000,
+		FailClosed:                true,
+		MaxRequestBodyMB:          50,
+		MaxResponseBodyMB:         50,
+		UpstreamTimeoutSecs:       120,
+		APIKeyMinLength:           20,
+		OverTokenPolicy:           "reject",
+		InstructionInjectionMode:  "append",
+		TokenLogSampleRate:        1.0,
 	}
 }
 
@@ -194,6 +688,38 @@ func (c *Config) ResolvePIIInstruction(model string) string {
 	return ""
 }
 
+// piiInstructionWarnChars is the instruction length above which Load warns
+// that the instruction may be wasting tokens.
+const piiInstructionWarnChars = 1000
+
+// capPIIInstructions truncates piiInstructions entries longer than
+// MaxPIIInstructionChars, and warns about uncapped ones longer than
+// piiInstructionWarnChars. Lengths count characters, not bytes.
+func capPIIInstructions(cfg *Config) {
+	limit := cfg.MaxPIIInstructionChars
+	for key, instruction := range cfg.PIIInstructions {
+		n := utf8.RuneCountInString(instruction)
+		switch {
+		case limit > 0 && n > limit:
+			log.Printf("[CONFIG] Warning: piiInstructions %q is %d characters, truncating to maxPIIInstructionChars %d", key, n, limit)
+			cfg.PIIInstructions[key] = truncateChars(instruction, limit)
+		case n > piiInstructionWarnChars:
+			log.Printf("[CONFIG] Warning: piiInstructions %q is %d characters and is sent with every anonymized request; set maxPIIInstructionChars to cap it", key, n)
+		}
+	}
+}
+
+// truncateChars returns the first n characters of s.
+func truncateChars(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
 func loadFile(cfg *Config, path string) {
 	data, err := os.ReadFile(path) //nolint:gosec // G703: path is a controlled config file path, not user input
 	if err != nil {
@@ -240,6 +766,13 @@ func loadEnvFloat(name string, dst *float64) {
 	}
 }
 
+// loadEnvBoolTrue sets *dst to true if the named env var equals "true".
+func loadEnvBoolTrue(name string, dst *bool) {
+	if os.Getenv(name) == "true" {
+		*dst = true
+	}
+}
+
 // loadEnvBoolFalse sets *dst to false if the named env var equals "false".
 func loadEnvBoolFalse(name string, dst *bool) {
 	if os.Getenv(name) == "false" {
@@ -251,17 +784,69 @@ func loadEnv(cfg *Config) {
 	loadEnvInt("PROXY_PORT", &cfg.ProxyPort)
 	loadEnvInt("MANAGEMENT_PORT", &cfg.ManagementPort)
 	loadEnvString("OLLAMA_ENDPOINT", &cfg.OllamaEndpoint)
+	loadEnvStringSlice("OLLAMA_TYPE_DENYLIST", &cfg.OllamaTypeDenylist)
+	loadEnvStringSlice("ALLOWLIST", &cfg.Allowlist)
 	loadEnvString("OLLAMA_MODEL", &cfg.OllamaModel)
 	loadEnvBoolFalse("USE_AI_DETECTION", &cfg.UseAIDetection)
 	loadEnvFloat("AI_CONFIDENCE_THRESHOLD", &cfg.AIConfidence)
+	loadEnvFloat("MIN_CONFIDENCE", &cfg.MinConfidence)
 	loadEnvIntPositive("OLLAMA_MAX_CONCURRENT", &cfg.OllamaMaxConcurrent)
+	loadEnvInt("OLLAMA_DISPATCH_DELAY_MS", &cfg.OllamaDispatchDelayMs)
+	loadEnvInt("OLLAMA_BATCH_WINDOW_MS", &cfg.OllamaBatchWindowMs)
 	loadEnvString("LOG_LEVEL", &cfg.LogLevel)
+	loadEnvString("LOG_FORMAT", &cfg.LogFormat)
+	loadEnvFloat("TOKEN_LOG_SAMPLE_RATE", &cfg.TokenLogSampleRate)
 	loadEnvString("CA_CERT_FILE", &cfg.CACertFile)
 	loadEnvString("CA_KEY_FILE", &cfg.CAKeyFile)
 	loadEnvString("BIND_ADDRESS", &cfg.BindAddress)
 	loadEnvString("MANAGEMENT_TOKEN", &cfg.ManagementToken)
+	loadEnvString("MANAGEMENT_READ_TOKEN", &cfg.ManagementReadToken)
+	loadEnvBoolTrue("DEBUG_ENDPOINTS_ENABLED", &cfg.DebugEndpointsEnabled)
+	loadEnvString("MANAGEMENT_TLS_CERT", &cfg.ManagementTLSCert)
+	loadEnvString("MANAGEMENT_TLS_KEY", &cfg.ManagementTLSKey)
+	loadEnvInt("MANAGEMENT_AUTH_MAX_FAILURES", &cfg.ManagementAuthMaxFailures)
+	loadEnvIntPositive("MANAGEMENT_AUTH_WINDOW_SECS", &cfg.ManagementAuthWindowSecs)
 	loadEnvString("UPSTREAM_PROXY", &cfg.UpstreamProxy)
+	loadEnvStringSlice("MANAGEMENT_CORS_ORIGINS", &cfg.ManagementCORSOrigins)
+	loadEnvString("DOMAINS_URL", &cfg.DomainsURL)
+	loadEnvInt("DOMAINS_REFRESH_SECS", &cfg.DomainsRefreshSecs)
 	loadEnvString("OLLAMA_CACHE_FILE", &cfg.OllamaCacheFile)
+	loadEnvFloat("CACHE_S_RATIO", &cfg.CacheSRatio)
+	loadEnvString("SESSION_ENCRYPTION_KEY", &cfg.SessionEncryptionKey)
+	loadEnvString("TOKEN_SALT", &cfg.TokenSalt)
+	loadEnvInt("MAX_SESSIONS", &cfg.MaxSessions)
+	loadEnvInt("MAX_CONCURRENT_ANONYMIZATIONS", &cfg.MaxConcurrentAnonymizations)
+	loadEnvInt("ANONYMIZE_QUEUE_MS", &cfg.AnonymizeQueueMs)
+	loadEnvBoolFalse("FAIL_CLOSED", &cfg.FailClosed)
+	loadEnvInt("MAX_REQUEST_BODY_MB", &cfg.MaxRequestBodyMB)
+	loadEnvInt("MAX_RESPONSE_BUFFER_KB", &cfg.MaxResponseBufferKB)
+	loadEnvInt("MAX_RESPONSE_BODY_MB", &cfg.MaxResponseBodyMB)
+	loadEnvInt("UPSTREAM_TIMEOUT_SECS", &cfg.UpstreamTimeoutSecs)
+	loadEnvInt("MAX_TOKENS_PER_REQUEST", &cfg.MaxTokensPerRequest)
+	loadEnvString("OVER_TOKEN_POLICY", &cfg.OverTokenPolicy)
 	loadEnvStringSlice("ENABLED_PACKS", &cfg.EnabledPacks)
+	loadEnvStringSlice("CODE_BLOCK_PACKS", &cfg.CodeBlockPacks)
+	loadEnvStringSlice("MRN_PREFIXES", &cfg.MRNPrefixes)
+	loadEnvInt("API_KEY_MIN_LENGTH", &cfg.APIKeyMinLength)
+	loadEnvStringSlice("SECRET_TOKEN_PREFIXES", &cfg.SecretTokenPrefixes)
+	loadEnvStringSlice("NATIONAL_ID_COUNTRIES", &cfg.NationalIDCountries)
+	loadEnvBoolTrue("DETECT_TIMESTAMPS", &cfg.DetectTimestamps)
+	loadEnvBoolTrue("NORMALIZE_UNICODE", &cfg.NormalizeUnicode)
+	loadEnvInt("MAX_PII_INSTRUCTION_CHARS", &cfg.MaxPIIInstructionChars)
+	loadEnvString("INSTRUCTION_INJECTION_MODE", &cfg.InstructionInjectionMode)
+	loadEnvStringSlice("BYPASS_USER_AGENTS", &cfg.BypassUserAgents)
+	loadEnvStringSlice("ANONYMIZE_CONTENT_TYPES", &cfg.AnonymizeContentTypes)
 	loadEnvFloat("PACK_DECAY_RATE", &cfg.PackDecayRate)
+	loadEnvBoolTrue("ANONYMIZE_PATHS", &cfg.AnonymizePaths)
+	loadEnvBoolTrue("PRESERVE_JSON_FORMAT", &cfg.PreserveJSONFormat)
+	loadEnvBoolTrue("DRY_RUN", &cfg.DryRun)
+	loadEnvBoolTrue("INDEX_REPEATED_TOKENS", &cfg.IndexRepeatedTokens)
+	loadEnvBoolTrue("JSON_ERRORS", &cfg.JSONErrors)
+	loadEnvString("TOKEN_STRIPPED_NOTICE", &cfg.TokenStrippedNotice)
+	loadEnvFloat("SHADOW_SAMPLE_RATE", &cfg.ShadowSampleRate)
+	loadEnvInt("RETRY_CACHE_SECS", &cfg.RetryCacheSecs)
+	loadEnvInt("SESSION_TTL_SECS", &cfg.SessionTTLSecs)
+	loadEnvString("SESSION_STORE_URL", &cfg.SessionStoreURL)
+	loadEnvString("ACCESS_LOG_FORMAT", &cfg.AccessLogFormat)
+	loadEnvString("ACCESS_LOG_FILE", &cfg.AccessLogFile)
 }
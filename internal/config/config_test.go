@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -214,6 +216,72 @@ func TestLoadFile_ValidJSON(t *testing.T) {
 	}
 }
 
+func TestLoadFile_CustomPatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"customPatterns":[{"name":"employee_id","regex":"\\bEMP-\\d{6}\\b","confidence":0.95,"piiType":"EMPLOYEEID"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaults()
+	loadFile(cfg, path)
+
+	want := []CustomPattern{{Name: "employee_id", Regex: `\bEMP-\d{6}\b`, Confidence: 0.95, PIIType: "EMPLOYEEID"}}
+	if !reflect.DeepEqual(cfg.CustomPatterns, want) {
+		t.Errorf("CustomPatterns: got %+v, want %+v", cfg.CustomPatterns, want)
+	}
+}
+
+func TestLoadFile_PatternProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"patternProfiles":{"strict":{"enabledPacks":["SECRETS","US"],"minConfidence":0.3}},"domainProfiles":{"*.example.com":"strict"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaults()
+	loadFile(cfg, path)
+
+	want := map[string]PatternProfile{"strict": {EnabledPacks: []string{"SECRETS", "US"}, MinConfidence: 0.3}}
+	if !reflect.DeepEqual(cfg.PatternProfiles, want) {
+		t.Errorf("PatternProfiles: got %+v, want %+v", cfg.PatternProfiles, want)
+	}
+	if got := cfg.DomainProfiles["*.example.com"]; got != "strict" {
+		t.Errorf("DomainProfiles[*.example.com]: got %q, want strict", got)
+	}
+}
+
+func TestLoadFile_TypePolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"typePolicies":{"SSN":"redact","COMPANY":"passthrough"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaults()
+	loadFile(cfg, path)
+
+	want := map[string]string{"SSN": "redact", "COMPANY": "passthrough"}
+	if !reflect.DeepEqual(cfg.TypePolicies, want) {
+		t.Errorf("TypePolicies: got %v, want %v", cfg.TypePolicies, want)
+	}
+}
+
+func TestLoad_DomainProfilesUndefined(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"patternProfiles":{"strict":{}},"domainProfiles":{"a.example.com":"strict","b.example.com":"default","c.example.com":"paranoid"}}`
+	if err := os.WriteFile(filepath.Join(dir, "proxy-config.json"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	cfg := Load()
+	want := map[string]string{"a.example.com": "strict", "b.example.com": "default"}
+	if !reflect.DeepEqual(cfg.DomainProfiles, want) {
+		t.Errorf("DomainProfiles: got %v, want %v", cfg.DomainProfiles, want)
+	}
+}
+
 func TestLoadFile_Missing_IsNoOp(t *testing.T) {
 	cfg := defaults()
 	loadFile(cfg, "/nonexistent/path/config.json")
@@ -273,6 +341,204 @@ func TestLoadEnv_EnabledPacks(t *testing.T) {
 	}
 }
 
+func TestLoadEnv_OllamaTypeDenylist(t *testing.T) {
+	t.Setenv("OLLAMA_TYPE_DENYLIST", "SSN,CREDITCARD")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.OllamaTypeDenylist) != 2 || cfg.OllamaTypeDenylist[0] != "SSN" || cfg.OllamaTypeDenylist[1] != "CREDITCARD" {
+		t.Errorf("OllamaTypeDenylist: got %v", cfg.OllamaTypeDenylist)
+	}
+}
+
+func TestLoadEnv_Allowlist(t *testing.T) {
+	t.Setenv("ALLOWLIST", "support@ourcompany.com, 203.0.113.10")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.Allowlist) != 2 || cfg.Allowlist[0] != "support@ourcompany.com" || cfg.Allowlist[1] != "203.0.113.10" {
+		t.Errorf("Allowlist: got %v", cfg.Allowlist)
+	}
+}
+
+func TestLoadEnv_MRNPrefixes(t *testing.T) {
+	t.Setenv("MRN_PREFIXES", "CHART,PID")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.MRNPrefixes) != 2 || cfg.MRNPrefixes[0] != "CHART" || cfg.MRNPrefixes[1] != "PID" {
+		t.Errorf("MRNPrefixes: got %v", cfg.MRNPrefixes)
+	}
+}
+
+func TestLoadEnv_SecretTokenPrefixes(t *testing.T) {
+	t.Setenv("SECRET_TOKEN_PREFIXES", "hf_,xoxe-")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.SecretTokenPrefixes) != 2 || cfg.SecretTokenPrefixes[0] != "hf_" || cfg.SecretTokenPrefixes[1] != "xoxe-" {
+		t.Errorf("SecretTokenPrefixes: got %v", cfg.SecretTokenPrefixes)
+	}
+}
+
+func TestLoadEnv_MinConfidence(t *testing.T) {
+	t.Setenv("MIN_CONFIDENCE", "0.5")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MinConfidence != 0.5 {
+		t.Errorf("MinConfidence: got %f, want 0.5", cfg.MinConfidence)
+	}
+}
+
+func TestLoadEnv_BypassUserAgents(t *testing.T) {
+	t.Setenv("BYPASS_USER_AGENTS", "HealthProbe, /^uptime-[0-9]+$/")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.BypassUserAgents) != 2 || cfg.BypassUserAgents[0] != "HealthProbe" || cfg.BypassUserAgents[1] != "/^uptime-[0-9]+$/" {
+		t.Errorf("BypassUserAgents: got %v", cfg.BypassUserAgents)
+	}
+}
+
+func TestLoadEnv_RetryCacheSecs(t *testing.T) {
+	t.Setenv("RETRY_CACHE_SECS", "30")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.RetryCacheSecs != 30 {
+		t.Errorf("RetryCacheSecs: got %d, want 30", cfg.RetryCacheSecs)
+	}
+}
+
+func TestLoadEnv_ConcurrentAnonymizations(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_ANONYMIZATIONS", "8")
+	t.Setenv("ANONYMIZE_QUEUE_MS", "250")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxConcurrentAnonymizations != 8 {
+		t.Errorf("MaxConcurrentAnonymizations: got %d, want 8", cfg.MaxConcurrentAnonymizations)
+	}
+	if cfg.AnonymizeQueueMs != 250 {
+		t.Errorf("AnonymizeQueueMs: got %d, want 250", cfg.AnonymizeQueueMs)
+	}
+}
+
+func TestLoadEnv_AnonymizeContentTypes(t *testing.T) {
+	if got := defaults().AnonymizeContentTypes; len(got) != 3 || got[0] != "application/json" || got[1] != "text/*" || got[2] != "multipart/form-data" {
+		t.Errorf("default AnonymizeContentTypes: got %v", got)
+	}
+	t.Setenv("ANONYMIZE_CONTENT_TYPES", "application/json, application/x-ndjson")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.AnonymizeContentTypes) != 2 || cfg.AnonymizeContentTypes[1] != "application/x-ndjson" {
+		t.Errorf("AnonymizeContentTypes: got %v", cfg.AnonymizeContentTypes)
+	}
+}
+
+func TestLoadEnv_CodeBlockPacks(t *testing.T) {
+	t.Setenv("CODE_BLOCK_PACKS", "SECRETS, GLOBAL")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.CodeBlockPacks) != 2 || cfg.CodeBlockPacks[0] != "SECRETS" || cfg.CodeBlockPacks[1] != "GLOBAL" {
+		t.Errorf("CodeBlockPacks: got %v", cfg.CodeBlockPacks)
+	}
+}
+
+func TestLoadEnv_NationalIDCountries(t *testing.T) {
+	t.Setenv("NATIONAL_ID_COUNTRIES", "BR,ES")
+	cfg := defaults()
+	loadEnv(cfg)
+	if len(cfg.NationalIDCountries) != 2 || cfg.NationalIDCountries[0] != "BR" || cfg.NationalIDCountries[1] != "ES" {
+		t.Errorf("NationalIDCountries: got %v", cfg.NationalIDCountries)
+	}
+}
+
+func TestLoadEnv_DetectTimestamps(t *testing.T) {
+	t.Setenv("DETECT_TIMESTAMPS", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.DetectTimestamps {
+		t.Error("DetectTimestamps should be true")
+	}
+}
+
+func TestLoadEnv_NormalizeUnicode(t *testing.T) {
+	t.Setenv("NORMALIZE_UNICODE", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.NormalizeUnicode {
+		t.Error("NormalizeUnicode should be true")
+	}
+}
+
+func TestLoad_PIIInstructionTruncated(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"maxPIIInstructionChars":20,"piiInstructions":{"default":"Keep every token exactly as written, always.","claude":"Keep tokens ëxact."}}`
+	if err := os.WriteFile(filepath.Join(dir, "proxy-config.json"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	cfg := Load()
+	if got, want := cfg.PIIInstructions["default"], "Keep every token exa"; got != want {
+		t.Errorf("default instruction = %q, want %q", got, want)
+	}
+	if got, want := cfg.PIIInstructions["claude"], "Keep tokens ëxact."; got != want {
+		t.Errorf("instruction within the cap changed: %q, want %q", got, want)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy-config.json")
+	t.Chdir(dir)
+
+	if _, err := Reload(); err == nil {
+		t.Error("Reload without a config file: expected an error")
+	}
+	if err := os.WriteFile(path, []byte(`{"aiConfidenceThreshold":0.6,"logLevel":"debug"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if cfg.AIConfidence != 0.6 || cfg.LogLevel != "debug" || cfg.ProxyPort != 8080 {
+		t.Errorf("Reload = threshold %v, logLevel %q, proxyPort %d", cfg.AIConfidence, cfg.LogLevel, cfg.ProxyPort)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"aiConfidenceThreshold":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Reload(); err == nil {
+		t.Error("Reload with an unparsable file: expected an error")
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	old := defaults()
+	next := defaults()
+	if got := ChangedFields(old, next); got != nil {
+		t.Errorf("ChangedFields of equal configs = %v, want none", got)
+	}
+	next.ProxyPort = 9090
+	next.PIIInstructions["gpt"] = "Keep tokens."
+	if got, want := ChangedFields(old, next), []string{"proxyPort", "piiInstructions"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedFields = %v, want %v", got, want)
+	}
+}
+
+func TestTruncateChars(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"héllo", 2, "hé"},
+		{"héllo", 5, "héllo"},
+		{"héllo", 9, "héllo"},
+		{"héllo", 0, ""},
+	} {
+		if got := truncateChars(tc.s, tc.n); got != tc.want {
+			t.Errorf("truncateChars(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
 func TestLoadEnv_PackDecayRate(t *testing.T) {
 	t.Setenv("PACK_DECAY_RATE", "0.10")
 	cfg := defaults()
@@ -448,3 +714,453 @@ func TestLoad_ReturnsNonNil(t *testing.T) {
 		t.Errorf("ProxyPort should be positive, got %d", cfg.ProxyPort)
 	}
 }
+
+func TestDefaults_AnonymizePathsOff(t *testing.T) {
+	if defaults().AnonymizePaths {
+		t.Error("AnonymizePaths should default to false")
+	}
+}
+
+func TestLoadEnv_AnonymizePaths(t *testing.T) {
+	t.Setenv("ANONYMIZE_PATHS", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.AnonymizePaths {
+		t.Error("AnonymizePaths should be true after ANONYMIZE_PATHS=true")
+	}
+}
+
+func TestLoadEnv_DomainsURL(t *testing.T) {
+	t.Setenv("DOMAINS_URL", "https://config.example.com/ai-domains.json")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.DomainsURL != "https://config.example.com/ai-domains.json" {
+		t.Errorf("DomainsURL = %q", cfg.DomainsURL)
+	}
+}
+
+func TestLoadEnv_DomainsRefreshSecs(t *testing.T) {
+	if defaults().DomainsRefreshSecs != 0 {
+		t.Error("DomainsRefreshSecs should default to 0 (no refresh)")
+	}
+	t.Setenv("DOMAINS_REFRESH_SECS", "900")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.DomainsRefreshSecs != 900 {
+		t.Errorf("DomainsRefreshSecs = %d, want 900", cfg.DomainsRefreshSecs)
+	}
+}
+
+func TestLoadEnv_TokenLogSampleRate(t *testing.T) {
+	if defaults().TokenLogSampleRate != 1.0 {
+		t.Error("TokenLogSampleRate should default to 1.0")
+	}
+	t.Setenv("TOKEN_LOG_SAMPLE_RATE", "0.01")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.TokenLogSampleRate != 0.01 {
+		t.Errorf("TokenLogSampleRate = %f, want 0.01", cfg.TokenLogSampleRate)
+	}
+}
+
+func TestLoadEnv_ShadowSampleRate(t *testing.T) {
+	t.Setenv("SHADOW_SAMPLE_RATE", "0.05")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.ShadowSampleRate != 0.05 {
+		t.Errorf("ShadowSampleRate = %f, want 0.05", cfg.ShadowSampleRate)
+	}
+}
+
+func TestLoadEnv_PreserveJSONFormat(t *testing.T) {
+	if defaults().PreserveJSONFormat {
+		t.Error("PreserveJSONFormat should default to false")
+	}
+	t.Setenv("PRESERVE_JSON_FORMAT", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.PreserveJSONFormat {
+		t.Error("PreserveJSONFormat should be true after PRESERVE_JSON_FORMAT=true")
+	}
+}
+
+func TestLoadEnv_DryRun(t *testing.T) {
+	if defaults().DryRun {
+		t.Error("DryRun should default to false")
+	}
+	t.Setenv("DRY_RUN", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.DryRun {
+		t.Error("DryRun should be true after DRY_RUN=true")
+	}
+}
+
+func TestLoadEnv_JSONErrors(t *testing.T) {
+	if defaults().JSONErrors {
+		t.Error("JSONErrors should default to false")
+	}
+	t.Setenv("JSON_ERRORS", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.JSONErrors {
+		t.Error("JSONErrors should be true after JSON_ERRORS=true")
+	}
+}
+
+func TestLoadEnv_IndexRepeatedTokens(t *testing.T) {
+	if defaults().IndexRepeatedTokens {
+		t.Error("IndexRepeatedTokens should default to false")
+	}
+	t.Setenv("INDEX_REPEATED_TOKENS", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.IndexRepeatedTokens {
+		t.Error("IndexRepeatedTokens should be true after INDEX_REPEATED_TOKENS=true")
+	}
+}
+
+func TestLoadEnv_TokenStrippedNotice(t *testing.T) {
+	t.Setenv("TOKEN_STRIPPED_NOTICE", "[proxy: tokens missing]")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.TokenStrippedNotice != "[proxy: tokens missing]" {
+		t.Errorf("TokenStrippedNotice = %q", cfg.TokenStrippedNotice)
+	}
+}
+
+func TestLoadEnv_AccessLog(t *testing.T) {
+	t.Setenv("ACCESS_LOG_FORMAT", "combined")
+	t.Setenv("ACCESS_LOG_FILE", "/var/log/ai-proxy/access.log")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.AccessLogFormat != "combined" {
+		t.Errorf("AccessLogFormat = %q, want combined", cfg.AccessLogFormat)
+	}
+	if cfg.AccessLogFile != "/var/log/ai-proxy/access.log" {
+		t.Errorf("AccessLogFile = %q", cfg.AccessLogFile)
+	}
+}
+
+func TestLoadEnv_CacheSRatio(t *testing.T) {
+	if got := defaults().CacheSRatio; got != 0.1 {
+		t.Errorf("default CacheSRatio: got %f, want 0.1", got)
+	}
+	t.Setenv("CACHE_S_RATIO", "0.25")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.CacheSRatio != 0.25 {
+		t.Errorf("CacheSRatio: got %f, want 0.25", cfg.CacheSRatio)
+	}
+}
+
+func TestLoad_CacheSRatioClamp(t *testing.T) {
+	tests := []struct {
+		env  string
+		want float64
+	}{
+		{"0", 0.01},
+		{"0.9", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("CACHE_S_RATIO", tt.env)
+			if got := Load().CacheSRatio; got != tt.want {
+				t.Errorf("CACHE_S_RATIO=%s: got %f, want %f", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnv_ManagementCORSOrigins(t *testing.T) {
+	t.Setenv("MANAGEMENT_CORS_ORIGINS", "https://dash.example.com, http://localhost:3000")
+	cfg := defaults()
+	loadEnv(cfg)
+	want := []string{"https://dash.example.com", "http://localhost:3000"}
+	if len(cfg.ManagementCORSOrigins) != 2 || cfg.ManagementCORSOrigins[0] != want[0] || cfg.ManagementCORSOrigins[1] != want[1] {
+		t.Errorf("ManagementCORSOrigins = %v, want %v", cfg.ManagementCORSOrigins, want)
+	}
+}
+
+func TestLoadEnv_ManagementReadToken(t *testing.T) {
+	t.Setenv("MANAGEMENT_READ_TOKEN", "monitor-token")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.ManagementReadToken != "monitor-token" {
+		t.Errorf("ManagementReadToken = %q, want monitor-token", cfg.ManagementReadToken)
+	}
+}
+
+func TestLoadEnv_SessionEncryptionKey(t *testing.T) {
+	if cfg := defaults(); cfg.SessionEncryptionKey != "" {
+		t.Errorf("default SessionEncryptionKey = %q, want empty", cfg.SessionEncryptionKey)
+	}
+	t.Setenv("SESSION_ENCRYPTION_KEY", "QUJDREVGR0hJSktMTU5PUA==")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.SessionEncryptionKey != "QUJDREVGR0hJSktMTU5PUA==" {
+		t.Errorf("SessionEncryptionKey = %q", cfg.SessionEncryptionKey)
+	}
+}
+
+func TestLoadEnv_TokenSalt(t *testing.T) {
+	if cfg := defaults(); cfg.TokenSalt != "" {
+		t.Errorf("default TokenSalt = %q, want empty", cfg.TokenSalt)
+	}
+	t.Setenv("TOKEN_SALT", "prod-eu-1")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.TokenSalt != "prod-eu-1" {
+		t.Errorf("TokenSalt = %q, want prod-eu-1", cfg.TokenSalt)
+	}
+}
+
+func TestLoadEnv_MaxSessions(t *testing.T) {
+	if cfg := defaults(); cfg.MaxSessions != 10000 {
+		t.Errorf("default MaxSessions = %d, want 10000", cfg.MaxSessions)
+	}
+	t.Setenv("MAX_SESSIONS", "0")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxSessions != 0 {
+		t.Errorf("MaxSessions = %d, want 0", cfg.MaxSessions)
+	}
+}
+
+func TestLoadEnv_MaxTokensPerRequest(t *testing.T) {
+	if cfg := defaults(); cfg.MaxTokensPerRequest != 0 || cfg.OverTokenPolicy != "reject" {
+		t.Errorf("defaults = %d/%q, want 0/reject", cfg.MaxTokensPerRequest, cfg.OverTokenPolicy)
+	}
+	t.Setenv("MAX_TOKENS_PER_REQUEST", "500")
+	t.Setenv("OVER_TOKEN_POLICY", "stop")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxTokensPerRequest != 500 || cfg.OverTokenPolicy != "stop" {
+		t.Errorf("got %d/%q, want 500/stop", cfg.MaxTokensPerRequest, cfg.OverTokenPolicy)
+	}
+}
+
+func TestLoad_LogFormat(t *testing.T) {
+	if cfg := defaults(); cfg.LogFormat != "text" {
+		t.Errorf("default = %q, want text", cfg.LogFormat)
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("LOG_FORMAT", "json")
+	if cfg := Load(); cfg.LogFormat != "json" {
+		t.Errorf("LOG_FORMAT=json: got %q", cfg.LogFormat)
+	}
+	t.Setenv("LOG_FORMAT", "logfmt")
+	if cfg := Load(); cfg.LogFormat != "text" {
+		t.Errorf("unknown format: got %q, want text", cfg.LogFormat)
+	}
+}
+
+func TestLoad_InstructionInjectionMode(t *testing.T) {
+	if cfg := defaults(); cfg.InstructionInjectionMode != "append" {
+		t.Errorf("default = %q, want append", cfg.InstructionInjectionMode)
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("INSTRUCTION_INJECTION_MODE", "separate")
+	if cfg := Load(); cfg.InstructionInjectionMode != "separate" {
+		t.Errorf("INSTRUCTION_INJECTION_MODE=separate: got %q", cfg.InstructionInjectionMode)
+	}
+	t.Setenv("INSTRUCTION_INJECTION_MODE", "prepend")
+	if cfg := Load(); cfg.InstructionInjectionMode != "append" {
+		t.Errorf("unknown mode: got %q, want append", cfg.InstructionInjectionMode)
+	}
+}
+
+func TestLoadEnv_ManagementAuthThrottle(t *testing.T) {
+	cfg := defaults()
+	if cfg.ManagementAuthMaxFailures != 5 || cfg.ManagementAuthWindowSecs != 300 {
+		t.Errorf("defaults = %d/%d, want 5/300", cfg.ManagementAuthMaxFailures, cfg.ManagementAuthWindowSecs)
+	}
+	t.Setenv("MANAGEMENT_AUTH_MAX_FAILURES", "0")
+	t.Setenv("MANAGEMENT_AUTH_WINDOW_SECS", "30")
+	loadEnv(cfg)
+	if cfg.ManagementAuthMaxFailures != 0 {
+		t.Errorf("ManagementAuthMaxFailures = %d, want 0", cfg.ManagementAuthMaxFailures)
+	}
+	if cfg.ManagementAuthWindowSecs != 30 {
+		t.Errorf("ManagementAuthWindowSecs = %d, want 30", cfg.ManagementAuthWindowSecs)
+	}
+}
+
+func TestLoadEnv_FailClosed(t *testing.T) {
+	cfg := defaults()
+	if !cfg.FailClosed {
+		t.Fatal("failClosed should default to true")
+	}
+	t.Setenv("FAIL_CLOSED", "false")
+	loadEnv(cfg)
+	if cfg.FailClosed {
+		t.Error("FAIL_CLOSED=false should disable failClosed")
+	}
+}
+
+func TestLoadEnv_MaxRequestBodyMB(t *testing.T) {
+	if cfg := defaults(); cfg.MaxRequestBodyMB != 50 {
+		t.Fatalf("default maxRequestBodyMB = %d, want 50", cfg.MaxRequestBodyMB)
+	}
+	t.Setenv("MAX_REQUEST_BODY_MB", "200")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxRequestBodyMB != 200 {
+		t.Errorf("MaxRequestBodyMB: got %d, want 200", cfg.MaxRequestBodyMB)
+	}
+}
+
+func TestLoad_MaxRequestBodyMBClampNegative(t *testing.T) {
+	t.Setenv("MAX_REQUEST_BODY_MB", "-1")
+	if got := Load().MaxRequestBodyMB; got != 0 {
+		t.Errorf("negative maxRequestBodyMB should clamp to 0, got %d", got)
+	}
+}
+
+func TestLoadEnv_MaxResponseBodyMB(t *testing.T) {
+	if cfg := defaults(); cfg.MaxResponseBodyMB != 50 {
+		t.Fatalf("default maxResponseBodyMB = %d, want 50", cfg.MaxResponseBodyMB)
+	}
+	t.Setenv("MAX_RESPONSE_BODY_MB", "8")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxResponseBodyMB != 8 {
+		t.Errorf("MaxResponseBodyMB: got %d, want 8", cfg.MaxResponseBodyMB)
+	}
+}
+
+func TestLoadEnv_UpstreamTimeoutSecs(t *testing.T) {
+	if cfg := defaults(); cfg.UpstreamTimeoutSecs != 120 {
+		t.Fatalf("default upstreamTimeoutSecs = %d, want 120", cfg.UpstreamTimeoutSecs)
+	}
+	t.Setenv("UPSTREAM_TIMEOUT_SECS", "30")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.UpstreamTimeoutSecs != 30 {
+		t.Errorf("UpstreamTimeoutSecs: got %d, want 30", cfg.UpstreamTimeoutSecs)
+	}
+}
+
+func TestLoad_UpstreamTimeoutSecsClamp(t *testing.T) {
+	t.Setenv("UPSTREAM_TIMEOUT_SECS", "-5")
+	if got := Load().UpstreamTimeoutSecs; got != 0 {
+		t.Errorf("UPSTREAM_TIMEOUT_SECS=-5: got %d, want 0", got)
+	}
+}
+
+func TestLoadEnv_MaxResponseBufferKB(t *testing.T) {
+	t.Setenv("MAX_RESPONSE_BUFFER_KB", "512")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.MaxResponseBufferKB != 512 {
+		t.Errorf("MaxResponseBufferKB: got %d, want 512", cfg.MaxResponseBufferKB)
+	}
+}
+
+func TestLoad_MaxResponseBufferKBClampNegative(t *testing.T) {
+	t.Setenv("MAX_RESPONSE_BUFFER_KB", "-1")
+	if got := Load().MaxResponseBufferKB; got != 0 {
+		t.Errorf("negative maxResponseBufferKB should clamp to 0, got %d", got)
+	}
+}
+
+func TestLoadEnv_APIKeyMinLength(t *testing.T) {
+	if cfg := defaults(); cfg.APIKeyMinLength != 20 {
+		t.Fatalf("default apiKeyMinLength = %d, want 20", cfg.APIKeyMinLength)
+	}
+	t.Setenv("API_KEY_MIN_LENGTH", "32")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.APIKeyMinLength != 32 {
+		t.Errorf("APIKeyMinLength: got %d, want 32", cfg.APIKeyMinLength)
+	}
+}
+
+func TestLoad_APIKeyMinLengthClamp(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"-5", 0},
+		{"5000", 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("API_KEY_MIN_LENGTH", tt.env)
+			if got := Load().APIKeyMinLength; got != tt.want {
+				t.Errorf("API_KEY_MIN_LENGTH=%s: got %d, want %d", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnv_DebugEndpointsEnabled(t *testing.T) {
+	if defaults().DebugEndpointsEnabled {
+		t.Fatal("debug endpoints should be off by default")
+	}
+	t.Setenv("DEBUG_ENDPOINTS_ENABLED", "true")
+	cfg := defaults()
+	loadEnv(cfg)
+	if !cfg.DebugEndpointsEnabled {
+		t.Error("DEBUG_ENDPOINTS_ENABLED=true should enable debug endpoints")
+	}
+}
+
+func TestLoadEnv_OllamaDispatchDelayMs(t *testing.T) {
+	if cfg := defaults(); cfg.OllamaDispatchDelayMs != 0 {
+		t.Fatalf("default ollamaDispatchDelayMs = %d, want 0", cfg.OllamaDispatchDelayMs)
+	}
+	t.Setenv("OLLAMA_DISPATCH_DELAY_MS", "250")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.OllamaDispatchDelayMs != 250 {
+		t.Errorf("OllamaDispatchDelayMs: got %d, want 250", cfg.OllamaDispatchDelayMs)
+	}
+}
+
+func TestLoadEnv_OllamaBatchWindowMs(t *testing.T) {
+	t.Setenv("OLLAMA_BATCH_WINDOW_MS", "50")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.OllamaBatchWindowMs != 50 {
+		t.Errorf("OllamaBatchWindowMs: got %d, want 50", cfg.OllamaBatchWindowMs)
+	}
+}
+
+func TestLoad_OllamaDispatchDelayMsClamp(t *testing.T) {
+	t.Setenv("OLLAMA_DISPATCH_DELAY_MS", "-10")
+	if got := Load().OllamaDispatchDelayMs; got != 0 {
+		t.Errorf("OLLAMA_DISPATCH_DELAY_MS=-10: got %d, want 0", got)
+	}
+}
+
+func TestLoadEnv_SessionTTLSecs(t *testing.T) {
+	if cfg := defaults(); cfg.SessionTTLSecs != 0 {
+		t.Fatalf("default sessionTtlSecs = %d, want 0", cfg.SessionTTLSecs)
+	}
+	t.Setenv("SESSION_TTL_SECS", "30")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.SessionTTLSecs != 30 {
+		t.Errorf("SessionTTLSecs: got %d, want 30", cfg.SessionTTLSecs)
+	}
+}
+
+func TestLoadEnv_SessionStoreURL(t *testing.T) {
+	if cfg := defaults(); cfg.SessionStoreURL != "" {
+		t.Fatalf("default sessionStoreURL = %q, want empty", cfg.SessionStoreURL)
+	}
+	t.Setenv("SESSION_STORE_URL", "redis://:secret@cache:6379/2")
+	cfg := defaults()
+	loadEnv(cfg)
+	if cfg.SessionStoreURL != "redis://:secret@cache:6379/2" {
+		t.Errorf("SessionStoreURL: got %q", cfg.SessionStoreURL)
+	}
+}
+
+func TestLoad_SessionTTLSecsClamp(t *testing.T) {
+	t.Setenv("SESSION_TTL_SECS", "-1")
+	if got := Load().SessionTTLSecs; got != 0 {
+		t.Errorf("SESSION_TTL_SECS=-1: got %d, want 0", got)
+	}
+}
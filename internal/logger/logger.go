@@ -7,6 +7,11 @@
 // Levels (lowest to highest): debug, info, warn, error.
 // Entries below the configured minimum level are silently dropped.
 //
+// SetFormat("json") writes each entry as one JSON object instead, with the
+// same fields:
+//
+//	{"ts":"2006-01-02T15:04:05.000Z07:00","module":"PROXY","action":"request_forward","level":"INFO","msg":"..."}
+//
 // Usage:
 //
 //	log := logger.New("PROXY", cfg.LogLevel)
@@ -15,10 +20,15 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,24 +46,42 @@ const (
 // Logger writes structured log lines for a single module.
 type Logger struct {
 	module string
-	level  Level
-	out    *log.Logger
+	level  atomic.Int32 // minimum Level written; see SetLevel
+	asJSON bool         // one JSON object per line instead of columns
+	out    *log.Logger  // nil: the standard log package's writer; see write
 }
 
+// stdMu serializes lines written to the standard log package's writer, which
+// may be shared with other loggers and is not itself safe for concurrent use.
+var stdMu sync.Mutex
+
 // New creates a Logger for the given module, gated at the given level string.
 // Unrecognized level strings default to "info".
 func New(module, levelStr string) *Logger {
-	return &Logger{
+	l := &Logger{
 		module: strings.ToUpper(module),
-		level:  parseLevel(levelStr),
-		// No prefix or flags — we supply the full line ourselves.
-		out: log.New(os.Stderr, "", 0),
 	}
+	l.SetLevel(levelStr)
+	return l
 }
 
-// SetLevel changes the minimum log level at runtime.
+// SetLevel changes the minimum log level at runtime. It is safe to call
+// while other goroutines are logging.
 func (l *Logger) SetLevel(levelStr string) {
-	l.level = parseLevel(levelStr)
+	l.level.Store(int32(parseLevel(levelStr)))
+}
+
+// SetFormat selects the line format: "json" for one JSON object per entry,
+// anything else for the default fixed-width columns.
+func (l *Logger) SetFormat(format string) {
+	l.asJSON = strings.EqualFold(strings.TrimSpace(format), "json")
+}
+
+// SetOutput redirects the logger to w. By default it writes to the standard
+// log package's current writer (log.Writer, stderr unless redirected), so
+// log.SetOutput moves every module's output at once.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.out = log.New(w, "", 0)
 }
 
 // Debug logs at DEBUG level.
@@ -99,13 +127,75 @@ func (l *Logger) Fatalf(action, format string, args ...any) {
 	l.Fatal(action, fmt.Sprintf(format, args...))
 }
 
+// jsonEntry is one log line in the JSON format.
+type jsonEntry struct {
+	TS     string `json:"ts"`
+	Module string `json:"module"`
+	Action string `json:"action"`
+	Level  string `json:"level"`
+	Msg    string `json:"msg"`
+}
+
 // write emits one log line if level >= l.level.
 func (l *Logger) write(level Level, levelLabel, action, msg string) {
-	if level < l.level {
+	if level < Level(l.level.Load()) {
+		return
+	}
+	now := time.Now()
+	if l.asJSON {
+		line, _ := json.Marshal(jsonEntry{ // cannot fail: all fields are strings
+			TS:     now.Format("2006-01-02T15:04:05.000Z07:00"),
+			Module: l.module,
+			Action: action,
+			Level:  strings.TrimSpace(levelLabel),
+			Msg:    msg,
+		})
+		l.print(string(line))
+		return
+	}
+	ts := now.Format("2006-01-02 15:04:05.000")
+	l.print(fmt.Sprintf("%s | %-12s | %-22s | %s | %s", ts, l.module, action, levelLabel, msg))
+}
+
+// print writes one complete line to the logger's output.
+func (l *Logger) print(line string) {
+	if l.out != nil {
+		l.out.Print(line)
 		return
 	}
-	ts := time.Now().Format("2006-01-02 15:04:05.000")
-	l.out.Printf("%s | %-12s | %-22s | %s | %s", ts, l.module, action, levelLabel, msg)
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	_, _ = io.WriteString(log.Writer(), line+"\n")
+}
+
+// Sampler admits a fixed fraction of events for high-volume log lines,
+// spread evenly: at rate 0.01 it admits the 1st, 101st, 201st, ... event.
+// It is safe for concurrent use.
+type Sampler struct {
+	every uint64 // admit one event in every; 0 = admit none
+	n     atomic.Uint64
+}
+
+// NewSampler returns a Sampler admitting rate (0.0-1.0) of events.
+// A rate of 0 or less admits nothing; 1 or more admits everything.
+func NewSampler(rate float64) *Sampler {
+	s := &Sampler{}
+	switch {
+	case rate <= 0:
+	case rate >= 1:
+		s.every = 1
+	default:
+		s.every = uint64(math.Round(1 / rate))
+	}
+	return s
+}
+
+// Allow reports whether the current event should be logged.
+func (s *Sampler) Allow() bool {
+	if s.every == 0 {
+		return false
+	}
+	return (s.n.Add(1)-1)%s.every == 0
 }
 
 // parseLevel converts a string to a Level, defaulting to LevelInfo.
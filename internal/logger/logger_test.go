@@ -2,9 +2,12 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // newTestLogger returns a Logger that writes to a buffer instead of stderr.
@@ -153,3 +156,102 @@ func TestOutputFormat_ContainsExpectedFields(t *testing.T) {
 		}
 	}
 }
+
+// TestJSONFormat checks that every line is one JSON object carrying the
+// fields of the columnar format, and that level filtering is unchanged.
+func TestJSONFormat(t *testing.T) {
+	var text, js bytes.Buffer
+	lt := newTestLogger("MYMOD", "info", &text)
+	lj := newTestLogger("MYMOD", "info", &js)
+	lj.SetFormat("json")
+	for _, l := range []*Logger{lt, lj} {
+		l.Debug("dropped", "below the level")
+		l.Info("my_action", "the message")
+		l.Warnf("quoted", "value %q | with a pipe", "x")
+	}
+
+	textLines := strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n")
+	jsonLines := strings.Split(strings.TrimSuffix(js.String(), "\n"), "\n")
+	if len(jsonLines) != 2 || len(textLines) != 2 {
+		t.Fatalf("got %d JSON and %d text lines, want 2 each:\n%s\n%s", len(jsonLines), len(textLines), js.String(), text.String())
+	}
+	for i, line := range jsonLines {
+		var e map[string]string
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v: %s", i, err, line)
+		}
+		if len(e) != 5 {
+			t.Errorf("line %d has fields %v, want ts, module, action, level, msg", i, e)
+		}
+		if _, err := time.Parse(time.RFC3339, e["ts"]); err != nil {
+			t.Errorf("line %d: ts %q: %v", i, e["ts"], err)
+		}
+		cols := strings.SplitN(textLines[i], " | ", 5)
+		for j, field := range []string{"module", "action", "level", "msg"} {
+			if want := strings.TrimSpace(cols[j+1]); e[field] != want {
+				t.Errorf("line %d: %s = %q, columnar %q", i, field, e[field], want)
+			}
+		}
+	}
+}
+
+func TestSetFormat_TextByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger("TEST", "info", &buf)
+	l.SetFormat("json")
+	l.SetFormat("text")
+	l.Info("action", "columns")
+	if strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("expected columnar output after SetFormat(\"text\"), got: %s", buf.String())
+	}
+}
+
+func TestSampler(t *testing.T) {
+	cases := []struct {
+		rate float64
+		want int // admitted out of 1000
+	}{
+		{0, 0},
+		{-1, 0},
+		{0.01, 10},
+		{0.25, 250},
+		{1, 1000},
+		{2, 1000},
+	}
+	for _, c := range cases {
+		s := NewSampler(c.rate)
+		got := 0
+		for range 1000 {
+			if s.Allow() {
+				got++
+			}
+		}
+		if got != c.want {
+			t.Errorf("NewSampler(%v): admitted %d of 1000, want %d", c.rate, got, c.want)
+		}
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := New("TEST", "info")
+	l.SetOutput(&buf)
+	l.Info("action", "redirected")
+	if !strings.Contains(buf.String(), "redirected") {
+		t.Errorf("expected output in buffer, got: %q", buf.String())
+	}
+}
+
+func TestDefaultOutput_FollowsStdLog(t *testing.T) {
+	l := New("TEST", "info")
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	l.Info("action", "to std log")
+	if !strings.Contains(buf.String(), "to std log") {
+		t.Errorf("expected output on the standard log writer, got: %q", buf.String())
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("expected exactly one line, got: %q", buf.String())
+	}
+}
@@ -0,0 +1,116 @@
+package management
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// authLimiter tracks failed management auth attempts per client IP and
+// locks an IP out once it reaches maxFailures within window. The lockout
+// lasts window from the failure that triggered it. A successful auth clears
+// the IP's record.
+//
+// The management API binds to loopback by default, so the table stays
+// small; entries are pruned lazily once it grows past pruneThreshold.
+type authLimiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	clients     map[string]*authFailures
+	now         func() time.Time // swapped in tests
+}
+
+type authFailures struct {
+	count       int
+	first       time.Time // start of the current counting window
+	lockedUntil time.Time // zero = not locked
+}
+
+const authLimiterPruneThreshold = 1024
+
+// newAuthLimiter returns nil when maxFailures <= 0 (throttling disabled).
+// All methods are nil-safe.
+func newAuthLimiter(maxFailures int, window time.Duration) *authLimiter {
+	if maxFailures <= 0 || window <= 0 {
+		return nil
+	}
+	return &authLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		clients:     make(map[string]*authFailures),
+		now:         time.Now,
+	}
+}
+
+// clientIP strips the port from a RemoteAddr. Falls back to the raw value
+// if it is not host:port.
+func clientIP(remoteAddr string) string {
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return h
+	}
+	return remoteAddr
+}
+
+// lockedFor reports how long ip remains locked out, or 0 if it is not.
+func (l *authLimiter) lockedFor(ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.clients[ip]
+	if !ok || f.lockedUntil.IsZero() {
+		return 0
+	}
+	if d := f.lockedUntil.Sub(l.now()); d > 0 {
+		return d
+	}
+	delete(l.clients, ip) // lockout expired; start fresh
+	return 0
+}
+
+// fail records a failed attempt from ip and reports whether this attempt
+// triggered a lockout.
+func (l *authLimiter) fail(ip string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.clients) >= authLimiterPruneThreshold {
+		l.pruneLocked(now)
+	}
+	f, ok := l.clients[ip]
+	if !ok || now.Sub(f.first) > l.window {
+		f = &authFailures{first: now}
+		l.clients[ip] = f
+	}
+	f.count++
+	if f.count >= l.maxFailures && f.lockedUntil.IsZero() {
+		f.lockedUntil = now.Add(l.window)
+		return true
+	}
+	return false
+}
+
+// succeed clears the failure record for ip.
+func (l *authLimiter) succeed(ip string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.clients, ip)
+	l.mu.Unlock()
+}
+
+// pruneLocked drops records whose window and lockout have both expired.
+// Must be called with l.mu held.
+func (l *authLimiter) pruneLocked(now time.Time) {
+	for ip, f := range l.clients {
+		if now.Sub(f.first) > l.window && now.After(f.lockedUntil) {
+			delete(l.clients, ip)
+		}
+	}
+}
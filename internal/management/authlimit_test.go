@@ -0,0 +1,144 @@
+package management
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ai-anonymizing-proxy/internal/metrics"
+)
+
+// fakeClock is a manually advanced time source for authLimiter.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestNewAuthLimiter_Disabled(t *testing.T) {
+	if l := newAuthLimiter(0, time.Minute); l != nil {
+		t.Error("expected nil limiter for maxFailures=0")
+	}
+	var l *authLimiter
+	if l.fail("192.0.2.1") || l.lockedFor("192.0.2.1") != 0 {
+		t.Error("nil limiter must never lock")
+	}
+	l.succeed("192.0.2.1") // must not panic
+}
+
+func TestClientIP(t *testing.T) {
+	if got := clientIP("192.0.2.7:5555"); got != "192.0.2.7" {
+		t.Errorf("clientIP = %q", got)
+	}
+	if got := clientIP("[2001:db8::1]:443"); got != "2001:db8::1" {
+		t.Errorf("clientIP v6 = %q", got)
+	}
+	if got := clientIP("no-port"); got != "no-port" {
+		t.Errorf("clientIP fallback = %q", got)
+	}
+}
+
+func TestAuthLimiter_WindowResetsCount(t *testing.T) {
+	clk := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := newAuthLimiter(3, time.Minute)
+	l.now = clk.now
+
+	l.fail("192.0.2.1")
+	l.fail("192.0.2.1")
+	clk.advance(2 * time.Minute) // window expires; count restarts
+	if l.fail("192.0.2.1") {
+		t.Error("failure after window expiry should not lock")
+	}
+	if l.lockedFor("192.0.2.1") != 0 {
+		t.Error("should not be locked")
+	}
+}
+
+func TestAuthLimiter_Prune(t *testing.T) {
+	clk := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := newAuthLimiter(100, time.Minute)
+	l.now = clk.now
+	for i := range authLimiterPruneThreshold {
+		l.fail(fmt.Sprintf("198.51.%d.%d", i/256, i%256))
+	}
+	clk.advance(2 * time.Minute)
+	l.fail("192.0.2.99")
+	if n := len(l.clients); n != 1 {
+		t.Errorf("expected stale entries pruned, %d remain", n)
+	}
+}
+
+// TestAuthMiddleware_Lockout drives repeated bad tokens from one IP and
+// verifies the lockout engages (even for a valid token), is per-IP, counts
+// the failures metric, and lifts after the window.
+func TestAuthMiddleware_Lockout(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementToken = "secret123"
+	cfg.ManagementAuthMaxFailures = 3
+	cfg.ManagementAuthWindowSecs = 60
+	m := metrics.New()
+	srv := New(cfg, NewDomainRegistry(cfg, ""), m)
+	clk := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	srv.authLimit.now = clk.now
+	h := srv.Handler()
+
+	do := func(remote, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := range 3 {
+		if w := do("192.0.2.10:4000", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+
+	w := do("192.0.2.10:4001", "secret123")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked out, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+	}
+
+	// Other clients are unaffected.
+	if w := do("192.0.2.20:4000", "secret123"); w.Code != http.StatusOK {
+		t.Errorf("other IP: expected 200, got %d", w.Code)
+	}
+
+	if got := m.Snapshot().Errors.ManagementAuth; got != 3 {
+		t.Errorf("ManagementAuth failures = %d, want 3", got)
+	}
+
+	clk.advance(61 * time.Second)
+	if w := do("192.0.2.10:4002", "secret123"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after lockout window, got %d", w.Code)
+	}
+}
+
+// TestAuthMiddleware_SuccessClearsFailures verifies a valid token resets the
+// failure count so sporadic typos never accumulate into a lockout.
+func TestAuthMiddleware_SuccessClearsFailures(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementToken = "secret123"
+	cfg.ManagementAuthMaxFailures = 2
+	cfg.ManagementAuthWindowSecs = 60
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+	h := srv.Handler()
+
+	for _, token := range []string{"wrong", "secret123", "wrong", "secret123"} {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code == http.StatusTooManyRequests {
+			t.Fatalf("unexpected lockout after interleaved successes")
+		}
+	}
+}
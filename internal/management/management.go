@@ -4,15 +4,29 @@
 // Endpoints:
 //
 //	GET  /status          - proxy health, current AI domain list
+//	GET  /readyz          - readiness, including persistent cache health
+//	GET  /domains/list    - AI API domains with their source
 //	POST /domains/add     - add an AI API domain {"domain":"api.example.com"}
 //	POST /domains/remove  - remove an AI API domain {"domain":"api.example.com"}
+//	POST /domains/anon-toggle - pause or resume anonymization for a domain
+//	                        {"domain":"api.example.com","disabled":true}
+//	POST /domains/reload  - re-read the persisted domain file
+//	POST /config/reload   - re-read proxy-config.json and apply the
+//	                        hot-reloadable settings
+//	GET  /sessions        - ID, token count and age of each open session
+//	                        (admin token only)
+//	GET  /sessions/{id}/mappings - token → original map of an open session
+//	                        (debugEndpointsEnabled and admin token only)
 package management
 
 import (
+	"cmp"
 	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -20,20 +34,55 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"ai-anonymizing-proxy/internal/anonymizer"
 	"ai-anonymizing-proxy/internal/config"
 	"ai-anonymizing-proxy/internal/domainmatch"
 	"ai-anonymizing-proxy/internal/metrics"
 )
 
+// CacheStatsFunc reports the anonymizer cache fill: the number of resident
+// entries and the capacity before eviction (-1 = unbounded).
+type CacheStatsFunc func() (entries, capacity int)
+
+// CacheHealthFunc probes the anonymizer's persistent cache; nil means healthy.
+type CacheHealthFunc func() error
+
+// PIITypesFunc reports the anonymizer's PII types and their detection status.
+type PIITypesFunc func() []anonymizer.PIITypeInfo
+
+// SessionMappingsFunc returns the token → original map of an open session;
+// ok is false for an unknown session.
+type SessionMappingsFunc func(sessionID string) (mappings map[string]string, ok bool)
+
+// SessionStatsFunc lists the anonymizer's sessions without their contents.
+type SessionStatsFunc func() []anonymizer.SessionStat
+
+// ConfigReloadFunc applies the hot-reloadable settings of a reloaded config.
+type ConfigReloadFunc func(cfg *config.Config)
+
 // Server is the management API server.
 type Server struct {
-	cfg       *config.Config
-	startTime time.Time
-	domains   *DomainRegistry
-	token     string           // bearer token for auth; empty = no auth
-	metrics   *metrics.Metrics // nil = no metrics
+	cfg         *config.Config
+	startTime   time.Time
+	domains     *DomainRegistry
+	token       string                              // admin bearer token; authorizes all endpoints
+	readToken   string                              // read-only bearer token; authorizes GET/HEAD only
+	metrics     *metrics.Metrics                    // nil = no metrics
+	corsOrigin  map[string]bool                     // allowed browser origins; empty = CORS disabled
+	authLimit   *authLimiter                        // nil = failed-auth throttling disabled
+	cacheStats  atomic.Pointer[CacheStatsFunc]      // nil = cache section omitted from /status
+	cacheHealth atomic.Pointer[CacheHealthFunc]     // nil = proxy not started; /readyz reports 503
+	piiTypes    atomic.Pointer[PIITypesFunc]        // nil = /patterns reports 503
+	mappings    atomic.Pointer[SessionMappingsFunc] // nil = session mappings report 503
+	sessions    atomic.Pointer[SessionStatsFunc]    // nil = /sessions reports 503
+	reload      atomic.Pointer[ConfigReloadFunc]    // nil = /config/reload reports 503
+
+	reloadMu   sync.Mutex                     // serializes /config/reload
+	reloaded   atomic.Pointer[config.Config]  // last config applied by /config/reload; nil = cfg
+	loadConfig func() (*config.Config, error) // config.Reload; replaced in tests
 }
 
 // DomainRegistry holds the mutable set of AI API domains.
@@ -48,44 +97,114 @@ type Server struct {
 //
 // Has() checks the exact-match map first, so an exact entry always wins
 // over an overlapping glob.
+//
+// When a remote domain list is configured, remote records the entries the
+// last fetch supplied and manual the ones added through the API, so a
+// refresh can drop entries the remote list no longer has without touching
+// manual additions.
+//
+// origins records where each entry came from (sourceConfig, sourceRuntime or
+// sourceRemote) for auditing through /domains/list.
+//
+// anonOff holds hosts whose traffic is still intercepted but forwarded
+// without anonymization, for diagnosing model behavior. It is runtime-only:
+// a restart turns anonymization back on everywhere.
 type DomainRegistry struct {
 	mu          sync.RWMutex
 	domains     map[string]bool          // exact matches
 	globs       []domainmatch.DomainGlob // segment-glob patterns
 	persistPath string                   // empty = no persistence
+	remote      map[string]bool          // entries from the last remote fetch
+	manual      map[string]bool          // entries added via Add since startup
+	origins     map[string]string        // entry → source; see DomainEntry
+	anonOff     map[string]bool          // hosts with anonymization paused; never persisted
+}
+
+// Sources reported for registry entries by List.
+const (
+	sourceConfig  = "config"  // aiApiDomains in the config
+	sourceRuntime = "runtime" // added through the API or only in the persist file
+	sourceRemote  = "remote"  // supplied by domainsURL
+)
+
+// DomainEntry is a registered domain or glob pattern and where it came from.
+type DomainEntry struct {
+	Domain string `json:"domain"`
+	Source string `json:"source"`
 }
 
 // NewDomainRegistry creates a registry seeded from the config defaults.
 // If persistPath is non-empty and the file exists, its contents take
-// precedence over config defaults (it represents runtime overrides).
+// precedence over config defaults (it represents runtime overrides); its
+// entries that are not config defaults are sourced as runtime.
+// If cfg.DomainsURL is set, a successfully fetched remote list is merged
+// into that local list, and the merged list is persisted so domains added
+// at runtime survive the next start alongside the remote entries.
 // Patterns containing "*" segments are routed to the glob slice; all
 // others are stored as exact matches.
 func NewDomainRegistry(cfg *config.Config, persistPath string) *DomainRegistry {
 	r := &DomainRegistry{
 		domains:     make(map[string]bool, len(cfg.AIAPIDomains)),
 		persistPath: persistPath,
+		remote:      make(map[string]bool),
+		manual:      make(map[string]bool),
+		origins:     make(map[string]string),
+		anonOff:     make(map[string]bool),
+	}
+
+	// Remote entries go in first so an entry that is also in the local list
+	// is sourced as remote, and a later refresh can drop it.
+	fetched := false
+	if cfg.DomainsURL != "" {
+		domains, err := fetchRemoteDomains(cfg.DomainsURL)
+		if err == nil {
+			for _, d := range domains {
+				r.addEntryLocked(d, sourceRemote)
+				r.remote[d] = true
+			}
+			log.Printf("[DOMAINS] Loaded %d domains from %s", len(domains), cfg.DomainsURL)
+			fetched = true
+		} else {
+			log.Printf("[DOMAINS] Warning: failed to fetch %s: %v (using local domain list)", cfg.DomainsURL, err)
+		}
 	}
 
-	// Try to load persisted domains first
-	if persistPath != "" {
+	r.loadLocal(cfg)
+	if fetched {
+		r.persist(r.snapshotLocked())
+	}
+	return r
+}
+
+// loadLocal adds the persisted domain list or, without one, the config
+// defaults. Called only from NewDomainRegistry, before r is shared.
+func (r *DomainRegistry) loadLocal(cfg *config.Config) {
+	if r.persistPath != "" {
 		domains, err := r.loadFromDisk()
 		switch {
 		case err == nil:
+			defaults := make(map[string]bool, len(cfg.AIAPIDomains))
+			for _, d := range cfg.AIAPIDomains {
+				defaults[domainmatch.NormalizeHost(d)] = true
+			}
 			for _, d := range domains {
-				r.addEntryLocked(d)
+				source := sourceRuntime
+				if defaults[domainmatch.NormalizeHost(d)] {
+					source = sourceConfig
+				}
+				r.addEntryLocked(d, source)
 			}
-			log.Printf("[DOMAINS] Loaded %d domains from %s", len(domains), persistPath)
-			return r
+			log.Printf("[DOMAINS] Loaded %d domains from %s", len(domains), r.persistPath)
+			return
 		case !os.IsNotExist(err):
-			log.Printf("[DOMAINS] Warning: failed to load %s: %v (using config defaults)", persistPath, err)
+			log.Printf("[DOMAINS] Warning: failed to load %s: %v (using config defaults)", r.persistPath, err)
 		}
 	}
 
 	// Fall back to config defaults
 	for _, d := range cfg.AIAPIDomains {
-		r.addEntryLocked(d)
+		r.addEntryLocked(d, sourceConfig)
 	}
-	return r
 }
 
 // addEntryLocked routes a single pattern into the appropriate bucket.
@@ -93,9 +212,13 @@ func NewDomainRegistry(cfg *config.Config, persistPath string) *DomainRegistry {
 // access is possible). The pattern is canonicalized (lowercased,
 // trailing "." stripped) so direct callers, the persistence loader,
 // and the HTTP handlers all converge on the same map keys. Duplicate
-// globs are silently dropped.
-func (r *DomainRegistry) addEntryLocked(pattern string) {
+// globs are silently dropped. source is recorded only for a new entry: an
+// entry keeps the source it was first registered with.
+func (r *DomainRegistry) addEntryLocked(pattern, source string) {
 	pattern = domainmatch.NormalizeHost(pattern)
+	if _, ok := r.origins[pattern]; !ok {
+		r.origins[pattern] = source
+	}
 	if domainmatch.IsGlob(pattern) {
 		for _, g := range r.globs {
 			if g.Raw() == pattern {
@@ -108,6 +231,41 @@ func (r *DomainRegistry) addEntryLocked(pattern string) {
 	r.domains[pattern] = true
 }
 
+// hasEntryLocked reports whether the exact domain or raw glob pattern is
+// registered. Unlike Has it does not match domains against globs.
+// Caller must hold r.mu.
+func (r *DomainRegistry) hasEntryLocked(pattern string) bool {
+	if domainmatch.IsGlob(pattern) {
+		for _, g := range r.globs {
+			if g.Raw() == pattern {
+				return true
+			}
+		}
+		return false
+	}
+	return r.domains[pattern]
+}
+
+// removeEntryLocked deletes a normalized exact domain or raw glob pattern
+// and reports whether it was present. Caller must hold r.mu.
+func (r *DomainRegistry) removeEntryLocked(pattern string) bool {
+	delete(r.origins, pattern)
+	if domainmatch.IsGlob(pattern) {
+		for i, g := range r.globs {
+			if g.Raw() == pattern {
+				r.globs = append(r.globs[:i], r.globs[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := r.domains[pattern]; ok {
+		delete(r.domains, pattern)
+		return true
+	}
+	return false
+}
+
 // Has returns true if the domain is registered as an AI API domain.
 // Exact matches take precedence over glob matches. The inbound domain
 // is canonicalized (lowercased, trailing "." stripped) per RFC 1035
@@ -132,7 +290,8 @@ func (r *DomainRegistry) Has(domain string) bool {
 // Patterns containing "*" segments are stored as globs; others as exact matches.
 func (r *DomainRegistry) Add(domain string) {
 	r.mu.Lock()
-	r.addEntryLocked(domain)
+	r.addEntryLocked(domain, sourceRuntime)
+	r.manual[domainmatch.NormalizeHost(domain)] = true
 	snapshot := r.snapshotLocked()
 	r.mu.Unlock()
 	r.persist(snapshot)
@@ -147,20 +306,9 @@ func (r *DomainRegistry) Add(domain string) {
 func (r *DomainRegistry) Remove(domain string) bool {
 	domain = domainmatch.NormalizeHost(domain)
 	r.mu.Lock()
-	removed := false
-	if domainmatch.IsGlob(domain) {
-		for i, g := range r.globs {
-			if g.Raw() == domain {
-				r.globs = append(r.globs[:i], r.globs[i+1:]...)
-				removed = true
-				break
-			}
-		}
-	} else if _, ok := r.domains[domain]; ok {
-		delete(r.domains, domain)
-		removed = true
-	}
-	if !removed {
+	delete(r.manual, domain)
+	delete(r.anonOff, domain)
+	if !r.removeEntryLocked(domain) {
 		r.mu.Unlock()
 		return false
 	}
@@ -170,6 +318,52 @@ func (r *DomainRegistry) Remove(domain string) bool {
 	return true
 }
 
+// SetAnonymizationDisabled pauses (disabled=true) or resumes anonymization
+// for host without removing it from the registry.
+func (r *DomainRegistry) SetAnonymizationDisabled(host string, disabled bool) {
+	host = domainmatch.NormalizeHost(host)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if disabled {
+		r.anonOff[host] = true
+	} else {
+		delete(r.anonOff, host)
+	}
+}
+
+// AnonymizationDisabled reports whether anonymization is paused for host.
+func (r *DomainRegistry) AnonymizationDisabled(host string) bool {
+	host = domainmatch.NormalizeHost(host)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.anonOff[host]
+}
+
+// AnonymizationDisabledHosts returns the sorted hosts with anonymization paused.
+func (r *DomainRegistry) AnonymizationDisabledHosts() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.anonOff))
+	for h := range r.anonOff {
+		out = append(out, h)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// List returns every registered domain and glob pattern with its source,
+// sorted by domain.
+func (r *DomainRegistry) List() []DomainEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snapshot := r.snapshotLocked()
+	out := make([]DomainEntry, len(snapshot))
+	for i, d := range snapshot {
+		out[i] = DomainEntry{Domain: d, Source: r.origins[d]}
+	}
+	return out
+}
+
 // All returns a sorted slice of all registered domains and glob patterns.
 // Glob patterns appear with their original "*" segments intact.
 func (r *DomainRegistry) All() []string {
@@ -178,6 +372,55 @@ func (r *DomainRegistry) All() []string {
 	return r.snapshotLocked()
 }
 
+// errNoPersistPath is returned by Reload when the registry has no file.
+var errNoPersistPath = errors.New("no domain persist file configured")
+
+// Reload re-reads the persisted domain file and replaces the registry's
+// entries with its contents, picking up edits made to the file outside the
+// proxy. It returns the entries added and removed, sorted. Anonymization
+// pauses and the sources of kept entries are kept; new entries are sourced
+// as runtime. On a read or parse error the registry is left as is.
+func (r *DomainRegistry) Reload() (added, removed []string, err error) {
+	if r.persistPath == "" {
+		return nil, nil, errNoPersistPath
+	}
+	domains, err := r.loadFromDisk()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before := r.snapshotLocked()
+	prev := r.origins
+	r.domains = make(map[string]bool, len(domains))
+	r.globs = nil
+	r.origins = make(map[string]string, len(domains))
+	for _, d := range domains {
+		r.addEntryLocked(d, cmp.Or(prev[domainmatch.NormalizeHost(d)], sourceRuntime))
+	}
+	after := r.snapshotLocked()
+
+	inBefore := make(map[string]bool, len(before))
+	for _, d := range before {
+		inBefore[d] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, d := range after {
+		inAfter[d] = true
+		if !inBefore[d] {
+			added = append(added, d)
+		}
+	}
+	for _, d := range before {
+		if !inAfter[d] {
+			removed = append(removed, d)
+			delete(r.manual, d)
+		}
+	}
+	return added, removed, nil
+}
+
 // loadFromDisk reads the persisted domain list from disk.
 func (r *DomainRegistry) loadFromDisk() ([]string, error) {
 	data, err := os.ReadFile(r.persistPath)
@@ -271,40 +514,194 @@ func New(cfg *config.Config, registry *DomainRegistry, m *metrics.Metrics) *Serv
 		startTime: time.Now(),
 		domains:   registry,
 		token:     cfg.ManagementToken,
+		readToken: cfg.ManagementReadToken,
 		metrics:   m,
+		authLimit: newAuthLimiter(cfg.ManagementAuthMaxFailures, time.Duration(cfg.ManagementAuthWindowSecs)*time.Second),
+
+		loadConfig: config.Reload,
+	}
+	if len(cfg.ManagementCORSOrigins) > 0 {
+		s.corsOrigin = make(map[string]bool, len(cfg.ManagementCORSOrigins))
+		for _, o := range cfg.ManagementCORSOrigins {
+			s.corsOrigin[strings.TrimSuffix(o, "/")] = true
+		}
+		log.Printf("[MANAGEMENT] CORS enabled for origins: %v", cfg.ManagementCORSOrigins)
 	}
 	if s.token != "" {
 		log.Printf("[MANAGEMENT] Bearer token authentication enabled")
 	}
+	if s.readToken != "" {
+		log.Printf("[MANAGEMENT] Read-only bearer token enabled")
+		if s.token == "" {
+			log.Printf("[MANAGEMENT] Warning: managementReadToken set without managementToken; domain changes are disabled")
+		}
+	}
 	return s
 }
 
+// SetCacheStats registers the source for the cache section of /status.
+// Safe to call while the server is running: the proxy (and with it the
+// anonymizer cache) is constructed after the management API starts.
+func (s *Server) SetCacheStats(fn CacheStatsFunc) {
+	if fn == nil {
+		s.cacheStats.Store(nil)
+		return
+	}
+	s.cacheStats.Store(&fn)
+}
+
+// SetCacheHealth registers the cache probe used by /readyz. Until it is set
+// the proxy is still starting and /readyz answers 503.
+func (s *Server) SetCacheHealth(fn CacheHealthFunc) {
+	if fn == nil {
+		s.cacheHealth.Store(nil)
+		return
+	}
+	s.cacheHealth.Store(&fn)
+}
+
+// SetPIITypes registers the source for /patterns and the enabled type list
+// in /status. Like SetCacheStats, it is called once the proxy exists.
+func (s *Server) SetPIITypes(fn PIITypesFunc) {
+	if fn == nil {
+		s.piiTypes.Store(nil)
+		return
+	}
+	s.piiTypes.Store(&fn)
+}
+
+// SetSessionMappings registers the source for GET /sessions/{id}/mappings,
+// which is only served with cfg.DebugEndpointsEnabled.
+func (s *Server) SetSessionMappings(fn SessionMappingsFunc) {
+	if fn == nil {
+		s.mappings.Store(nil)
+		return
+	}
+	s.mappings.Store(&fn)
+}
+
+// SetSessionStats registers the source for GET /sessions.
+func (s *Server) SetSessionStats(fn SessionStatsFunc) {
+	if fn == nil {
+		s.sessions.Store(nil)
+		return
+	}
+	s.sessions.Store(&fn)
+}
+
+// SetConfigReload registers the function that applies a reloaded config
+// for POST /config/reload.
+func (s *Server) SetConfigReload(fn ConfigReloadFunc) {
+	if fn == nil {
+		s.reload.Store(nil)
+		return
+	}
+	s.reload.Store(&fn)
+}
+
 // Handler returns the HTTP handler for the management API.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/readyz", s.handleReadyz)
 	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/patterns", s.handlePatterns)
+	mux.HandleFunc("/domains/list", s.handleListDomains)
 	mux.HandleFunc("/domains/add", s.handleAddDomain)
 	mux.HandleFunc("/domains/remove", s.handleRemoveDomain)
-	return s.authMiddleware(mux)
+	mux.HandleFunc("/domains/anon-toggle", s.handleAnonToggle)
+	mux.HandleFunc("/domains/reload", s.handleReloadDomains)
+	mux.HandleFunc("/config/reload", s.handleReloadConfig)
+	mux.HandleFunc("/sessions", s.handleSessions)
+	mux.HandleFunc("/sessions/{id}/mappings", s.handleSessionMappings)
+	return s.corsMiddleware(s.authMiddleware(mux))
+}
+
+// corsMiddleware emits CORS headers for allowed browser origins and answers
+// preflight requests. It runs before authMiddleware because browsers never
+// send the Authorization header on an OPTIONS preflight. Requests from
+// origins that are not allowed get no CORS headers (the browser then blocks
+// the response); a disallowed preflight is rejected with 403.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(s.corsOrigin) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := s.corsOrigin["*"] || s.corsOrigin[origin]
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		w.Header().Add("Vary", "Origin")
+		if !allowed {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // authMiddleware checks for a valid Bearer token if one is configured.
+// Authentication is enabled when either token is set. The admin token
+// authorizes every endpoint; the read-only token authorizes only GET/HEAD
+// requests and gets 403 on anything that mutates state.
+//
+// Repeated failures from one client IP lock that IP out (429) for the
+// configured window, even if it later presents a valid token.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.token == "" {
+		if s.token == "" && s.readToken == "" {
 			next.ServeHTTP(w, r)
 			return
 		}
+		ip := clientIP(r.RemoteAddr)
+		if d := s.authLimit.lockedFor(ip); d > 0 {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(d.Seconds()+0.999)))
+			http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+			return
+		}
 		auth := r.Header.Get("Authorization")
 		const prefix = "Bearer "
-		if !strings.HasPrefix(auth, prefix) ||
-			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[len(prefix):])), []byte(s.token)) != 1 {
-			log.Printf("[MANAGEMENT] Unauthorized access attempt from %s to %s", r.RemoteAddr, r.URL.Path)
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		var presented []byte
+		if strings.HasPrefix(auth, prefix) {
+			presented = []byte(strings.TrimSpace(auth[len(prefix):]))
+		}
+		if s.token != "" && subtle.ConstantTimeCompare(presented, []byte(s.token)) == 1 {
+			s.authLimit.succeed(ip)
+			next.ServeHTTP(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		if s.readToken != "" && subtle.ConstantTimeCompare(presented, []byte(s.readToken)) == 1 {
+			s.authLimit.succeed(ip)
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			log.Printf("[MANAGEMENT] Read-only token rejected for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if s.metrics != nil {
+			s.metrics.ManagementAuthFailures.Add(1)
+		}
+		if s.authLimit.fail(ip) {
+			log.Printf("[MANAGEMENT] Locking out %s after %d failed auth attempts", ip, s.authLimit.maxFailures)
+		}
+		log.Printf("[MANAGEMENT] Unauthorized access attempt from %s to %s", r.RemoteAddr, r.URL.Path)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 	})
 }
 
@@ -398,16 +795,25 @@ func validDomain(d string) bool {
 var labelPieceRegexp = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
 
 func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	type cacheStatus struct {
+		Entries  int `json:"entries"`
+		Capacity int `json:"capacity"`
+	}
 	type response struct {
 		Status    string   `json:"status"`
 		Uptime    string   `json:"uptime"`
 		ProxyPort int      `json:"proxyPort"`
 		Domains   []string `json:"aiApiDomains"`
+		AnonOff   []string `json:"anonymizationDisabled,omitempty"`
 		Ollama    struct {
-			Endpoint string `json:"endpoint"`
-			Model    string `json:"model"`
-			Enabled  bool   `json:"enabled"`
+			Endpoint  string  `json:"endpoint"`
+			Model     string  `json:"model"`
+			Enabled   bool    `json:"enabled"`
+			Threshold float64 `json:"aiConfidenceThreshold"`
 		} `json:"ollama"`
+		Cache    *cacheStatus       `json:"cache,omitempty"`
+		PIITypes []string           `json:"enabledPIITypes,omitempty"`
+		Settings reloadableSettings `json:"settings"`
 	}
 
 	resp := response{
@@ -415,14 +821,79 @@ func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
 		Uptime:    time.Since(s.startTime).Round(time.Second).String(),
 		ProxyPort: s.cfg.ProxyPort,
 		Domains:   s.domains.All(),
+		AnonOff:   s.domains.AnonymizationDisabledHosts(),
 	}
 	resp.Ollama.Endpoint = s.cfg.OllamaEndpoint
 	resp.Ollama.Model = s.cfg.OllamaModel
 	resp.Ollama.Enabled = s.cfg.UseAIDetection
+	// One snapshot: the settings of a single reload, never a mix.
+	current := s.cfg
+	if next := s.reloaded.Load(); next != nil {
+		current = next
+	}
+	resp.Settings = newReloadableSettings(current)
+	resp.Ollama.Threshold = resp.Settings.AIConfidence
+	if fn := s.cacheStats.Load(); fn != nil {
+		entries, capacity := (*fn)()
+		resp.Cache = &cacheStatus{Entries: entries, Capacity: capacity}
+	}
+	if fn := s.piiTypes.Load(); fn != nil {
+		for _, t := range (*fn)() {
+			if t.Enabled {
+				resp.PIITypes = append(resp.PIITypes, string(t.Name))
+			}
+		}
+	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// handlePatterns lists every PII type with its regex availability,
+// confidence and whether it is currently detected.
+func (s *Server) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	fn := s.piiTypes.Load()
+	if fn == nil {
+		http.Error(w, "proxy starting", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]anonymizer.PIITypeInfo{"piiTypes": (*fn)()})
+}
+
+// handleReadyz reports readiness. A failing cache probe marks the proxy
+// "degraded" but still ready (200): requests are anonymized either way and
+// only cross-restart cache reuse is affected.
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	type response struct {
+		Status     string `json:"status"`
+		Cache      string `json:"cache,omitempty"`
+		CacheError string `json:"cacheError,omitempty"`
+	}
+	fn := s.cacheHealth.Load()
+	if fn == nil {
+		writeJSON(w, http.StatusServiceUnavailable, response{Status: "starting"})
+		return
+	}
+	resp := response{Status: "ready", Cache: "ok"}
+	if err := (*fn)(); err != nil {
+		resp = response{Status: "degraded", Cache: "degraded", CacheError: err.Error()}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleListDomains lists the registered AI domains with the source of
+// each, so runtime additions can be told apart from the config defaults.
+func (s *Server) handleListDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.domains.List())
+}
+
 func (s *Server) handleAddDomain(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "POST only", http.StatusMethodNotAllowed)
@@ -473,12 +944,231 @@ func (s *Server) handleRemoveDomain(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"removed": req.Domain})
 }
 
-func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+// handleAnonToggle pauses or resumes anonymization for a registered domain.
+// The domain stays intercepted, so its requests are still logged and
+// counted, but they are forwarded unmodified. Without "disabled" the current
+// state is flipped.
+func (s *Server) handleAnonToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	var req struct {
+		Domain   string `json:"domain"`
+		Disabled *bool  `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Domain == "" {
+		http.Error(w, "invalid request: need {\"domain\":\"...\"}", http.StatusBadRequest)
+		return
+	}
+	req.Domain = strings.ToLower(req.Domain)
+	if !validDomain(req.Domain) {
+		http.Error(w, "invalid domain name", http.StatusBadRequest)
+		return
+	}
+	disabled := !s.domains.AnonymizationDisabled(req.Domain)
+	if req.Disabled != nil {
+		disabled = *req.Disabled
+	}
+	if disabled && !s.domains.Has(req.Domain) {
+		http.Error(w, "domain not registered", http.StatusNotFound)
+		return
+	}
+	s.domains.SetAnonymizationDisabled(req.Domain, disabled)
+	if disabled {
+		log.Printf("[MANAGEMENT] Anonymization DISABLED for %s: requests are forwarded unmodified", req.Domain)
+	} else {
+		log.Printf("[MANAGEMENT] Anonymization re-enabled for %s", req.Domain)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"domain": req.Domain, "anonymizationDisabled": disabled})
+}
+
+// handleReloadDomains replaces the domain set with the contents of the
+// persist file, for deployments where config management edits the file.
+func (s *Server) handleReloadDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	added, removed, err := s.domains.Reload()
+	switch {
+	case errors.Is(err, errNoPersistPath):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[MANAGEMENT] Domain reload failed: %v (keeping current list)", err)
+		http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[MANAGEMENT] Reloaded AI domains from disk: added %v, removed %v", added, removed)
+	if added == nil {
+		added = []string{}
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"added": added, "removed": removed})
+}
+
+// reloadableFields are the config fields POST /config/reload applies to the
+// running proxy. maxPIIInstructionChars takes effect through the
+// piiInstructions it truncates.
+var reloadableFields = map[string]bool{
+	"aiConfidenceThreshold":  true,
+	"piiInstructions":        true,
+	"maxPIIInstructionChars": true,
+	"logLevel":               true,
+}
+
+// reloadableSettings is the JSON view of the hot-reloadable settings of a
+// config, as /config/reload applies them and /status reports them. PII
+// instructions are listed by key only.
+type reloadableSettings struct {
+	AIConfidence    float64  `json:"aiConfidenceThreshold"`
+	PIIInstructions []string `json:"piiInstructions"`
+	LogLevel        string   `json:"logLevel"`
+}
+
+func newReloadableSettings(cfg *config.Config) reloadableSettings {
+	keys := make([]string, 0, len(cfg.PIIInstructions))
+	for key := range cfg.PIIInstructions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return reloadableSettings{AIConfidence: cfg.AIConfidence, PIIInstructions: keys, LogLevel: cfg.LogLevel}
+}
+
+// handleReloadConfig re-reads proxy-config.json and applies the
+// hot-reloadable settings together. Changed fields that need a restart,
+// such as ports and CA paths, are listed as ignored. A file that cannot be
+// read or parsed changes nothing.
+func (s *Server) handleReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	fn := s.reload.Load()
+	if fn == nil {
+		http.Error(w, "proxy starting", http.StatusServiceUnavailable)
+		return
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	next, err := s.loadConfig()
+	if err != nil {
+		log.Printf("[MANAGEMENT] Config reload failed: %v (keeping current settings)", err)
+		http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	(*fn)(next)
+	s.reloaded.Store(next)
+	ignored := []string{}
+	for _, name := range config.ChangedFields(s.cfg, next) {
+		if !reloadableFields[name] {
+			ignored = append(ignored, name)
+		}
+	}
+	log.Printf("[MANAGEMENT] Reloaded config: aiConfidenceThreshold=%g logLevel=%s, ignored %v", next.AIConfidence, next.LogLevel, ignored)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"applied": newReloadableSettings(next),
+		"ignored": ignored,
+	})
+}
+
+// handleSessionMappings returns the token → original map of an open session
+// for debugging. It exposes PII originals, so it is 404 unless
+// debugEndpointsEnabled is set and needs the admin token even for GET: the
+// read-only token, and any request when no admin token is configured, get
+// 403. Each access is logged, without the originals.
+func (s *Server) handleSessionMappings(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DebugEndpointsEnabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	if !s.isAdmin(r) {
+		log.Printf("[MANAGEMENT] Session mappings for %q refused for %s: admin token required", id, r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	fn := s.mappings.Load()
+	if fn == nil {
+		http.Error(w, "proxy starting", http.StatusServiceUnavailable)
+		return
+	}
+	mappings, ok := (*fn)(id)
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("[MANAGEMENT] Session mappings for %q read by %s (%d tokens)", id, r.RemoteAddr, len(mappings))
+	writeJSON(w, http.StatusOK, map[string]any{"sessionID": id, "mappings": mappings})
+}
+
+// handleSessions lists the open sessions with their token counts and ages,
+// never their tokens or originals. The list is operational state, so like
+// the mappings endpoint it needs the admin token even when authentication
+// is otherwise off; the read-only token gets 403.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isAdmin(r) {
+		log.Printf("[MANAGEMENT] Session list refused for %s: admin token required", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	fn := s.sessions.Load()
+	if fn == nil {
+		http.Error(w, "proxy starting", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": (*fn)()})
+}
+
+// isAdmin reports whether r presents the admin token. It is false whenever
+// no admin token is configured.
+func (s *Server) isAdmin(r *http.Request) bool {
+	presented, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(presented)), []byte(s.token)) == 1
+}
+
+// handleMetrics returns the counters as JSON, or in the Prometheus text
+// format when the client asks for it with ?format=prometheus or an Accept
+// header listing text/plain (as Prometheus scrapers send).
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	if s.metrics == nil {
 		http.Error(w, "metrics not enabled", http.StatusServiceUnavailable)
 		return
 	}
-	writeJSON(w, http.StatusOK, s.metrics.Snapshot())
+	if !wantsPrometheus(r) {
+		writeJSON(w, http.StatusOK, s.metrics.Snapshot())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.WritePrometheus(w); err != nil {
+		log.Printf("[MANAGEMENT] metrics write error: %v", err)
+	}
+}
+
+// wantsPrometheus reports whether r asks for the Prometheus text format.
+func wantsPrometheus(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "prometheus" {
+		return true
+	}
+	for part := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "text/plain") {
+			return true
+		}
+	}
+	return false
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -490,13 +1180,34 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 }
 
 // ListenAndServe starts the management HTTP server.
+//
+// With cfg.ManagementTLSCert and cfg.ManagementTLSKey set the API is served
+// over HTTPS, so bearer tokens never cross the network in cleartext. Setting
+// only one of them is a configuration error.
 func (s *Server) ListenAndServe() error {
+	certFile, keyFile := s.cfg.ManagementTLSCert, s.cfg.ManagementTLSKey
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("managementTLSCert and managementTLSKey must be set together")
+	}
 	addr := fmt.Sprintf("127.0.0.1:%d", s.cfg.ManagementPort)
-	log.Printf("[MANAGEMENT] Listening on %s", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln)
+}
+
+// serve runs the management API on ln, over TLS when a certificate is
+// configured. Split from ListenAndServe so tests can pass their own listener.
+func (s *Server) serve(ln net.Listener) error {
 	srv := &http.Server{
-		Addr:              addr,
 		Handler:           s.Handler(),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
-	return srv.ListenAndServe()
+	if s.cfg.ManagementTLSCert != "" {
+		log.Printf("[MANAGEMENT] Listening on %s (TLS)", ln.Addr())
+		return srv.ServeTLS(ln, s.cfg.ManagementTLSCert, s.cfg.ManagementTLSKey)
+	}
+	log.Printf("[MANAGEMENT] Listening on %s", ln.Addr())
+	return srv.Serve(ln)
 }
@@ -2,16 +2,22 @@ package management
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"ai-anonymizing-proxy/internal/anonymizer"
 	"ai-anonymizing-proxy/internal/config"
 	"ai-anonymizing-proxy/internal/metrics"
+	"ai-anonymizing-proxy/internal/mitm"
 )
 
 func testConfig() *config.Config {
@@ -213,6 +219,25 @@ func TestStatus_OK(t *testing.T) {
 	}
 }
 
+func TestStatus_AIConfidenceThreshold(t *testing.T) {
+	srv, _ := newTestServer("")
+	srv.cfg.AIConfidence = 0.85
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil))
+
+	var resp struct {
+		Ollama struct {
+			Threshold *float64 `json:"aiConfidenceThreshold"`
+		} `json:"ollama"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.Ollama.Threshold == nil || *resp.Ollama.Threshold != 0.85 {
+		t.Errorf("ollama.aiConfidenceThreshold = %v, want 0.85", resp.Ollama.Threshold)
+	}
+}
+
 func TestAuth_NoToken_PassThrough(t *testing.T) {
 	srv, _ := newTestServer("")
 	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
@@ -344,6 +369,391 @@ func TestRemoveDomain_OK(t *testing.T) {
 	}
 }
 
+func TestAnonToggle(t *testing.T) {
+	srv, reg := newTestServer("")
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/anon-toggle", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"domain":"api.openai.com","disabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !reg.AnonymizationDisabled("API.OpenAI.com") || !reg.Has("api.openai.com") {
+		t.Error("anonymization should be disabled with the domain still registered")
+	}
+	if got := reg.AnonymizationDisabledHosts(); len(got) != 1 || got[0] != "api.openai.com" {
+		t.Errorf("AnonymizationDisabledHosts = %v", got)
+	}
+
+	// Without "disabled" the state flips.
+	w := post(`{"domain":"api.openai.com"}`)
+	if w.Code != http.StatusOK || reg.AnonymizationDisabled("api.openai.com") {
+		t.Errorf("flip: expected re-enabled, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"anonymizationDisabled":false`) {
+		t.Errorf("flip: unexpected body %s", w.Body.String())
+	}
+
+	if w := post(`{"domain":"unknown.example.com","disabled":true}`); w.Code != http.StatusNotFound {
+		t.Errorf("unregistered domain: expected 404, got %d", w.Code)
+	}
+	if w := post(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty body: expected 400, got %d", w.Code)
+	}
+}
+
+// TestReloadDomains edits the persist file behind the registry's back and
+// checks that POST /domains/reload picks up the change, and that the
+// endpoint requires the admin token.
+func TestListDomains(t *testing.T) {
+	srv, reg := newTestServer("")
+	reg.Add("api.example.com")
+	reg.Add("api.openai.com") // already a config default: keeps its source
+
+	get := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), method, "/domains/list", nil))
+		return w
+	}
+	w := get(http.MethodGet)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var got []DomainEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	want := []DomainEntry{
+		{"api.anthropic.com", "config"},
+		{"api.example.com", "runtime"},
+		{"api.openai.com", "config"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/domains/list = %+v, want %+v", got, want)
+	}
+
+	if w := get(http.MethodPost); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", w.Code)
+	}
+}
+
+// TestDomainRegistry_ListSources checks sources survive a restart from the
+// persist file and a reload: config defaults stay "config", everything else
+// in the file is "runtime".
+func TestDomainRegistry_ListSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.json")
+	cfg := testConfig()
+	NewDomainRegistry(cfg, path).Add("*.llm.example.org")
+
+	reg := NewDomainRegistry(cfg, path)
+	want := []DomainEntry{
+		{"*.llm.example.org", "runtime"},
+		{"api.anthropic.com", "config"},
+		{"api.openai.com", "config"},
+	}
+	if got := reg.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after restart: %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`["api.openai.com","api.newai.example.com"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	want = []DomainEntry{
+		{"api.newai.example.com", "runtime"},
+		{"api.openai.com", "config"},
+	}
+	if got := reg.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reload: %+v, want %+v", got, want)
+	}
+}
+
+func TestSessionMappings(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementToken = "admin-secret"
+	cfg.ManagementReadToken = "read-secret"
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+	srv.SetSessionMappings(func(id string) (map[string]string, bool) {
+		if id != "sess-1" {
+			return nil, false
+		}
+		return map[string]string{"[PII_EMAIL_0123456789abcdef]": "alice@example.com"}, true
+	})
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/sessions/sess-1/mappings", "admin-secret"); w.Code != http.StatusNotFound {
+		t.Errorf("debug endpoints off: expected 404, got %d", w.Code)
+	}
+
+	cfg.DebugEndpointsEnabled = true
+	w := get("/sessions/sess-1/mappings", "admin-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin token: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		SessionID string            `json:"sessionID"`
+		Mappings  map[string]string `json:"mappings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.SessionID != "sess-1" || resp.Mappings["[PII_EMAIL_0123456789abcdef]"] != "alice@example.com" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if w := get("/sessions/sess-1/mappings", "read-secret"); w.Code != http.StatusForbidden {
+		t.Errorf("read-only token: expected 403, got %d", w.Code)
+	}
+	if w := get("/sessions/sess-1/mappings", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: expected 401, got %d", w.Code)
+	}
+	if w := get("/sessions/sess-unknown/mappings", "admin-secret"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown session: expected 404, got %d", w.Code)
+	}
+
+	// Without an admin token configured the endpoint is never served.
+	srv.token, srv.readToken = "", ""
+	if w := get("/sessions/sess-1/mappings", ""); w.Code != http.StatusForbidden {
+		t.Errorf("no admin token configured: expected 403, got %d", w.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementToken = "admin-secret"
+	cfg.ManagementReadToken = "read-secret"
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/sessions", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("admin-secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before SetSessionStats: expected 503, got %d", w.Code)
+	}
+	srv.SetSessionStats(func() []anonymizer.SessionStat {
+		return []anonymizer.SessionStat{{SessionID: "sess-1", Tokens: 2, AgeSecs: 1.5}}
+	})
+
+	w := get("admin-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin token: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Sessions []anonymizer.SessionStat `json:"sessions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	want := []anonymizer.SessionStat{{SessionID: "sess-1", Tokens: 2, AgeSecs: 1.5}}
+	if !reflect.DeepEqual(resp.Sessions, want) {
+		t.Errorf("sessions = %+v, want %+v", resp.Sessions, want)
+	}
+
+	if w := get("read-secret"); w.Code != http.StatusForbidden {
+		t.Errorf("read-only token: expected 403, got %d", w.Code)
+	}
+	if w := get(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: expected 401, got %d", w.Code)
+	}
+
+	// With authentication off the other endpoints are open, this one is not.
+	srv.token, srv.readToken = "", ""
+	if w := get(""); w.Code != http.StatusForbidden {
+		t.Errorf("no admin token configured: expected 403, got %d", w.Code)
+	}
+}
+
+func TestReloadDomains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.json")
+	cfg := testConfig()
+	cfg.ManagementToken = "admin-secret"
+	cfg.ManagementReadToken = "read-secret"
+	reg := NewDomainRegistry(cfg, path)
+	reg.Add("api.example.com")
+	srv := New(cfg, reg, nil)
+
+	if err := os.WriteFile(path, []byte(`["api.openai.com","api.newai.example.com","*.llm.example.org"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/reload", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: expected 401, got %d", w.Code)
+	}
+	if w := post("read-secret"); w.Code != http.StatusForbidden {
+		t.Errorf("read-only token: expected 403, got %d", w.Code)
+	}
+	if reg.Has("api.newai.example.com") {
+		t.Fatal("rejected reload must not change the registry")
+	}
+
+	w := post("admin-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reload: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Added   []string `json:"added"`
+		Removed []string `json:"removed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Added) != 2 || resp.Added[0] != "*.llm.example.org" || resp.Added[1] != "api.newai.example.com" {
+		t.Errorf("added = %v", resp.Added)
+	}
+	if !reg.Has("api.newai.example.com") || !reg.Has("chat.llm.example.org") || !reg.Has("api.openai.com") {
+		t.Errorf("registry missing reloaded domains: %v", reg.All())
+	}
+	if reg.Has("api.example.com") {
+		t.Error("domain dropped from the file should be removed")
+	}
+	for _, d := range resp.Removed {
+		if d == "api.openai.com" {
+			t.Errorf("removed lists a domain still in the file: %v", resp.Removed)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if w := post("admin-secret"); w.Code != http.StatusInternalServerError {
+		t.Errorf("corrupt file: expected 500, got %d", w.Code)
+	}
+	if !reg.Has("api.newai.example.com") {
+		t.Error("failed reload must keep the current list")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementToken = "admin-secret"
+	cfg.ManagementReadToken = "read-secret"
+	cfg.AIConfidence = 0.8
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+	next := *cfg
+	next.AIConfidence = 0.6
+	next.LogLevel = "debug"
+	next.PIIInstructions = map[string]string{"gpt": "Keep tokens.", "default": "Keep tokens as written."}
+	next.ProxyPort = 9090
+	next.CACertFile = "other-ca.pem"
+	srv.loadConfig = func() (*config.Config, error) { return &next, nil }
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/config/reload", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("admin-secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before SetConfigReload: expected 503, got %d", w.Code)
+	}
+	var applied *config.Config
+	srv.SetConfigReload(func(c *config.Config) { applied = c })
+
+	if w := post("read-secret"); w.Code != http.StatusForbidden {
+		t.Errorf("read-only token: expected 403, got %d", w.Code)
+	}
+	if applied != nil {
+		t.Fatal("rejected reload must not apply the config")
+	}
+
+	w := post("admin-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reload: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if applied != &next {
+		t.Error("reloaded config not passed to the reload function")
+	}
+	var resp struct {
+		Applied struct {
+			Threshold       float64  `json:"aiConfidenceThreshold"`
+			PIIInstructions []string `json:"piiInstructions"`
+			LogLevel        string   `json:"logLevel"`
+		} `json:"applied"`
+		Ignored []string `json:"ignored"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Applied.Threshold != 0.6 || resp.Applied.LogLevel != "debug" ||
+		!reflect.DeepEqual(resp.Applied.PIIInstructions, []string{"default", "gpt"}) {
+		t.Errorf("applied = %+v", resp.Applied)
+	}
+	if want := []string{"proxyPort", "caCertFile"}; !reflect.DeepEqual(resp.Ignored, want) {
+		t.Errorf("ignored = %v, want %v", resp.Ignored, want)
+	}
+
+	w = httptest.NewRecorder()
+	status := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	status.Header.Set("Authorization", "Bearer read-secret")
+	srv.Handler().ServeHTTP(w, status)
+	var st struct {
+		Ollama struct {
+			Threshold float64 `json:"aiConfidenceThreshold"`
+		} `json:"ollama"`
+		Settings struct {
+			Threshold       float64  `json:"aiConfidenceThreshold"`
+			PIIInstructions []string `json:"piiInstructions"`
+			LogLevel        string   `json:"logLevel"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("invalid /status JSON: %v", err)
+	}
+	if st.Ollama.Threshold != 0.6 || !reflect.DeepEqual(st.Settings, resp.Applied) {
+		t.Errorf("/status does not report the reloaded settings: %s", w.Body.String())
+	}
+
+	applied = nil
+	srv.loadConfig = func() (*config.Config, error) { return nil, errors.New("parse proxy-config.json: bad") }
+	if w := post("admin-secret"); w.Code != http.StatusInternalServerError {
+		t.Errorf("unparsable file: expected 500, got %d", w.Code)
+	}
+	if applied != nil {
+		t.Error("failed reload must not apply anything")
+	}
+}
+
+func TestReloadDomains_NoPersistFile(t *testing.T) {
+	srv, _ := newTestServer("")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/reload", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 without a persist file, got %d", w.Code)
+	}
+}
+
 func TestRemoveDomain_InvalidDomain(t *testing.T) {
 	srv, _ := newTestServer("")
 	body := `{"domain":"bad domain!"}`
@@ -410,6 +820,51 @@ func TestMetrics_Enabled(t *testing.T) {
 	}
 }
 
+func TestMetrics_Prometheus(t *testing.T) {
+	cfg := testConfig()
+	reg := NewDomainRegistry(cfg, "")
+	m := metrics.New()
+	m.RequestsTotal.Add(2)
+	srv := New(cfg, reg, m)
+
+	tests := []struct {
+		name, target, accept string
+		wantProm             bool
+	}{
+		{"default", "/metrics", "", false},
+		{"json accept", "/metrics", "application/json", false},
+		{"query param", "/metrics?format=prometheus", "", true},
+		{"scraper accept", "/metrics", "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+			ct := w.Header().Get("Content-Type")
+			if !tt.wantProm {
+				if ct != "application/json" {
+					t.Errorf("expected application/json, got %q", ct)
+				}
+				return
+			}
+			if !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+				t.Errorf("expected Prometheus text content type, got %q", ct)
+			}
+			if !strings.Contains(w.Body.String(), "aiproxy_requests_total 2\n") {
+				t.Errorf("body missing aiproxy_requests_total:\n%s", w.Body.String())
+			}
+		})
+	}
+}
+
 func TestDomainRegistry_PersistNoPersistPath(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -695,6 +1150,25 @@ func TestHandleAddDomain_Glob(t *testing.T) {
 	}
 }
 
+func TestHandleAddDomain_PrefixWildcard(t *testing.T) {
+	srv, reg := newTestServer("")
+	body := `{"domain":"*.anthropic.com"}`
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/add", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !reg.Has("api-eu.anthropic.com") {
+		t.Error("*.anthropic.com should match api-eu.anthropic.com")
+	}
+	if reg.Has("anthropic.com") {
+		t.Error("*.anthropic.com should not match the apex anthropic.com")
+	}
+}
+
 func TestHandleRemoveDomain_Glob(t *testing.T) {
 	srv, reg := newTestServer("")
 	reg.Add("bedrock-runtime.*.amazonaws.com")
@@ -763,3 +1237,361 @@ func TestAuth_MalformedBearerToken(t *testing.T) {
 		t.Errorf("expected 401 for wrong auth scheme, got %d", w.Code)
 	}
 }
+
+func TestStatus_CacheStats(t *testing.T) {
+	srv, _ := newTestServer("")
+
+	// Without a registered source the cache section is omitted.
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil))
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if _, ok := resp["cache"]; ok {
+		t.Errorf("expected no cache section before SetCacheStats, got %v", resp["cache"])
+	}
+
+	entries := 0
+	srv.SetCacheStats(func() (int, int) { return entries, 50000 })
+	entries = 42
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil))
+	var withCache struct {
+		Cache struct {
+			Entries  int `json:"entries"`
+			Capacity int `json:"capacity"`
+		} `json:"cache"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &withCache); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if withCache.Cache.Entries != 42 || withCache.Cache.Capacity != 50000 {
+		t.Errorf("cache = %+v, want {42 50000}", withCache.Cache)
+	}
+
+	srv.SetCacheStats(nil)
+	if srv.cacheStats.Load() != nil {
+		t.Error("SetCacheStats(nil) should clear the source")
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	srv, _ := newTestServer("")
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/patterns"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("before SetPIITypes: %d, want 503", w.Code)
+	}
+
+	srv.SetPIITypes(func() []anonymizer.PIITypeInfo {
+		return []anonymizer.PIITypeInfo{
+			{Name: anonymizer.PIIEmail, HasRegex: true, Confidence: 0.95, Enabled: true},
+			{Name: anonymizer.PIISSN, HasRegex: true, Confidence: 0.85},
+		}
+	})
+
+	w := get("/patterns")
+	var patterns struct {
+		PIITypes []anonymizer.PIITypeInfo `json:"piiTypes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &patterns); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if w.Code != http.StatusOK || len(patterns.PIITypes) != 2 || patterns.PIITypes[0].Name != "EMAIL" || patterns.PIITypes[1].Enabled {
+		t.Errorf("/patterns = %d %+v", w.Code, patterns)
+	}
+
+	var status struct {
+		Enabled []string `json:"enabledPIITypes"`
+	}
+	if err := json.Unmarshal(get("/status").Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(status.Enabled) != 1 || status.Enabled[0] != "EMAIL" {
+		t.Errorf("status enabledPIITypes = %v, want [EMAIL]", status.Enabled)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/patterns", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /patterns: %d, want 405", w.Code)
+	}
+}
+
+func TestReadyz_CacheHealth(t *testing.T) {
+	srv, _ := newTestServer("")
+	get := func() (int, map[string]string) {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/readyz", nil))
+		var resp map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		return w.Code, resp
+	}
+
+	if code, resp := get(); code != http.StatusServiceUnavailable || resp["status"] != "starting" {
+		t.Errorf("before SetCacheHealth: %d %v, want 503 starting", code, resp)
+	}
+
+	var probeErr error
+	srv.SetCacheHealth(func() error { return probeErr })
+	if code, resp := get(); code != http.StatusOK || resp["status"] != "ready" || resp["cache"] != "ok" {
+		t.Errorf("healthy: %d %v, want 200 ready/ok", code, resp)
+	}
+
+	probeErr = errors.New("cache probe write: database is in read-only mode")
+	code, resp := get()
+	if code != http.StatusOK || resp["status"] != "degraded" || resp["cache"] != "degraded" {
+		t.Errorf("unwritable: %d %v, want 200 degraded/degraded", code, resp)
+	}
+	if resp["cacheError"] == "" {
+		t.Error("degraded response should carry the probe error")
+	}
+}
+
+// --- CORS ---
+
+func newCORSTestServer(token string, origins ...string) *Server {
+	cfg := testConfig()
+	cfg.ManagementToken = token
+	cfg.ManagementCORSOrigins = origins
+	return New(cfg, NewDomainRegistry(cfg, ""), nil)
+}
+
+func TestCORS_DisabledByDefault(t *testing.T) {
+	srv, _ := newTestServer("")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS header when disabled, got %q", got)
+	}
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	srv := newCORSTestServer("", "https://dash.example.com")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORS_WildcardEchoesOrigin(t *testing.T) {
+	srv := newCORSTestServer("", "*")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/metrics", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	srv := newCORSTestServer("", "https://dash.example.com")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Allow-Origin for disallowed origin, got %q", got)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	srv := newCORSTestServer("secret123", "https://dash.example.com")
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+		wantACAO   string
+	}{
+		{"allowed", "https://dash.example.com", http.StatusNoContent, "https://dash.example.com"},
+		{"disallowed", "https://evil.example.net", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No Authorization header: browsers never send it on preflight.
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodOptions, "/domains/add", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantACAO {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantACAO)
+			}
+			if tt.wantStatus == http.StatusNoContent {
+				if got := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") {
+					t.Errorf("Access-Control-Allow-Headers = %q, want Authorization", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS_StillRequiresToken(t *testing.T) {
+	srv := newCORSTestServer("secret123", "https://dash.example.com")
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", w.Code)
+	}
+	// CORS header is still present so the browser can surface the 401.
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+// --- read-only token ---
+
+func newReadTokenTestServer(adminToken, readToken string) (*Server, *DomainRegistry) {
+	cfg := testConfig()
+	cfg.ManagementToken = adminToken
+	cfg.ManagementReadToken = readToken
+	reg := NewDomainRegistry(cfg, "")
+	return New(cfg, reg, metrics.New()), reg
+}
+
+func TestAuth_ReadToken(t *testing.T) {
+	srv, reg := newReadTokenTestServer("admin-secret", "read-secret")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{"read token GET status", http.MethodGet, "/status", "", "read-secret", http.StatusOK},
+		{"read token GET metrics", http.MethodGet, "/metrics", "", "read-secret", http.StatusOK},
+		{"read token add domain", http.MethodPost, "/domains/add", `{"domain":"api.newai.example.com"}`, "read-secret", http.StatusForbidden},
+		{"read token remove domain", http.MethodPost, "/domains/remove", `{"domain":"api.openai.com"}`, "read-secret", http.StatusForbidden},
+		{"admin token add domain", http.MethodPost, "/domains/add", `{"domain":"api.admin.example.com"}`, "admin-secret", http.StatusOK},
+		{"admin token GET status", http.MethodGet, "/status", "", "admin-secret", http.StatusOK},
+		{"wrong token", http.MethodGet, "/status", "", "nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(context.Background(), tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if reg.Has("api.newai.example.com") {
+		t.Error("read token must not be able to add domains")
+	}
+	if !reg.Has("api.openai.com") {
+		t.Error("read token must not be able to remove domains")
+	}
+	if !reg.Has("api.admin.example.com") {
+		t.Error("admin token should have added domain")
+	}
+}
+
+func TestAuth_ReadTokenOnlyEnablesAuth(t *testing.T) {
+	srv, _ := newReadTokenTestServer("", "read-secret")
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/status", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token when only read token is configured, got %d", w.Code)
+	}
+
+	req = httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/add",
+		strings.NewReader(`{"domain":"api.newai.example.com"}`))
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for mutation without token, got %d", w.Code)
+	}
+}
+
+func TestListenAndServe_TLSRequiresCertAndKey(t *testing.T) {
+	cfg := testConfig()
+	cfg.ManagementTLSCert = "mgmt-cert.pem"
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+	err := srv.ListenAndServe()
+	if err == nil || !strings.Contains(err.Error(), "set together") {
+		t.Fatalf("expected cert/key pairing error, got %v", err)
+	}
+}
+
+// TestServe_TLS serves the API with a configured certificate and checks a
+// client gets a TLS connection, while a plain-HTTP request is refused.
+func TestServe_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := mitm.GenerateCA(certFile, keyFile); err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	cfg := testConfig()
+	cfg.ManagementTLSCert = certFile
+	cfg.ManagementTLSKey = keyFile
+	srv := New(cfg, NewDomainRegistry(cfg, ""), nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.serve(ln) }()
+	t.Cleanup(func() { _ = ln.Close() })
+	base := ln.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- self-signed test certificate
+	}}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://"+base+"/status", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("HTTPS request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.TLS == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 over TLS, got %d (TLS=%v)", resp.StatusCode, resp.TLS != nil)
+	}
+
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+base+"/status", nil)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request should not be served")
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteDomainsTimeout bounds one domain-list fetch so an unreachable
+// domainsURL delays startup by seconds, not indefinitely.
+const remoteDomainsTimeout = 10 * time.Second
+
+// maxRemoteDomainsBody caps the domain-list response size.
+const maxRemoteDomainsBody = 1 << 20
+
+// fetchRemoteDomains downloads a JSON array of domain names and glob patterns
+// from url. Entries are canonicalized and checked with validDomain; invalid
+// ones are logged and skipped. A list with no valid entries is an error, so a
+// broken upstream file can never empty the registry.
+func fetchRemoteDomains(url string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteDomainsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req) // #nosec G704 -- URL from trusted config, not user input
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }() // best-effort close on HTTP response body
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteDomainsBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteDomainsBody {
+		return nil, fmt.Errorf("domain list exceeds %d bytes", maxRemoteDomainsBody)
+	}
+
+	var entries []string
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("parse domain list: %w", err)
+	}
+	domains := make([]string, 0, len(entries))
+	for _, e := range entries {
+		d := strings.ToLower(strings.TrimSpace(e))
+		if !validDomain(d) {
+			log.Printf("[DOMAINS] Skipping invalid remote domain %q", e)
+			continue
+		}
+		domains = append(domains, d)
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("domain list has no valid entries")
+	}
+	return domains, nil
+}
+
+// RefreshRemote re-fetches the remote domain list and applies the difference
+// from the previous fetch: new entries are added, and entries the list no
+// longer contains are removed unless they were also added through the API.
+// An entry removed through the API stays removed until it drops out of the
+// remote list and reappears. On fetch failure the registry is left as is.
+func (r *DomainRegistry) RefreshRemote(url string) error {
+	domains, err := fetchRemoteDomains(url)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	next := make(map[string]bool, len(domains))
+	var added, removed []string
+	for _, d := range domains {
+		next[d] = true
+		if !r.remote[d] && !r.hasEntryLocked(d) {
+			r.addEntryLocked(d, sourceRemote)
+			added = append(added, d)
+		}
+	}
+	for d := range r.remote {
+		if !next[d] && !r.manual[d] && r.removeEntryLocked(d) {
+			removed = append(removed, d)
+		}
+	}
+	r.remote = next
+	snapshot := r.snapshotLocked()
+	r.mu.Unlock()
+
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	sort.Strings(removed)
+	log.Printf("[DOMAINS] Remote refresh from %s: added %v, removed %v", url, added, removed)
+	r.persist(snapshot)
+	return nil
+}
+
+// StartRemoteRefresh calls RefreshRemote every interval in a background
+// goroutine. The returned stop function ends the loop and waits for an
+// in-flight refresh to finish; it is safe to call more than once.
+func (r *DomainRegistry) StartRemoteRefresh(url string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.RefreshRemote(url); err != nil {
+					log.Printf("[DOMAINS] Warning: remote refresh from %s failed: %v (keeping current list)", url, err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
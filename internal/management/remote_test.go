@@ -0,0 +1,215 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newDomainListServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewDomainRegistry_RemoteList(t *testing.T) {
+	srv := newDomainListServer(t, http.StatusOK,
+		`["API.Example.com", "*.openai.azure.com", "not a domain", "*.com", ""]`)
+	path := filepath.Join(t.TempDir(), "domains.json")
+
+	cfg := testConfig()
+	cfg.DomainsURL = srv.URL
+	r := NewDomainRegistry(cfg, path)
+
+	if !r.Has("api.example.com") {
+		t.Error("expected remote domain api.example.com")
+	}
+	if !r.Has("myres.openai.azure.com") {
+		t.Error("expected remote glob *.openai.azure.com to match")
+	}
+	if !r.Has("api.openai.com") {
+		t.Error("remote list should be merged with config defaults")
+	}
+	if got := r.All(); len(got) != 4 {
+		t.Errorf("invalid entries should be skipped, got %v", got)
+	}
+
+	// The merged list is persisted as the fallback for the next start.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("remote list not persisted: %v", err)
+	}
+	var persisted []string
+	if err := json.Unmarshal(data, &persisted); err != nil || len(persisted) != 4 {
+		t.Errorf("persisted = %v (err %v), want 4 entries", persisted, err)
+	}
+}
+
+// TestNewDomainRegistry_RemoteKeepsPersisted restarts with a domain added
+// through the API in the persist file: the remote list must not drop it,
+// nor overwrite the file without it.
+func TestNewDomainRegistry_RemoteKeepsPersisted(t *testing.T) {
+	srv := newDomainListServer(t, http.StatusOK, `["api.example.com", "api.openai.com"]`)
+	path := filepath.Join(t.TempDir(), "domains.json")
+	if err := os.WriteFile(path, []byte(`["api.openai.com", "llm.internal.example.org"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.DomainsURL = srv.URL
+	r := NewDomainRegistry(cfg, path)
+
+	want := []string{"api.example.com", "api.openai.com", "llm.internal.example.org"}
+	if got := r.All(); !equalStrings(got, want) {
+		t.Errorf("All = %v, want %v", got, want)
+	}
+	sources := map[string]string{}
+	for _, e := range r.List() {
+		sources[e.Domain] = e.Source
+	}
+	if sources["llm.internal.example.org"] != "runtime" || sources["api.openai.com"] != "remote" {
+		t.Errorf("sources = %v", sources)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var persisted []string
+	if err := json.Unmarshal(data, &persisted); err != nil || !equalStrings(persisted, want) {
+		t.Errorf("persisted = %v (err %v), want %v", persisted, err, want)
+	}
+}
+
+func TestNewDomainRegistry_RemoteFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, `["api.example.com"]`},
+		{"not json", http.StatusOK, `api.example.com`},
+		{"no valid entries", http.StatusOK, `["*", "bad domain"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.DomainsURL = newDomainListServer(t, tt.status, tt.body).URL
+			r := NewDomainRegistry(cfg, "")
+			if !r.Has("api.openai.com") || r.Has("api.example.com") {
+				t.Errorf("expected fallback to config defaults, got %v", r.All())
+			}
+		})
+	}
+}
+
+// newMutableDomainListServer serves whatever JSON list is currently stored in body.
+func newMutableDomainListServer(t *testing.T, initial string) (*httptest.Server, *atomic.Value) {
+	t.Helper()
+	var body atomic.Value
+	body.Store(initial)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &body
+}
+
+func TestDomainRegistry_RefreshRemoteAppliesDiff(t *testing.T) {
+	srv, body := newMutableDomainListServer(t, `["api.one.example.com", "api.two.example.com"]`)
+	cfg := testConfig()
+	cfg.AIAPIDomains = nil
+	cfg.DomainsURL = srv.URL
+	r := NewDomainRegistry(cfg, "")
+	r.Add("api.manual.example.com")
+
+	body.Store(`["api.two.example.com", "api.three.example.com"]`)
+	if err := r.RefreshRemote(srv.URL); err != nil {
+		t.Fatalf("RefreshRemote: %v", err)
+	}
+	want := []string{"api.manual.example.com", "api.three.example.com", "api.two.example.com"}
+	if got := r.All(); !equalStrings(got, want) {
+		t.Errorf("after second fetch All = %v, want %v", got, want)
+	}
+	for _, e := range r.List() {
+		want := "remote"
+		if e.Domain == "api.manual.example.com" {
+			want = "runtime"
+		}
+		if e.Source != want {
+			t.Errorf("source of %s = %q, want %q", e.Domain, e.Source, want)
+		}
+	}
+
+	// A manual addition that the remote list later stops listing is kept.
+	body.Store(`["api.manual.example.com", "api.two.example.com"]`)
+	if err := r.RefreshRemote(srv.URL); err != nil {
+		t.Fatalf("RefreshRemote: %v", err)
+	}
+	body.Store(`["api.two.example.com"]`)
+	if err := r.RefreshRemote(srv.URL); err != nil {
+		t.Fatalf("RefreshRemote: %v", err)
+	}
+	if !r.Has("api.manual.example.com") {
+		t.Error("manual addition removed by remote refresh")
+	}
+	if r.Has("api.three.example.com") {
+		t.Error("entry dropped from the remote list should be removed")
+	}
+
+	// A failed fetch leaves the registry unchanged.
+	body.Store(`not json`)
+	before := r.All()
+	if err := r.RefreshRemote(srv.URL); err == nil {
+		t.Error("expected error for invalid list")
+	}
+	if got := r.All(); !equalStrings(got, before) {
+		t.Errorf("failed refresh changed registry: %v -> %v", before, got)
+	}
+}
+
+func TestDomainRegistry_StartRemoteRefresh(t *testing.T) {
+	srv, body := newMutableDomainListServer(t, `["api.one.example.com"]`)
+	cfg := testConfig()
+	cfg.DomainsURL = srv.URL
+	r := NewDomainRegistry(cfg, "")
+
+	stop := r.StartRemoteRefresh(srv.URL, 10*time.Millisecond)
+	body.Store(`["api.two.example.com"]`)
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.Has("api.two.example.com") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	stop() // idempotent
+
+	if !r.Has("api.two.example.com") || r.Has("api.one.example.com") {
+		t.Errorf("background refresh not applied: %v", r.All())
+	}
+	body.Store(`["api.three.example.com"]`)
+	time.Sleep(50 * time.Millisecond)
+	if r.Has("api.three.example.com") {
+		t.Error("refresh ran after stop")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
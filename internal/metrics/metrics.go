@@ -7,7 +7,10 @@
 package metrics
 
 import (
+	"maps"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,10 +23,12 @@ import (
 // counters are always available for AI-detected categories.
 func knownPIITypes() []string {
 	// Static baseline — types detected by the AI path (Ollama) that are not
-	// registered in any pack.
+	// registered in any pack, plus the config-gated national IDs and
+	// timestamps.
 	baseline := map[string]bool{
 		"NAME": true, "MEDICAL": true, "SALARY": true,
-		"COMPANY": true, "JOBTITLE": true,
+		"COMPANY": true, "JOBTITLE": true, "NATIONALID": true,
+		"TIMESTAMP": true,
 	}
 	// Merge in all types from the pack registry.
 	for _, t := range packs.PIITypes() {
@@ -44,14 +49,39 @@ type Metrics struct {
 	RequestsAnonymized  atomic.Int64
 	RequestsPassthrough atomic.Int64
 	RequestsAuth        atomic.Int64
+	RequestsOpaque      atomic.Int64 // AI-domain requests forwarded unscanned (gRPC)
+	RequestsAnonOff     atomic.Int64 // AI-domain requests forwarded unmodified (anonymization paused)
+	RequestsContentType atomic.Int64 // AI-domain requests forwarded unscanned (Content-Type not allowlisted)
+
+	// Per-domain AI request counts, capped at maxDomains (see
+	// RecordDomainRequest). Created on first use.
+	domainMu sync.Mutex
+	domains  map[string]int64
+
+	// Deanonymized responses by delivery: SSE streamed vs read in full
+	ResponsesStreaming atomic.Int64
+	ResponsesBuffered  atomic.Int64
+	// Buffered responses over maxResponseBodyMB: only the first part was
+	// deanonymized, the rest was passed through
+	ResponseTruncatedDeanon atomic.Int64
 
 	// Error counters
 	ErrorsUpstream  atomic.Int64
 	ErrorsAnonymize atomic.Int64
 
+	// ManagementAuthFailures counts rejected management API credentials.
+	ManagementAuthFailures atomic.Int64
+
+	// ClientDisconnects counts clients that went away while their request
+	// was being read or anonymized. They are not anonymize errors.
+	ClientDisconnects atomic.Int64
+
 	// PII token volume
 	TokensReplaced     atomic.Int64
 	TokensDeanonymized atomic.Int64
+	TokenStripped      atomic.Int64 // responses that contained none of their request's tokens
+	PreTokenized       atomic.Int64 // tokens already present in requests, passed through as-is
+	RetryReuses        atomic.Int64 // retried request bodies served from the retry cache
 
 	// Anonymizer cache counters (per PII type)
 	// Maps are written only in New(); concurrent reads are safe without a lock.
@@ -63,6 +93,17 @@ type Metrics struct {
 	OllamaErrors     atomic.Int64 // async Ollama queries that failed
 	CacheFallbacks   atomic.Int64 // low-confidence misses that used a fallback token
 
+	// Per-type detection statistics (mutex-guarded because they accumulate
+	// floats). Created on first use so the zero value stays snapshot-safe.
+	detectMu   sync.Mutex
+	detections map[string]*detectionStats
+
+	// Token fidelity: per response, the fraction of the request's tokens
+	// that came back intact, averaged over all responses with tokens.
+	fidelityMu  sync.Mutex
+	fidelityN   int64
+	fidelitySum float64
+
 	// Latency statistics (mutex-guarded because they accumulate floats)
 	anonMu   sync.Mutex
 	anonStat latencyStats
@@ -70,9 +111,26 @@ type Metrics struct {
 	upstreamMu   sync.Mutex
 	upstreamStat latencyStats
 
+	// Source of the cache section; nil omits it.
+	cacheStats atomic.Pointer[CacheStatsFunc]
+
 	startTime time.Time
 }
 
+// CacheStatsFunc reports the in-memory layer of the anonymizer's value
+// cache. ok is false when the cache has no such layer.
+type CacheStatsFunc func() (s CacheSnapshot, ok bool)
+
+// SetCacheStats registers the source of the cache section of Snapshot. The
+// anonymizer calls it once its cache is built; nil removes the section.
+func (m *Metrics) SetCacheStats(fn CacheStatsFunc) {
+	if fn == nil {
+		m.cacheStats.Store(nil)
+		return
+	}
+	m.cacheStats.Store(&fn)
+}
+
 // New returns a new Metrics with the start time recorded and per-type cache
 // counter maps pre-populated for all known PII types.
 func New() *Metrics {
@@ -105,6 +163,93 @@ func (m *Metrics) RecordCacheMiss(piiType string) {
 	}
 }
 
+// Detection paths reported to RecordDetection.
+const (
+	DetectionImmediate = "immediate" // confidence at or above the AI threshold
+	DetectionCacheHit  = "cacheHit"  // low confidence, token from the per-value cache
+	DetectionFallback  = "fallback"  // low confidence, cache miss, fallback token
+)
+
+// RecordDetection records one tokenized regex match of piiType with its
+// effective pattern confidence and the path that produced the token.
+func (m *Metrics) RecordDetection(piiType, path string, confidence float64) {
+	m.detectMu.Lock()
+	defer m.detectMu.Unlock()
+	if m.detections == nil {
+		m.detections = make(map[string]*detectionStats)
+	}
+	d, ok := m.detections[piiType]
+	if !ok {
+		d = &detectionStats{}
+		m.detections[piiType] = d
+	}
+	d.count++
+	d.confSum += confidence
+	switch path {
+	case DetectionImmediate:
+		d.immediate++
+	case DetectionCacheHit:
+		d.cacheHit++
+	case DetectionFallback:
+		d.fallback++
+	}
+}
+
+// maxDomains caps the domains counted individually by RecordDomainRequest,
+// so clients cannot grow the map (and the Prometheus series) without bound.
+const maxDomains = 100
+
+// OtherDomain is the RecordDomainRequest bucket for domains past maxDomains
+// and for hosts that are not valid domain names.
+const OtherDomain = "other"
+
+// RecordDomainRequest counts one request to an AI domain. The first
+// maxDomains distinct domains are counted individually, later ones under
+// OtherDomain.
+func (m *Metrics) RecordDomainRequest(domain string) {
+	domain = strings.ToLower(domain)
+	if !validDomainKey(domain) {
+		domain = OtherDomain
+	}
+	m.domainMu.Lock()
+	defer m.domainMu.Unlock()
+	if m.domains == nil {
+		m.domains = make(map[string]int64)
+	}
+	if _, ok := m.domains[domain]; !ok && len(m.domains) >= maxDomains {
+		domain = OtherDomain
+	}
+	m.domains[domain]++
+}
+
+// validDomainKey reports whether domain is non-empty and made only of
+// characters that appear in host names and IP addresses, so it can be used
+// as a Prometheus label value without escaping.
+func validDomainKey(domain string) bool {
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, c := range []byte(domain) {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordTokenFidelity records one deanonymized response in which found of
+// the total tokens issued for its request appeared intact. Responses to
+// requests without tokens (total == 0) are not counted.
+func (m *Metrics) RecordTokenFidelity(found, total int) {
+	if total <= 0 {
+		return
+	}
+	m.fidelityMu.Lock()
+	m.fidelityN++
+	m.fidelitySum += float64(found) / float64(total)
+	m.fidelityMu.Unlock()
+}
+
 // RecordAnonLatency records the duration of one anonymization pass.
 func (m *Metrics) RecordAnonLatency(d time.Duration) {
 	m.anonMu.Lock()
@@ -142,30 +287,77 @@ func (m *Metrics) Snapshot() Snapshot {
 		}
 	}
 
+	m.fidelityMu.Lock()
+	fidelityN := m.fidelityN
+	var fidelity float64
+	if fidelityN > 0 {
+		fidelity = round2(m.fidelitySum / float64(fidelityN))
+	}
+	m.fidelityMu.Unlock()
+
+	m.domainMu.Lock()
+	byDomain := maps.Clone(m.domains)
+	m.domainMu.Unlock()
+
+	m.detectMu.Lock()
+	var detections map[string]DetectionSnapshot
+	if len(m.detections) > 0 {
+		detections = make(map[string]DetectionSnapshot, len(m.detections))
+		for t, d := range m.detections {
+			detections[t] = d.snapshot()
+		}
+	}
+	m.detectMu.Unlock()
+
+	var cache *CacheSnapshot
+	if fn := m.cacheStats.Load(); fn != nil {
+		if cs, ok := (*fn)(); ok {
+			cache = &cs
+		}
+	}
+
 	return Snapshot{
 		Requests: RequestSnapshot{
 			Total:       m.RequestsTotal.Load(),
 			Anonymized:  m.RequestsAnonymized.Load(),
 			Passthrough: m.RequestsPassthrough.Load(),
 			Auth:        m.RequestsAuth.Load(),
+			Opaque:      m.RequestsOpaque.Load(),
+			AnonOff:     m.RequestsAnonOff.Load(),
+			ContentType: m.RequestsContentType.Load(),
+			ByDomain:    byDomain,
+		},
+		Responses: ResponseSnapshot{
+			Streaming: m.ResponsesStreaming.Load(),
+			Buffered:  m.ResponsesBuffered.Load(),
+			Truncated: m.ResponseTruncatedDeanon.Load(),
 		},
 		Errors: ErrorSnapshot{
-			Upstream:  m.ErrorsUpstream.Load(),
-			Anonymize: m.ErrorsAnonymize.Load(),
+			Upstream:         m.ErrorsUpstream.Load(),
+			Anonymize:        m.ErrorsAnonymize.Load(),
+			ManagementAuth:   m.ManagementAuthFailures.Load(),
+			ClientDisconnect: m.ClientDisconnects.Load(),
 		},
 		PIITokens: PIISnapshot{
-			Replaced:         m.TokensReplaced.Load(),
-			Deanonymized:     m.TokensDeanonymized.Load(),
-			CacheHits:        cacheHits,
-			CacheMisses:      cacheMisses,
-			OllamaDispatches: m.OllamaDispatches.Load(),
-			OllamaErrors:     m.OllamaErrors.Load(),
-			CacheFallbacks:   m.CacheFallbacks.Load(),
+			Replaced:          m.TokensReplaced.Load(),
+			Deanonymized:      m.TokensDeanonymized.Load(),
+			CacheHits:         cacheHits,
+			CacheMisses:       cacheMisses,
+			OllamaDispatches:  m.OllamaDispatches.Load(),
+			OllamaErrors:      m.OllamaErrors.Load(),
+			CacheFallbacks:    m.CacheFallbacks.Load(),
+			Detections:        detections,
+			TokenFidelity:     fidelity,
+			FidelityResponses: fidelityN,
+			TokenStripped:     m.TokenStripped.Load(),
+			PreTokenized:      m.PreTokenized.Load(),
+			RetryReuses:       m.RetryReuses.Load(),
 		},
 		Latency: LatencyGroup{
 			AnonymizationMs: anon,
 			UpstreamMs:      upstream,
 		},
+		Cache:      cache,
 		UptimeSecs: time.Since(m.startTime).Seconds(),
 	}
 }
@@ -174,11 +366,25 @@ func (m *Metrics) Snapshot() Snapshot {
 
 // Snapshot is a point-in-time view of all metrics.
 type Snapshot struct {
-	Requests   RequestSnapshot `json:"requests"`
-	Errors     ErrorSnapshot   `json:"errors"`
-	PIITokens  PIISnapshot     `json:"piiTokens"`
-	Latency    LatencyGroup    `json:"latency"`
-	UptimeSecs float64         `json:"uptimeSecs"`
+	Requests   RequestSnapshot  `json:"requests"`
+	Responses  ResponseSnapshot `json:"responses"`
+	Errors     ErrorSnapshot    `json:"errors"`
+	PIITokens  PIISnapshot      `json:"piiTokens"`
+	Latency    LatencyGroup     `json:"latency"`
+	Cache      *CacheSnapshot   `json:"cache,omitempty"`
+	UptimeSecs float64          `json:"uptimeSecs"`
+}
+
+// CacheSnapshot describes the S3-FIFO in-memory layer of the value cache.
+// MemoryHits and ColdHits split cache hits between entries already in
+// memory and entries read back from the cache file.
+type CacheSnapshot struct {
+	SQueueLen  int   `json:"sQueueLen"`
+	MQueueLen  int   `json:"mQueueLen"`
+	GhostCount int   `json:"ghostCount"`
+	Capacity   int   `json:"capacity"`
+	MemoryHits int64 `json:"memoryHits"`
+	ColdHits   int64 `json:"coldHits"`
 }
 
 // RequestSnapshot holds request-level counters.
@@ -187,12 +393,28 @@ type RequestSnapshot struct {
 	Anonymized  int64 `json:"anonymized"`
 	Passthrough int64 `json:"passthrough"`
 	Auth        int64 `json:"auth"`
+	Opaque      int64 `json:"opaque"`
+	AnonOff     int64 `json:"anonymizationDisabled"`
+	ContentType int64 `json:"contentTypeSkipped"`
+
+	// AI-domain requests by domain; at most maxDomains entries plus
+	// OtherDomain.
+	ByDomain map[string]int64 `json:"byDomain,omitempty"`
+}
+
+// ResponseSnapshot splits deanonymized responses by delivery mode.
+type ResponseSnapshot struct {
+	Streaming int64 `json:"streaming"`
+	Buffered  int64 `json:"buffered"`
+	Truncated int64 `json:"truncatedDeanon"` // buffered responses deanonymized only up to maxResponseBodyMB
 }
 
 // ErrorSnapshot holds error counters.
 type ErrorSnapshot struct {
-	Upstream  int64 `json:"upstream"`
-	Anonymize int64 `json:"anonymize"`
+	Upstream         int64 `json:"upstream"`
+	Anonymize        int64 `json:"anonymize"`
+	ManagementAuth   int64 `json:"managementAuth"`
+	ClientDisconnect int64 `json:"clientDisconnect"`
 }
 
 // PIISnapshot holds PII token volume and cache effectiveness counters.
@@ -208,6 +430,39 @@ type PIISnapshot struct {
 	OllamaDispatches int64 `json:"ollamaDispatches"`
 	OllamaErrors     int64 `json:"ollamaErrors"`
 	CacheFallbacks   int64 `json:"cacheFallbacks"`
+
+	// Per-type detection confidence and path breakdown.
+	Detections map[string]DetectionSnapshot `json:"detections,omitempty"`
+
+	// TokenFidelity is the mean fraction (0.0-1.0) of request tokens that
+	// responses reproduced intact, over FidelityResponses responses. A low
+	// value means models are ignoring the token instruction.
+	TokenFidelity     float64 `json:"tokenFidelity"`
+	FidelityResponses int64   `json:"fidelityResponses"`
+
+	// TokenStripped counts responses whose request had tokens but that
+	// contained none of them — typically a model that replaced the tokens
+	// with invented values, which then reach the client unflagged.
+	TokenStripped int64 `json:"tokenStripped"`
+
+	// PreTokenized counts tokens that arrived already in request text (a
+	// client sending proxy output back) and were passed through untouched.
+	PreTokenized int64 `json:"preTokenized"`
+
+	// RetryReuses counts request bodies identical to one anonymized within
+	// retryCacheSecs whose cached anonymization was reused.
+	RetryReuses int64 `json:"retryReuses"`
+}
+
+// DetectionSnapshot summarizes the regex matches of one PII type: how many
+// were tokenized, their mean effective confidence, and how many took each
+// path. Use it to tune aiConfidenceThreshold and pack order.
+type DetectionSnapshot struct {
+	Count          int64   `json:"count"`
+	MeanConfidence float64 `json:"meanConfidence"`
+	Immediate      int64   `json:"immediate"`
+	CacheHit       int64   `json:"cacheHit"`
+	Fallback       int64   `json:"fallback"`
 }
 
 // LatencyGroup groups the two latency dimensions.
@@ -216,21 +471,46 @@ type LatencyGroup struct {
 	UpstreamMs      LatencySnapshot `json:"upstreamMs"`
 }
 
-// LatencySnapshot is a min/mean/max summary for one latency dimension.
+// LatencySnapshot summarizes one latency dimension. The percentiles are
+// estimated from histogram buckets and are accurate to within one bucket
+// width (latencyBucketGrowth).
 type LatencySnapshot struct {
 	Count  int64   `json:"count"`
 	MinMs  float64 `json:"minMs"`
 	MeanMs float64 `json:"meanMs"`
 	MaxMs  float64 `json:"maxMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	P99Ms  float64 `json:"p99Ms"`
 }
 
 // --- internal accumulator ---
 
+// Latency histogram layout: bucket i holds samples up to
+// latencyBucketBase * latencyBucketGrowth^i ms, so each bucket is 20% wider
+// than the previous one. 80 buckets reach from 50µs to about 110s; slower
+// samples land in the last bucket, whose percentile reads as the maximum.
+const (
+	latencyBucketCount  = 80
+	latencyBucketBase   = 0.05
+	latencyBucketGrowth = 1.2
+)
+
+// latencyBounds holds the upper bound in ms of each histogram bucket.
+var latencyBounds = func() []float64 {
+	b := make([]float64, latencyBucketCount)
+	for i := range b {
+		b[i] = latencyBucketBase * math.Pow(latencyBucketGrowth, float64(i))
+	}
+	return b
+}()
+
 type latencyStats struct {
-	count int64
-	sum   float64
-	min   float64
-	max   float64
+	count   int64
+	sum     float64
+	min     float64
+	max     float64
+	buckets [latencyBucketCount]int64
 }
 
 func (s *latencyStats) record(ms float64) {
@@ -242,6 +522,42 @@ func (s *latencyStats) record(ms float64) {
 	if ms > s.max {
 		s.max = ms
 	}
+	s.buckets[min(sort.SearchFloat64s(latencyBounds, ms), latencyBucketCount-1)]++
+}
+
+// percentile estimates the q-quantile (0 < q <= 1) as the upper bound of the
+// bucket holding the sample of that rank, clamped to the observed range.
+func (s *latencyStats) percentile(q float64) float64 {
+	rank := int64(math.Ceil(q * float64(s.count)))
+	var seen int64
+	for i, n := range s.buckets {
+		seen += n
+		if seen >= rank {
+			if i == latencyBucketCount-1 {
+				return s.max
+			}
+			return min(max(latencyBounds[i], s.min), s.max)
+		}
+	}
+	return s.max
+}
+
+type detectionStats struct {
+	count     int64
+	confSum   float64
+	immediate int64
+	cacheHit  int64
+	fallback  int64
+}
+
+func (d *detectionStats) snapshot() DetectionSnapshot {
+	return DetectionSnapshot{
+		Count:          d.count,
+		MeanConfidence: round2(d.confSum / float64(d.count)),
+		Immediate:      d.immediate,
+		CacheHit:       d.cacheHit,
+		Fallback:       d.fallback,
+	}
 }
 
 func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -255,5 +571,8 @@ func (s *latencyStats) snapshot() LatencySnapshot {
 		MinMs:  round2(s.min),
 		MeanMs: round2(s.sum / float64(s.count)),
 		MaxMs:  round2(s.max),
+		P50Ms:  round2(s.percentile(0.50)),
+		P95Ms:  round2(s.percentile(0.95)),
+		P99Ms:  round2(s.percentile(0.99)),
 	}
 }
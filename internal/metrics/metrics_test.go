@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -45,6 +46,34 @@ func TestRequestCounters(t *testing.T) {
 	}
 }
 
+func TestRecordDomainRequest(t *testing.T) {
+	var m Metrics
+	if m.Snapshot().Requests.ByDomain != nil {
+		t.Error("byDomain should be omitted before any domain request")
+	}
+	m.RecordDomainRequest("api.openai.com")
+	m.RecordDomainRequest("API.OpenAI.com")
+	m.RecordDomainRequest("api.anthropic.com")
+	m.RecordDomainRequest(`evil"} 1`)
+	m.RecordDomainRequest("")
+	for i := range maxDomains {
+		m.RecordDomainRequest(fmt.Sprintf("api%d.example.com", i))
+	}
+
+	got := m.Snapshot().Requests.ByDomain
+	if got["api.openai.com"] != 2 || got["api.anthropic.com"] != 1 {
+		t.Errorf("per-domain counts = %v", got)
+	}
+	// Two invalid hosts, then the last three example domains past the cap
+	// (the two providers and the invalid-host bucket took three slots).
+	if got[OtherDomain] != 5 {
+		t.Errorf("other = %d, want 5", got[OtherDomain])
+	}
+	if len(got) != maxDomains {
+		t.Errorf("%d domains counted, want %d", len(got), maxDomains)
+	}
+}
+
 func TestErrorCounters(t *testing.T) {
 	m := New()
 	m.ErrorsUpstream.Add(3)
@@ -202,6 +231,22 @@ func TestCacheMissCounters(t *testing.T) {
 	}
 }
 
+// TestCachePackTypeCounters verifies that types registered only by an
+// optional pack (FINANCE_EU's IBAN and SWIFTBIC) get cache counters.
+func TestCachePackTypeCounters(t *testing.T) {
+	m := New()
+	m.RecordCacheHit("IBAN")
+	m.RecordCacheMiss("SWIFTBIC")
+
+	s := m.Snapshot()
+	if s.PIITokens.CacheHits["IBAN"] != 1 {
+		t.Errorf("IBAN hits: got %d, want 1", s.PIITokens.CacheHits["IBAN"])
+	}
+	if s.PIITokens.CacheMisses["SWIFTBIC"] != 1 {
+		t.Errorf("SWIFTBIC misses: got %d, want 1", s.PIITokens.CacheMisses["SWIFTBIC"])
+	}
+}
+
 func TestCacheUnknownTypeIgnored(t *testing.T) {
 	m := New()
 	// Should not panic or create a new entry for an unknown type.
@@ -246,7 +291,133 @@ func TestCacheCountersZeroValueOmitted(t *testing.T) {
 func TestLatencyStats_Empty(t *testing.T) {
 	var s latencyStats
 	snap := s.snapshot()
-	if snap.Count != 0 || snap.MinMs != 0 || snap.MaxMs != 0 || snap.MeanMs != 0 {
+	if snap != (LatencySnapshot{}) {
 		t.Errorf("empty stats snapshot should be zero, got %+v", snap)
 	}
 }
+
+func TestRecordDetection(t *testing.T) {
+	m := New()
+	m.RecordDetection("EMAIL", DetectionImmediate, 0.95)
+	m.RecordDetection("PHONE", DetectionCacheHit, 0.6)
+	m.RecordDetection("PHONE", DetectionFallback, 0.7)
+
+	s := m.Snapshot().PIITokens.Detections
+	if got := s["EMAIL"]; got.Count != 1 || got.Immediate != 1 || got.MeanConfidence != 0.95 {
+		t.Errorf("EMAIL: got %+v", got)
+	}
+	if got := s["PHONE"]; got.Count != 2 || got.CacheHit != 1 || got.Fallback != 1 || got.MeanConfidence != 0.65 {
+		t.Errorf("PHONE: got %+v", got)
+	}
+}
+
+func TestDetectionsZeroValueOmitted(t *testing.T) {
+	var m Metrics
+	if d := m.Snapshot().PIITokens.Detections; d != nil {
+		t.Errorf("Detections should be nil before any detection, got %v", d)
+	}
+}
+
+func TestRecordTokenFidelity(t *testing.T) {
+	m := New()
+	m.RecordTokenFidelity(3, 4)
+	m.RecordTokenFidelity(1, 1)
+	m.RecordTokenFidelity(0, 0) // request had no tokens: not counted
+
+	s := m.Snapshot().PIITokens
+	if s.FidelityResponses != 2 {
+		t.Errorf("FidelityResponses = %d, want 2", s.FidelityResponses)
+	}
+	if s.TokenFidelity != 0.88 {
+		t.Errorf("TokenFidelity = %v, want 0.88", s.TokenFidelity)
+	}
+}
+
+func TestLatencyStats_Percentiles(t *testing.T) {
+	var s latencyStats
+	// 1..1000 ms, one sample each: the exact quantiles are 500, 950 and 990.
+	for ms := 1; ms <= 1000; ms++ {
+		s.record(float64(ms))
+	}
+
+	snap := s.snapshot()
+	cases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"P50Ms", snap.P50Ms, 500},
+		{"P95Ms", snap.P95Ms, 950},
+		{"P99Ms", snap.P99Ms, 990},
+	}
+	for _, c := range cases {
+		// Within one bucket width above the exact value, and never below it.
+		if c.got < c.want || c.got > c.want*latencyBucketGrowth {
+			t.Errorf("%s = %v, want in [%v, %v]", c.name, c.got, c.want, c.want*latencyBucketGrowth)
+		}
+	}
+	if snap.MinMs != 1 || snap.MaxMs != 1000 {
+		t.Errorf("min/max: got %v/%v, want 1/1000", snap.MinMs, snap.MaxMs)
+	}
+}
+
+func TestLatencyStats_PercentilesTail(t *testing.T) {
+	var s latencyStats
+	// 95 fast requests and 5 slow ones: the tail shows only from p99.
+	for range 95 {
+		s.record(2)
+	}
+	for range 5 {
+		s.record(3000)
+	}
+
+	snap := s.snapshot()
+	if snap.P50Ms < 2 || snap.P50Ms > 2*latencyBucketGrowth {
+		t.Errorf("P50Ms = %v, want ~2", snap.P50Ms)
+	}
+	if snap.P95Ms < 2 || snap.P95Ms > 2*latencyBucketGrowth {
+		t.Errorf("P95Ms = %v, want ~2", snap.P95Ms)
+	}
+	if snap.P99Ms < 3000 || snap.P99Ms > 3000*latencyBucketGrowth {
+		t.Errorf("P99Ms = %v, want ~3000", snap.P99Ms)
+	}
+}
+
+func TestLatencyStats_PercentilesClamped(t *testing.T) {
+	var s latencyStats
+	s.record(7)
+	s.record(7)
+
+	// The bucket bound above 7 is clamped to the largest sample.
+	if snap := s.snapshot(); snap.P50Ms != 7 || snap.P99Ms != 7 {
+		t.Errorf("P50Ms/P99Ms = %v/%v, want 7/7", snap.P50Ms, snap.P99Ms)
+	}
+
+	s.record(1e6) // beyond the last bucket bound
+	if snap := s.snapshot(); snap.P99Ms != 1e6 {
+		t.Errorf("P99Ms = %v, want 1e6 (overflow reads as max)", snap.P99Ms)
+	}
+}
+
+func TestSetCacheStats(t *testing.T) {
+	m := New()
+	if s := m.Snapshot(); s.Cache != nil {
+		t.Fatalf("Cache without a source: got %+v, want nil", s.Cache)
+	}
+
+	want := CacheSnapshot{SQueueLen: 2, MQueueLen: 5, GhostCount: 1, Capacity: 10, MemoryHits: 7, ColdHits: 3}
+	m.SetCacheStats(func() (CacheSnapshot, bool) { return want, true })
+	if s := m.Snapshot(); s.Cache == nil || *s.Cache != want {
+		t.Errorf("Cache: got %+v, want %+v", s.Cache, want)
+	}
+
+	m.SetCacheStats(func() (CacheSnapshot, bool) { return CacheSnapshot{}, false })
+	if s := m.Snapshot(); s.Cache != nil {
+		t.Errorf("Cache from a source without a layer: got %+v, want nil", s.Cache)
+	}
+
+	m.SetCacheStats(nil)
+	if s := m.Snapshot(); s.Cache != nil {
+		t.Errorf("Cache after SetCacheStats(nil): got %+v, want nil", s.Cache)
+	}
+}
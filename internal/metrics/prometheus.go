@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// promPrefix namespaces every exported metric name.
+const promPrefix = "aiproxy_"
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format (version 0.0.4). Counters carry the _total suffix. Latency is
+// exported as min/mean/max and percentile gauges plus an observation
+// counter; the internal buckets are not exposed as a Prometheus histogram.
+// PII types appear lower-cased in the "type" label, and every known type is
+// listed so series do not come and go.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	p := &promWriter{}
+
+	p.counter("requests_total", "Requests handled by the proxy.", s.Requests.Total)
+	p.counter("requests_anonymized_total", "AI-domain requests whose body was anonymized.", s.Requests.Anonymized)
+	p.counter("requests_passthrough_total", "Requests to non-AI domains forwarded unchanged.", s.Requests.Passthrough)
+	p.counter("requests_auth_total", "Requests to auth domains forwarded unchanged.", s.Requests.Auth)
+	p.counter("requests_opaque_total", "AI-domain gRPC requests forwarded unscanned.", s.Requests.Opaque)
+	p.counter("requests_anonymization_disabled_total", "AI-domain requests forwarded while anonymization was paused.", s.Requests.AnonOff)
+	p.counter("requests_content_type_skipped_total", "AI-domain requests forwarded unscanned because of their Content-Type.", s.Requests.ContentType)
+
+	if len(s.Requests.ByDomain) > 0 {
+		p.header("requests_by_domain_total", "AI-domain requests by domain; \"other\" past the domain cap.", "counter")
+		for _, d := range slices.Sorted(maps.Keys(s.Requests.ByDomain)) {
+			p.sample("requests_by_domain_total", `domain="`+d+`"`, s.Requests.ByDomain[d])
+		}
+	}
+
+	p.header("responses_total", "Deanonymized responses by delivery mode.", "counter")
+	p.sample("responses_total", `delivery="streaming"`, s.Responses.Streaming)
+	p.sample("responses_total", `delivery="buffered"`, s.Responses.Buffered)
+	p.counter("responses_truncated_deanon_total", "Buffered responses deanonymized only up to maxResponseBodyMB.", s.Responses.Truncated)
+
+	p.header("errors_total", "Errors by kind.", "counter")
+	p.sample("errors_total", `kind="upstream"`, s.Errors.Upstream)
+	p.sample("errors_total", `kind="anonymize"`, s.Errors.Anonymize)
+	p.sample("errors_total", `kind="management_auth"`, s.Errors.ManagementAuth)
+	p.sample("errors_total", `kind="client_disconnect"`, s.Errors.ClientDisconnect)
+
+	p.counter("tokens_replaced_total", "PII values replaced with tokens.", s.PIITokens.Replaced)
+	p.counter("tokens_deanonymized_total", "Tokens restored to their original values.", s.PIITokens.Deanonymized)
+	p.counter("tokens_pretokenized_total", "Tokens already present in request text, passed through.", s.PIITokens.PreTokenized)
+	p.counter("responses_token_stripped_total", "Responses that contained none of their request's tokens.", s.PIITokens.TokenStripped)
+	p.counter("retry_reuses_total", "Retried request bodies served from the retry cache.", s.PIITokens.RetryReuses)
+	p.counter("ollama_dispatches_total", "Background Ollama queries dispatched.", s.PIITokens.OllamaDispatches)
+	p.counter("ollama_errors_total", "Ollama queries that failed or were dropped.", s.PIITokens.OllamaErrors)
+	p.counter("cache_fallbacks_total", "Low-confidence cache misses given a fallback token.", s.PIITokens.CacheFallbacks)
+
+	p.typeCounters("cache_hits_total", "Anonymizer cache hits by PII type.", m.cacheHits)
+	p.typeCounters("cache_misses_total", "Anonymizer cache misses by PII type.", m.cacheMisses)
+
+	if len(s.PIITokens.Detections) > 0 {
+		types := slices.Sorted(maps.Keys(s.PIITokens.Detections))
+		p.header("detections_total", "Tokenized regex matches by PII type and path.", "counter")
+		for _, t := range types {
+			d := s.PIITokens.Detections[t]
+			label := promLabel(t)
+			p.sample("detections_total", label+`,path="immediate"`, d.Immediate)
+			p.sample("detections_total", label+`,path="cache_hit"`, d.CacheHit)
+			p.sample("detections_total", label+`,path="fallback"`, d.Fallback)
+		}
+		p.header("detection_confidence_mean", "Mean effective confidence of tokenized matches by PII type.", "gauge")
+		for _, t := range types {
+			p.sample("detection_confidence_mean", promLabel(t), s.PIITokens.Detections[t].MeanConfidence)
+		}
+	}
+
+	p.gauge("token_fidelity", "Mean fraction of request tokens that responses reproduced intact.", s.PIITokens.TokenFidelity)
+	p.counter("token_fidelity_responses_total", "Responses counted in token_fidelity.", s.PIITokens.FidelityResponses)
+
+	if c := s.Cache; c != nil {
+		p.header("cache_layer_entries", "Entries in the value cache's S3-FIFO layer by queue.", "gauge")
+		p.sample("cache_layer_entries", `queue="small"`, c.SQueueLen)
+		p.sample("cache_layer_entries", `queue="main"`, c.MQueueLen)
+		p.sample("cache_layer_entries", `queue="ghost"`, c.GhostCount)
+		p.gauge("cache_layer_capacity", "S3-FIFO layer capacity (small + main).", float64(c.Capacity))
+		p.header("cache_layer_hits_total", "Value cache hits by where the entry was found.", "counter")
+		p.sample("cache_layer_hits_total", `source="memory"`, c.MemoryHits)
+		p.sample("cache_layer_hits_total", `source="cold"`, c.ColdHits)
+	}
+
+	p.latency("anonymization", s.Latency.AnonymizationMs)
+	p.latency("upstream", s.Latency.UpstreamMs)
+
+	p.gauge("uptime_seconds", "Seconds since the proxy started.", s.UptimeSecs)
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// promWriter accumulates exposition-format lines.
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *promWriter) header(name, help, typ string) {
+	fmt.Fprintf(&p.buf, "# HELP %s%s %s\n# TYPE %s%s %s\n", promPrefix, name, help, promPrefix, name, typ)
+}
+
+// sample writes one value; labels is the inside of the braces, or "".
+func (p *promWriter) sample(name, labels string, v any) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(&p.buf, "%s%s%s %v\n", promPrefix, name, labels, v)
+}
+
+func (p *promWriter) counter(name, help string, v int64) {
+	p.header(name, help, "counter")
+	p.sample(name, "", v)
+}
+
+func (p *promWriter) gauge(name, help string, v float64) {
+	p.header(name, help, "gauge")
+	p.sample(name, "", v)
+}
+
+// typeCounters writes one sample per PII type in counters, sorted by type.
+func (p *promWriter) typeCounters(name, help string, counters map[string]*atomic.Int64) {
+	if len(counters) == 0 {
+		return
+	}
+	p.header(name, help, "counter")
+	for _, t := range slices.Sorted(maps.Keys(counters)) {
+		p.sample(name, promLabel(t), counters[t].Load())
+	}
+}
+
+// latency writes the summary gauges and observation count of one latency
+// dimension.
+func (p *promWriter) latency(dimension string, l LatencySnapshot) {
+	name := dimension + "_latency_ms"
+	p.header(name, "Latency of "+dimension+" in milliseconds (min, mean, max, percentiles).", "gauge")
+	p.sample(name, `stat="min"`, l.MinMs)
+	p.sample(name, `stat="mean"`, l.MeanMs)
+	p.sample(name, `stat="max"`, l.MaxMs)
+	p.sample(name, `stat="p50"`, l.P50Ms)
+	p.sample(name, `stat="p95"`, l.P95Ms)
+	p.sample(name, `stat="p99"`, l.P99Ms)
+	p.counter(name+"_count", "Observations in "+name+".", l.Count)
+}
+
+// promLabel formats a PII type as a type label. Type names are restricted
+// to A-Z, 0-9 and _, so no escaping is needed.
+func promLabel(piiType string) string {
+	return `type="` + strings.ToLower(piiType) + `"`
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	m := New()
+	m.RequestsTotal.Add(5)
+	m.TokensReplaced.Add(3)
+	m.RecordCacheHit("EMAIL")
+	m.RecordCacheHit("EMAIL")
+	m.RecordDetection("EMAIL", DetectionImmediate, 0.95)
+	m.RecordAnonLatency(2 * time.Millisecond)
+	m.RecordDomainRequest("api.openai.com")
+	m.SetCacheStats(func() (CacheSnapshot, bool) {
+		return CacheSnapshot{SQueueLen: 2, MQueueLen: 5, GhostCount: 1, Capacity: 10, MemoryHits: 7, ColdHits: 3}, true
+	})
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE aiproxy_requests_total counter\n",
+		"aiproxy_requests_total 5\n",
+		"aiproxy_tokens_replaced_total 3\n",
+		`aiproxy_requests_by_domain_total{domain="api.openai.com"} 1` + "\n",
+		`aiproxy_cache_hits_total{type="email"} 2` + "\n",
+		`aiproxy_cache_misses_total{type="email"} 0` + "\n",
+		`aiproxy_detections_total{type="email",path="immediate"} 1` + "\n",
+		`aiproxy_errors_total{kind="upstream"} 0` + "\n",
+		"# TYPE aiproxy_anonymization_latency_ms gauge\n",
+		`aiproxy_anonymization_latency_ms{stat="mean"} 2` + "\n",
+		`aiproxy_anonymization_latency_ms{stat="p99"} 2` + "\n",
+		"aiproxy_anonymization_latency_ms_count 1\n",
+		`aiproxy_cache_layer_entries{queue="main"} 5` + "\n",
+		"aiproxy_cache_layer_capacity 10\n",
+		`aiproxy_cache_layer_hits_total{source="cold"} 3` + "\n",
+		"aiproxy_uptime_seconds ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePrometheus_ZeroValue(t *testing.T) {
+	var m Metrics
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	if !strings.Contains(b.String(), "aiproxy_requests_total 0\n") {
+		t.Errorf("zero-value output missing aiproxy_requests_total:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "aiproxy_cache_hits_total") {
+		t.Errorf("zero value has no cache counters, got:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "aiproxy_cache_layer_") {
+		t.Errorf("zero value has no cache layer, got:\n%s", b.String())
+	}
+}
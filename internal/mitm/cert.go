@@ -12,11 +12,12 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"os"
 	"sync"
 	"time"
+
+	"ai-anonymizing-proxy/internal/logger"
 )
 
 // Indirection seams for deterministic, portable testing of the crypto and
@@ -39,21 +40,25 @@ type CA struct {
 
 	mu    sync.RWMutex
 	cache map[string]*tls.Certificate // hostname → leaf cert (Leaf field carries NotAfter)
+
+	log *logger.Logger // certificate and handshake logging; see SetLogger
 }
 
 // LoadOrGenerateCA loads a CA from PEM files, or generates one if the files
 // don't exist. If the files exist but are invalid, an error is returned.
-func LoadOrGenerateCA(certFile, keyFile string) (*CA, error) {
+// The returned CA logs to lg.
+func LoadOrGenerateCA(certFile, keyFile string, lg *logger.Logger) (*CA, error) {
 	// Try loading first
 	ca, err := LoadCA(certFile, keyFile)
 	if err == nil {
-		log.Printf("[MITM] Loaded CA from %s / %s", certFile, keyFile)
+		ca.SetLogger(lg)
+		lg.Infof("ca_load", "Loaded CA from %s / %s", certFile, keyFile)
 		return ca, nil
 	}
 
 	// If files don't exist, generate
 	if errors.Is(err, os.ErrNotExist) {
-		log.Printf("[MITM] CA files not found, generating new CA...")
+		lg.Info("ca_generate", "CA files not found, generating new CA...")
 		if genErr := GenerateCA(certFile, keyFile); genErr != nil {
 			return nil, fmt.Errorf("failed to generate CA: %w", genErr)
 		}
@@ -61,18 +66,20 @@ func LoadOrGenerateCA(certFile, keyFile string) (*CA, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to load generated CA: %w", err)
 		}
-		log.Printf("[MITM] Generated new CA: %s / %s", certFile, keyFile)
-		log.Printf("[MITM] Trust the CA certificate to enable HTTPS interception:")
-		log.Printf("[MITM]   macOS:   security add-trusted-cert -d -r trustRoot -k ~/Library/Keychains/login.keychain %s", certFile)
-		log.Printf("[MITM]   Linux:   sudo cp %s /usr/local/share/ca-certificates/ai-proxy.crt && sudo update-ca-certificates", certFile)
-		log.Printf("[MITM]   Windows: certutil -addstore Root %s", certFile)
+		ca.SetLogger(lg)
+		lg.Infof("ca_generate", "Generated new CA: %s / %s", certFile, keyFile)
+		lg.Info("ca_generate", "Trust the CA certificate to enable HTTPS interception:")
+		lg.Infof("ca_generate", "  macOS:   security add-trusted-cert -d -r trustRoot -k ~/Library/Keychains/login.keychain %s", certFile)
+		lg.Infof("ca_generate", "  Linux:   sudo cp %s /usr/local/share/ca-certificates/ai-proxy.crt && sudo update-ca-certificates", certFile)
+		lg.Infof("ca_generate", "  Windows: certutil -addstore Root %s", certFile)
 		return ca, nil
 	}
 
 	return nil, fmt.Errorf("failed to load CA: %w", err)
 }
 
-// LoadCA reads a CA certificate and private key from PEM files.
+// LoadCA reads a CA certificate and private key from PEM files. The CA logs
+// to a "MITM" logger at info level until SetLogger replaces it.
 func LoadCA(certFile, keyFile string) (*CA, error) {
 	certPEM, err := os.ReadFile(certFile)
 	if err != nil {
@@ -114,9 +121,16 @@ func LoadCA(certFile, keyFile string) (*CA, error) {
 		cert:  caCert,
 		key:   caKey,
 		cache: make(map[string]*tls.Certificate),
+		log:   logger.New("MITM", "info"),
 	}, nil
 }
 
+// SetLogger replaces the logger used by CertFor and HandleConn. It must be
+// called before the CA is shared between goroutines.
+func (ca *CA) SetLogger(lg *logger.Logger) {
+	ca.log = lg
+}
+
 // GenerateCA creates a new self-signed CA certificate and private key,
 // writing them to the specified PEM files.
 func GenerateCA(certFile, keyFile string) error {
@@ -172,6 +186,12 @@ func GenerateCA(certFile, keyFile string) error {
 	return nil
 }
 
+// CertPEM returns the CA certificate PEM-encoded, as clients import it into
+// their trust store.
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
 // CertFor returns a TLS certificate for the given hostname, generating
 // and caching one on first use. The leaf cert is signed by the CA.
 func (ca *CA) CertFor(host string) (*tls.Certificate, error) {
@@ -179,24 +199,24 @@ func (ca *CA) CertFor(host string) (*tls.Certificate, error) {
 	if c, ok := ca.cache[host]; ok {
 		if c.Leaf != nil && time.Until(c.Leaf.NotAfter) > time.Hour {
 			ca.mu.RUnlock()
-			log.Printf("[MITM] Certificate cache hit for %s (expires %s)", host, c.Leaf.NotAfter.Format(time.RFC3339))
+			ca.log.Debugf("cert_cache_hit", "Certificate cache hit for %s (expires %s)", host, c.Leaf.NotAfter.Format(time.RFC3339))
 			return c, nil
 		}
-		log.Printf("[MITM] Certificate expired for %s, regenerating", host)
+		ca.log.Debugf("cert_expired", "Certificate expired for %s, regenerating", host)
 	}
 	ca.mu.RUnlock()
 
-	log.Printf("[MITM] Generating certificate for %s", host)
+	ca.log.Debugf("cert_generate", "Generating certificate for %s", host)
 
 	leafKey, err := rsaGenerateKey(rand.Reader, 2048)
 	if err != nil {
-		log.Printf("[MITM] Failed to generate key for %s: %v", host, err)
+		ca.log.Errorf("cert_generate", "Failed to generate key for %s: %v", host, err)
 		return nil, fmt.Errorf("generate leaf key: %w", err)
 	}
 
 	serial, err := randInt(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		log.Printf("[MITM] Failed to generate serial for %s: %v", host, err)
+		ca.log.Errorf("cert_generate", "Failed to generate serial for %s: %v", host, err)
 		return nil, fmt.Errorf("generate serial: %w", err)
 	}
 
@@ -212,7 +232,7 @@ func (ca *CA) CertFor(host string) (*tls.Certificate, error) {
 
 	derBytes, err := x509CreateCertificate(rand.Reader, template, ca.cert, &leafKey.PublicKey, ca.key)
 	if err != nil {
-		log.Printf("[MITM] Failed to sign certificate for %s: %v", host, err)
+		ca.log.Errorf("cert_generate", "Failed to sign certificate for %s: %v", host, err)
 		return nil, fmt.Errorf("sign leaf cert: %w", err)
 	}
 
@@ -231,7 +251,7 @@ func (ca *CA) CertFor(host string) (*tls.Certificate, error) {
 	}
 	ca.mu.Unlock()
 
-	log.Printf("[MITM] Certificate cached for %s (expires %s)", host, leaf.Leaf.NotAfter.Format(time.RFC3339))
+	ca.log.Debugf("cert_cache_store", "Certificate cached for %s (expires %s)", host, leaf.Leaf.NotAfter.Format(time.RFC3339))
 	return leaf, nil
 }
 
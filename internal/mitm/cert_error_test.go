@@ -24,7 +24,7 @@ func TestLoadOrGenerateCA_GenerateFails(t *testing.T) {
 	certFile := filepath.Join(dir, "missing", "ca.pem")
 	keyFile := filepath.Join(dir, "missing", "ca.key")
 
-	_, err := LoadOrGenerateCA(certFile, keyFile)
+	_, err := LoadOrGenerateCA(certFile, keyFile, testLog)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -40,7 +40,7 @@ func TestLoadOrGenerateCA_LoadGeneratedFails(t *testing.T) {
 	// certificate is expected.
 	path := filepath.Join(dir, "ca.pem")
 
-	_, err := LoadOrGenerateCA(path, path)
+	_, err := LoadOrGenerateCA(path, path, testLog)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -3,7 +3,6 @@ package mitm
 import (
 	"context"
 	"crypto/tls"
-	"log"
 	"net"
 	"net/http"
 	"time"
@@ -14,12 +13,13 @@ import (
 // HandleConn performs a TLS handshake on the hijacked client connection,
 // then serves HTTP/1.1 or HTTP/2 requests through the provided handler.
 // The handler receives plaintext HTTP requests that can be inspected and modified.
+// Handshake failures are logged to the CA's logger.
 func HandleConn(clientConn net.Conn, host string, ca *CA, handler http.Handler) {
 	tlsCfg := ca.TLSConfigForHost(host)
 
 	tlsConn := tls.Server(clientConn, tlsCfg)
 	if err := tlsConn.HandshakeContext(context.Background()); err != nil {
-		log.Printf("[MITM] TLS handshake failed for %s: %v", host, err)
+		ca.log.Errorf("tls_handshake", "TLS handshake failed for %s: %v", host, err)
 		return
 	}
 	defer func() { _ = tlsConn.Close() }() // best-effort close on TLS connection
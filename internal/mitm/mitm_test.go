@@ -13,9 +13,14 @@ import (
 	"testing"
 	"time"
 
+	"ai-anonymizing-proxy/internal/logger"
+
 	"golang.org/x/net/http2"
 )
 
+// testLog is the logger passed to LoadOrGenerateCA in tests.
+var testLog = logger.New("MITM", "info")
+
 // tempCA generates a CA into a temp dir and returns (certFile, keyFile).
 func tempCA(t *testing.T) (string, string) {
 	t.Helper()
@@ -118,7 +123,7 @@ func TestLoadOrGenerateCA_GeneratesWhenMissing(t *testing.T) {
 	cert := filepath.Join(dir, "ca-cert.pem")
 	key := filepath.Join(dir, "ca-key.pem")
 
-	ca, err := LoadOrGenerateCA(cert, key)
+	ca, err := LoadOrGenerateCA(cert, key, testLog)
 	if err != nil {
 		t.Fatalf("LoadOrGenerateCA: %v", err)
 	}
@@ -132,7 +137,7 @@ func TestLoadOrGenerateCA_GeneratesWhenMissing(t *testing.T) {
 
 func TestLoadOrGenerateCA_LoadsExisting(t *testing.T) {
 	cert, key := tempCA(t)
-	ca, err := LoadOrGenerateCA(cert, key)
+	ca, err := LoadOrGenerateCA(cert, key, testLog)
 	if err != nil {
 		t.Fatalf("LoadOrGenerateCA: %v", err)
 	}
@@ -141,6 +146,21 @@ func TestLoadOrGenerateCA_LoadsExisting(t *testing.T) {
 	}
 }
 
+func TestCertPEM_MatchesCertFile(t *testing.T) {
+	cert, key := tempCA(t)
+	ca, err := LoadCA(cert, key)
+	if err != nil {
+		t.Fatalf("LoadCA: %v", err)
+	}
+	want, err := os.ReadFile(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ca.CertPEM(); string(got) != string(want) {
+		t.Errorf("CertPEM differs from %s:\n%s", cert, got)
+	}
+}
+
 func TestLoadOrGenerateCA_ErrorOnBadExistingCert(t *testing.T) {
 	dir := t.TempDir()
 	cert := filepath.Join(dir, "ca-cert.pem")
@@ -153,7 +173,7 @@ func TestLoadOrGenerateCA_ErrorOnBadExistingCert(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := LoadOrGenerateCA(cert, key)
+	_, err := LoadOrGenerateCA(cert, key, testLog)
 	if err == nil {
 		t.Error("expected error for invalid existing CA files")
 	}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats accepted by config.AccessLogFormat.
+const (
+	accessLogCLF      = "clf"
+	accessLogCombined = "combined"
+)
+
+// clfTimeLayout is the timestamp layout used by Apache/NGINX access logs.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// accessLog writes one line per proxied request in Common or Combined Log
+// Format. It runs alongside the leveled per-request log lines and is meant for
+// existing web-log tooling. The client address is replaced with the same
+// hashRemoteAddr identifier the structured logs use, so no client IP is
+// written.
+type accessLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	closer   io.Closer // nil for stdout/stderr
+	combined bool
+}
+
+// newAccessLog opens the destination for the given format. dest is a file
+// path opened in append mode, or "" / "stdout" / "stderr". Returns (nil, nil)
+// when format is empty (access logging disabled).
+func newAccessLog(format, dest string) (*accessLog, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		return nil, nil
+	case accessLogCLF, accessLogCombined:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q (want %q or %q)", format, accessLogCLF, accessLogCombined)
+	}
+
+	l := &accessLog{combined: format == accessLogCombined}
+	switch dest {
+	case "", "stdout":
+		l.w = os.Stdout
+	case "stderr":
+		l.w = os.Stderr
+	default:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec // G304: path comes from operator config, not request input
+		if err != nil {
+			return nil, fmt.Errorf("open access log %s: %w", dest, err)
+		}
+		l.w = f
+		l.closer = f
+	}
+	return l, nil
+}
+
+// Close closes the underlying file, if any.
+func (l *accessLog) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// write formats and writes a single access log line. r must be the request
+// as forwarded (i.e. after any path anonymization), so the logged path never
+// contains PII that was tokenized upstream.
+func (l *accessLog) write(r *http.Request, status int, bytes int64, start time.Time, dur time.Duration) {
+	if l == nil {
+		return
+	}
+	line := formatAccessLine(r, status, bytes, start, dur, l.combined)
+	l.mu.Lock()
+	_, _ = io.WriteString(l.w, line) // best-effort; never fail a request over logging
+	l.mu.Unlock()
+}
+
+// formatAccessLine renders one CLF or Combined line. The request target is
+// written in absolute form (scheme://host/path) as proxies conventionally do.
+// The request duration in microseconds is appended as a final field,
+// matching Apache's %D extension.
+func formatAccessLine(r *http.Request, status int, bytes int64, start time.Time, dur time.Duration, combined bool) string {
+	host := r.Host
+	if host == "" && r.URL != nil {
+		host = r.URL.Host
+	}
+	scheme := "http"
+	reqPath := "/"
+	if r.URL != nil {
+		if r.URL.Scheme != "" {
+			scheme = r.URL.Scheme
+		}
+		if p := r.URL.EscapedPath(); p != "" {
+			reqPath = p
+		}
+	}
+	size := "-"
+	if bytes > 0 {
+		size = fmt.Sprintf("%d", bytes)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - - [%s] \"%s %s://%s%s %s\" %d %s",
+		hashRemoteAddr(r.RemoteAddr), start.Format(clfTimeLayout),
+		r.Method, scheme, host, reqPath, r.Proto, status, size)
+	if combined {
+		fmt.Fprintf(&b, " %s %s", quoteLogField(r.Referer()), quoteLogField(r.UserAgent()))
+	}
+	fmt.Fprintf(&b, " %d\n", dur.Microseconds())
+	return b.String()
+}
+
+// quoteLogField wraps v in double quotes, escaping embedded quotes and
+// backslashes. Empty values are written as "-" per CLF convention.
+func quoteLogField(v string) string {
+	if v == "" {
+		return `"-"`
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+// accessLogWriter wraps an http.ResponseWriter to capture the status code and
+// number of body bytes written. It forwards Flush so streaming responses
+// still reach the client immediately via flushingCopy.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statusCode returns the recorded status, defaulting to 200 when the handler
+// wrote nothing (net/http's implicit status).
+func (w *accessLogWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// withAccessLog runs handle with a status-capturing writer and emits an
+// access log line afterwards. When access logging is disabled it calls
+// handle directly with the original writer.
+func (s *Server) withAccessLog(w http.ResponseWriter, r *http.Request, handle func(http.ResponseWriter, *http.Request)) {
+	if s.accessLog == nil {
+		handle(w, r)
+		return
+	}
+	start := time.Now()
+	aw := &accessLogWriter{ResponseWriter: w}
+	handle(aw, r)
+	s.accessLog.write(r, aw.statusCode(), aw.bytes, start, time.Since(start))
+}
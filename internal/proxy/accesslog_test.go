@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAccessLog_Disabled(t *testing.T) {
+	l, err := newAccessLog("", "")
+	if err != nil || l != nil {
+		t.Fatalf("expected (nil, nil) for empty format, got (%v, %v)", l, err)
+	}
+	// nil receiver must be safe
+	l.write(httptest.NewRequest("GET", "/", nil), 200, 0, time.Now(), 0)
+	if err := l.Close(); err != nil {
+		t.Errorf("nil Close: %v", err)
+	}
+}
+
+func TestNewAccessLog_UnknownFormat(t *testing.T) {
+	if _, err := newAccessLog("json", ""); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestNewAccessLog_FileDestination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	l, err := newAccessLog("CLF", path)
+	if err != nil {
+		t.Fatalf("newAccessLog: %v", err)
+	}
+	l.write(httptest.NewRequest("GET", "http://example.com/x", nil), 204, 0, time.Now(), time.Millisecond)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // G304: test temp file
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(data), `"GET http://example.com/x HTTP/1.1" 204 - 1000`) {
+		t.Errorf("unexpected file contents: %q", data)
+	}
+}
+
+func TestNewAccessLog_BadFile(t *testing.T) {
+	if _, err := newAccessLog("clf", filepath.Join(t.TempDir(), "missing", "access.log")); err == nil {
+		t.Error("expected error for unwritable destination")
+	}
+}
+
+func TestFormatAccessLine(t *testing.T) {
+	start := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	req := httptest.NewRequest("POST", "http://api.openai.com/v1/chat/completions", nil)
+	req.RemoteAddr = "192.0.2.10:5555"
+	req.Header.Set("User-Agent", `curl/8 "test"`)
+
+	wantPrefix := hashRemoteAddr("192.0.2.10:5555") +
+		` - - [05/Mar/2024:14:07:09 +0000] "POST http://api.openai.com/v1/chat/completions HTTP/1.1" 200 42`
+
+	tests := []struct {
+		name     string
+		combined bool
+		want     string
+	}{
+		{"clf", false, wantPrefix + " 1500\n"},
+		{"combined", true, wantPrefix + ` "-" "curl/8 \"test\"" 1500` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatAccessLine(req, 200, 42, start, 1500*time.Microsecond, tt.combined)
+			if got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLog_ForwardedRequestWritesCLFLine(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, nil, nil)
+	var buf bytes.Buffer
+	srv.accessLog = &accessLog{w: &buf}
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/v1/models", nil)
+	req.Host = host
+	req.URL.Host = host
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	clf := regexp.MustCompile(`^[0-9a-f]{8} - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] ` +
+		`"GET http://` + regexp.QuoteMeta(host) + `/v1/models HTTP/1\.1" 201 5 \d+\n$`)
+	if !clf.MatchString(buf.String()) {
+		t.Errorf("access log line does not match CLF: %q", buf.String())
+	}
+}
+
+func TestAccessLog_DisabledByDefault(t *testing.T) {
+	srv := newTestProxyServer(t)
+	if srv.accessLog != nil {
+		t.Error("access log should be nil when AccessLogFormat is empty")
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Error types reported in the "type" field of JSON error bodies.
+const (
+	errTypeUpstream   = "upstream_error"
+	errTypeForbidden  = "forbidden"
+	errTypeBusy       = "proxy_busy"
+	errTypeTooLarge   = "request_too_large"
+	errTypeBadRequest = "invalid_request"
+	errTypeInternal   = "internal_error"
+)
+
+// writeError sends an error generated by the proxy itself for a request to
+// domain. By default the body is plain text. With cfg.JSONErrors it is a JSON
+// error in the envelope the target provider uses for its own errors, so the
+// client SDK can parse it and surface the message.
+func (s *Server) writeError(w http.ResponseWriter, domain string, status int, errType, msg string) {
+	if !s.cfg.JSONErrors {
+		http.Error(w, msg, status)
+		return
+	}
+	body, err := json.Marshal(errorEnvelope(domain, status, errType, msg))
+	if err != nil {
+		http.Error(w, msg, status)
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// errorEnvelope builds the JSON error body for domain:
+//
+//	Anthropic: {"type":"error","error":{"type":...,"message":...}}
+//	Google:    {"error":{"code":...,"message":...,"status":...}}
+//	others:    {"error":{"type":...,"message":...}} (OpenAI and compatibles)
+func errorEnvelope(domain string, status int, errType, msg string) any {
+	host := strings.ToLower(domain)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	switch {
+	case host == "anthropic.com" || strings.HasSuffix(host, ".anthropic.com"):
+		return map[string]any{
+			"type":  "error",
+			"error": map[string]string{"type": errType, "message": msg},
+		}
+	case strings.HasSuffix(host, ".googleapis.com"):
+		return map[string]any{
+			"error": map[string]any{"code": status, "message": msg, "status": googleStatus(status)},
+		}
+	default:
+		return map[string]any{
+			"error": map[string]string{"type": errType, "message": msg},
+		}
+	}
+}
+
+// googleStatus maps the HTTP statuses the proxy emits to the canonical
+// google.rpc.Code names Google APIs put in error.status.
+func googleStatus(status int) string {
+	switch status {
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "INVALID_ARGUMENT"
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	case http.StatusInternalServerError:
+		return "INTERNAL"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteError_PlainTextByDefault(t *testing.T) {
+	srv := newTestProxyServer(t)
+	w := httptest.NewRecorder()
+	srv.writeError(w, "api.openai.com", http.StatusBadGateway, errTypeUpstream, errBadGateway)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status: got %d, want 502", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type: got %q, want text/plain", ct)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != errBadGateway {
+		t.Errorf("body: got %q, want %q", got, errBadGateway)
+	}
+}
+
+func TestWriteError_GoogleTimeoutStatus(t *testing.T) {
+	srv := newTestProxyServer(t)
+	srv.cfg.JSONErrors = true
+	w := httptest.NewRecorder()
+	srv.writeError(w, "generativelanguage.googleapis.com", http.StatusGatewayTimeout, errTypeUpstream, "upstream timed out")
+	if want := `{"error":{"code":504,"message":"upstream timed out","status":"DEADLINE_EXCEEDED"}}`; w.Body.String() != want {
+		t.Errorf("body:\n got %s\nwant %s", w.Body.String(), want)
+	}
+}
+
+func TestWriteError_JSONEnvelopes(t *testing.T) {
+	srv := newTestProxyServer(t)
+	srv.cfg.JSONErrors = true
+
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"api.openai.com", `{"error":{"message":"bad gateway","type":"upstream_error"}}`},
+		{"api.anthropic.com:443", `{"error":{"message":"bad gateway","type":"upstream_error"},"type":"error"}`},
+		{"generativelanguage.googleapis.com", `{"error":{"code":502,"message":"bad gateway","status":"UNAVAILABLE"}}`},
+		{"llm.example.com", `{"error":{"message":"bad gateway","type":"upstream_error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.writeError(w, tt.domain, http.StatusBadGateway, errTypeUpstream, errBadGateway)
+
+			if w.Code != http.StatusBadGateway {
+				t.Errorf("status: got %d, want 502", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type: got %q, want application/json", ct)
+			}
+			if !json.Valid(w.Body.Bytes()) {
+				t.Fatalf("body is not valid JSON: %s", w.Body.String())
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteAnonymizeError checks the status each anonymization failure maps
+// to; an error it does not know is a 500, not a 413.
+func TestWriteAnonymizeError(t *testing.T) {
+	srv := newTestProxyServer(t)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"too large", fmt.Errorf("%w: exceeds 10 bytes", ErrBodyTooLarge), http.StatusRequestEntityTooLarge},
+		{"too many tokens", errTooManyTokens, http.StatusRequestEntityTooLarge},
+		{"read error", fmt.Errorf("%w: %w", ErrBodyRead, io.ErrClosedPipe), http.StatusBadRequest},
+		{"busy", errAnonymizeBusy, http.StatusServiceUnavailable},
+		{"unknown", errors.New("session store unavailable"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.writeAnonymizeError(w, "api.openai.com", tt.err)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestJSONErrors_ProxyResponses drives real error paths with jsonErrors on
+// and checks each response body parses as JSON with the expected type.
+func TestJSONErrors_ProxyResponses(t *testing.T) {
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.cfg.JSONErrors = true
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		t.Helper()
+		var env struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("body is not valid JSON (%v): %s", err, w.Body.String())
+		}
+		if env.Error.Message == "" {
+			t.Errorf("error.message is empty: %s", w.Body.String())
+		}
+		return env.Error.Type
+	}
+
+	t.Run("upstream unreachable", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), "GET", "http://localhost:1/v1/models", nil)
+		req.Host = "localhost:1"
+		w := httptest.NewRecorder()
+		srv.handleHTTP(w, req)
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("status: got %d, want 502", w.Code)
+		}
+		if typ := decode(t, w); typ != errTypeUpstream {
+			t.Errorf("error.type: got %q, want %q", typ, errTypeUpstream)
+		}
+	})
+
+	t.Run("anonymization busy", func(t *testing.T) {
+		srv.anonSlots = make(chan struct{}, 1)
+		srv.anonSlots <- struct{}{}
+		t.Cleanup(func() { srv.anonSlots = nil })
+
+		body := `{"messages":[{"role":"user","content":"hello there"}]}`
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://localhost:1/v1/chat", strings.NewReader(body))
+		req.Host = "localhost:1"
+		w := httptest.NewRecorder()
+		srv.handleHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status: got %d, want 503", w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("503 response missing Retry-After")
+		}
+		if typ := decode(t, w); typ != errTypeBusy {
+			t.Errorf("error.type: got %q, want %q", typ, errTypeBusy)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// multipartBoundary returns the boundary of a multipart/form-data request
+// body, or "" when h declares some other type.
+func multipartBoundary(h http.Header) string {
+	mt, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || mt != "multipart/form-data" {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// anonymizeMultipart anonymizes a multipart/form-data body part by part in
+// session sessionID and re-encodes it with the same boundary. text/plain and
+// application/json parts go through AnonymizeText and AnonymizeJSON; every
+// other part (images, PDFs, octet-stream uploads) is copied byte for byte,
+// since rewriting binary content could only corrupt it. Parts keep their
+// headers; the preamble and epilogue, which carry no form data, are dropped.
+func (s *Server) anonymizeMultipart(body []byte, boundary, sessionID string) ([]byte, error) {
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	var out bytes.Buffer
+	mw := multipart.NewWriter(&out)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	for {
+		// NextRawPart: a quoted-printable part is rewritten as it was sent,
+		// not decoded behind the client's back.
+		part, err := mr.NextRawPart()
+		if err == io.EOF { //nolint:errorlint // only a bare EOF is the closing boundary; a wrapped one is a truncated body
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		switch partMediaType(part.Header) {
+		case "text/plain":
+			data = []byte(s.anon.AnonymizeText(string(data), sessionID))
+		case "application/json":
+			data = s.anon.AnonymizeJSON(data, sessionID)
+		}
+		pw, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("closing multipart body: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// partMediaType returns the media type of a form part. A part without a
+// Content-Type is a plain form field, text/plain by RFC 7578.
+func partMediaType(h textproto.MIMEHeader) string {
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		return "text/plain"
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
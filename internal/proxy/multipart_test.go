@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"ai-anonymizing-proxy/internal/config"
+)
+
+func TestAnonymizeRequestBody_Multipart(t *testing.T) {
+	// The binary part holds an address too: it must come through untouched.
+	binary := append([]byte{0x89, 'P', 'N', 'G', 0x00, 0xff}, "bob@example.org"...)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("prompt", "Summarise the attached file for alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="file"; filename="scan.png"`)
+	h.Set("Content-Type", "image/png")
+	fw, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(binary); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestProxyServer(t)
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://api.openai.com/v1/files", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	sessionID, err := srv.anonymizeRequestBody(req)
+	if err != nil {
+		t.Fatalf("anonymizeRequestBody: %v", err)
+	}
+	defer srv.anon.DeleteSession(sessionID)
+
+	got, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ContentLength != int64(len(got)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(got))
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(got), mw.Boundary())
+	text, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("text part: %v", err)
+	}
+	prompt, _ := io.ReadAll(text)
+	if strings.Contains(string(prompt), "alice@example.com") || !strings.Contains(string(prompt), "[PII_EMAIL_") {
+		t.Errorf("text part not anonymized: %q", prompt)
+	}
+	file, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("binary part: %v", err)
+	}
+	if file.FileName() != "scan.png" {
+		t.Errorf("file name = %q, want scan.png", file.FileName())
+	}
+	if data, _ := io.ReadAll(file); !bytes.Equal(data, binary) {
+		t.Errorf("binary part changed: got %q, want %q", data, binary)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got more (err=%v)", err)
+	}
+}
+
+func TestAnonymizeRequestBody_MalformedMultipart(t *testing.T) {
+	srv := newTestProxyServer(t)
+	const body = "not multipart at all: alice@example.com"
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://api.openai.com/v1/files", strings.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+
+	sessionID, err := srv.anonymizeRequestBody(req)
+	if err != nil {
+		t.Fatalf("anonymizeRequestBody: %v", err)
+	}
+	defer srv.anon.DeleteSession(sessionID)
+
+	got, _ := io.ReadAll(req.Body)
+	if strings.Contains(string(got), "alice@example.com") || !strings.Contains(string(got), "[PII_EMAIL_") {
+		t.Errorf("malformed multipart body not scanned whole: %q", got)
+	}
+}
+
+// TestServeHTTP_HTTP_MultipartDefaultContentTypes sends a form upload
+// through the full handler with the default anonymizeContentTypes: the
+// multipart body must be scanned, not forwarded as an unlisted type.
+func TestServeHTTP_HTTP_MultipartDefaultContentTypes(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.anonTypes = lowerAll(config.Load().AnonymizeContentTypes)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("prompt", "Summarise this for alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/files", bytes.NewReader(body.Bytes()))
+	req.Host = host
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	got, _ := received.Load().(string)
+	if strings.Contains(got, "alice@example.com") || !strings.Contains(got, "[PII_EMAIL_") {
+		t.Errorf("multipart upload not anonymized under the default content types: %q", got)
+	}
+	if r := srv.m.Snapshot().Requests; r.ContentType != 0 {
+		t.Errorf("multipart upload counted as contentTypeSkipped: %+v", r)
+	}
+}
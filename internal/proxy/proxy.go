@@ -21,18 +21,23 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"ai-anonymizing-proxy/internal/anonymizer"
 	"ai-anonymizing-proxy/internal/config"
+	"ai-anonymizing-proxy/internal/domainmatch"
+	"ai-anonymizing-proxy/internal/logger"
 	"ai-anonymizing-proxy/internal/management"
 	"ai-anonymizing-proxy/internal/metrics"
 	"ai-anonymizing-proxy/internal/mitm"
@@ -41,6 +46,7 @@ import (
 // HTTP header and error message constants.
 const (
 	headerContentEncoding = "Content-Encoding"
+	headerDeanonTruncated = "X-Deanonymization-Truncated" // set on responses only partly deanonymized
 	errBadGateway         = "bad gateway"
 )
 
@@ -114,7 +120,7 @@ var dialContextFn = (*net.Dialer).DialContext
 
 // ssrfSafeDialContext wraps a net.Dialer and checks the resolved IP address
 // at connection time — eliminating the TOCTOU gap between DNS resolution and dial.
-func ssrfSafeDialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+func ssrfSafeDialContext(d *net.Dialer, lg *logger.Logger) func(ctx context.Context, network, addr string) (net.Conn, error) {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
 		host, port, err := net.SplitHostPort(addr)
 		if err != nil {
@@ -129,7 +135,7 @@ func ssrfSafeDialContext(d *net.Dialer) func(ctx context.Context, network, addr
 
 		for _, ipAddr := range ips {
 			if isPrivateIP(ipAddr.IP) {
-				log.Printf("[SSRF] Blocked connection to private IP %s (host: %s)", ipAddr.IP, host)
+				lg.Warnf("ssrf_block", "Blocked connection to private IP %s (host: %s)", ipAddr.IP, host)
 				return nil, errPrivateIP
 			}
 		}
@@ -145,15 +151,121 @@ func ssrfSafeDialContext(d *net.Dialer) func(ctx context.Context, network, addr
 
 // Server is the HTTP proxy server.
 type Server struct {
-	cfg         *config.Config
-	anon        *anonymizer.Anonymizer
-	m           *metrics.Metrics
-	aiDomains   *management.DomainRegistry
-	authDomains map[string]bool
-	authPaths   map[string]bool
-	transport   *http.Transport
-	dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
-	ca          *mitm.CA // nil if MITM is not available
+	cfg             *config.Config
+	anon            *anonymizer.Anonymizer
+	m               *metrics.Metrics
+	aiDomains       *management.DomainRegistry
+	authDomains     map[string]bool
+	authPaths       map[string]bool
+	bypassUA        []userAgentMatcher
+	profiles        domainProfiles // compiled cfg.DomainProfiles
+	anonTypes       []string       // lowercased anonymizeContentTypes; empty = scan every body
+	anonSlots       chan struct{}  // bounds concurrent body anonymizations; nil = unlimited
+	maxRequestBody  int64          // bytes; larger AI-domain bodies get 413
+	maxRespBuffer   int64          // bytes; larger non-SSE responses stream; 0 = always buffer
+	maxRespBody     int64          // bytes of a buffered response read for deanonymization
+	upstreamTimeout time.Duration  // bound on a non-SSE upstream exchange; 0 = none
+	transport       *http.Transport
+	dialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+	ca              *mitm.CA   // nil if MITM is not available
+	accessLog       *accessLog // nil unless cfg.AccessLogFormat is set
+	log             *logger.Logger
+	mitmLog         *logger.Logger // intercepted requests and the CA's certificates
+}
+
+// newLogger returns a logger for module at cfg's log level and format.
+func newLogger(module string, cfg *config.Config) *logger.Logger {
+	lg := logger.New(module, cfg.LogLevel)
+	lg.SetFormat(cfg.LogFormat)
+	return lg
+}
+
+// ErrStoreWithoutKey refuses a shared session store configured without a
+// session encryption key: every original would reach the store, over plain
+// TCP, in plaintext.
+var ErrStoreWithoutKey = errors.New("sessionStoreURL requires sessionEncryptionKey, or originals would leave the process in plaintext")
+
+// NewSessionStore returns the shared session store cfg.SessionStoreURL
+// names, or nil when it is empty. It fails for an invalid URL or key, and
+// with ErrStoreWithoutKey when no key is set.
+func NewSessionStore(cfg *config.Config) (anonymizer.SessionStore, error) {
+	if cfg.SessionStoreURL == "" {
+		return nil, nil
+	}
+	key, err := anonymizer.DecodeEncryptionKey(cfg.SessionEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrStoreWithoutKey
+	}
+	rs, err := anonymizer.NewRedisSessionStore(cfg.SessionStoreURL)
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// AnonymizerOptions maps cfg onto the anonymizer options the proxy runs
+// with. The scan command builds its detector from the same mapping so a
+// corpus is checked against exactly the patterns the proxy would load.
+func AnonymizerOptions(cfg *config.Config, m *metrics.Metrics) anonymizer.Options {
+	// main validates the key at startup; a bad key here only disables encryption.
+	encKey, err := anonymizer.DecodeEncryptionKey(cfg.SessionEncryptionKey)
+	if err != nil {
+		newLogger("PROXY", cfg).Warnf("config", "%v", err)
+	}
+	// Validated by main too; a bad URL or a missing key here keeps sessions
+	// in process.
+	store, err := NewSessionStore(cfg)
+	if err != nil {
+		newLogger("PROXY", cfg).Errorf("config", "%v; sessions stay in process", err)
+	}
+	return anonymizer.Options{
+		OllamaEndpoint:      cfg.OllamaEndpoint,
+		OllamaModel:         cfg.OllamaModel,
+		OllamaHeaders:       cfg.OllamaHeaders,
+		OllamaTypeDenylist:  cfg.OllamaTypeDenylist,
+		Allowlist:           cfg.Allowlist,
+		UseAI:               cfg.UseAIDetection,
+		AIThreshold:         cfg.AIConfidence,
+		MinConfidence:       cfg.MinConfidence,
+		OllamaMaxConcurrent: cfg.OllamaMaxConcurrent,
+		OllamaDispatchDelay: time.Duration(cfg.OllamaDispatchDelayMs) * time.Millisecond,
+		OllamaBatchWindow:   time.Duration(cfg.OllamaBatchWindowMs) * time.Millisecond,
+		Metrics:             m,
+		CachePath:           cfg.OllamaCacheFile,
+		CacheCapacity:       50_000,
+		CacheSRatio:         cfg.CacheSRatio,
+		EnabledPacks:        cfg.EnabledPacks,
+		CodeBlockPacks:      cfg.CodeBlockPacks,
+		PatternProfiles:     patternProfiles(cfg.PatternProfiles),
+		PackDecayRate:       cfg.PackDecayRate,
+		EncryptionKey:       encKey,
+		TokenSalt:           cfg.TokenSalt,
+		MaxSessions:         cfg.MaxSessions,
+		MaxTokensPerRequest: cfg.MaxTokensPerRequest,
+		PreserveJSONFormat:  cfg.PreserveJSONFormat,
+		IndexRepeatedTokens: cfg.IndexRepeatedTokens,
+		TokenStrippedNotice: cfg.TokenStrippedNotice,
+		RetryCacheTTL:       time.Duration(cfg.RetryCacheSecs) * time.Second,
+		SessionTTL:          time.Duration(cfg.SessionTTLSecs) * time.Second,
+		SessionStore:        store,
+		ShadowSampleRate:    cfg.ShadowSampleRate,
+		LogLevel:            cfg.LogLevel,
+		LogFormat:           cfg.LogFormat,
+		TokenLogSampleRate:  cfg.TokenLogSampleRate,
+		MRNPrefixes:         cfg.MRNPrefixes,
+		SecretTokenPrefixes: cfg.SecretTokenPrefixes,
+		APIKeyMinLength:     cfg.APIKeyMinLength,
+		NationalIDCountries: cfg.NationalIDCountries,
+		DetectTimestamps:    cfg.DetectTimestamps,
+		NormalizeUnicode:    cfg.NormalizeUnicode,
+		SeparateInstruction: cfg.InstructionInjectionMode == "separate",
+		CustomPatterns:      customPatterns(cfg.CustomPatterns),
+		PreserveSuffix:      preserveSuffix(cfg.PreserveSuffix),
+		TypePolicies:        typePolicies(cfg.TypePolicies),
+	}
 }
 
 // New creates and configures a new proxy server.
@@ -161,25 +273,29 @@ func New(cfg *config.Config, domains *management.DomainRegistry, m *metrics.Metr
 	s := &Server{
 		cfg: cfg,
 		anon: func() *anonymizer.Anonymizer {
-			a := anonymizer.NewWithCacheAndCapacity(anonymizer.Options{
-				OllamaEndpoint:      cfg.OllamaEndpoint,
-				OllamaModel:         cfg.OllamaModel,
-				UseAI:               cfg.UseAIDetection,
-				AIThreshold:         cfg.AIConfidence,
-				OllamaMaxConcurrent: cfg.OllamaMaxConcurrent,
-				Metrics:             m,
-				CachePath:           cfg.OllamaCacheFile,
-				CacheCapacity:       50_000,
-				EnabledPacks:        cfg.EnabledPacks,
-				PackDecayRate:       cfg.PackDecayRate,
-			})
+			a := anonymizer.NewWithCacheAndCapacity(AnonymizerOptions(cfg, m))
 			a.SetPIIInstructions(cfg.PIIInstructions)
 			return a
 		}(),
-		m:           m,
-		aiDomains:   domains,
-		authDomains: toSet(cfg.AuthDomains),
-		authPaths:   toSet(cfg.AuthPaths),
+		m:               m,
+		aiDomains:       domains,
+		authDomains:     toSet(cfg.AuthDomains),
+		authPaths:       toSet(cfg.AuthPaths),
+		profiles:        compileDomainProfiles(cfg.DomainProfiles),
+		anonTypes:       lowerAll(cfg.AnonymizeContentTypes),
+		maxRequestBody:  bodyLimit(cfg.MaxRequestBodyMB),
+		maxRespBuffer:   int64(cfg.MaxResponseBufferKB) << 10,
+		maxRespBody:     bodyLimit(cfg.MaxResponseBodyMB),
+		upstreamTimeout: time.Duration(cfg.UpstreamTimeoutSecs) * time.Second,
+		log:             newLogger("PROXY", cfg),
+		mitmLog:         newLogger("MITM", cfg),
+	}
+	s.bypassUA = compileUserAgentMatchers(cfg.BypassUserAgents, s.log)
+	if cfg.DryRun {
+		s.log.Warn("dry_run", "Dry run: AI-domain requests are forwarded unmodified; detections are only logged and counted")
+	}
+	if cfg.MaxConcurrentAnonymizations > 0 {
+		s.anonSlots = make(chan struct{}, cfg.MaxConcurrentAnonymizations)
 	}
 
 	// The custom DialContext enforces SSRF protection at connection time,
@@ -189,7 +305,7 @@ func New(cfg *config.Config, domains *management.DomainRegistry, m *metrics.Metr
 		KeepAlive: 30 * time.Second,
 	}
 
-	safeDial := ssrfSafeDialContext(dialer)
+	safeDial := ssrfSafeDialContext(dialer, s.log)
 	s.dialContext = safeDial
 
 	// ProxyFromEnvironment picks up HTTP_PROXY / HTTPS_PROXY / NO_PROXY.
@@ -203,14 +319,20 @@ func New(cfg *config.Config, domains *management.DomainRegistry, m *metrics.Metr
 		ForceAttemptHTTP2:     true,
 	}
 
+	if al, err := newAccessLog(cfg.AccessLogFormat, cfg.AccessLogFile); err != nil {
+		s.log.Warnf("access_log", "Access log disabled: %v", err)
+	} else {
+		s.accessLog = al
+	}
+
 	// Load or auto-generate CA for MITM TLS termination
 	if cfg.CACertFile != "" && cfg.CAKeyFile != "" {
-		ca, err := mitm.LoadOrGenerateCA(cfg.CACertFile, cfg.CAKeyFile)
+		ca, err := mitm.LoadOrGenerateCA(cfg.CACertFile, cfg.CAKeyFile, s.mitmLog)
 		if err != nil {
-			log.Printf("[PROXY] MITM disabled: %v", err)
+			s.log.Warnf("mitm_setup", "MITM disabled: %v", err)
 		} else {
 			s.ca = ca
-			log.Printf("[PROXY] MITM TLS interception enabled for AI API domains")
+			s.log.Info("mitm_setup", "MITM TLS interception enabled for AI API domains")
 		}
 	}
 
@@ -220,16 +342,64 @@ func New(cfg *config.Config, domains *management.DomainRegistry, m *metrics.Metr
 // Close releases resources held by the proxy server, including the persistent
 // Ollama cache. Must be called on shutdown.
 func (s *Server) Close() error {
+	if err := s.accessLog.Close(); err != nil {
+		s.log.Errorf("access_log", "Access log close error: %v", err)
+	}
 	return s.anon.Close()
 }
 
+// CacheStats reports the anonymizer's Ollama value cache fill. See
+// anonymizer.Anonymizer.CacheStats.
+func (s *Server) CacheStats() (entries, capacity int) {
+	return s.anon.CacheStats()
+}
+
+// CacheHealth reports whether the anonymizer's persistent cache is usable.
+// See anonymizer.Anonymizer.CacheHealth.
+func (s *Server) CacheHealth() error {
+	return s.anon.CacheHealth()
+}
+
+// PIITypes reports the anonymizer's PII types and their detection status.
+// See anonymizer.Anonymizer.PIITypes.
+func (s *Server) PIITypes() []anonymizer.PIITypeInfo {
+	return s.anon.PIITypes()
+}
+
+// SessionMappings returns the token → original map of an open session.
+// See anonymizer.Anonymizer.SessionMappings.
+func (s *Server) SessionMappings(sessionID string) (map[string]string, bool) {
+	return s.anon.SessionMappings(sessionID)
+}
+
+// SessionStats lists the anonymizer's sessions without their contents.
+// See anonymizer.Anonymizer.SessionStats.
+func (s *Server) SessionStats() []anonymizer.SessionStat {
+	return s.anon.SessionStats()
+}
+
+// ApplyConfig applies the hot-reloadable settings of a reloaded config: the
+// AI confidence threshold, the PII instructions and the log level. The
+// anonymizer gets them as one anonymizer.Settings, so no request sees a mix
+// of old and new. Every other field of cfg is ignored; the server keeps its
+// startup config.
+func (s *Server) ApplyConfig(cfg *config.Config) {
+	s.anon.ApplySettings(anonymizer.Settings{
+		AIThreshold:     cfg.AIConfidence,
+		PIIInstructions: cfg.PIIInstructions,
+		LogLevel:        cfg.LogLevel,
+	})
+	s.log.SetLevel(cfg.LogLevel)
+	s.mitmLog.SetLevel(cfg.LogLevel)
+}
+
 // ServeHTTP dispatches incoming proxy requests.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodConnect {
 		s.handleTunnel(w, r)
 		return
 	}
-	s.handleHTTP(w, r)
+	s.withAccessLog(w, r, s.handleHTTP)
 }
 
 // handleTunnel dispatches CONNECT requests: MITM intercept for AI domains,
@@ -264,11 +434,11 @@ type mitmContext struct {
 // reads the plaintext HTTP request, anonymizes it, and forwards upstream.
 func (s *Server) handleMITMTunnel(w http.ResponseWriter, r *http.Request, host, domain string) {
 	remoteHash := hashRemoteAddr(r.RemoteAddr)
-	log.Printf("[MITM] %s Intercepting CONNECT %s", remoteHash, host)
+	s.mitmLog.Infof("connect", "%s Intercepting CONNECT %s", remoteHash, host)
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		log.Printf("[MITM] %s Hijacking not supported for %s", remoteHash, host)
+		s.mitmLog.Warnf("connect", "%s Hijacking not supported for %s", remoteHash, host)
 		s.handleOpaqueTunnel(w, r, host)
 		return
 	}
@@ -278,7 +448,7 @@ func (s *Server) handleMITMTunnel(w http.ResponseWriter, r *http.Request, host,
 
 	clientConn, _, err := hijacker.Hijack()
 	if err != nil {
-		log.Printf("[MITM] %s Hijack error for %s: %v", remoteHash, host, err)
+		s.mitmLog.Errorf("connect", "%s Hijack error for %s: %v", remoteHash, host, err)
 		return
 	}
 	defer func() { _ = clientConn.Close() }()
@@ -286,7 +456,9 @@ func (s *Server) handleMITMTunnel(w http.ResponseWriter, r *http.Request, host,
 	// Build a handler that anonymizes and forwards requests
 	ctx := mitmContext{host: host, domain: domain, remoteHash: remoteHash}
 	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		s.serveMITMRequest(rw, req, ctx)
+		s.withAccessLog(rw, req, func(rw http.ResponseWriter, req *http.Request) {
+			s.serveMITMRequest(rw, req, ctx)
+		})
 	})
 
 	// Perform TLS handshake and serve HTTP/1.1 or HTTP/2
@@ -301,9 +473,10 @@ func (s *Server) serveMITMRequest(rw http.ResponseWriter, req *http.Request, ctx
 	req.RequestURI = ""
 
 	isAuth := s.isAuthRequest(ctx.domain, req.URL.Path)
-	s.recordMITMMetrics(isAuth)
+	anonOff := s.aiDomains.AnonymizationDisabled(ctx.domain)
+	s.recordMITMMetrics(ctx.domain, isAuth, isGRPCRequest(req), anonOff, s.isBypassUserAgent(req), !s.scansContentType(req))
 
-	sessionID, ok := s.processMITMRequestBody(rw, req, ctx, isAuth)
+	sessionID, ok := s.processMITMRequestBody(rw, req, ctx, isAuth, anonOff)
 	if !ok {
 		return // error already sent to client
 	}
@@ -314,36 +487,69 @@ func (s *Server) serveMITMRequest(rw http.ResponseWriter, req *http.Request, ctx
 	s.forwardMITMRequest(rw, req, sessionID, ctx.domain)
 }
 
-// recordMITMMetrics records metrics for a MITM request.
-func (s *Server) recordMITMMetrics(isAuth bool) {
+// recordMITMMetrics records metrics for a MITM request. MITM is only done
+// for AI domains, so every request is counted for its domain.
+func (s *Server) recordMITMMetrics(domain string, isAuth, isGRPC, anonOff, bypassUA, otherType bool) {
 	if s.m == nil {
 		return
 	}
 	s.m.RequestsTotal.Add(1)
-	if isAuth {
+	s.m.RecordDomainRequest(domain)
+	switch {
+	case isAuth:
 		s.m.RequestsAuth.Add(1)
-	} else {
+	case isGRPC:
+		s.m.RequestsOpaque.Add(1)
+	case anonOff:
+		s.m.RequestsAnonOff.Add(1)
+	case bypassUA:
+		s.m.RequestsPassthrough.Add(1)
+	case otherType:
+		s.m.RequestsContentType.Add(1)
+	default:
 		s.m.RequestsAnonymized.Add(1)
 	}
 }
 
 // processMITMRequestBody anonymizes the request body for non-auth requests.
-// Returns (sessionID, true) on success, ("", true) for auth pass-through,
-// or ("", false) on error (error response already sent to client).
-func (s *Server) processMITMRequestBody(rw http.ResponseWriter, req *http.Request, ctx mitmContext, isAuth bool) (string, bool) {
+// Returns (sessionID, true) on success, ("", true) for auth pass-through, a
+// domain with anonymization paused, a bypassed User-Agent or a body type not
+// on the allowlist, or ("", false) on error (error response already sent to
+// client).
+func (s *Server) processMITMRequestBody(rw http.ResponseWriter, req *http.Request, ctx mitmContext, isAuth, anonOff bool) (string, bool) {
 	if isAuth {
-		log.Printf("[MITM] %s %s %s%s [AUTH][PASS]", ctx.remoteHash, req.Method, ctx.domain, req.URL.Path)
+		s.mitmLog.Infof("request", "%s %s %s%s [AUTH][PASS]", ctx.remoteHash, req.Method, ctx.domain, req.URL.Path)
+		return "", true
+	}
+	if isGRPCRequest(req) {
+		s.mitmLog.Infof("request", "%s %s %s%s [GRPC][PASS] binary framing, body not anonymized", ctx.remoteHash, req.Method, ctx.domain, req.URL.Path)
+		return "", true
+	}
+	if anonOff {
+		s.mitmLog.Infof("request", "%s %s %s%s [ANON-OFF][PASS] anonymization paused for domain", ctx.remoteHash, req.Method, ctx.domain, req.URL.Path)
+		return "", true
+	}
+	if s.isBypassUserAgent(req) {
+		s.mitmLog.Infof("request", "%s %s %s%s [UA-BYPASS][PASS]", ctx.remoteHash, req.Method, ctx.domain, req.URL.Path)
+		return "", true
+	}
+	if !s.scansContentType(req) {
+		s.mitmLog.Infof("request", "%s %s %s%s [CONTENT-TYPE][PASS] %s not in anonymizeContentTypes",
+			ctx.remoteHash, req.Method, ctx.domain, req.URL.Path, mediaType(req.Header))
 		return "", true
 	}
 
-	sessionID, err := s.anonymizeRequestBody(req)
+	sessionID, err := s.anonymizeRequest(req)
+	if errors.Is(err, ErrClientDisconnected) {
+		return "", false
+	}
 	if err != nil {
-		log.Printf("[MITM] %s Anonymization error for %s: %v", ctx.remoteHash, ctx.domain, err)
-		http.Error(rw, "payload too large", http.StatusRequestEntityTooLarge)
+		s.mitmLog.Errorf("anonymize", "%s Anonymization error for %s: %v", ctx.remoteHash, ctx.domain, err)
+		s.writeAnonymizeError(rw, ctx.domain, err)
 		return "", false
 	}
 
-	log.Printf("[MITM] %s %s %s%s [ANON] sessionID=%s tokens=%d",
+	s.mitmLog.Infof("request", "%s %s %s%s [ANON] sessionID=%s tokens=%d",
 		ctx.remoteHash, req.Method, ctx.domain, req.URL.Path, sessionID, s.anon.SessionTokenCount(sessionID))
 	return sessionID, true
 }
@@ -351,13 +557,14 @@ func (s *Server) processMITMRequestBody(rw http.ResponseWriter, req *http.Reques
 // forwardMITMRequest forwards the request upstream and writes the response.
 func (s *Server) forwardMITMRequest(rw http.ResponseWriter, req *http.Request, sessionID string, domain string) {
 	removeHopByHop(req.Header)
+	if sessionID != "" {
+		restrictAcceptEncoding(req.Header)
+	}
 	upstreamStart := time.Now()
-	resp, err := s.transport.RoundTrip(req)
+	resp, stop, err := s.roundTrip(req)
+	defer stop()
 	if err != nil {
-		if s.m != nil {
-			s.m.ErrorsUpstream.Add(1)
-		}
-		http.Error(rw, errBadGateway, http.StatusBadGateway)
+		s.writeUpstreamError(rw, domain, err)
 		return
 	}
 	if s.m != nil {
@@ -372,14 +579,15 @@ func (s *Server) forwardMITMRequest(rw http.ResponseWriter, req *http.Request, s
 	copyHeader(rw.Header(), resp.Header)
 	rw.WriteHeader(resp.StatusCode)
 	flushingCopy(rw, resp.Body)
+	copyTrailers(rw, resp)
 }
 
 // handleOpaqueTunnel establishes a TCP tunnel without inspecting the traffic.
 func (s *Server) handleOpaqueTunnel(w http.ResponseWriter, r *http.Request, host string) {
-	log.Printf("[TUNNEL] %s CONNECT %s", hashRemoteAddr(r.RemoteAddr), host)
+	s.log.Infof("tunnel", "%s CONNECT %s", hashRemoteAddr(r.RemoteAddr), host)
 
 	if isPrivateHost(host) {
-		log.Printf("[TUNNEL] %s Blocked CONNECT to private address: %s", hashRemoteAddr(r.RemoteAddr), host)
+		s.log.Warnf("ssrf_block", "%s Blocked CONNECT to private address: %s", hashRemoteAddr(r.RemoteAddr), host)
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
@@ -389,7 +597,7 @@ func (s *Server) handleOpaqueTunnel(w http.ResponseWriter, r *http.Request, host
 	defer cancel()
 	destConn, err := s.dialContext(ctx, "tcp", host)
 	if err != nil {
-		log.Printf("[TUNNEL] %s Connection failed for %s: %v", hashRemoteAddr(r.RemoteAddr), host, err)
+		s.log.Errorf("tunnel", "%s Connection failed for %s: %v", hashRemoteAddr(r.RemoteAddr), host, err)
 		http.Error(w, errBadGateway, http.StatusBadGateway)
 		return
 	}
@@ -405,7 +613,7 @@ func (s *Server) handleOpaqueTunnel(w http.ResponseWriter, r *http.Request, host
 
 	clientConn, _, err := hijacker.Hijack()
 	if err != nil {
-		log.Printf("[TUNNEL] %s Hijack error for %s: %v", hashRemoteAddr(r.RemoteAddr), host, err)
+		s.log.Errorf("tunnel", "%s Hijack error for %s: %v", hashRemoteAddr(r.RemoteAddr), host, err)
 		return
 	}
 	defer func() { _ = clientConn.Close() }()
@@ -431,13 +639,26 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 
 	isAuth := s.isAuthRequest(domain, r.URL.Path)
 	isAI := s.aiDomains.Has(domain)
+	isGRPC := isAI && !isAuth && isGRPCRequest(r)
+	anonOff := isAI && !isAuth && !isGRPC && s.aiDomains.AnonymizationDisabled(domain)
+	bypassUA := isAI && !isAuth && !isGRPC && !anonOff && s.isBypassUserAgent(r)
+	otherType := isAI && !isAuth && !isGRPC && !anonOff && !bypassUA && !s.scansContentType(r)
 
 	if s.m != nil {
 		s.m.RequestsTotal.Add(1)
+		if isAI {
+			s.m.RecordDomainRequest(domain)
+		}
 		switch {
 		case isAuth:
 			s.m.RequestsAuth.Add(1)
-		case isAI:
+		case isGRPC:
+			s.m.RequestsOpaque.Add(1)
+		case anonOff:
+			s.m.RequestsAnonOff.Add(1)
+		case otherType:
+			s.m.RequestsContentType.Add(1)
+		case isAI && !bypassUA:
 			s.m.RequestsAnonymized.Add(1)
 		default:
 			s.m.RequestsPassthrough.Add(1)
@@ -446,23 +667,37 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Anonymize body only for AI API requests that are not auth
 	var sessionID string
-	if isAI && !isAuth {
+	if isGRPC {
+		s.log.Infof("http_request", "%s %s %s%s [GRPC][PASS] binary framing, body not anonymized",
+			hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
+	} else if anonOff {
+		s.log.Infof("http_request", "%s %s %s%s [ANON-OFF][PASS] anonymization paused for domain",
+			hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
+	} else if bypassUA {
+		s.log.Infof("http_request", "%s %s %s%s [UA-BYPASS][PASS]", hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
+	} else if otherType {
+		s.log.Infof("http_request", "%s %s %s%s [CONTENT-TYPE][PASS] %s not in anonymizeContentTypes",
+			hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path, mediaType(r.Header))
+	} else if isAI && !isAuth {
 		var err error
-		sessionID, err = s.anonymizeRequestBody(r)
+		sessionID, err = s.anonymizeRequest(r)
+		if errors.Is(err, ErrClientDisconnected) {
+			return
+		}
 		if err != nil {
-			log.Printf("[HTTP] %s Anonymization error for %s: %v", hashRemoteAddr(r.RemoteAddr), domain, err)
-			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			s.log.Errorf("anonymize", "%s Anonymization error for %s: %v", hashRemoteAddr(r.RemoteAddr), domain, err)
+			s.writeAnonymizeError(w, domain, err)
 			return
 		}
 		if sessionID != "" {
 			defer s.anon.DeleteSession(sessionID)
 		}
-		log.Printf("[HTTP] %s %s %s%s [ANON] sessionID=%s tokens=%d",
+		s.log.Infof("http_request", "%s %s %s%s [ANON] sessionID=%s tokens=%d",
 			hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path, sessionID, s.anon.SessionTokenCount(sessionID))
 	} else if isAuth {
-		log.Printf("[HTTP] %s %s %s%s [AUTH][PASS]", hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
+		s.log.Infof("http_request", "%s %s %s%s [AUTH][PASS]", hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
 	} else {
-		log.Printf("[HTTP] %s %s %s%s [PASS]", hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
+		s.log.Infof("http_request", "%s %s %s%s [PASS]", hashRemoteAddr(r.RemoteAddr), r.Method, domain, r.URL.Path)
 	}
 
 	// Forward the request
@@ -479,21 +714,22 @@ func (s *Server) forward(w http.ResponseWriter, r *http.Request, sessionID strin
 	}
 
 	if isPrivateHost(r.URL.Host) {
-		log.Printf("[HTTP] %s Blocked request to private address: %s", hashRemoteAddr(r.RemoteAddr), r.URL.Host)
-		http.Error(w, "forbidden", http.StatusForbidden)
+		s.log.Warnf("ssrf_block", "%s Blocked request to private address: %s", hashRemoteAddr(r.RemoteAddr), r.URL.Host)
+		s.writeError(w, domain, http.StatusForbidden, errTypeForbidden, "forbidden")
 		return
 	}
 
 	// Strip hop-by-hop headers
 	r.RequestURI = ""
 	removeHopByHop(r.Header)
+	if sessionID != "" {
+		restrictAcceptEncoding(r.Header)
+	}
 	upstreamStart := time.Now()
-	resp, err := s.transport.RoundTrip(r)
+	resp, stop, err := s.roundTrip(r)
+	defer stop()
 	if err != nil {
-		if s.m != nil {
-			s.m.ErrorsUpstream.Add(1)
-		}
-		http.Error(w, errBadGateway, http.StatusBadGateway)
+		s.writeUpstreamError(w, domain, err)
 		return
 	}
 	if s.m != nil {
@@ -508,9 +744,66 @@ func (s *Server) forward(w http.ResponseWriter, r *http.Request, sessionID strin
 	copyHeader(w.Header(), resp.Header)
 	w.WriteHeader(resp.StatusCode)
 	flushingCopy(w, resp.Body)
+	copyTrailers(w, resp)
+}
+
+// errUpstreamTimeout cancels an upstream exchange that ran past
+// cfg.UpstreamTimeoutSecs.
+var errUpstreamTimeout = errors.New("upstream timeout")
+
+// roundTrip sends req upstream under s.upstreamTimeout. The deadline covers
+// the wait for response headers and, for anything but an SSE stream or a
+// gRPC call, the whole body; those are long-lived by design (a gRPC stream
+// may run for hours) and are released from it as soon as headers are in.
+// The caller must call stop once done with the response, error or not.
+func (s *Server) roundTrip(req *http.Request) (resp *http.Response, stop func(), err error) {
+	if s.upstreamTimeout <= 0 {
+		resp, err = s.transport.RoundTrip(req)
+		return resp, func() {}, err
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(s.upstreamTimeout, func() { cancel(errUpstreamTimeout) })
+	stop = func() {
+		timer.Stop()
+		cancel(nil)
+	}
+	resp, err = s.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if errors.Is(context.Cause(ctx), errUpstreamTimeout) {
+			err = fmt.Errorf("%w after %s: %w", errUpstreamTimeout, s.upstreamTimeout, err)
+		}
+		return nil, stop, err
+	}
+	if isStreamingResponse(resp) || isGRPCRequest(req) {
+		timer.Stop()
+	}
+	return resp, stop, nil
 }
 
-const maxRequestBody = 50 << 20 // 50 MB
+// writeUpstreamError answers a failed upstream request: 504 when it ran past
+// the upstream timeout, 502 otherwise.
+func (s *Server) writeUpstreamError(w http.ResponseWriter, domain string, err error) {
+	if s.m != nil {
+		s.m.ErrorsUpstream.Add(1)
+	}
+	if errors.Is(err, errUpstreamTimeout) {
+		s.log.Warnf("upstream", "%s: %v", domain, err)
+		s.writeError(w, domain, http.StatusGatewayTimeout, errTypeUpstream, "upstream timed out")
+		return
+	}
+	s.writeError(w, domain, http.StatusBadGateway, errTypeUpstream, errBadGateway)
+}
+
+const defaultMaxBody = 50 << 20 // 50 MB
+
+// bodyLimit converts cfg.MaxRequestBodyMB or cfg.MaxResponseBodyMB to bytes;
+// 0 or less means defaultMaxBody.
+func bodyLimit(mb int) int64 {
+	if mb <= 0 {
+		return defaultMaxBody
+	}
+	return int64(mb) << 20
+}
 
 // randRead fills b with cryptographically secure random bytes. It is a package
 // var so tests can inject a failing reader to exercise the timestamp fallback;
@@ -518,86 +811,472 @@ const maxRequestBody = 50 << 20 // 50 MB
 // return one in-process.
 var randRead = rand.Read
 
+// newSessionID returns a random 16-hex-char session identifier, falling back
+// to a nanosecond timestamp if the system random source fails.
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := randRead(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// anonymizeRequestPath tokenizes PII in the request URL path when
+// cfg.AnonymizePaths is enabled. It reuses sessionID when the body already
+// opened a session; otherwise a new session is created and kept only if the
+// path actually contained PII. Returns the session ID the caller must clean up
+// ("" when no tokens were recorded). Callers only invoke this for non-auth
+// AI-domain requests. The only error is anonymizer.ErrTooManySessions. In a
+// dry run the path is left as it is.
+func (s *Server) anonymizeRequestPath(r *http.Request, sessionID string) (string, error) {
+	if !s.cfg.AnonymizePaths || s.cfg.DryRun || r.URL == nil {
+		return sessionID, nil
+	}
+	pathSession := sessionID
+	if pathSession == "" {
+		pathSession = newSessionID()
+		if err := s.anon.BeginSessionProfile(pathSession, s.profiles.lookup(requestDomain(r))); err != nil {
+			return "", err
+		}
+	}
+	anonymized := s.anon.AnonymizePath(r.URL.Path, pathSession)
+	if anonymized == r.URL.Path {
+		if pathSession != sessionID {
+			s.anon.DeleteSession(pathSession)
+		}
+		return sessionID, nil
+	}
+	r.URL.Path = anonymized
+	r.URL.RawPath = "" // force re-encoding from the rewritten Path
+	return pathSession, nil
+}
+
+// errTooManyTokens rejects a request whose PII match count exceeds
+// cfg.MaxTokensPerRequest under the "reject" overTokenPolicy.
+var errTooManyTokens = errors.New("too many PII matches in request")
+
+// enforceTokenLimit applies cfg.OverTokenPolicy once a request has been fully
+// anonymized. Under "reject" the session is discarded and errTooManyTokens is
+// returned; under "stop" the request proceeds with the excess matches left as
+// they were, which is logged since that PII reaches the upstream.
+func (s *Server) enforceTokenLimit(sessionID string) error {
+	over := s.anon.TokensOverLimit(sessionID)
+	if over == 0 {
+		return nil
+	}
+	if s.cfg.OverTokenPolicy == "stop" {
+		s.log.Warnf("token_limit", "sessionID=%s %d PII matches over maxTokensPerRequest=%d forwarded unmasked",
+			sessionID, over, s.cfg.MaxTokensPerRequest)
+		return nil
+	}
+	s.anon.DeleteSession(sessionID)
+	return fmt.Errorf("%w: %d over maxTokensPerRequest=%d", errTooManyTokens, over, s.cfg.MaxTokensPerRequest)
+}
+
+// ErrBodyTooLarge rejects a request body over the configured maxRequestBodyMB.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrBodyRead reports that the client's request body could not be read, for
+// example because the connection dropped mid-upload.
+var ErrBodyRead = errors.New("reading request body")
+
+// ErrClientDisconnected reports that the client closed the connection before
+// its request was anonymized. There is nobody left to send a response to.
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// errAnonymizeBusy rejects a request that found every anonymization slot
+// taken for the whole of cfg.AnonymizeQueueMs.
+var errAnonymizeBusy = errors.New("all anonymization slots busy")
+
+// acquireAnonSlot takes one of the cfg.MaxConcurrentAnonymizations slots,
+// waiting up to cfg.AnonymizeQueueMs or until ctx ends. The returned release
+// must be called when the anonymization is done.
+func (s *Server) acquireAnonSlot(ctx context.Context) (release func(), err error) {
+	if s.anonSlots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-s.anonSlots }
+	select {
+	case s.anonSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	wait := time.Duration(s.cfg.AnonymizeQueueMs) * time.Millisecond
+	if wait <= 0 {
+		return nil, errAnonymizeBusy
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s.anonSlots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errAnonymizeBusy
+	case <-ctx.Done():
+		return nil, errAnonymizeBusy
+	}
+}
+
+// writeAnonymizeError maps an anonymization failure to a client response:
+// 503 with Retry-After when the session limit is reached or no anonymization
+// slot freed up in time, 400 when the body could not be read, 413 for an
+// oversized body or too many PII matches, and 500 for any other failure.
+func (s *Server) writeAnonymizeError(w http.ResponseWriter, domain string, err error) {
+	switch {
+	case errors.Is(err, anonymizer.ErrTooManySessions), errors.Is(err, errAnonymizeBusy):
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, domain, http.StatusServiceUnavailable, errTypeBusy, "proxy busy, retry later")
+	case errors.Is(err, errTooManyTokens):
+		s.writeError(w, domain, http.StatusRequestEntityTooLarge, errTypeTooLarge, "request contains too many PII values")
+	case errors.Is(err, ErrClientDisconnected):
+		// Nothing to write; the connection is gone.
+	case errors.Is(err, ErrBodyRead):
+		s.writeError(w, domain, http.StatusBadRequest, errTypeBadRequest, "could not read request body")
+	case errors.Is(err, ErrBodyTooLarge):
+		s.writeError(w, domain, http.StatusRequestEntityTooLarge, errTypeTooLarge, "payload too large")
+	default:
+		s.writeError(w, domain, http.StatusInternalServerError, errTypeInternal, "anonymization failed")
+	}
+}
+
+// failOpen handles a capacity error hit after r's body was read. With
+// failClosed (the default) it returns err, so the request is refused. With
+// failClosed off it puts the original body back for forwarding and returns
+// nil.
+func (s *Server) failOpen(r *http.Request, body []byte, err error) error {
+	if s.cfg.FailClosed {
+		return err
+	}
+	s.log.Warnf("fail_open", "forwarding request body unanonymized (failClosed=false): %v", err)
+	if s.m != nil {
+		s.m.ErrorsAnonymize.Add(1)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+// anonymizeRequest anonymizes r's body and path and applies the token limit,
+// returning the session ID. On any error the session, if one was opened, is
+// deleted before returning.
+func (s *Server) anonymizeRequest(r *http.Request) (string, error) {
+	if s.cfg.DryRun {
+		return "", s.dryRunRequestBody(r)
+	}
+	sessionID, err := s.anonymizeRequestBody(r)
+	if err == nil {
+		var pathID string
+		if pathID, err = s.anonymizeRequestPath(r, sessionID); err == nil {
+			sessionID = pathID
+		}
+	}
+	if err == nil {
+		err = s.enforceTokenLimit(sessionID)
+	}
+	if err != nil {
+		s.anon.DeleteSession(sessionID)
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// anonymizeRequestBody buffers, anonymizes and replaces r's body, returning
+// the session ID ("" when there is no body). The body is read in full even
+// when the client streams it chunked: the PII instruction goes into the
+// system prompt, which can follow the content it covers, so AnonymizeJSON
+// needs the whole document.
 func (s *Server) anonymizeRequestBody(r *http.Request) (string, error) {
 	if r.Body == nil || r.ContentLength == 0 {
 		return "", nil
 	}
 
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxRequestBody+1))
 	_ = r.Body.Close() // body already read; close is best-effort
 	if err != nil {
+		if clientGone(r, err) {
+			return "", s.clientDisconnected(r, err)
+		}
 		if s.m != nil {
 			s.m.ErrorsAnonymize.Add(1)
 		}
-		return "", err
+		return "", fmt.Errorf("%w: %w", ErrBodyRead, err)
 	}
-	if int64(len(body)) > maxRequestBody {
-		return "", fmt.Errorf("request body exceeds %d bytes", maxRequestBody)
+	if int64(len(body)) > s.maxRequestBody {
+		return "", fmt.Errorf("%w: exceeds %d bytes", ErrBodyTooLarge, s.maxRequestBody)
 	}
 
-	var sessionID string
-	b := make([]byte, 8)
-	if _, err := randRead(b); err != nil {
-		sessionID = fmt.Sprintf("%d", time.Now().UnixNano())
-	} else {
-		sessionID = hex.EncodeToString(b)
+	release, err := s.acquireAnonSlot(r.Context())
+	if err != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return "", s.clientDisconnected(r, ctxErr)
+		}
+		return "", s.failOpen(r, body, err)
+	}
+	defer release()
+
+	sessionID := newSessionID()
+	if err := s.anon.BeginSessionProfile(sessionID, s.profiles.lookup(requestDomain(r))); err != nil {
+		return "", s.failOpen(r, body, err)
 	}
 
 	anonStart := time.Now()
-	anonymized := s.anon.AnonymizeJSON(body, sessionID)
+	anonymized := s.anonymizeBody(r, body, sessionID)
 	if s.m != nil {
 		s.m.RecordAnonLatency(time.Since(anonStart))
 	}
+	if err := r.Context().Err(); err != nil {
+		s.anon.DeleteSession(sessionID)
+		return "", s.clientDisconnected(r, err)
+	}
 
 	r.Body = io.NopCloser(bytes.NewReader(anonymized))
 	r.ContentLength = int64(len(anonymized))
 	return sessionID, nil
 }
 
+// anonymizeBody anonymizes body in session sessionID according to r's
+// Content-Type: part by part for multipart/form-data, whole otherwise. A
+// multipart body that fails to parse is scanned whole, as text.
+func (s *Server) anonymizeBody(r *http.Request, body []byte, sessionID string) []byte {
+	if boundary := multipartBoundary(r.Header); boundary != "" {
+		out, err := s.anonymizeMultipart(body, boundary, sessionID)
+		if err == nil {
+			return out
+		}
+		s.log.Warnf("multipart", "%s: malformed multipart body, scanning it whole: %v", requestDomain(r), err)
+	}
+	return s.anon.AnonymizeRequest(body, sessionID, isEventStream(r.Header))
+}
+
+// clientGone reports whether err, returned while reading r's body, means the
+// client closed the connection: either the request context was canceled or
+// the body ended before its declared length.
+func clientGone(r *http.Request, err error) bool {
+	return r.Context().Err() != nil || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// clientDisconnected counts and logs a client that went away mid-request and
+// returns the ErrClientDisconnected wrapping cause.
+func (s *Server) clientDisconnected(r *http.Request, cause error) error {
+	if s.m != nil {
+		s.m.ClientDisconnects.Add(1)
+	}
+	s.log.Infof("client_disconnect", "%s closed the connection during anonymization for %s",
+		hashRemoteAddr(r.RemoteAddr), requestDomain(r))
+	return fmt.Errorf("%w: %w", ErrClientDisconnected, cause)
+}
+
+// dryRunRequestBody counts and logs what r's body would have had masked and
+// leaves the body to be forwarded unchanged. No session is opened, so no
+// original is recorded anywhere. A dry run never refuses a request: a body
+// over maxRequestBodyMB, or one that finds every anonymization slot busy,
+// is forwarded without being scanned.
+func (s *Server) dryRunRequestBody(r *http.Request) error {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil
+	}
+	domain := requestDomain(r)
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxRequestBody+1))
+	if err != nil {
+		_ = r.Body.Close()
+		if clientGone(r, err) {
+			return s.clientDisconnected(r, err)
+		}
+		return fmt.Errorf("%w: %w", ErrBodyRead, err)
+	}
+	if int64(len(body)) > s.maxRequestBody {
+		s.log.Infof("dry_run", "%s: body over %d bytes, forwarded unscanned", domain, s.maxRequestBody)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil
+	}
+	_ = r.Body.Close() // body already read; close is best-effort
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	release, err := s.acquireAnonSlot(r.Context())
+	if err != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return s.clientDisconnected(r, ctxErr)
+		}
+		s.log.Infof("dry_run", "%s: no anonymization slot free, forwarded unscanned", domain)
+		return nil
+	}
+	defer release()
+
+	anonStart := time.Now()
+	counts := s.anon.CountDetections(body, s.profiles.lookup(domain))
+	if s.m != nil {
+		s.m.RecordAnonLatency(time.Since(anonStart))
+	}
+	s.logDryRun(counts, domain)
+	return nil
+}
+
+// logDryRun logs, by PII type, the tokens a dry-run request would have been
+// sent with.
+func (s *Server) logDryRun(counts map[anonymizer.PIIType]int, domain string) {
+	if len(counts) == 0 {
+		s.log.Infof("dry_run", "%s: nothing would be masked", domain)
+		return
+	}
+	parts := make([]string, 0, len(counts))
+	for _, t := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%s=%d", t, counts[t]))
+	}
+	s.log.Infof("dry_run", "%s: would mask %s", domain, strings.Join(parts, " "))
+}
+
 func (s *Server) deanonymizeResponseBody(resp *http.Response, sessionID string, domain string) {
 	if sessionID == "" || resp == nil || resp.Body == nil {
-		log.Printf("[DEANON] skipping: sessionID=%q resp=%v bodyNil=%v", sessionID, resp == nil, resp != nil && resp.Body == nil)
+		s.log.Debugf("deanon", "skipping: sessionID=%q resp=%v bodyNil=%v", sessionID, resp == nil, resp != nil && resp.Body == nil)
 		return
 	}
 
-	// Decompress the body before token replacement. The upstream may have
-	// compressed the response even if we sent Accept-Encoding: identity,
-	// so handle it defensively here.
-	if err := decompressResponse(resp); err != nil {
-		log.Printf("[DEANON] decompression error sessionID=%s: %v", sessionID, err)
+	// Decompress the body before token replacement: tokens cannot be found
+	// in compressed bytes. restrictAcceptEncoding keeps the upstream to
+	// codings decompressResponse handles, but a server may compress anyway.
+	if err := decompressResponse(resp, s.log); err != nil {
+		s.log.Errorf("deanon", "decompression error sessionID=%s: %v", sessionID, err)
 	}
 
 	ct := resp.Header.Get("Content-Type")
-	streaming := isStreamingResponse(resp)
-	log.Printf("[DEANON] sessionID=%s content-type=%q streaming=%v encoding=%q", sessionID, ct, streaming, resp.Header.Get(headerContentEncoding))
+	sse := isStreamingResponse(resp)
+	streaming := sse || s.exceedsResponseBuffer(resp)
+	s.log.Debugf("deanon", "sessionID=%s content-type=%q streaming=%v encoding=%q", sessionID, ct, streaming, resp.Header.Get(headerContentEncoding))
+	if s.m != nil {
+		if streaming {
+			s.m.ResponsesStreaming.Add(1)
+		} else {
+			s.m.ResponsesBuffered.Add(1)
+		}
+	}
 
 	// Streaming responses (SSE or unknown-length chunked) must never be fully
 	// buffered: io.ReadAll blocks until the upstream closes the connection.
 	// Wrap the body in a pipe-based reader that replaces tokens on-the-fly.
-	if streaming {
+	if sse {
 		resp.Body = s.anon.StreamingDeanonymize(resp.Body, sessionID, domain)
 		resp.ContentLength = -1 // length is unknown; let the client stream
 		return
 	}
+	// Plain bodies over maxResponseBufferKB have no event framing, so tokens
+	// can split at any byte; DeanonymizeStream holds back partial ones.
+	if streaming {
+		resp.Body = s.anon.DeanonymizeStream(resp.Body, sessionID)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length") // restored originals change the length
+		return
+	}
 
-	body, err := io.ReadAll(resp.Body)
-	_ = resp.Body.Close() // body already read; close is best-effort
+	body, err := io.ReadAll(io.LimitReader(resp.Body, s.maxRespBody+1))
 	if err != nil {
+		_ = resp.Body.Close() // best-effort; the body is replaced
 		resp.Body = http.NoBody
 		return
 	}
-	deanonymized := s.anon.DeanonymizeText(string(body), sessionID)
-	log.Printf("[DEANON] non-streaming: body=%d bytes, deanon=%d bytes", len(body), len(deanonymized))
+	if int64(len(body)) > s.maxRespBody {
+		s.passTruncated(resp, body, sessionID)
+		return
+	}
+	_ = resp.Body.Close() // body already read; close is best-effort
+	// Only successful replies count toward token fidelity and the
+	// stripped-token check; error bodies never echo the request's tokens.
+	var deanonymized string
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		deanonymized = s.anon.DeanonymizeResponse(string(body), sessionID)
+	} else {
+		deanonymized = s.anon.DeanonymizeText(string(body), sessionID)
+	}
+	s.log.Debugf("deanon", "non-streaming: body=%d bytes, deanon=%d bytes", len(body), len(deanonymized))
 	resp.Body = io.NopCloser(strings.NewReader(deanonymized))
 	resp.ContentLength = int64(len(deanonymized))
 }
 
-// isStreamingResponse returns true for responses whose body must not be fully
-// buffered before forwarding.  SSE connections stay open indefinitely; chunked
-// responses with no Content-Length may also be long-lived.
+// passTruncated forwards a buffered response that outgrew maxResponseBodyMB
+// without holding it all in memory: the first maxRespBody bytes, already
+// read into body, are deanonymized and the rest of the body follows as
+// received. Tokens past the limit reach the client unrestored, so the
+// response is marked with headerDeanonTruncated. A token cut in two by the
+// limit is left as it is, which is no worse. Token fidelity is not recorded
+// for a response only partly checked.
+func (s *Server) passTruncated(resp *http.Response, body []byte, sessionID string) {
+	head := s.anon.DeanonymizeText(string(body[:s.maxRespBody]), sessionID)
+	s.log.Warnf("deanon", "sessionID=%s response over maxResponseBodyMB (%d bytes); the rest is forwarded without deanonymization",
+		sessionID, s.maxRespBody)
+	if s.m != nil {
+		s.m.ResponseTruncatedDeanon.Add(1)
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(strings.NewReader(head), bytes.NewReader(body[s.maxRespBody:]), resp.Body), resp.Body}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set(headerDeanonTruncated, "true")
+}
+
+// exceedsResponseBuffer reports whether a non-SSE response should be
+// deanonymized as it streams: maxResponseBufferKB is set, the response is a
+// success, and its length is unknown or over the limit. Error bodies are
+// small and stay buffered.
+func (s *Server) exceedsResponseBuffer(resp *http.Response) bool {
+	if s.maxRespBuffer <= 0 || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false
+	}
+	return resp.ContentLength < 0 || resp.ContentLength > s.maxRespBuffer
+}
+
+// isGRPCRequest reports whether r carries gRPC framing (application/grpc,
+// application/grpc+proto, application/grpc-web, ...). Its length-prefixed
+// binary frames cannot be regex-scanned or rewritten without corrupting them,
+// so such requests are forwarded opaquely.
+func isGRPCRequest(r *http.Request) bool {
+	ct := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
+	return strings.HasPrefix(ct, "application/grpc")
+}
+
+// mediaType returns the lowercased media type of h's Content-Type, without
+// parameters such as charset.
+func mediaType(h http.Header) string {
+	ct, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// scansContentType reports whether r's body type is on the
+// anonymizeContentTypes allowlist. Entries are exact media types or a
+// "type/*" wildcard. A request without a Content-Type is scanned, as is
+// every request when the list is empty: an unlabeled body may still be
+// a prompt.
+func (s *Server) scansContentType(r *http.Request) bool {
+	mt := mediaType(r.Header)
+	if len(s.anonTypes) == 0 || mt == "" {
+		return true
+	}
+	for _, allowed := range s.anonTypes {
+		if allowed == mt || allowed == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(mt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStreamingResponse reports whether resp is an SSE stream, whose body must
+// not be fully buffered before forwarding: the connection stays open for as
+// long as the model keeps generating.
 func isStreamingResponse(resp *http.Response) bool {
-	ct := resp.Header.Get("Content-Type")
-	return strings.Contains(ct, "text/event-stream")
+	return isEventStream(resp.Header)
+}
+
+// isEventStream reports whether h declares an SSE (text/event-stream) body.
+// Some agent frameworks send their requests framed this way too.
+func isEventStream(h http.Header) bool {
+	return strings.Contains(h.Get("Content-Type"), "text/event-stream")
 }
 
 func (s *Server) isAuthRequest(domain, reqPath string) bool {
@@ -649,6 +1328,102 @@ func matchesAuthPath(cleanPath, authPath string) bool {
 	return false
 }
 
+// userAgentMatcher is one compiled bypassUserAgents entry: a regular
+// expression, or else a lowercased substring.
+type userAgentMatcher struct {
+	re  *regexp.Regexp
+	sub string
+}
+
+// compileUserAgentMatchers compiles bypassUserAgents entries. Entries wrapped
+// in slashes are regular expressions; an invalid one is logged and ignored
+// rather than failing startup.
+func compileUserAgentMatchers(entries []string, lg *logger.Logger) []userAgentMatcher {
+	var out []userAgentMatcher
+	for _, e := range entries {
+		if len(e) > 2 && strings.HasPrefix(e, "/") && strings.HasSuffix(e, "/") {
+			re, err := regexp.Compile(e[1 : len(e)-1])
+			if err != nil {
+				lg.Warnf("config", "Ignoring invalid bypassUserAgents pattern %q: %v", e, err)
+				continue
+			}
+			out = append(out, userAgentMatcher{re: re})
+			continue
+		}
+		if e != "" {
+			out = append(out, userAgentMatcher{sub: strings.ToLower(e)})
+		}
+	}
+	return out
+}
+
+// isBypassUserAgent reports whether r's User-Agent matches a bypassUserAgents
+// entry. A request without a User-Agent never matches.
+func (s *Server) isBypassUserAgent(r *http.Request) bool {
+	ua := r.UserAgent()
+	if ua == "" {
+		return false
+	}
+	lower := strings.ToLower(ua)
+	for _, m := range s.bypassUA {
+		if m.re != nil && m.re.MatchString(ua) || m.re == nil && strings.Contains(lower, m.sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainProfiles maps request domains to anonymizer pattern profiles.
+type domainProfiles struct {
+	exact map[string]string
+	globs []profileGlob // sorted by pattern, for a stable first match
+}
+
+type profileGlob struct {
+	glob    domainmatch.DomainGlob
+	profile string
+}
+
+// compileDomainProfiles splits domainProfiles entries into exact domains and
+// globs.
+func compileDomainProfiles(m map[string]string) domainProfiles {
+	dp := domainProfiles{exact: make(map[string]string)}
+	for _, pattern := range slices.Sorted(maps.Keys(m)) {
+		if domainmatch.IsGlob(pattern) {
+			dp.globs = append(dp.globs, profileGlob{glob: domainmatch.Parse(pattern), profile: m[pattern]})
+		} else {
+			dp.exact[domainmatch.NormalizeHost(pattern)] = m[pattern]
+		}
+	}
+	return dp
+}
+
+// lookup returns the pattern profile for domain: an exact entry first, then
+// the first matching glob, else anonymizer.DefaultProfile.
+func (dp domainProfiles) lookup(domain string) string {
+	if p, ok := dp.exact[domainmatch.NormalizeHost(domain)]; ok {
+		return p
+	}
+	for _, g := range dp.globs {
+		if g.glob.Match(domain) {
+			return g.profile
+		}
+	}
+	return anonymizer.DefaultProfile
+}
+
+// requestDomain returns the host r is addressed to, without the port.
+func requestDomain(r *http.Request) string {
+	host := r.Host
+	if host == "" && r.URL != nil {
+		host = r.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
 // ReverseProxy returns an httputil.ReverseProxy-based handler for testing.
 func (s *Server) ReverseProxy() *httputil.ReverseProxy {
 	return &httputil.ReverseProxy{
@@ -666,6 +1441,61 @@ func toSet(items []string) map[string]bool {
 	return m
 }
 
+func lowerAll(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, v := range items {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// preserveSuffix converts the config file's per-type suffix lengths to
+// anonymizer options.
+func preserveSuffix(m map[string]int) map[anonymizer.PIIType]int {
+	out := make(map[anonymizer.PIIType]int, len(m))
+	for t, n := range m {
+		out[anonymizer.PIIType(t)] = n
+	}
+	return out
+}
+
+// typePolicies converts the config file's per-type replacement policies to
+// anonymizer options; the anonymizer validates the policy names.
+func typePolicies(m map[string]string) map[anonymizer.PIIType]anonymizer.Policy {
+	out := make(map[anonymizer.PIIType]anonymizer.Policy, len(m))
+	for t, p := range m {
+		out[anonymizer.PIIType(t)] = anonymizer.Policy(p)
+	}
+	return out
+}
+
+// patternProfiles converts the config file's pattern profiles to anonymizer
+// options.
+func patternProfiles(m map[string]config.PatternProfile) map[string]anonymizer.PatternProfile {
+	out := make(map[string]anonymizer.PatternProfile, len(m))
+	for name, p := range m {
+		out[name] = anonymizer.PatternProfile{EnabledPacks: p.EnabledPacks, MinConfidence: p.MinConfidence}
+	}
+	return out
+}
+
+// customPatterns converts the config file's custom patterns to anonymizer
+// options.
+func customPatterns(list []config.CustomPattern) []anonymizer.CustomPattern {
+	out := make([]anonymizer.CustomPattern, 0, len(list))
+	for _, cp := range list {
+		out = append(out, anonymizer.CustomPattern{
+			Name:       cp.Name,
+			Regex:      cp.Regex,
+			PIIType:    cp.PIIType,
+			Confidence: cp.Confidence,
+		})
+	}
+	return out
+}
+
 var hopByHopHeaders = []string{
 	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
 	"Te", "Trailers", "Transfer-Encoding", "Upgrade", "Proxy-Connection",
@@ -685,10 +1515,46 @@ func copyHeader(dst, src http.Header) {
 	}
 }
 
+// copyTrailers forwards upstream response trailers (gRPC sends grpc-status
+// this way). Call after the body is fully copied so resp.Trailer is filled.
+func copyTrailers(w http.ResponseWriter, resp *http.Response) {
+	for k, vv := range resp.Trailer {
+		for _, v := range vv {
+			w.Header().Add(http.TrailerPrefix+k, v)
+		}
+	}
+}
+
+// decodableEncodings are the content codings decompressResponse can undo.
+var decodableEncodings = map[string]bool{"gzip": true, "deflate": true, "identity": true}
+
+// restrictAcceptEncoding removes the codings decompressResponse cannot undo,
+// such as br and zstd, from an anonymized request's Accept-Encoding, so the
+// upstream does not answer in a form whose tokens the proxy cannot restore.
+// A "*" entry goes too. If nothing is left the header is removed.
+func restrictAcceptEncoding(h http.Header) {
+	ae := h.Get("Accept-Encoding")
+	if ae == "" {
+		return
+	}
+	var keep []string
+	for part := range strings.SplitSeq(ae, ",") {
+		coding, _, _ := strings.Cut(part, ";")
+		if decodableEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			keep = append(keep, strings.TrimSpace(part))
+		}
+	}
+	if len(keep) == 0 {
+		h.Del("Accept-Encoding")
+		return
+	}
+	h.Set("Accept-Encoding", strings.Join(keep, ", "))
+}
+
 // decompressResponse transparently decompresses a gzip or deflate response body
 // and removes the Content-Encoding header so the client receives plain text.
 // If the encoding is unsupported or absent, the body is left unchanged.
-func decompressResponse(resp *http.Response) error {
+func decompressResponse(resp *http.Response, lg *logger.Logger) error {
 	enc := strings.ToLower(resp.Header.Get(headerContentEncoding))
 	switch enc {
 	case "gzip":
@@ -712,7 +1578,7 @@ func decompressResponse(resp *http.Response) error {
 	case "", "identity":
 		// nothing to do
 	default:
-		log.Printf("[DEANON] unsupported Content-Encoding %q — token replacement may fail", enc)
+		lg.Warnf("deanon", "unsupported Content-Encoding %q — token replacement may fail", enc)
 	}
 	return nil
 }
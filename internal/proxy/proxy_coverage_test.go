@@ -57,7 +57,7 @@ func TestSsrfSafeDialContext_Branches(t *testing.T) {
 	origDial := dialContextFn
 	defer func() { lookupIPAddr = origLookup; dialContextFn = origDial }()
 
-	dialFn := ssrfSafeDialContext(&net.Dialer{})
+	dialFn := ssrfSafeDialContext(&net.Dialer{}, testLog)
 
 	t.Run("split host port error falls to direct dial", func(t *testing.T) {
 		// No colon -> net.SplitHostPort fails -> the direct-dial fallback, which
@@ -157,14 +157,14 @@ func TestAnonymizeRequestBody_BodyTooLarge(t *testing.T) {
 	srv := newTestProxyServer(t)
 	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://example.com", nil)
 	req.Body = infiniteReader{}
-	req.ContentLength = maxRequestBody + 10
+	req.ContentLength = srv.maxRequestBody + 10
 
 	sessionID, err := srv.anonymizeRequestBody(req)
 	if err == nil {
 		t.Fatal("expected error for body exceeding limit")
 	}
-	if !strings.Contains(err.Error(), "exceeds") {
-		t.Fatalf("expected 'exceeds' error, got %v", err)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected ErrBodyTooLarge, got %v", err)
 	}
 	if sessionID != "" {
 		t.Fatalf("expected empty sessionID, got %q", sessionID)
@@ -219,7 +219,7 @@ func TestDeanonymizeResponseBody_DecompressError(t *testing.T) {
 	// Bad gzip -> decompressResponse returns an error -> deanonymizeResponseBody's
 	// error-LOG branch fires. The branch's only distinctive effect is the log:
 	// the body stays readable and Content-Encoding stays "gzip" whether the branch
-	// logs or is reduced to `_ = decompressResponse(resp)`. So assert the log line
+	// logs or is reduced to `_ = decompressResponse(resp, testLog)`. So assert the log line
 	// to prove the branch's effect ran; deleting it must fail the test.
 	logs := captureLog(t)
 	srv.deanonymizeResponseBody(resp, "sess-x", "api.example.com")
@@ -400,7 +400,7 @@ func TestServeMITMRequest_ProcessBodyError(t *testing.T) {
 	req := httptest.NewRequestWithContext(context.Background(), "POST",
 		"https://api.example.com/v1/chat", nil)
 	req.Body = infiniteReader{}
-	req.ContentLength = maxRequestBody + 10
+	req.ContentLength = srv.maxRequestBody + 10
 
 	rw := newResponseRecorder()
 	ctx := mitmContext{host: "api.example.com:443", domain: "api.example.com", remoteHash: "abcd1234"}
@@ -8,6 +8,8 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -15,12 +17,18 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"ai-anonymizing-proxy/internal/config"
+	"ai-anonymizing-proxy/internal/logger"
 	"ai-anonymizing-proxy/internal/management"
 	"ai-anonymizing-proxy/internal/metrics"
 	"ai-anonymizing-proxy/internal/mitm"
@@ -222,7 +230,7 @@ func TestIsPrivateHost_Literal(t *testing.T) {
 
 func TestSsrfSafeDialContext_BlocksPrivateIP(t *testing.T) {
 	dialer := &net.Dialer{Timeout: 1}
-	dialFn := ssrfSafeDialContext(dialer)
+	dialFn := ssrfSafeDialContext(dialer, testLog)
 
 	// localhost resolves to ::1 on macOS (/etc/hosts); ::1/128 is in the blocked range.
 	_, err := dialFn(t.Context(), "tcp", "localhost:80")
@@ -355,7 +363,7 @@ func TestProcessMITMRequestBody_AuthPassthrough(t *testing.T) {
 	ctx := mitmContext{host: "api.example.com:443", domain: "api.example.com", remoteHash: "test123"}
 
 	// Call with isAuth=true
-	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, true)
+	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, true, false)
 
 	if !ok {
 		t.Errorf("expected ok=true for auth passthrough, got false")
@@ -385,7 +393,7 @@ func TestProcessMITMRequestBody_AnonymizationError(t *testing.T) {
 	ctx := mitmContext{host: "api.example.com:443", domain: "api.example.com", remoteHash: "test123"}
 
 	// Call with isAuth=false to trigger anonymization
-	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, false)
+	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, false, false)
 
 	if ok {
 		t.Errorf("expected ok=false for anonymization error, got true")
@@ -393,8 +401,8 @@ func TestProcessMITMRequestBody_AnonymizationError(t *testing.T) {
 	if sessionID != "" {
 		t.Errorf("expected empty sessionID on error, got %q", sessionID)
 	}
-	if rw.code != http.StatusRequestEntityTooLarge {
-		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rw.code)
+	if rw.code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a body read error, got %d", http.StatusBadRequest, rw.code)
 	}
 }
 
@@ -419,7 +427,7 @@ func TestProcessMITMRequestBody_SuccessfulAnonymization(t *testing.T) {
 	ctx := mitmContext{host: "api.example.com:443", domain: "api.example.com", remoteHash: "test123"}
 
 	// Call with isAuth=false to trigger anonymization
-	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, false)
+	sessionID, ok := srv.processMITMRequestBody(rw, req, ctx, false, false)
 
 	if !ok {
 		t.Errorf("expected ok=true for successful anonymization, got false")
@@ -435,6 +443,9 @@ func TestProcessMITMRequestBody_SuccessfulAnonymization(t *testing.T) {
 
 // --- helpers for new tests ---
 
+// testLog is the logger passed to the package's free functions in tests.
+var testLog = logger.New("PROXY", "info")
+
 func newTestProxyServer(t *testing.T) *Server {
 	t.Helper()
 	cfg := &config.Config{
@@ -444,6 +455,7 @@ func newTestProxyServer(t *testing.T) *Server {
 		AuthDomains:    []string{"auth.example.com"},
 		AuthPaths:      []string{"/oauth"},
 		EnabledPacks:   []string{"GLOBAL"},
+		FailClosed:     true,
 	}
 	domains := management.NewDomainRegistry(cfg, "")
 	srv := New(cfg, domains, metrics.New())
@@ -451,6 +463,48 @@ func newTestProxyServer(t *testing.T) *Server {
 	return srv
 }
 
+// TestNewSessionStore_RequiresKey verifies that a shared session store is
+// refused without a session encryption key, so originals never reach Redis
+// in plaintext, and built once a key is set.
+func TestNewSessionStore_RequiresKey(t *testing.T) {
+	cfg := &config.Config{SessionStoreURL: "redis://127.0.0.1:6379/0"}
+	if store, err := NewSessionStore(cfg); !errors.Is(err, ErrStoreWithoutKey) || store != nil {
+		t.Fatalf("without a key: store %v, err %v; want ErrStoreWithoutKey", store, err)
+	}
+	if opts := AnonymizerOptions(cfg, nil); opts.SessionStore != nil {
+		t.Error("AnonymizerOptions built a session store without a key")
+	}
+
+	cfg.SessionEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+	store, err := NewSessionStore(cfg)
+	if err != nil || store == nil {
+		t.Fatalf("with a key: store %v, err %v", store, err)
+	}
+	if opts := AnonymizerOptions(cfg, nil); opts.SessionStore == nil {
+		t.Error("AnonymizerOptions dropped the session store despite the key")
+	}
+
+	cfg.SessionStoreURL = "http://cache"
+	if store, err := NewSessionStore(cfg); err == nil || store != nil {
+		t.Errorf("invalid URL: store %v, err %v; want an error", store, err)
+	}
+}
+
+// TestApplyConfig checks that a reloaded config's PII instructions reach the
+// anonymizer and are injected into the next anonymized request.
+func TestApplyConfig(t *testing.T) {
+	srv := newTestProxyServer(t)
+	next := *srv.cfg
+	next.PIIInstructions = map[string]string{"default": "RELOADED: keep [PII_*] tokens exactly."}
+	srv.ApplyConfig(&next)
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"Mail alice@example.com"}]}`)
+	out := srv.anon.AnonymizeJSON(body, "sess-apply-config")
+	if !bytes.Contains(out, []byte("RELOADED: keep")) {
+		t.Errorf("reloaded instruction not injected: %s", out)
+	}
+}
+
 // newTestProxyServerAllowLocal creates a proxy that allows connections to
 // localhost (overriding SSRF protection) so httptest backends are reachable.
 func newTestProxyServerAllowLocal(t *testing.T, aiDomains, authDomains []string) *Server {
@@ -462,6 +516,7 @@ func newTestProxyServerAllowLocal(t *testing.T, aiDomains, authDomains []string)
 		AuthDomains:    authDomains,
 		AuthPaths:      []string{"/oauth"},
 		EnabledPacks:   []string{"GLOBAL"},
+		FailClosed:     true,
 	}
 	domains := management.NewDomainRegistry(cfg, "")
 	srv := New(cfg, domains, metrics.New())
@@ -590,7 +645,7 @@ func TestDecompressResponse_Gzip(t *testing.T) {
 	}
 	resp.Header.Set("Content-Encoding", "gzip")
 
-	if err := decompressResponse(resp); err != nil {
+	if err := decompressResponse(resp, testLog); err != nil {
 		t.Fatalf("decompressResponse gzip: %v", err)
 	}
 	if resp.Header.Get("Content-Encoding") != "" {
@@ -621,7 +676,7 @@ func TestDecompressResponse_Deflate(t *testing.T) {
 	}
 	resp.Header.Set("Content-Encoding", "deflate")
 
-	if err := decompressResponse(resp); err != nil {
+	if err := decompressResponse(resp, testLog); err != nil {
 		t.Fatalf("decompressResponse deflate: %v", err)
 	}
 	if resp.Header.Get("Content-Encoding") != "" {
@@ -640,7 +695,7 @@ func TestDecompressResponse_Identity(t *testing.T) {
 	}
 	resp.Header.Set("Content-Encoding", "identity")
 
-	if err := decompressResponse(resp); err != nil {
+	if err := decompressResponse(resp, testLog); err != nil {
 		t.Fatalf("decompressResponse identity: %v", err)
 	}
 	body, _ := io.ReadAll(resp.Body)
@@ -654,7 +709,7 @@ func TestDecompressResponse_Empty(t *testing.T) {
 		Header: http.Header{},
 		Body:   io.NopCloser(strings.NewReader("plain")),
 	}
-	if err := decompressResponse(resp); err != nil {
+	if err := decompressResponse(resp, testLog); err != nil {
 		t.Fatalf("decompressResponse empty: %v", err)
 	}
 	body, _ := io.ReadAll(resp.Body)
@@ -670,7 +725,7 @@ func TestDecompressResponse_Unsupported(t *testing.T) {
 	}
 	resp.Header.Set("Content-Encoding", "br")
 	// Should not error, just log and leave body unchanged
-	if err := decompressResponse(resp); err != nil {
+	if err := decompressResponse(resp, testLog); err != nil {
 		t.Fatalf("decompressResponse unsupported: %v", err)
 	}
 }
@@ -681,7 +736,7 @@ func TestDecompressResponse_InvalidGzip(t *testing.T) {
 		Body:   io.NopCloser(strings.NewReader("not gzip data")),
 	}
 	resp.Header.Set("Content-Encoding", "gzip")
-	err := decompressResponse(resp)
+	err := decompressResponse(resp, testLog)
 	if err == nil {
 		t.Error("expected error for invalid gzip data")
 	}
@@ -769,6 +824,147 @@ func TestDeanonymizeResponseBody_Streaming(t *testing.T) {
 	}
 }
 
+func TestDeanonymizeResponseBody_DeliveryCounters(t *testing.T) {
+	srv := newTestProxyServer(t)
+	for _, ct := range []string{"text/event-stream", "application/json"} {
+		resp := &http.Response{
+			Header: http.Header{},
+			Body:   io.NopCloser(strings.NewReader("data: hello\n\n")),
+		}
+		resp.Header.Set("Content-Type", ct)
+		srv.deanonymizeResponseBody(resp, "test-session", "")
+		_, _ = io.ReadAll(resp.Body)
+	}
+
+	got := srv.m.Snapshot().Responses
+	if got.Streaming != 1 || got.Buffered != 1 {
+		t.Errorf("Responses = %+v, want 1 streaming and 1 buffered", got)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// TestDeanonymizeResponseBody_OverMaxBody sends a buffered response far over
+// maxResponseBodyMB: no more than the limit is read before the response is
+// handed on, the head is deanonymized, the rest passes through as received,
+// and the truncation is marked with a header and counted.
+func TestDeanonymizeResponseBody_OverMaxBody(t *testing.T) {
+	srv := newTestProxyServer(t)
+	srv.maxRespBody = 1 << 10
+	const sessionID = "sess-over-max-body"
+	anonymized := srv.anon.AnonymizeText("Write to alice@example.com", sessionID)
+	token := strings.TrimPrefix(anonymized, "Write to ")
+	if !strings.HasPrefix(token, "[PII_") {
+		t.Fatalf("setup: body was not anonymized: %q", anonymized)
+	}
+
+	const size = 8 << 20
+	filler := int64(size - 2*len(anonymized))
+	src := &countingReader{r: io.MultiReader(
+		strings.NewReader(anonymized),
+		io.LimitReader(neverEnding('x'), filler),
+		strings.NewReader(anonymized),
+	)}
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"text/plain"}, "Content-Length": {strconv.Itoa(size)}},
+		Body:          io.NopCloser(src),
+		ContentLength: size,
+	}
+	srv.deanonymizeResponseBody(resp, sessionID, "api.openai.com")
+	if src.n > srv.maxRespBody+1 {
+		t.Errorf("read %d bytes before forwarding, want at most %d", src.n, srv.maxRespBody+1)
+	}
+	if resp.Header.Get(headerDeanonTruncated) != "true" {
+		t.Errorf("%s header not set: %v", headerDeanonTruncated, resp.Header)
+	}
+	if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("truncated response kept length %d / %q", resp.ContentLength, resp.Header.Get("Content-Length"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if !strings.HasPrefix(string(body), "Write to alice@example.com") {
+		t.Errorf("head not deanonymized: %q", body[:64])
+	}
+	if !strings.HasSuffix(string(body), anonymized) {
+		t.Errorf("tail past the limit should pass through as received: %q", body[len(body)-64:])
+	}
+	if got := srv.m.Snapshot().Responses.Truncated; got != 1 {
+		t.Errorf("Responses.Truncated = %d, want 1", got)
+	}
+}
+
+// neverEnding is an endless reader of one byte.
+type neverEnding byte
+
+func (b neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+// TestDeanonymizeResponseBody_OverBufferStreams checks that a JSON response
+// over maxResponseBufferKB is restored as it streams, delivered one byte per
+// Read so its token straddles every read boundary, while a small one is
+// still buffered.
+func TestDeanonymizeResponseBody_OverBufferStreams(t *testing.T) {
+	srv := newTestProxyServer(t)
+	srv.maxRespBuffer = 64
+	const sessionID = "sess-over-buffer"
+	original := `{"content":[{"type":"text","text":"Write to alice@example.com"}]}`
+	anonymized := srv.anon.AnonymizeText(original, sessionID)
+	if anonymized == original {
+		t.Fatal("setup: body was not anonymized")
+	}
+
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}, "Content-Length": {strconv.Itoa(len(anonymized))}},
+		Body:          io.NopCloser(iotest.OneByteReader(strings.NewReader(anonymized))),
+		ContentLength: int64(len(anonymized)),
+	}
+	srv.deanonymizeResponseBody(resp, sessionID, "api.anthropic.com")
+	if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("streamed response kept length %d / %q", resp.ContentLength, resp.Header.Get("Content-Length"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if string(body) != original {
+		t.Errorf("body = %q, want %q", body, original)
+	}
+	if got := srv.m.Snapshot().Responses; got.Streaming != 1 {
+		t.Errorf("Responses = %+v, want 1 streaming", got)
+	}
+
+	srv.maxRespBuffer = int64(len(anonymized))
+	resp = &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(anonymized)),
+		ContentLength: int64(len(anonymized)),
+	}
+	srv.deanonymizeResponseBody(resp, sessionID, "api.anthropic.com")
+	if resp.ContentLength != int64(len(original)) {
+		t.Errorf("response within the limit: ContentLength = %d, want buffered %d", resp.ContentLength, len(original))
+	}
+}
+
 func TestDeanonymizeResponseBody_GzipEncoded(t *testing.T) {
 	srv := newTestProxyServer(t)
 
@@ -826,18 +1022,122 @@ func TestRecordMITMMetrics_NilMetrics(t *testing.T) {
 			t.Errorf("recordMITMMetrics panicked with nil metrics: %v", r)
 		}
 	}()
-	srv.recordMITMMetrics(false)
-	srv.recordMITMMetrics(true)
+	srv.recordMITMMetrics("api.openai.com", false, false, false, false, false)
+	srv.recordMITMMetrics("api.openai.com", true, false, false, false, false)
 }
 
 func TestRecordMITMMetrics_WithMetrics(t *testing.T) {
 	srv := newTestProxyServer(t)
-	srv.recordMITMMetrics(false) // anonymized
-	srv.recordMITMMetrics(true)  // auth
+	srv.recordMITMMetrics("api.openai.com", false, false, false, false, false) // anonymized
+	srv.recordMITMMetrics("api.openai.com", true, false, false, false, false)  // auth
+	srv.recordMITMMetrics("api.openai.com", false, true, false, false, false)  // gRPC passthrough
+	srv.recordMITMMetrics("api.openai.com", false, false, true, false, false)  // anonymization paused
+	srv.recordMITMMetrics("api.openai.com", false, false, false, true, false)  // bypassed User-Agent
+	srv.recordMITMMetrics("api.openai.com", false, false, false, false, true)  // Content-Type not allowlisted
+
+	snap := srv.m.Snapshot()
+	if snap.Requests.Total != 6 {
+		t.Errorf("expected 6 total requests, got %d", snap.Requests.Total)
+	}
+	if snap.Requests.Anonymized != 1 || snap.Requests.Auth != 1 || snap.Requests.Opaque != 1 || snap.Requests.AnonOff != 1 || snap.Requests.Passthrough != 1 || snap.Requests.ContentType != 1 {
+		t.Errorf("unexpected split: %+v", snap.Requests)
+	}
+}
 
+// TestRequestsByDomain drives plain HTTP requests to two AI domains and one
+// other host, then fills the domain cap through the MITM path. Requests are
+// counted before they are forwarded, so the private-address block that
+// answers them does not matter.
+func TestRequestsByDomain(t *testing.T) {
+	srv := newTestProxyServerAllowLocal(t, []string{"10.0.0.1", "10.0.0.2"}, nil)
+	send := func(host string) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+host+"/v1/models", nil)
+		srv.handleHTTP(httptest.NewRecorder(), req)
+	}
+	send("10.0.0.1:8443")
+	send("10.0.0.1")
+	send("10.0.0.2")
+	send("10.0.0.3") // not an AI domain: counted in total only
+
+	snap := srv.m.Snapshot()
+	want := map[string]int64{"10.0.0.1": 2, "10.0.0.2": 1}
+	if !reflect.DeepEqual(snap.Requests.ByDomain, want) {
+		t.Errorf("byDomain = %v, want %v", snap.Requests.ByDomain, want)
+	}
+	if snap.Requests.Total != 4 {
+		t.Errorf("total = %d, want 4", snap.Requests.Total)
+	}
+
+	for i := range 100 {
+		srv.recordMITMMetrics(fmt.Sprintf("api%d.example.com", i), false, false, false, false, false)
+	}
+	snap = srv.m.Snapshot()
+	if got := snap.Requests.ByDomain[metrics.OtherDomain]; got != 2 {
+		t.Errorf("other = %d, want the 2 domains past the cap", got)
+	}
+	if got := snap.Requests.ByDomain["10.0.0.1"]; got != 2 {
+		t.Errorf("10.0.0.1 = %d after overflow, want 2", got)
+	}
+}
+
+func TestIsGRPCRequest(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"application/grpc":           true,
+		"application/grpc+proto":     true,
+		"application/grpc-web+proto": true,
+		"Application/GRPC":           true,
+		"application/json":           false,
+		"":                           false,
+	} {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://api.openai.com/", nil)
+		req.Header.Set("Content-Type", ct)
+		if got := isGRPCRequest(req); got != want {
+			t.Errorf("isGRPCRequest(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
+
+// TestHandleHTTP_GRPCPassthrough verifies a gRPC request to an AI domain
+// reaches upstream byte-for-byte (PII included, since frames cannot be
+// rewritten safely), is counted as opaque, and gets upstream trailers back.
+func TestHandleHTTP_GRPCPassthrough(t *testing.T) {
+	// gRPC frame: 1-byte flag, 4-byte big-endian length, then payload.
+	payload := []byte("\x0a\x11alice@example.com")
+	frame := append([]byte{0, 0, 0, 0, byte(len(payload))}, payload...)
+
+	var got []byte
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/ai.v1.Chat/Complete", bytes.NewReader(frame))
+	req.Host = host
+	req.URL.Host = host
+	req.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Errorf("gRPC body modified in transit:\n got  %q\n want %q", got, frame)
+	}
+	if st := w.Result().Trailer.Get("Grpc-Status"); st != "0" {
+		t.Errorf("Grpc-Status trailer = %q, want 0", st)
+	}
 	snap := srv.m.Snapshot()
-	if snap.Requests.Total != 2 {
-		t.Errorf("expected 2 total requests, got %d", snap.Requests.Total)
+	if snap.Requests.Opaque != 1 || snap.Requests.Anonymized != 0 {
+		t.Errorf("expected request counted as opaque, got %+v", snap.Requests)
 	}
 }
 
@@ -898,6 +1198,154 @@ func TestServeHTTP_HTTP_AIAnonymization(t *testing.T) {
 	}
 }
 
+// TestServeHTTP_HTTP_AnonymizationToggledOff pauses anonymization for an AI
+// domain through the management API and verifies its requests reach the
+// upstream unmodified while still being counted, then resumes it.
+func TestServeHTTP_HTTP_AnonymizationToggledOff(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	mgmt := management.New(srv.cfg, srv.aiDomains, srv.m).Handler()
+	toggle := func(disabled bool) {
+		t.Helper()
+		body := fmt.Sprintf(`{"domain":"localhost","disabled":%v}`, disabled)
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/domains/anon-toggle", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mgmt.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("anon-toggle: %d %s", w.Code, w.Body.String())
+		}
+	}
+	const payload = `{"messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	send := func() string {
+		t.Helper()
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(payload))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		got, _ := received.Load().(string)
+		return got
+	}
+
+	toggle(true)
+	if got := send(); got != payload {
+		t.Errorf("paused domain: upstream got %s, want the original body", got)
+	}
+	if r := srv.m.Snapshot().Requests; r.Total != 1 || r.AnonOff != 1 || r.Anonymized != 0 {
+		t.Errorf("paused domain: unexpected counters %+v", r)
+	}
+
+	toggle(false)
+	if got := send(); strings.Contains(got, "alice@example.com") {
+		t.Errorf("resumed domain: upstream got unanonymized body %s", got)
+	}
+	if r := srv.m.Snapshot().Requests; r.Total != 2 || r.Anonymized != 1 {
+		t.Errorf("resumed domain: unexpected counters %+v", r)
+	}
+}
+
+func TestServeHTTP_HTTP_BypassUserAgent(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.bypassUA = compileUserAgentMatchers([]string{"healthprobe", "/^uptime-[0-9]+$/", "/[/"}, srv.log)
+
+	const payload = `{"messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	for _, tc := range []struct {
+		ua     string
+		bypass bool
+	}{
+		{"Acme-HealthProbe/1.2", true},
+		{"uptime-42", true},
+		{"uptime-42 (compatible)", false},
+		{"python-requests/2.31", false},
+		{"", false},
+	} {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(payload))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", tc.ua)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d: %s", tc.ua, w.Code, w.Body.String())
+		}
+		got, _ := received.Load().(string)
+		if bypassed := got == payload; bypassed != tc.bypass {
+			t.Errorf("%q: bypassed = %v, want %v (upstream got %s)", tc.ua, bypassed, tc.bypass, got)
+		}
+	}
+	if r := srv.m.Snapshot().Requests; r.Total != 5 || r.Passthrough != 2 || r.Anonymized != 3 {
+		t.Errorf("unexpected counters %+v", r)
+	}
+}
+
+// TestServeHTTP_HTTP_ContentTypeAllowlist sends the same PII-bearing body
+// under several Content-Types and checks that only allowlisted (or missing)
+// types are anonymized; the rest reach upstream byte-for-byte.
+func TestServeHTTP_HTTP_ContentTypeAllowlist(t *testing.T) {
+	var received atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.anonTypes = lowerAll([]string{"application/json", "TEXT/*"})
+
+	const payload = `{"messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	for _, tc := range []struct {
+		contentType string
+		scanned     bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/plain", true},
+		{"", true},
+		{"application/octet-stream", false},
+		{"application/x-protobuf", false},
+	} {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(payload))
+		req.Host = host
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d: %s", tc.contentType, w.Code, w.Body.String())
+		}
+		got, _ := received.Load().(string)
+		if scanned := got != payload; scanned != tc.scanned {
+			t.Errorf("%q: anonymized = %v, want %v (upstream got %s)", tc.contentType, scanned, tc.scanned, got)
+		}
+	}
+	if r := srv.m.Snapshot().Requests; r.Total != 6 || r.ContentType != 2 || r.Anonymized != 4 {
+		t.Errorf("unexpected counters %+v", r)
+	}
+}
+
 func TestServeHTTP_HTTP_AuthPassthrough(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -1038,13 +1486,248 @@ func TestAnonymizeRequestBody_ValidBody(t *testing.T) {
 	srv.anon.DeleteSession(sessionID)
 }
 
+// TestAnonymizeRequestBody_DomainProfile verifies that a domain mapped to a
+// strict pattern profile has a ZIP code (confidence 0.40) masked that the
+// default minConfidence of 0.5 lets through for other domains.
+func TestAnonymizeRequestBody_DomainProfile(t *testing.T) {
+	cfg := &config.Config{
+		OllamaEndpoint: "http://localhost:11434",
+		OllamaModel:    "test",
+		AIAPIDomains:   []string{"api.openai.com", "*.example.com"},
+		EnabledPacks:   []string{"US"},
+		MinConfidence:  0.5,
+		PatternProfiles: map[string]config.PatternProfile{
+			"strict": {MinConfidence: 0},
+		},
+		DomainProfiles: map[string]string{"*.example.com": "strict"},
+	}
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+	t.Cleanup(func() { _ = srv.Close() })
+
+	const body = `{"prompt":"Ship to ZIP 90210"}`
+	for _, tc := range []struct {
+		url    string
+		masked bool
+	}{
+		{"http://records.example.com:8443/v1/chat", true},
+		{"http://api.openai.com/v1/chat", false},
+	} {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", tc.url, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		sessionID, err := srv.anonymizeRequestBody(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.url, err)
+		}
+		got, _ := io.ReadAll(req.Body)
+		if masked := !strings.Contains(string(got), "90210"); masked != tc.masked {
+			t.Errorf("%s: ZIP masked = %v, want %v (body %s)", tc.url, masked, tc.masked, got)
+		}
+		srv.anon.DeleteSession(sessionID)
+	}
+}
+
+// TestAnonymizeRequestBody_RetryCacheProfile sends one body to a default
+// domain and then to a strict one: the retry cache must not hand the strict
+// domain the anonymization made under the default profile.
+func TestAnonymizeRequestBody_RetryCacheProfile(t *testing.T) {
+	cfg := &config.Config{
+		OllamaEndpoint: "http://localhost:11434",
+		OllamaModel:    "test",
+		AIAPIDomains:   []string{"api.openai.com", "*.example.com"},
+		EnabledPacks:   []string{"US"},
+		MinConfidence:  0.5,
+		PatternProfiles: map[string]config.PatternProfile{
+			"strict": {MinConfidence: 0},
+		},
+		DomainProfiles: map[string]string{"*.example.com": "strict"},
+		RetryCacheSecs: 60,
+	}
+	m := metrics.New()
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), m)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	const body = `{"prompt":"Ship to ZIP 90210"}`
+	for _, tc := range []struct {
+		url    string
+		masked bool
+	}{
+		{"http://api.openai.com/v1/chat", false},
+		{"http://records.example.com/v1/chat", true},
+	} {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", tc.url, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		sessionID, err := srv.anonymizeRequestBody(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.url, err)
+		}
+		got, _ := io.ReadAll(req.Body)
+		if masked := !strings.Contains(string(got), "90210"); masked != tc.masked {
+			t.Errorf("%s: ZIP masked = %v, want %v (body %s)", tc.url, masked, tc.masked, got)
+		}
+		srv.anon.DeleteSession(sessionID)
+	}
+	if got := m.RetryReuses.Load(); got != 0 {
+		t.Errorf("RetryReuses = %d across profiles, want 0", got)
+	}
+}
+
+// TestAnonymizeRequestBody_StreamedBodyGetsInstruction sends a chunked body
+// (no Content-Length) in pieces, with the system prompt after the messages,
+// and verifies the PII instruction is still injected next to it.
+func TestAnonymizeRequestBody_StreamedBodyGetsInstruction(t *testing.T) {
+	srv := newTestProxyServer(t)
+	pr, pw := io.Pipe()
+	go func() {
+		for _, part := range []string{
+			`{"messages":[{"role":"user","content":"Mail alice`,
+			`@example.com the report"}],`,
+			`"system":"You are a terse assistant."}`,
+		} {
+			_, _ = pw.Write([]byte(part))
+		}
+		_ = pw.Close()
+	}()
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://api.anthropic.com/v1/messages", pr)
+	req.ContentLength = -1
+
+	sessionID, err := srv.anonymizeRequestBody(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.anon.DeleteSession(sessionID)
+
+	out, _ := io.ReadAll(req.Body)
+	var doc struct {
+		System string `json:"system"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("anonymized body is not JSON: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(doc.System, "You are a terse assistant.") || !strings.Contains(doc.System, "PRIVACY TOKENS") {
+		t.Errorf("system prompt = %q, want original prompt followed by the PII instruction", doc.System)
+	}
+	if strings.Contains(string(out), "alice@example.com") {
+		t.Errorf("email not anonymized: %s", out)
+	}
+	if req.ContentLength != int64(len(out)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(out))
+	}
+}
+
+// TestAnonymizeRequestBody_ClientSSE streams an SSE-framed request one byte
+// at a time and verifies the PII in each event is tokenized before the body
+// is forwarded, including a JSON-escaped address raw scanning would miss.
+func TestAnonymizeRequestBody_ClientSSE(t *testing.T) {
+	srv := newTestProxyServer(t)
+	stream := "event: message\n" +
+		`data: {"role":"user","content":"reach me at alice\u0040example.com"}` + "\n\n" +
+		"data: cc bob@example.com\n\n"
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(stream); i++ {
+			_, _ = pw.Write([]byte{stream[i]})
+		}
+		_ = pw.Close()
+	}()
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://api.example.com/agent/run", pr)
+	req.Header.Set("Content-Type", "text/event-stream")
+	req.ContentLength = -1
+
+	sessionID, err := srv.anonymizeRequestBody(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.anon.DeleteSession(sessionID)
+
+	out, _ := io.ReadAll(req.Body)
+	got := string(out)
+	if strings.Contains(got, "alice") || strings.Contains(got, "bob@example.com") {
+		t.Errorf("PII forwarded in SSE request: %q", got)
+	}
+	if n := srv.anon.SessionTokenCount(sessionID); n != 2 {
+		t.Errorf("session has %d tokens, want 2", n)
+	}
+	if !strings.HasPrefix(got, "event: message\ndata: {") || !strings.HasSuffix(got, "\n\n") || strings.Count(got, "data: ") != 2 {
+		t.Errorf("SSE framing not preserved: %q", got)
+	}
+}
+
 func TestAnonymizeRequestBody_ReadError(t *testing.T) {
 	srv := newTestProxyServer(t)
 	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://example.com", errorReader{})
 	req.ContentLength = 100
 	_, err := srv.anonymizeRequestBody(req)
-	if err == nil {
-		t.Error("expected error for read error")
+	if !errors.Is(err, ErrBodyRead) {
+		t.Errorf("expected ErrBodyRead, got %v", err)
+	}
+}
+
+// hangupReader plays a client that disconnects: it serves data, then cancels
+// the request context and returns err, as net/http does when the connection
+// drops mid-body.
+type hangupReader struct {
+	data   *strings.Reader
+	cancel context.CancelFunc
+	err    error
+}
+
+func (h *hangupReader) Read(p []byte) (int, error) {
+	if h.data.Len() > 0 {
+		return h.data.Read(p)
+	}
+	h.cancel()
+	return 0, h.err
+}
+
+func (h *hangupReader) Close() error { return nil }
+
+func TestHandleHTTP_ClientDisconnect(t *testing.T) {
+	const body = `{"messages":[{"role":"user","content":"Mail alice@example.com"}]}`
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		// Connection dropped halfway through the upload.
+		{"mid-read", body[:20], io.ErrUnexpectedEOF},
+		// Whole body arrived, then the client left while it was anonymized.
+		{"after read", body, io.EOF},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var upstreamHit atomic.Bool
+			backend := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				upstreamHit.Store(true)
+			}))
+			defer backend.Close()
+
+			host := backendHostPort(t, backend.URL, "http")
+			srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rd := &hangupReader{data: strings.NewReader(tc.data), cancel: cancel, err: tc.err}
+			req := httptest.NewRequestWithContext(ctx, "POST", "http://"+host+"/v1/chat", rd)
+			req.ContentLength = int64(len(body))
+			req.Host = host
+			req.URL.Host = host
+			req.Header.Set("Content-Type", "application/json")
+
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+
+			if upstreamHit.Load() {
+				t.Error("request was forwarded after the client disconnected")
+			}
+			if n := len(srv.anon.SessionStats()); n != 0 {
+				t.Errorf("%d sessions left open, want 0", n)
+			}
+			if got := srv.m.ClientDisconnects.Load(); got != 1 {
+				t.Errorf("ClientDisconnects = %d, want 1", got)
+			}
+			if got := srv.m.ErrorsAnonymize.Load(); got != 0 {
+				t.Errorf("ErrorsAnonymize = %d, want 0", got)
+			}
+		})
 	}
 }
 
@@ -1090,6 +1773,77 @@ func TestForward_WithGzipResponse(t *testing.T) {
 	}
 }
 
+// TestForward_GzipResponseTokenRestored verifies that a token inside a
+// gzip-compressed upstream response is restored and the client receives the
+// body decompressed, and that br is not offered to the upstream.
+func TestForward_GzipResponseTokenRestored(t *testing.T) {
+	tokenRe := regexp.MustCompile(`\[PII_EMAIL_[0-9a-f]+\]`)
+	var acceptEncoding string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		body, _ := io.ReadAll(r.Body)
+		token := tokenRe.Find(body)
+		if token == nil {
+			http.Error(w, "no token in request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		_, _ = fmt.Fprintf(gw, `{"reply":"Sent to %s"}`, token)
+		_ = gw.Close()
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+
+	reqBody := `{"message":"mail alice@example.com"}`
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat",
+		strings.NewReader(reqBody))
+	req.Host = host
+	req.URL.Host = host
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	req.ContentLength = int64(len(reqBody))
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if got, want := w.Body.String(), `{"reply":"Sent to alice@example.com"}`; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if acceptEncoding != "gzip, deflate" {
+		t.Errorf("upstream Accept-Encoding = %q, want %q", acceptEncoding, "gzip, deflate")
+	}
+}
+
+func TestRestrictAcceptEncoding(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"gzip, deflate, br", "gzip, deflate"},
+		{"br;q=1.0, gzip;q=0.8, zstd", "gzip;q=0.8"},
+		{"br", ""},
+		{"*", ""},
+		{"identity", "identity"},
+		{"", ""},
+	} {
+		h := http.Header{}
+		if tc.in != "" {
+			h.Set("Accept-Encoding", tc.in)
+		}
+		restrictAcceptEncoding(h)
+		if got := h.Get("Accept-Encoding"); got != tc.want {
+			t.Errorf("restrictAcceptEncoding(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
 // --- New with CA files ---
 
 func TestNew_WithInvalidCAFiles(t *testing.T) {
@@ -1121,7 +1875,7 @@ func TestServer_Close(t *testing.T) {
 
 func TestSsrfSafeDialContext_NoPort(t *testing.T) {
 	dialer := &net.Dialer{Timeout: 1}
-	dialFn := ssrfSafeDialContext(dialer)
+	dialFn := ssrfSafeDialContext(dialer, testLog)
 	// Address without port — falls back to plain DialContext
 	_, err := dialFn(t.Context(), "tcp", "invalid-no-port")
 	if err == nil {
@@ -1262,13 +2016,83 @@ func TestHandleHTTP_AIAnonymizationError(t *testing.T) {
 	w := httptest.NewRecorder()
 	srv.handleHTTP(w, req)
 
-	if w.Code != http.StatusRequestEntityTooLarge {
-		t.Errorf("expected 413, got %d", w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a body read error, got %d", w.Code)
 	}
 }
 
-// --- handleTunnel dispatch ---
-
+func TestHandleHTTP_AIBodyTooLarge(t *testing.T) {
+	host := "example.com:80"
+	srv := newTestProxyServerAllowLocal(t, []string{"example.com"}, nil)
+
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", nil)
+	req.Body = infiniteReader{}
+	req.Host = host
+	req.URL.Host = host
+	req.ContentLength = srv.maxRequestBody + 10
+
+	w := httptest.NewRecorder()
+	srv.handleHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized body, got %d", w.Code)
+	}
+}
+
+// TestHandleHTTP_MaxRequestBodyMB configures a 1 MB limit: a body of exactly
+// 1 MB is forwarded, one byte more is refused with 413 before reaching upstream.
+func TestHandleHTTP_MaxRequestBodyMB(t *testing.T) {
+	var forwarded atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		forwarded.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	cfg := &config.Config{
+		OllamaEndpoint:   "http://localhost:11434",
+		OllamaModel:      "test",
+		AIAPIDomains:     []string{"localhost"},
+		EnabledPacks:     []string{"GLOBAL"},
+		MaxRequestBodyMB: 1,
+	}
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+	dialer := &net.Dialer{Timeout: 5e9}
+	srv.transport.DialContext = dialer.DialContext
+	t.Cleanup(func() { _ = srv.Close() })
+
+	send := func(size int) int {
+		body := strings.Repeat("a", size)
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(body))
+		req.Host = host
+		req.URL.Host = host
+		w := httptest.NewRecorder()
+		srv.handleHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(1 << 20); code != http.StatusOK {
+		t.Errorf("body at the limit: expected 200, got %d", code)
+	}
+	if code := send(1<<20 + 1); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit: expected 413, got %d", code)
+	}
+	if n := forwarded.Load(); n != 1 {
+		t.Errorf("expected only the in-limit request upstream, forwarded=%d", n)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	for mb, want := range map[int]int64{0: defaultMaxBody, -5: defaultMaxBody, 1: 1 << 20, 200: 200 << 20} {
+		if got := bodyLimit(mb); got != want {
+			t.Errorf("bodyLimit(%d) = %d, want %d", mb, got, want)
+		}
+	}
+}
+
+// --- handleTunnel dispatch ---
+
 func TestHandleTunnel_NonAIDomain(t *testing.T) {
 	srv := newTestProxyServer(t)
 	// CONNECT to private IP — goes through handleOpaqueTunnel path
@@ -1304,7 +2128,7 @@ func TestHandleTunnel_AIDomainWithoutCA(t *testing.T) {
 
 func TestSsrfSafeDialContext_ResolvesToPrivate(t *testing.T) {
 	dialer := &net.Dialer{Timeout: 1e9}
-	dialFn := ssrfSafeDialContext(dialer)
+	dialFn := ssrfSafeDialContext(dialer, testLog)
 
 	// localhost resolves to 127.0.0.1 or ::1, both private
 	_, err := dialFn(t.Context(), "tcp", "localhost:80")
@@ -1327,6 +2151,130 @@ func TestForwardMITMRequest_UpstreamError(t *testing.T) {
 	}
 }
 
+// hangingBackend never answers until the test ends or the proxy gives up.
+func hangingBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		backend.Close()
+	})
+	return backend
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	backend := hangingBackend(t)
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.upstreamTimeout = 50 * time.Millisecond
+
+	newReq := func() *http.Request {
+		req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/v1/models", nil)
+		req.Host = host
+		req.URL.Host = host
+		return req
+	}
+	paths := []struct {
+		name string
+		run  func(http.ResponseWriter, *http.Request)
+	}{
+		{"forward", srv.ServeHTTP},
+		{"mitm", func(w http.ResponseWriter, r *http.Request) {
+			r.RequestURI = ""
+			srv.forwardMITMRequest(w, r, "", "localhost")
+		}},
+	}
+	for _, p := range paths {
+		t.Run(p.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			start := time.Now()
+			p.run(w, newReq())
+			if w.Code != http.StatusGatewayTimeout {
+				t.Errorf("status = %d, want 504", w.Code)
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("returned after %s, want about the 50ms timeout", d)
+			}
+		})
+	}
+	if got := srv.m.ErrorsUpstream.Load(); got != 2 {
+		t.Errorf("ErrorsUpstream = %d, want 2", got)
+	}
+}
+
+func TestUpstreamTimeout_SSEExempt(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond) // well past the timeout
+		_, _ = io.WriteString(w, "data: done\n\n")
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.upstreamTimeout = 50 * time.Millisecond
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/v1/stream", nil)
+	req.Host = host
+	req.URL.Host = host
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "data: done") {
+		t.Errorf("stream cut by the upstream timeout: %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestUpstreamTimeout_GRPCExempt verifies that a gRPC call, forwarded
+// opaquely, is released from the timeout once its headers are in, on both
+// the forward and the MITM path.
+func TestUpstreamTimeout_GRPCExempt(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond) // well past the timeout
+		_, _ = w.Write([]byte{0, 0, 0, 0, 2, 'o', 'k'})
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.upstreamTimeout = 50 * time.Millisecond
+
+	paths := []struct {
+		name string
+		run  func(http.ResponseWriter, *http.Request)
+	}{
+		{"forward", srv.ServeHTTP},
+		{"mitm", func(w http.ResponseWriter, r *http.Request) {
+			r.RequestURI = ""
+			srv.forwardMITMRequest(w, r, "", "localhost")
+		}},
+	}
+	for _, p := range paths {
+		t.Run(p.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/pkg.Svc/Watch", strings.NewReader("\x00\x00\x00\x00\x00"))
+			req.Host = host
+			req.URL.Host = host
+			req.Header.Set("Content-Type", "application/grpc")
+			w := httptest.NewRecorder()
+			p.run(w, req)
+			if w.Code != http.StatusOK || !strings.HasSuffix(w.Body.String(), "ok") {
+				t.Errorf("gRPC stream cut by the upstream timeout: %d %q", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
 // --- handleMITMTunnel ---
 
 // hijackResponseWriter wraps an httptest.ResponseRecorder with hijack support
@@ -1477,6 +2425,55 @@ func TestHandleMITMTunnel_NoHijacker(t *testing.T) {
 	}
 }
 
+// TestMITMLogLevel checks that the MITM logger follows the proxy's log level:
+// at info the per-host certificate lines are dropped while the CONNECT line
+// is kept, and after a reload to debug the certificate cache hit shows up.
+func TestMITMLogLevel(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		OllamaEndpoint: "http://localhost:11434",
+		OllamaModel:    "test",
+		EnabledPacks:   []string{"GLOBAL"},
+		CACertFile:     filepath.Join(dir, "ca-cert.pem"),
+		CAKeyFile:      filepath.Join(dir, "ca-key.pem"),
+		LogLevel:       "info",
+	}
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+	t.Cleanup(func() { _ = srv.Close() })
+	if srv.ca == nil {
+		t.Fatal("MITM CA not loaded")
+	}
+	srv.aiDomains.Add("10.0.0.53")
+
+	logs := captureLog(t)
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodConnect, "http://10.0.0.53:443", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	srv.handleMITMTunnel(httptest.NewRecorder(), req, "10.0.0.53:443", "10.0.0.53")
+	for range 2 {
+		if _, err := srv.ca.CertFor("api.openai.com"); err != nil {
+			t.Fatalf("CertFor: %v", err)
+		}
+	}
+	if !strings.Contains(logs.String(), "Intercepting CONNECT 10.0.0.53:443") {
+		t.Errorf("info-level CONNECT line missing: %q", logs.String())
+	}
+	for _, debug := range []string{"Generating certificate", "Certificate cached", "Certificate cache hit"} {
+		if strings.Contains(logs.String(), debug) {
+			t.Errorf("debug line %q written at info level: %q", debug, logs.String())
+		}
+	}
+
+	next := *cfg
+	next.LogLevel = "debug"
+	srv.ApplyConfig(&next)
+	if _, err := srv.ca.CertFor("api.openai.com"); err != nil {
+		t.Fatalf("CertFor: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Certificate cache hit for api.openai.com") {
+		t.Errorf("cache hit not logged at debug level: %q", logs.String())
+	}
+}
+
 func TestHandleOpaqueTunnel_HappyPath(t *testing.T) {
 	// Start a local TCP echo server
 	var lc net.ListenConfig
@@ -1543,3 +2540,461 @@ func TestHandleOpaqueTunnel_DialFailure(t *testing.T) {
 		t.Errorf("expected 502 for dial failure, got %d", w.Code)
 	}
 }
+
+// --- URL path anonymization ---
+
+func TestHandleHTTP_AnonymizesPathSegment(t *testing.T) {
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.cfg.AnonymizePaths = true
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/v1/users/alice@example.com/messages", nil)
+	req.Host = host
+	req.URL.Host = host
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if strings.Contains(gotPath, "alice@example.com") {
+		t.Errorf("email leaked upstream in path: %q", gotPath)
+	}
+	if !strings.HasPrefix(gotPath, "/v1/users/[PII_EMAIL_") || !strings.HasSuffix(gotPath, "]/messages") {
+		t.Errorf("path not rebuilt around token: %q", gotPath)
+	}
+}
+
+// TestHandleHTTP_DryRun checks that a dry run forwards the body and path
+// unmodified and leaves the response alone, while the tokens that would have
+// been used are still counted, logged by type, and not kept in a session.
+func TestHandleHTTP_DryRun(t *testing.T) {
+	var gotBody []byte
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotBody, _ = io.ReadAll(r.Body)
+		_, _ = w.Write(gotBody) // echo: a token would only come back if one was sent
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.cfg.DryRun = true
+	srv.cfg.AnonymizePaths = true
+
+	const body = `{"messages":[{"role":"user","content":"Mail alice@example.com and bob@example.org"}]}`
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/users/carol@example.com", strings.NewReader(body))
+	req.Host = host
+	req.URL.Host = host
+	req.Header.Set("Content-Type", "application/json")
+
+	logs := captureLog(t)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if string(gotBody) != body {
+		t.Errorf("forwarded body = %q, want the original %q", gotBody, body)
+	}
+	if gotPath != "/v1/users/carol@example.com" {
+		t.Errorf("forwarded path = %q, want it unchanged", gotPath)
+	}
+	if w.Body.String() != body {
+		t.Errorf("response = %q, want the upstream body unchanged", w.Body.String())
+	}
+	if got := srv.m.TokensReplaced.Load(); got != 2 {
+		t.Errorf("TokensReplaced = %d, want 2 (what would have been masked)", got)
+	}
+	if !strings.Contains(logs.String(), "would mask EMAIL=2") {
+		t.Errorf("dry-run log missing per-type counts: %q", logs.String())
+	}
+	if n := len(srv.anon.SessionStats()); n != 0 {
+		t.Errorf("dry run left %d sessions open", n)
+	}
+}
+
+// TestHandleHTTP_DryRunNeverRefuses checks that a dry run forwards requests
+// the anonymizing path would reject under failClosed: one that finds every
+// anonymization slot busy and one over maxRequestBodyMB.
+func TestHandleHTTP_DryRunNeverRefuses(t *testing.T) {
+	var forwarded []byte
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.cfg.DryRun = true
+	const body = `{"messages":[{"role":"user","content":"mail bob@example.com"}]}`
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(body))
+		req.Host = host
+		req.URL.Host = host
+		req.ContentLength = int64(len(body))
+		w := httptest.NewRecorder()
+		srv.handleHTTP(w, req)
+		return w
+	}
+
+	t.Run("slots busy", func(t *testing.T) {
+		forwarded = nil
+		srv.anonSlots = make(chan struct{}, 1)
+		srv.anonSlots <- struct{}{}
+		t.Cleanup(func() { srv.anonSlots = nil })
+		if w := send(); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+		if string(forwarded) != body {
+			t.Errorf("forwarded %q, want the original body", forwarded)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		forwarded = nil
+		limit := srv.maxRequestBody
+		srv.maxRequestBody = 16
+		t.Cleanup(func() { srv.maxRequestBody = limit })
+		if w := send(); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+		if string(forwarded) != body {
+			t.Errorf("forwarded %q, want the whole original body", forwarded)
+		}
+	})
+}
+
+func TestHandleHTTP_PathAnonymizationDisabledByDefault(t *testing.T) {
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/v1/users/alice@example.com", nil)
+	req.Host = host
+	req.URL.Host = host
+
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotPath != "/v1/users/alice@example.com" {
+		t.Errorf("path rewritten with AnonymizePaths=false: %q", gotPath)
+	}
+}
+
+func TestHandleHTTP_AuthPathNotAnonymized(t *testing.T) {
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	srv.cfg.AnonymizePaths = true
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://"+host+"/oauth/alice@example.com", nil)
+	req.Host = host
+	req.URL.Host = host
+
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotPath != "/oauth/alice@example.com" {
+		t.Errorf("auth path must pass through unchanged, got %q", gotPath)
+	}
+}
+
+func TestAnonymizeRequestPath_NoPIIKeepsSession(t *testing.T) {
+	srv := newTestProxyServer(t)
+	srv.cfg.AnonymizePaths = true
+
+	req := httptest.NewRequestWithContext(context.Background(), "GET", "http://api.openai.com/v1/models", nil)
+	if got, err := srv.anonymizeRequestPath(req, ""); got != "" || err != nil {
+		t.Errorf("expected no session for PII-free path, got %q, %v", got, err)
+	}
+	if n := srv.anon.ActiveSessions(); n != 0 {
+		t.Errorf("reserved path session not released: %d open", n)
+	}
+	if got, err := srv.anonymizeRequestPath(req, "existing"); got != "existing" || err != nil {
+		t.Errorf("expected existing session preserved, got %q, %v", got, err)
+	}
+}
+
+// TestHandleHTTP_SessionLimitReturns503 fills the session table and verifies
+// further AI-domain requests are shed with 503 instead of being forwarded,
+// and that completed requests free their slot.
+func TestHandleHTTP_SessionLimitReturns503(t *testing.T) {
+	var forwarded atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	cfg := &config.Config{
+		OllamaEndpoint: "http://localhost:11434",
+		OllamaModel:    "test",
+		AIAPIDomains:   []string{"localhost"},
+		EnabledPacks:   []string{"GLOBAL"},
+		MaxSessions:    2,
+		FailClosed:     true,
+	}
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+	dialer := &net.Dialer{Timeout: 5e9}
+	srv.transport.DialContext = dialer.DialContext
+	t.Cleanup(func() { _ = srv.Close() })
+
+	send := func() *httptest.ResponseRecorder {
+		body := `{"messages":[{"role":"user","content":"mail bob@example.com"}]}`
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(body))
+		req.Host = host
+		req.URL.Host = host
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusOK {
+		t.Fatalf("under limit: expected 200, got %d", w.Code)
+	}
+	if n := srv.anon.ActiveSessions(); n != 0 {
+		t.Fatalf("session not released after request: %d open", n)
+	}
+
+	// Simulate two in-flight requests holding every slot.
+	for _, id := range []string{"inflight-1", "inflight-2"} {
+		if err := srv.anon.BeginSession(id); err != nil {
+			t.Fatalf("BeginSession(%s): %v", id, err)
+		}
+	}
+	w := send()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("at limit: expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("503 response missing Retry-After")
+	}
+	if n := forwarded.Load(); n != 1 {
+		t.Errorf("rejected request must not reach upstream; forwarded=%d", n)
+	}
+
+	srv.anon.DeleteSession("inflight-1")
+	if w := send(); w.Code != http.StatusOK {
+		t.Errorf("after a slot frees: expected 200, got %d", w.Code)
+	}
+}
+
+// TestAnonymizeRequestBody_ConcurrencyLimit holds every anonymization slot
+// and verifies an over-limit request waits for a freed slot within the queue
+// timeout and is rejected with errAnonymizeBusy once the timeout passes.
+func TestAnonymizeRequestBody_ConcurrencyLimit(t *testing.T) {
+	cfg := &config.Config{
+		OllamaEndpoint:              "http://localhost:11434",
+		OllamaModel:                 "test",
+		EnabledPacks:                []string{"GLOBAL"},
+		MaxConcurrentAnonymizations: 1,
+		AnonymizeQueueMs:            50,
+		FailClosed:                  true,
+	}
+	srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+	t.Cleanup(func() { _ = srv.Close() })
+
+	newReq := func() *http.Request {
+		body := `{"messages":[{"role":"user","content":"mail bob@example.com"}]}`
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://example.com", strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		return req
+	}
+
+	// Simulate an in-flight anonymization holding the only slot.
+	release, err := srv.acquireAnonSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireAnonSlot: %v", err)
+	}
+	if _, err := srv.anonymizeRequestBody(newReq()); !errors.Is(err, errAnonymizeBusy) {
+		t.Fatalf("saturated: expected errAnonymizeBusy, got %v", err)
+	}
+	w := httptest.NewRecorder()
+	srv.writeAnonymizeError(w, "example.com", errAnonymizeBusy)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("busy: expected 503 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if n := srv.anon.ActiveSessions(); n != 0 {
+		t.Errorf("rejected request left %d sessions open", n)
+	}
+
+	// A slot freed while the request is queued lets it through.
+	cfg.AnonymizeQueueMs = 5000
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	sessionID, err := srv.anonymizeRequestBody(newReq())
+	if err != nil {
+		t.Fatalf("queued: expected success once the slot frees, got %v", err)
+	}
+	srv.anon.DeleteSession(sessionID)
+	if n := len(srv.anonSlots); n != 0 {
+		t.Errorf("slot not released after anonymization: %d held", n)
+	}
+}
+
+// TestHandleHTTP_FailClosed induces anonymization failures and checks what
+// reaches upstream: nothing with failClosed on, and with it off the original
+// body only for capacity errors.
+func TestHandleHTTP_FailClosed(t *testing.T) {
+	var forwarded []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, string(b))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	host := backendHostPort(t, backend.URL, "http")
+	srv := newTestProxyServerAllowLocal(t, []string{"localhost"}, nil)
+	const body = `{"messages":[{"role":"user","content":"mail bob@example.com"}]}`
+
+	send := func(b io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", b)
+		req.Host = host
+		req.URL.Host = host
+		req.ContentLength = int64(len(body))
+		w := httptest.NewRecorder()
+		srv.handleHTTP(w, req)
+		return w
+	}
+	saturate := func(t *testing.T) {
+		srv.anonSlots = make(chan struct{}, 1)
+		srv.anonSlots <- struct{}{}
+		t.Cleanup(func() { srv.anonSlots = nil })
+	}
+
+	t.Run("busy, failClosed on", func(t *testing.T) {
+		forwarded = nil
+		saturate(t)
+		if w := send(strings.NewReader(body)); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+		if len(forwarded) != 0 {
+			t.Errorf("request reached upstream: %q", forwarded)
+		}
+	})
+
+	t.Run("read error, failClosed on", func(t *testing.T) {
+		forwarded = nil
+		if w := send(errorReader{}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+		if len(forwarded) != 0 {
+			t.Errorf("request reached upstream: %q", forwarded)
+		}
+	})
+
+	srv.cfg.FailClosed = false
+
+	t.Run("read error, failClosed off", func(t *testing.T) {
+		forwarded = nil
+		if w := send(errorReader{}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+		if len(forwarded) != 0 {
+			t.Errorf("request reached upstream: %q", forwarded)
+		}
+	})
+
+	t.Run("busy, failClosed off", func(t *testing.T) {
+		forwarded = nil
+		saturate(t)
+		if w := send(strings.NewReader(body)); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+		if len(forwarded) != 1 || forwarded[0] != body {
+			t.Errorf("expected the original body upstream, got %q", forwarded)
+		}
+	})
+}
+
+// TestHandleHTTP_MaxTokensPerRequestPolicy sends a prompt with more PII
+// matches than maxTokensPerRequest under both overTokenPolicy values.
+func TestHandleHTTP_MaxTokensPerRequestPolicy(t *testing.T) {
+	var emails []string
+	for i := range 20 {
+		emails = append(emails, fmt.Sprintf("user%02d@example.com", i))
+	}
+	body := `{"messages":[{"role":"user","content":"` + strings.Join(emails, " ") + `"}]}`
+
+	for _, policy := range []string{"reject", "stop"} {
+		t.Run(policy, func(t *testing.T) {
+			var upstreamBody atomic.Value
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				upstreamBody.Store(string(b))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer backend.Close()
+
+			host := backendHostPort(t, backend.URL, "http")
+			cfg := &config.Config{
+				OllamaEndpoint:      "http://localhost:11434",
+				OllamaModel:         "test",
+				AIAPIDomains:        []string{"localhost"},
+				EnabledPacks:        []string{"GLOBAL"},
+				MaxTokensPerRequest: 5,
+				OverTokenPolicy:     policy,
+			}
+			srv := New(cfg, management.NewDomainRegistry(cfg, ""), metrics.New())
+			dialer := &net.Dialer{Timeout: 5e9}
+			srv.transport.DialContext = dialer.DialContext
+			t.Cleanup(func() { _ = srv.Close() })
+
+			req := httptest.NewRequestWithContext(context.Background(), "POST", "http://"+host+"/v1/chat", strings.NewReader(body))
+			req.Host = host
+			req.URL.Host = host
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			if n := srv.anon.ActiveSessions(); n != 0 {
+				t.Errorf("session not released: %d open", n)
+			}
+			got, _ := upstreamBody.Load().(string)
+			if policy == "reject" {
+				if w.Code != http.StatusRequestEntityTooLarge {
+					t.Fatalf("expected 413, got %d", w.Code)
+				}
+				if got != "" {
+					t.Errorf("rejected request reached upstream: %q", got)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+			if n := strings.Count(got, "[PII_EMAIL_"); n != 5 {
+				t.Errorf("upstream saw %d tokens, want 5: %q", n, got)
+			}
+			if !strings.Contains(got, emails[len(emails)-1]) {
+				t.Errorf("matches past the cap should be left as-is: %q", got)
+			}
+		})
+	}
+}